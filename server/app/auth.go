@@ -0,0 +1,231 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/dig"
+	"go.uber.org/zap"
+)
+
+const (
+	_USER_KEY    = "UserKey"
+	_API_KEY_KEY = "ApiKeyKey"
+
+	// ApiKeyHeader holds the api key of scripts using the dashboard api
+	ApiKeyHeader = "X-Api-Key"
+)
+
+// Authenticator resolves the dashboard user a token was issued to
+type Authenticator interface {
+	Authenticate(token string) (*model.User, error)
+}
+
+// ApiKeyAuthenticator resolves an active api key and tracks its use
+type ApiKeyAuthenticator interface {
+	AuthenticateKey(key string) (*model.ApiKey, error)
+}
+
+type authDeps struct {
+	dig.In
+
+	Users    Authenticator
+	Keys     ApiKeyAuthenticator `optional:"true"`
+	Projects ProjectAuthorizer   `optional:"true"`
+}
+
+// apiKeyReadScopes are the scopes api keys need to read a route, other reads and every change need ScopeManageConfig
+var apiKeyReadScopes = map[string]model.ApiKeyScope{
+	"/api/requests":                 model.ScopeReadRequests,
+	"/api/requests/export":          model.ScopeReadRequests,
+	"/api/requests/:id":             model.ScopeReadRequests,
+	"/api/requests/statistics":      model.ScopeReadStats,
+	"/api/requests/consumers":       model.ScopeReadStats,
+	"/api/ws/requests/statistics":   model.ScopeReadStats,
+	"/api/openapi/inferred":         model.ScopeReadStats,
+	"/api/openapi/violations":       model.ScopeReadStats,
+	"/api/openapi/specs/:id/report": model.ScopeReadStats,
+	"/api/views":                    model.ScopeReadRequests,
+	"/api/views/:id":                model.ScopeReadRequests,
+	"/api/views/:id/requests":       model.ScopeReadRequests,
+	"/api/views/:id/statistics":     model.ScopeReadStats,
+}
+
+// apiKeyForbidden are route prefixes only logged in users can use
+var apiKeyForbidden = []string{"/api/auth", "/api/users", "/api/api-keys", "/api/audit"}
+
+// apiKeyGlobal are route prefixes of resources shared by every project, keys of other projects can't change them
+var apiKeyGlobal = []string{"/api/config", "/api/rate-limits"}
+
+// viewerWritable are route prefixes viewers can change too, the views service lets them change only their private views
+var viewerWritable = []string{"/api/views"}
+
+// PublicController is a controller with endpoints reachable without a token, e.g. login
+type PublicController interface {
+	RegisterPublicEndpoints(router *gin.RouterGroup)
+}
+
+// Authenticate rejects requests without a valid bearer token or api key and stores the user or key in the context.
+// Viewers are only allowed to read and save their own views, every other change needs an admin. Api keys can only use routes their scopes grant,
+// keys of other projects than the default one can't change resources shared by every project.
+// Browsers can't set headers on websockets so upgrade requests may pass the token in the access_token query
+func Authenticate(auth Authenticator, keys ApiKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.Request)
+		if !ok {
+			if key := c.GetHeader(ApiKeyHeader); key != "" && keys != nil {
+				authenticateKey(c, keys, key)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token or api key"})
+			return
+		}
+
+		user, err := auth.Authenticate(token)
+		if err != nil {
+			abortAuth(c, err)
+			return
+		}
+		c.Set(_USER_KEY, user)
+
+		if !isReadMethod(c.Request.Method) && user.Role != model.RoleAdmin && !viewerCanChange(c.FullPath()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": cerror.ErrBadRole.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticateKey(c *gin.Context, keys ApiKeyAuthenticator, key string) {
+	apiKey, err := keys.AuthenticateKey(key)
+	if err != nil {
+		abortAuth(c, err)
+		return
+	}
+	c.Set(_API_KEY_KEY, apiKey)
+
+	scope := apiKeyScope(apiKey, c.Request.Method, c.FullPath())
+	if scope == "" || !apiKey.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": cerror.ErrMissingScope.Error()})
+		return
+	}
+	c.Next()
+}
+
+// abortAuth answers a failed authentication, errors other than bad credentials are server errors
+func abortAuth(c *gin.Context, err error) {
+	if errors.Is(err, cerror.ErrInvalidTokenFormat) || errors.Is(err, cerror.ErrInvalidCredentials) || errors.Is(err, cerror.ErrInvalidApiKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	zap.S().Errorf("Failed to authenticate request, error = %v", err)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not authenticate request"})
+}
+
+// apiKeyScope returns the scope apiKey needs for a route, empty if it can't use it
+func apiKeyScope(apiKey *model.ApiKey, method, route string) model.ApiKeyScope {
+	for _, prefix := range apiKeyForbidden {
+		if strings.HasPrefix(route, prefix) {
+			return ""
+		}
+	}
+	if scope, ok := apiKeyReadScopes[route]; ok && isReadMethod(method) {
+		return scope
+	}
+	if apiKey.ProjectID != model.DefaultProjectID && !isReadMethod(method) {
+		for _, prefix := range apiKeyGlobal {
+			if strings.HasPrefix(route, prefix) {
+				return ""
+			}
+		}
+	}
+	return model.ScopeManageConfig
+}
+
+// viewerCanChange reports if viewers can change route
+func viewerCanChange(route string) bool {
+	for _, prefix := range viewerWritable {
+		if strings.HasPrefix(route, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole only lets users with one of roles through, it has to run after Authenticate
+func RequireRole(roles ...model.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil && CurrentApiKey(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": cerror.ErrBadRole.Error()})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": cerror.ErrUserIsNil.Error()})
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": cerror.ErrBadRole.Error()})
+	}
+}
+
+// CurrentUser returns the authenticated user of the request, nil outside of Authenticate
+func CurrentUser(c *gin.Context) *model.User {
+	value, ok := c.Get(_USER_KEY)
+	if !ok {
+		return nil
+	}
+	user, _ := value.(*model.User)
+	return user
+}
+
+// CurrentApiKey returns the api key the request was authenticated with, nil for users
+func CurrentApiKey(c *gin.Context) *model.ApiKey {
+	value, ok := c.Get(_API_KEY_KEY)
+	if !ok {
+		return nil
+	}
+	apiKey, _ := value.(*model.ApiKey)
+	return apiKey
+}
+
+// Actor names who sent the request in audit entries
+func Actor(c *gin.Context) string {
+	if user := CurrentUser(c); user != nil {
+		return user.Actor()
+	}
+	if apiKey := CurrentApiKey(c); apiKey != nil {
+		return apiKey.Actor()
+	}
+	return "anonymous"
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(req.Header.Get("Authorization")), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") && strings.TrimSpace(token) != "" {
+		return strings.TrimSpace(token), true
+	}
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		if token := req.URL.Query().Get("access_token"); token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+func isReadMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
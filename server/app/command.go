@@ -0,0 +1,101 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Command is a cli sub command run as `treblle <name> [args]` instead of the http server
+type Command struct {
+	Name          string
+	Usage         string
+	Run           func(args []string) error
+	ConfigOnly    bool // ConfigOnly commands run right after the config is loaded, before the database is connected
+	ManagesSchema bool // ManagesSchema commands change the schema themselves, pending migrations aren't applied before they run
+}
+
+var commands = map[string]Command{}
+
+func init() {
+	RegisterCommand(newConfigCmd)
+	RegisterCommand(newMigrateCmd)
+}
+
+// RegisterCommand registers a cli sub command
+func RegisterCommand(newCmd func() Command) {
+	cmd := newCmd()
+	commands[cmd.Name] = cmd
+}
+
+// runCommand runs the sub command given in program arguments after the flags, returns false if there is none
+func runCommand() bool {
+	if len(commandArgs) == 0 {
+		return false
+	}
+
+	name := commandArgs[0]
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		zap.S().Fatalf("Unknown command %s", name)
+	}
+
+	if err := cmd.Run(commandArgs[1:]); err != nil {
+		zap.S().Fatalf("Command %s failed, err = %+v", name, err)
+	}
+	return true
+}
+
+// runConfigOnlyCommand runs the sub command if it only needs the config, returns false otherwise
+func runConfigOnlyCommand() bool {
+	if len(commandArgs) == 0 || !commands[commandArgs[0]].ConfigOnly {
+		return false
+	}
+	return runCommand()
+}
+
+// newConfigCmd creates the `config` command that prints the effective config with secrets redacted
+func newConfigCmd() Command {
+	return Command{
+		Name:       "config",
+		Usage:      "config [-format yaml|toml], prints the effective config with secrets redacted",
+		ConfigOnly: true,
+		Run: func(args []string) error {
+			flags := flag.NewFlagSet("config", flag.ContinueOnError)
+			format := flags.String("format", "yaml", "output format (yaml, toml)")
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+			if flags.NArg() != 0 {
+				flags.Usage()
+				return errors.New("config takes no arguments")
+			}
+
+			data, err := EffectiveConfig().Redacted().Marshal(*format)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: treblle [flags] [command]")
+	fmt.Fprintln(os.Stderr, "Without a command the http server is started. Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].Usage)
+	}
+}
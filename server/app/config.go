@@ -0,0 +1,401 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the startup configuration. Every setting can be set in the config file, by an env variable
+// and by a flag named after its key, e.g. -proxy.url. Later layers win: defaults < file < env < flags
+type Config struct {
+	Port      int             `yaml:"port" toml:"port" env:"PORT" doc:"Port of the http server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Proxy     ProxyConfig     `yaml:"proxy" toml:"proxy"`
+	Mock      MockConfig      `yaml:"mock" toml:"mock"`
+	Contract  ContractConfig  `yaml:"contract" toml:"contract"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Consumer  ConsumerConfig  `yaml:"consumer" toml:"consumer"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Analytics AnalyticsConfig `yaml:"analytics" toml:"analytics"`
+}
+
+type DatabaseConfig struct {
+	Driver      string `yaml:"driver" toml:"driver" env:"DB_DRIVER" doc:"Database driver, one of postgres, sqlite"`
+	Conn        string `yaml:"conn" toml:"conn" env:"DB_CONN" secret:"credentials" doc:"Postgres connection string or sqlite file"`
+	MongoConn   string `yaml:"mongo_conn" toml:"mongo_conn" env:"MONGO_CONN" secret:"credentials" doc:"Mongo connection string"`
+	AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE" doc:"Apply pending schema migrations at startup, otherwise run treblle migrate before starting"`
+}
+
+type StorageConfig struct {
+	Backend  string `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND" doc:"Where captured requests are stored, one of database, embedded"`
+	Path     string `yaml:"path" toml:"path" env:"STORAGE_PATH" doc:"File of the embedded store, empty keeps requests in memory only"`
+	Payloads string `yaml:"payloads" toml:"payloads" env:"STORAGE_PAYLOADS" doc:"Where captured headers and bodies are stored, one of requests, mongo"`
+	// Partitions and PartitionsAhead only apply to the database backend on postgres
+	Partitions      string `yaml:"partitions" toml:"partitions" env:"STORAGE_PARTITIONS" doc:"Partition the requests table by creation time, one of none, daily, weekly"`
+	PartitionsAhead int    `yaml:"partitions_ahead" toml:"partitions_ahead" env:"STORAGE_PARTITIONS_AHEAD" doc:"Number of future partitions created ahead of time"`
+}
+
+type ProxyConfig struct {
+	Url              string `yaml:"url" toml:"url" env:"PROXY_URL" doc:"Url of the proxied api"`
+	CaptureBodyLimit int    `yaml:"capture_body_limit" toml:"capture_body_limit" env:"CAPTURE_BODY_LIMIT" doc:"Max number of body bytes stored per request, 0 disables body capture"`
+	Timeout          int    `yaml:"timeout" toml:"timeout" env:"PROXY_TIMEOUT" doc:"Seconds to wait for the upstream to answer before responding with 504, 0 waits as long as the client"`
+}
+
+type MockConfig struct {
+	Mode     bool   `yaml:"mode" toml:"mode" env:"MOCK_MODE" doc:"Answer every proxied route from recorded traffic unless a mock route says otherwise"`
+	Strategy string `yaml:"strategy" toml:"strategy" env:"MOCK_STRATEGY" doc:"Default matching strategy, one of path, query, body"`
+	Fallback string `yaml:"fallback" toml:"fallback" env:"MOCK_FALLBACK" doc:"Default behavior without a match, one of 404, passthrough, synthetic"`
+}
+
+type ContractConfig struct {
+	Enforce bool `yaml:"enforce" toml:"enforce" env:"CONTRACT_ENFORCE" doc:"Reject proxied requests violating the uploaded api spec with 400"`
+}
+
+type RateLimitConfig struct {
+	Limit     int    `yaml:"limit" toml:"limit" env:"RATE_LIMIT" doc:"Default number of requests allowed per window, 0 disables the default limit"`
+	Window    int    `yaml:"window" toml:"window" env:"RATE_LIMIT_WINDOW" doc:"Default window in seconds"`
+	Algorithm string `yaml:"algorithm" toml:"algorithm" env:"RATE_LIMIT_ALGORITHM" doc:"Default algorithm, one of token_bucket, sliding_window"`
+	Key       string `yaml:"key" toml:"key" env:"RATE_LIMIT_KEY" doc:"Default key, one of ip, api_key, route"`
+	KeyHeader string `yaml:"key_header" toml:"key_header" env:"RATE_LIMIT_KEY_HEADER" doc:"Header holding the client api key"`
+}
+
+type ConsumerConfig struct {
+	Sources   []string `yaml:"sources" toml:"sources" env:"CONSUMER_SOURCES" doc:"Consumer sources tried in order, any of api_key, jwt, basic, ip"`
+	KeyHeader string   `yaml:"key_header" toml:"key_header" env:"CONSUMER_KEY_HEADER" doc:"Header holding the consumer api key"`
+	JwtClaim  string   `yaml:"jwt_claim" toml:"jwt_claim" env:"CONSUMER_JWT_CLAIM" doc:"Bearer token claim naming the consumer"`
+	JwtKey    string   `yaml:"jwt_key" toml:"jwt_key" env:"CONSUMER_JWT_KEY" secret:"true" doc:"Verifies bearer tokens, an hmac secret or a pem public key, unverified tokens name a jwt_unverified consumer if empty"`
+}
+
+type AuthConfig struct {
+	Secret         string   `yaml:"secret" toml:"secret" env:"AUTH_SECRET" secret:"true" doc:"Signs dashboard api tokens, a random secret is used if empty"`
+	TokenTtl       int      `yaml:"token_ttl" toml:"token_ttl" env:"AUTH_TOKEN_TTL" doc:"Dashboard api token lifetime in minutes"`
+	AdminEmail     string   `yaml:"admin_email" toml:"admin_email" env:"AUTH_ADMIN_EMAIL" doc:"Admin created on startup when there are no users"`
+	AdminPassword  string   `yaml:"admin_password" toml:"admin_password" env:"AUTH_ADMIN_PASSWORD" secret:"true" doc:"Password of the startup admin"`
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"ALLOWED_ORIGINS" doc:"Origins allowed to open websockets, * allows all"`
+}
+
+type AnalyticsConfig struct {
+	Url           string `yaml:"url" toml:"url" env:"ANALYTICS_URL" secret:"credentials" doc:"Http interface of the clickhouse compatible analytics store, empty disables the analytics sink"`
+	Database      string `yaml:"database" toml:"database" env:"ANALYTICS_DATABASE" doc:"Database of the analytics table"`
+	Table         string `yaml:"table" toml:"table" env:"ANALYTICS_TABLE" doc:"Table completed requests are inserted into, created if missing"`
+	User          string `yaml:"user" toml:"user" env:"ANALYTICS_USER" doc:"User of the analytics store"`
+	Password      string `yaml:"password" toml:"password" env:"ANALYTICS_PASSWORD" secret:"true" doc:"Password of the analytics user"`
+	BatchSize     int    `yaml:"batch_size" toml:"batch_size" env:"ANALYTICS_BATCH_SIZE" doc:"Number of requests inserted at once"`
+	FlushInterval int    `yaml:"flush_interval" toml:"flush_interval" env:"ANALYTICS_FLUSH_INTERVAL" doc:"Seconds between inserts of partial batches"`
+	Queries       bool   `yaml:"queries" toml:"queries" env:"ANALYTICS_QUERIES" doc:"Compute request statistics in the analytics store instead of the request store"`
+}
+
+// DefaultConfig holds the settings used when no layer sets them
+var DefaultConfig = Config{
+	Port: 8090,
+	Database: DatabaseConfig{
+		Driver:      DbDriverPostgres,
+		AutoMigrate: true,
+	},
+	Storage: StorageConfig{
+		Backend:         StorageDatabase,
+		Payloads:        PayloadsWithRequests,
+		Partitions:      PartitionsNone,
+		PartitionsAhead: 7,
+	},
+	Mock: MockConfig{
+		Strategy: string(model.MockMatchQuery),
+		Fallback: string(model.MockFallbackNotFound),
+	},
+	RateLimit: RateLimitConfig{
+		Window:    60,
+		Algorithm: string(model.RateLimitTokenBucket),
+		Key:       string(model.RateLimitByIP),
+		KeyHeader: "X-Api-Key",
+	},
+	Consumer: ConsumerConfig{
+		Sources:   []string{string(model.ConsumerApiKey), string(model.ConsumerJwt), string(model.ConsumerBasic), string(model.ConsumerIP)},
+		KeyHeader: "X-Api-Key",
+		JwtClaim:  "sub",
+	},
+	Auth: AuthConfig{
+		TokenTtl: 720,
+	},
+	Analytics: AnalyticsConfig{
+		Database:      "default",
+		Table:         "treblle_requests",
+		BatchSize:     1000,
+		FlushInterval: 5,
+	},
+}
+
+// ConfigSources are the layers on top of the defaults
+type ConfigSources struct {
+	File  string // File is a .yaml, .yml or .toml config file, empty for none
+	Env   func(string) string
+	Flags map[string]string // Flags are the set flags by setting key
+}
+
+// configSetting is a single setting of Config
+type configSetting struct {
+	Key    string // Key is the dotted path in the config file
+	Env    string
+	Doc    string
+	Secret string // Secret is true for secrets and credentials for connection strings holding a password
+	Value  reflect.Value
+}
+
+// settings lists every setting of config
+func (c *Config) settings() []configSetting {
+	return collectSettings(reflect.ValueOf(c).Elem(), "")
+}
+
+func collectSettings(v reflect.Value, prefix string) []configSetting {
+	var settings []configSetting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct {
+			settings = append(settings, collectSettings(v.Field(i), key+".")...)
+			continue
+		}
+		settings = append(settings, configSetting{
+			Key:    key,
+			Env:    field.Tag.Get("env"),
+			Doc:    field.Tag.Get("doc"),
+			Secret: field.Tag.Get("secret"),
+			Value:  v.Field(i),
+		})
+	}
+	return settings
+}
+
+// LoadConfigFrom layers sources on top of DefaultConfig and validates the result,
+// every bad setting is reported in the returned error
+func LoadConfigFrom(sources ConfigSources) (Config, error) {
+	config := DefaultConfig
+	config.Consumer.Sources = append([]string(nil), DefaultConfig.Consumer.Sources...)
+
+	if sources.File != "" {
+		if err := config.readFile(sources.File); err != nil {
+			return config, fmt.Errorf("%w: %s: %v", cerror.ErrBadConfig, sources.File, err)
+		}
+	}
+
+	var errs []error
+	for _, setting := range config.settings() {
+		if sources.Env != nil && setting.Env != "" {
+			if raw := strings.TrimSpace(sources.Env(setting.Env)); raw != "" {
+				if err := setConfigValue(setting.Value, raw); err != nil {
+					errs = append(errs, fmt.Errorf("env %s: %v", setting.Env, err))
+				}
+			}
+		}
+		if raw, ok := sources.Flags[setting.Key]; ok {
+			if err := setConfigValue(setting.Value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %v", setting.Key, err))
+			}
+		}
+	}
+	errs = append(errs, config.validate()...)
+	if len(errs) != 0 {
+		return config, fmt.Errorf("%w:\n%w", cerror.ErrBadConfig, errors.Join(errs...))
+	}
+	return config, nil
+}
+
+// readFile decodes the config file over c, unknown keys are errors
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			var strict *toml.StrictMissingError
+			if errors.As(err, &strict) {
+				return errors.New(strict.String())
+			}
+			return err
+		}
+		return nil
+	}
+	return errors.New("unknown config file format, use .yaml, .yml or .toml")
+}
+
+// setConfigValue parses raw into the setting, lists are comma separated
+func setConfigValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		num, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		v.SetInt(int64(num))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for item := range strings.SplitSeq(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Kind())
+	}
+	return nil
+}
+
+// validate returns an error for every setting out of range
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port", "should be between 1 and 65535, got %d", c.Port)
+	check(c.Database.Driver == DbDriverPostgres || c.Database.Driver == DbDriverSqlite, "database.driver", "should be one of postgres, sqlite, got %q", c.Database.Driver)
+	check(c.Database.Conn != "", "database.conn", "is required")
+	check(c.Storage.Backend == StorageDatabase || c.Storage.Backend == StorageEmbedded, "storage.backend", "should be one of database, embedded, got %q", c.Storage.Backend)
+	check(c.Storage.Payloads == PayloadsWithRequests || c.Storage.Payloads == PayloadsMongo, "storage.payloads", "should be one of requests, mongo, got %q", c.Storage.Payloads)
+	check(c.Storage.Payloads != PayloadsMongo || c.Database.MongoConn != "", "database.mongo_conn", "is required to store payloads in mongo")
+	check(c.Storage.Partitions == PartitionsNone || c.Storage.Partitions == PartitionsDaily || c.Storage.Partitions == PartitionsWeekly, "storage.partitions", "should be one of none, daily, weekly, got %q", c.Storage.Partitions)
+	check(c.Storage.Partitions == PartitionsNone || (c.Database.Driver == DbDriverPostgres && c.Storage.Backend == StorageDatabase), "storage.partitions", "needs the database backend on postgres")
+	check(c.Storage.PartitionsAhead > 0, "storage.partitions_ahead", "should be positive, got %d", c.Storage.PartitionsAhead)
+	check(isHttpUrl(c.Proxy.Url), "proxy.url", "should be an http or https url, got %q", c.Proxy.Url)
+	check(c.Proxy.CaptureBodyLimit >= 0, "proxy.capture_body_limit", "should not be negative, got %d", c.Proxy.CaptureBodyLimit)
+	check(c.Proxy.Timeout >= 0, "proxy.timeout", "should not be negative, got %d", c.Proxy.Timeout)
+	check(model.MockStrategy(c.Mock.Strategy).IsValid(), "mock.strategy", "should be one of path, query, body, got %q", c.Mock.Strategy)
+	check(model.MockFallback(c.Mock.Fallback).IsValid(), "mock.fallback", "should be one of 404, passthrough, synthetic, got %q", c.Mock.Fallback)
+	check(c.RateLimit.Limit >= 0, "rate_limit.limit", "should not be negative, got %d", c.RateLimit.Limit)
+	check(c.RateLimit.Window > 0, "rate_limit.window", "should be positive, got %d", c.RateLimit.Window)
+	check(model.RateLimitAlgorithm(c.RateLimit.Algorithm).IsValid(), "rate_limit.algorithm", "should be one of token_bucket, sliding_window, got %q", c.RateLimit.Algorithm)
+	check(model.RateLimitKey(c.RateLimit.Key).IsValid(), "rate_limit.key", "should be one of ip, api_key, route, got %q", c.RateLimit.Key)
+	check(c.RateLimit.KeyHeader != "", "rate_limit.key_header", "is required")
+	check(len(c.Consumer.Sources) != 0, "consumer.sources", "needs at least one source")
+	for _, source := range c.Consumer.Sources {
+		check(model.ConsumerSource(source).IsValid(), "consumer.sources", "should be any of api_key, jwt, basic, ip, got %q", source)
+	}
+	check(c.Consumer.KeyHeader != "", "consumer.key_header", "is required")
+	check(c.Consumer.JwtClaim != "", "consumer.jwt_claim", "is required")
+	check(c.Auth.TokenTtl > 0, "auth.token_ttl", "should be positive, got %d", c.Auth.TokenTtl)
+	check((c.Auth.AdminEmail == "") == (c.Auth.AdminPassword == ""), "auth.admin_email", "should be set together with auth.admin_password")
+	check(c.Analytics.Url == "" || isHttpUrl(c.Analytics.Url), "analytics.url", "should be an http or https url, got %q", c.Analytics.Url)
+	check(identifierRegex.MatchString(c.Analytics.Database), "analytics.database", "should be a plain identifier, got %q", c.Analytics.Database)
+	check(identifierRegex.MatchString(c.Analytics.Table), "analytics.table", "should be a plain identifier, got %q", c.Analytics.Table)
+	check(c.Analytics.BatchSize > 0, "analytics.batch_size", "should be positive, got %d", c.Analytics.BatchSize)
+	check(c.Analytics.FlushInterval > 0, "analytics.flush_interval", "should be positive, got %d", c.Analytics.FlushInterval)
+	check(!c.Analytics.Queries || c.Analytics.Url != "", "analytics.queries", "needs analytics.url")
+	return errs
+}
+
+func isHttpUrl(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// identifierRegex matches names used in queries as they are
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var dsnPasswordRegex = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Redacted returns a copy of c with secrets and the passwords of connection strings replaced
+func (c Config) Redacted() Config {
+	c.Consumer.Sources = append([]string(nil), c.Consumer.Sources...)
+	c.Auth.AllowedOrigins = append([]string(nil), c.Auth.AllowedOrigins...)
+	for _, setting := range c.settings() {
+		if setting.Value.Kind() != reflect.String || setting.Value.String() == "" {
+			continue
+		}
+		switch setting.Secret {
+		case "true":
+			setting.Value.SetString(model.RedactedValue)
+		case "credentials":
+			setting.Value.SetString(RedactCredentials(setting.Value.String()))
+		}
+	}
+	return c
+}
+
+// RedactCredentials replaces the password of a url or of a key=value connection string,
+// the url is parsed because a password may contain '@'
+func RedactCredentials(conn string) string {
+	if u, err := url.Parse(conn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			conn = u.Redacted()
+		}
+	}
+	return dsnPasswordRegex.ReplaceAllString(conn, "${1}"+model.RedactedValue)
+}
+
+// Marshal encodes c in the format of the config file named by ext, yaml if ext is empty
+func (c Config) Marshal(ext string) ([]byte, error) {
+	switch strings.TrimPrefix(strings.ToLower(ext), ".") {
+	case "", "yaml", "yml":
+		return yaml.Marshal(c)
+	case "toml":
+		return toml.Marshal(c)
+	}
+	return nil, fmt.Errorf("%w: unknown format %s", cerror.ErrBadConfig, ext)
+}
+
+// parseFlags parses the flags before the command, every setting has a flag named after its key.
+// It returns the config file, the set flags and the remaining arguments
+func parseFlags(args []string) (string, map[string]string, []string, error) {
+	flags := flag.NewFlagSet("treblle", flag.ContinueOnError)
+	configFile := flags.String("config", "", "config file (.yaml, .yml or .toml), also set by CONFIG_FILE")
+	set := map[string]string{}
+	var config Config
+	for _, setting := range config.settings() {
+		key := setting.Key
+		usage := setting.Doc
+		if setting.Env != "" {
+			usage += ", also set by " + setting.Env
+		}
+		flags.Func(key, usage, func(value string) error {
+			set[key] = value
+			return nil
+		})
+	}
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: treblle [flags] [command]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return "", nil, nil, err
+	}
+	return *configFile, set, flags.Args(), nil
+}
@@ -11,7 +11,11 @@ import (
 )
 
 func newDbConn() *gorm.DB {
-	db, err := gorm.Open(postgres.Open(DbConn), &gorm.Config{
+	dialector := postgres.Open(DbConn)
+	if DbDriver == DbDriverSqlite {
+		dialector = sqlite.Open(DbConn)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
 		// NOTE: change LogMode if needed when debugging
 		Logger: gormzap.NewGormZapLogger().LogMode(logger.Warn),
 	})
@@ -7,11 +7,10 @@ import (
 
 var digContainer *dig.Container = nil
 
-// Test configures app so that it can be used in unit testing
+// Test configures app so that it can be used in unit testing,
+// every call starts with an empty container so test suites can provide their own dependencies
 func Test() {
-	if digContainer == nil {
-		digContainer = dig.New()
-	}
+	digContainer = dig.New()
 }
 
 // Provide is a wrapper around digs Provide on a global container
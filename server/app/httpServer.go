@@ -20,8 +20,12 @@ import (
 
 var signalNotificationCh = make(chan os.Signal, 1)
 
-// Start will start the web server of the app
+// Start will start the web server of the app, or run a cli command if one is given in program arguments
 func Start() {
+	if runCommand() {
+		return
+	}
+
 	// relay selected signals to channel
 	// - os.Interrupt, ctrl-c
 	// - syscall.SIGTERM, program termination
@@ -41,6 +45,15 @@ func Start() {
 	go run(schedulerCtx, &schedulerWg)
 	zap.S().Debugf("Started HTTP server")
 
+	for _, worker := range workers {
+		schedulerWg.Add(1)
+		go func() {
+			defer schedulerWg.Done()
+			worker(schedulerCtx)
+		}()
+	}
+	zap.S().Debugf("Started %d workers", len(workers))
+
 	schedulerWg.Wait()
 
 	zap.S().Debugf("Terminated program")
@@ -88,8 +101,20 @@ func run(ctx context.Context, wg *sync.WaitGroup) {
 	// setup controllers
 
 	Proxy(router.Group("/proxy"))
-	basePath := router.Group("/api")
+
+	var auth authDeps
+	Invoke(func(deps authDeps) {
+		auth = deps
+	})
+	publicPath := router.Group("/api")
+	basePath := router.Group("/api", Authenticate(auth.Users, auth.Keys))
+	if auth.Projects != nil {
+		basePath.Use(ProjectAccess(auth.Projects))
+	}
 	for _, c := range controllers {
+		if public, ok := c.(PublicController); ok {
+			public.RegisterPublicEndpoints(publicPath)
+		}
 		c.RegisterEndpoints(basePath)
 	}
 	// cleanup
@@ -1,64 +1,114 @@
 package app
 
 import (
+	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
-// LoadConfig loads in program configuration should be a first thing called in the program
+// effectiveConfig is the config the app was started with
+var effectiveConfig Config
+
+// commandArgs are the program arguments after the flags, the sub command and its arguments
+var commandArgs []string
+
+// LoadConfig loads in program configuration should be a first thing called in the program.
+// Invalid settings stop the program with an error naming each of them
 func LoadConfig() {
-	zap.S().Debugf("Loading env variables")
+	zap.S().Debugf("Loading config")
 
 	if err := godotenv.Load("../.env"); err != nil {
 		zap.S().DPanicf("Env load err = %+v\n", err)
 		zap.S().Infof("Can't load config using real env")
 	}
 
-	// App config
-	Port = loadInt("PORT")
-
-	// Database
-	DbConn = loadString("DB_CONN")
-	MongoConn = loadString("MONGO_CONN")
-	ProxyUrl = loadString("PROXY_URL")
-
-	zap.S().Debugf("Finished loading env variables")
-}
-
-func loadInt(name string) int {
-	rez := os.Getenv(name)
-	if rez == "" {
-		zap.S().Errorf("Env variable %s is empty\n", name)
+	file, flags, args, err := parseFlags(os.Args[1:])
+	if err != nil {
+		zap.S().Fatalf("Failed to parse flags, err = %v", err)
 	}
+	if file == "" {
+		file = strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	}
+	commandArgs = args
 
-	num, err := strconv.Atoi(rez)
+	config, err := LoadConfigFrom(ConfigSources{File: file, Env: os.Getenv, Flags: flags})
 	if err != nil {
-		zap.S().Errorf("Failed to parse int %s, will use default (0)\n", rez)
-		return 0
+		fmt.Fprintln(os.Stderr, err)
+		zap.S().Fatalf("Failed to load config")
 	}
+	applyConfig(config)
 
-	zap.S().Debugf("Loaded %s = %d", name, num)
-	return num
+	zap.S().Debugf("Finished loading config")
 }
 
-func loadString(name string) string {
-	rez := strings.TrimSpace(os.Getenv(name))
-	if rez == "" {
-		zap.S().Errorf("Env variable %s is empty", name)
-		return rez
-	}
-	zap.S().Debugf("Loaded %s = %s", name, rez)
-	return rez
+// EffectiveConfig returns the config the app was started with
+func EffectiveConfig() Config {
+	return effectiveConfig
 }
 
-func loadBool(name string) bool {
-	rez := os.Getenv(name)
-	if rez == "" {
-		zap.S().Errorf("Env variable %s is empty", name)
-	}
-	return rez == "true"
+// applyConfig sets the config variables
+func applyConfig(config Config) {
+	effectiveConfig = config
+
+	// App config
+	Port = config.Port
+
+	// Database
+	DbDriver = config.Database.Driver
+	DbConn = config.Database.Conn
+	DbAutoMigrate = config.Database.AutoMigrate
+	MongoConn = config.Database.MongoConn
+	ProxyUrl = config.Proxy.Url
+	ProxyTimeout = config.Proxy.Timeout
+
+	// Storage
+	StorageBackend = config.Storage.Backend
+	StoragePath = config.Storage.Path
+	StoragePayloads = config.Storage.Payloads
+	StoragePartitions = config.Storage.Partitions
+	StoragePartitionsAhead = config.Storage.PartitionsAhead
+
+	// Capture
+	CaptureBodyLimit = config.Proxy.CaptureBodyLimit
+
+	// Mock server
+	MockMode = config.Mock.Mode
+	MockStrategy = config.Mock.Strategy
+	MockFallback = config.Mock.Fallback
+
+	// Contract validation
+	ContractEnforce = config.Contract.Enforce
+
+	// Rate limiting
+	RateLimit = config.RateLimit.Limit
+	RateLimitWindow = config.RateLimit.Window
+	RateLimitAlgorithm = config.RateLimit.Algorithm
+	RateLimitKey = config.RateLimit.Key
+	RateLimitKeyHeader = config.RateLimit.KeyHeader
+
+	// Consumer identification
+	ConsumerSources = strings.Join(config.Consumer.Sources, ",")
+	ConsumerKeyHeader = config.Consumer.KeyHeader
+	ConsumerJwtClaim = config.Consumer.JwtClaim
+	ConsumerJwtKey = config.Consumer.JwtKey
+
+	// Dashboard auth
+	AuthSecret = config.Auth.Secret
+	AuthTokenTtl = config.Auth.TokenTtl
+	AuthAdminEmail = config.Auth.AdminEmail
+	AuthAdminPassword = config.Auth.AdminPassword
+	AllowedOrigins = strings.Join(config.Auth.AllowedOrigins, ",")
+
+	// Analytics sink
+	AnalyticsUrl = config.Analytics.Url
+	AnalyticsDatabase = config.Analytics.Database
+	AnalyticsTable = config.Analytics.Table
+	AnalyticsUser = config.Analytics.User
+	AnalyticsPassword = config.Analytics.Password
+	AnalyticsBatchSize = config.Analytics.BatchSize
+	AnalyticsFlushInterval = config.Analytics.FlushInterval
+	AnalyticsQueries = config.Analytics.Queries
 }
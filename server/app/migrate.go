@@ -0,0 +1,97 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"treblle/migration"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// migrateOnStartup applies the pending schema migrations, or checks that there are none if DbAutoMigrate is off
+func migrateOnStartup(db *gorm.DB) {
+	migrator := migration.New(db)
+	if DbAutoMigrate {
+		if _, err := migrator.Up(); err != nil {
+			zap.S().Panicf("Can't migrate the database schema err = %+v", err)
+		}
+		return
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		zap.S().Panicf("Can't read the database schema version err = %+v", err)
+	}
+	if len(pending) > 0 {
+		zap.S().Panicf("%v, %d pending starting with %d %s", cerror.ErrPendingMigrations, len(pending), pending[0].Version, pending[0].Name)
+	}
+}
+
+// runsSchemaCommand returns true if the sub command manages the schema itself
+func runsSchemaCommand() bool {
+	return len(commandArgs) > 0 && commands[commandArgs[0]].ManagesSchema
+}
+
+// newMigrateCmd creates the `migrate` command that applies, reverts or lists the schema migrations
+func newMigrateCmd() Command {
+	return Command{
+		Name:          "migrate",
+		Usage:         "migrate [up | down [-steps n] | status], applies pending schema migrations by default",
+		ManagesSchema: true,
+		Run: func(args []string) error {
+			action := "up"
+			if len(args) > 0 {
+				action, args = args[0], args[1:]
+			}
+			flags := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+			steps := flags.Int("steps", 1, "number of migrations to revert, newest first")
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+			if flags.NArg() != 0 || *steps < 1 {
+				flags.Usage()
+				return errors.New("migrate takes one of up, down, status and a positive number of steps")
+			}
+
+			migrator := migration.New(newDbConn())
+			switch action {
+			case "up":
+				applied, err := migrator.Up()
+				for _, m := range applied {
+					fmt.Printf("applied %d %s\n", m.Version, m.Name)
+				}
+				if err == nil && len(applied) == 0 {
+					fmt.Println("schema is up to date")
+				}
+				return err
+			case "down":
+				reverted, err := migrator.Down(*steps)
+				for _, m := range reverted {
+					fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+				}
+				return err
+			case "status":
+				statuses, err := migrator.Status()
+				if err != nil {
+					return err
+				}
+				for _, status := range statuses {
+					state := "pending"
+					if status.AppliedAt != nil {
+						state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+					}
+					if status.Unknown {
+						state += ", unknown to this build"
+					}
+					fmt.Printf("%6d %-40s %s\n", status.Version, status.Name, state)
+				}
+				return nil
+			default:
+				return fmt.Errorf("unknown migrate action %s, should be one of up, down, status", action)
+			}
+		},
+	}
+}
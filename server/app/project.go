@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type projectCtxKey struct{}
+
+const (
+	_PROJECT_KEY = "ProjectKey"
+
+	// ProjectIdHeader selects the project of a dashboard api request, the project_id query does the same
+	ProjectIdHeader = "X-Project-Id"
+)
+
+// ProjectResolver finds the project a proxied request is sent to from its ingestion key or route prefix.
+// It returns the path without the project prefix, a nil project is the default project
+type ProjectResolver interface {
+	ResolveProject(req *http.Request) (*model.Project, string, error)
+}
+
+// ProjectAuthorizer decides if a user or api key can read a project, it returns gorm.ErrRecordNotFound for unknown projects
+type ProjectAuthorizer interface {
+	CanAccessProject(user *model.User, apiKey *model.ApiKey, projectID uint) (bool, error)
+}
+
+// WithProject stores the project of a proxied request in its context
+func WithProject(ctx context.Context, project *model.Project) context.Context {
+	return context.WithValue(ctx, projectCtxKey{}, project)
+}
+
+// ProjectFrom returns the project of a proxied request, nil for the default project
+func ProjectFrom(ctx context.Context) *model.Project {
+	project, _ := ctx.Value(projectCtxKey{}).(*model.Project)
+	return project
+}
+
+// ProjectIDFrom returns the id of the project of a proxied request
+func ProjectIDFrom(ctx context.Context) uint {
+	if project := ProjectFrom(ctx); project != nil {
+		return project.ID
+	}
+	return model.DefaultProjectID
+}
+
+// ProjectAccess selects the project a dashboard api request reads from the project_id query or the X-Project-Id header,
+// the default project is used when neither is set. It has to run after Authenticate
+func ProjectAccess(projects ProjectAuthorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.Query("project_id")
+		if value == "" {
+			value = c.GetHeader(ProjectIdHeader)
+		}
+		projectID := model.DefaultProjectID
+		if value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+				return
+			}
+			projectID = uint(id)
+		}
+
+		ok, err := projects.CanAccessProject(CurrentUser(c), CurrentApiKey(c), projectID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+		if err != nil {
+			zap.S().Errorf("Failed to check project access, error = %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "could not check project access"})
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": cerror.ErrNoProjectAccess.Error()})
+			return
+		}
+		c.Set(_PROJECT_KEY, projectID)
+		c.Next()
+	}
+}
+
+// CurrentProjectID returns the project selected by ProjectAccess, the default project outside of it
+func CurrentProjectID(c *gin.Context) uint {
+	projectID, _ := c.Get(_PROJECT_KEY)
+	id, _ := projectID.(uint)
+	return id
+}
@@ -2,21 +2,63 @@ package app
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 	"treblle/model"
+	"treblle/util/cerror"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/dig"
 	"go.uber.org/zap"
 )
 
-const _REQUEST_ID_KEY = "RequestIdKey"
+// _REQUEST_KEY holds the logged request in the context of the proxied request
+const _REQUEST_KEY = "RequestKey"
 
 type RequestLogger interface {
 	LogRequest(req *http.Request) (*model.Request, error)
-	LogResponse(id uint, resp *http.Response) (*model.Request, error)
+	LogResponse(logged *model.Request, resp *http.Response) (*model.Request, error)
+	// LogError completes a request the upstream never answered, err is the error of the proxy
+	LogError(logged *model.Request, err error) (*model.Request, error)
+}
+
+// Mocker answers proxied requests from recorded traffic,
+// a nil response means the request is passed through to the upstream, also when err is set
+type Mocker interface {
+	Mock(req *model.Request) (*http.Response, error)
+}
+
+// ContractValidator checks proxied traffic against the api spec of the upstream,
+// a non nil response rejects the request instead of sending it to the upstream
+type ContractValidator interface {
+	ValidateRequest(req *http.Request, logged *model.Request) (*http.Response, error)
+	ValidateResponse(logged *model.Request, resp *http.Response) error
+	// SaveViolations saves the violations a tail sampled request holds once it's stored without a response to validate
+	SaveViolations(logged *model.Request) error
+}
+
+// RateLimiter enforces request quotas at the proxy, a non nil response rejects the request.
+// The returned header describes the quota and is added to the response of allowed requests
+type RateLimiter interface {
+	Limit(req *http.Request, logged *model.Request) (http.Header, *http.Response, error)
+}
+
+type proxyDeps struct {
+	dig.In
+
+	Logger    RequestLogger
+	Limiter   RateLimiter       `optional:"true"`
+	Mocker    Mocker            `optional:"true"`
+	Validator ContractValidator `optional:"true"`
+	Projects  ProjectResolver   `optional:"true"`
+	Config    RuntimeConfig     `optional:"true"`
 }
 
 func Proxy(router *gin.RouterGroup) {
@@ -25,23 +67,67 @@ func Proxy(router *gin.RouterGroup) {
 	if err != nil {
 		zap.S().Fatalf("Failed to parse target URL: %v", err)
 	}
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	originalDirector := proxy.Director
+	var config RuntimeConfig
+	proxy := &httputil.ReverseProxy{Transport: upstreamTransport()}
 	proxy.Director = func(req *http.Request) {
 		const prefixToRemove = "/proxy"
 		if after, ok := strings.CutPrefix(req.URL.Path, prefixToRemove); ok {
 			req.URL.Path = after
+			req.URL.RawPath = ""
+		}
+		// the upstream is read per request, a changed upstream applies to the next request
+		upstream := target
+		if config != nil && config.Runtime().UpstreamUrl != "" {
+			configTarget, err := url.Parse(config.Runtime().UpstreamUrl)
+			if err != nil {
+				zap.S().Errorf("Bad upstream url in runtime config, error = %v", err)
+			} else {
+				upstream = configTarget
+			}
+		}
+		if project := ProjectFrom(req.Context()); project != nil {
+			projectTarget, err := url.Parse(project.UpstreamUrl)
+			if err != nil {
+				zap.S().Errorf("Bad upstream url of project %d, error = %v", project.ID, err)
+			} else {
+				upstream = projectTarget
+			}
 		}
-		originalDirector(req)
-		req.Host = target.Host
+		rewriteTarget(req, upstream)
+		req.Header.Del(model.ProjectKeyHeader)
 	}
 	var reqLogger RequestLogger
-	Invoke(func(logger RequestLogger) {
-		reqLogger = logger
+	var limiter RateLimiter
+	var mocker Mocker
+	var validator ContractValidator
+	var resolver ProjectResolver
+	Invoke(func(deps proxyDeps) {
+		reqLogger = deps.Logger
+		limiter = deps.Limiter
+		mocker = deps.Mocker
+		validator = deps.Validator
+		resolver = deps.Projects
+		config = deps.Config
 	})
 
 	proxyHandler := func(c *gin.Context) {
+		if resolver != nil {
+			project, path, err := resolver.ResolveProject(c.Request)
+			if errors.Is(err, cerror.ErrInvalidIngestionKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				zap.S().Errorf("Failed to resolve project, error %v", err)
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			// the project prefix is dropped so the request is logged and forwarded without it
+			c.Request.URL.Path = "/proxy" + path
+			c.Request.URL.RawPath = ""
+			c.Request = c.Request.WithContext(WithProject(c.Request.Context(), project))
+		}
+
 		req, err := reqLogger.LogRequest(c.Request)
 		if err != nil {
 			zap.S().Errorf("Failed to log request, error %v", err)
@@ -49,24 +135,179 @@ func Proxy(router *gin.RouterGroup) {
 			return
 		}
 
-		ctx := context.WithValue(c.Request.Context(), _REQUEST_ID_KEY, req.ID)
+		if limiter != nil {
+			// a failing limiter store lets requests through instead of taking the api down
+			header, resp, err := limiter.Limit(c.Request, req)
+			if err != nil {
+				zap.S().Errorf("Failed to rate limit request, error %v", err)
+			}
+			for key, values := range header {
+				c.Writer.Header()[key] = values
+			}
+			if resp != nil {
+				serveLocal(c, reqLogger, req, resp)
+				return
+			}
+		}
+
+		if validator != nil {
+			// validation only observes traffic, failing to validate doesn't fail the request
+			resp, err := validator.ValidateRequest(c.Request, req)
+			if err != nil {
+				zap.S().Errorf("Failed to validate request, error %v", err)
+			}
+			if resp != nil {
+				serveLocal(c, reqLogger, req, resp)
+				saveViolations(validator, req)
+				return
+			}
+		}
+
+		if mocker != nil {
+			// a failing mock store passes requests through instead of taking the api down
+			resp, err := mocker.Mock(req)
+			if err != nil {
+				zap.S().Errorf("Failed to mock request, error %v", err)
+			}
+			if resp != nil {
+				serveLocal(c, reqLogger, req, resp)
+				saveViolations(validator, req)
+				return
+			}
+		}
+
+		ctx := context.WithValue(c.Request.Context(), _REQUEST_KEY, req)
 		c.Request = c.Request.WithContext(ctx)
 		// ----------------------------------------
 		proxy.ServeHTTP(c.Writer, c.Request)
 	}
 
 	proxy.ModifyResponse = func(resp *http.Response) error {
-		strData := resp.Request.Context().Value(_REQUEST_ID_KEY)
-		if strData != nil {
-			requestID := strData.(uint)
-			if _, err := reqLogger.LogResponse(requestID, resp); err != nil {
+		if req, ok := resp.Request.Context().Value(_REQUEST_KEY).(*model.Request); ok {
+			// the upstream answered, failing to log the response doesn't turn it into a proxy error
+			logged, err := reqLogger.LogResponse(req, resp)
+			if err != nil {
 				zap.S().Errorf("Failed to log response, error %v", err)
-				return err
+				return nil
+			}
+			if validator != nil && logged != nil {
+				// the body is captured while it streams to the client, so it's validated once it's closed
+				resp.Body = &closeHook{ReadCloser: resp.Body, hook: func() {
+					if err := validator.ValidateResponse(logged, resp); err != nil {
+						zap.S().Errorf("Failed to validate response, error %v", err)
+					}
+				}}
 			}
 		}
 
 		return nil
 	}
 
+	// the upstream failed to answer, the request is logged with the kind of failure and answered with 502 or 504
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		kind := model.ProxyErrorOf(err)
+		if req, ok := r.Context().Value(_REQUEST_KEY).(*model.Request); ok {
+			if _, err := reqLogger.LogError(req, err); err != nil {
+				zap.S().Errorf("Failed to log proxy error, error %v", err)
+			}
+		}
+		// a canceled client is nobody's failure, there is just no one left to read the response
+		if kind != model.ProxyErrorCanceled {
+			zap.S().Warnf("Upstream failed to answer %s %s, kind %s, error %v", r.Method, r.URL.Path, kind, err)
+		}
+		writeJSON(w, kind.Status(), gin.H{"error": http.StatusText(kind.Status()), "proxyError": kind})
+	}
+
 	router.Any("/*proxyPath", proxyHandler)
 }
+
+// upstreamTransport is the default transport waiting at most ProxyTimeout seconds for the upstream to answer
+func upstreamTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ProxyTimeout > 0 {
+		transport.ResponseHeaderTimeout = time.Duration(ProxyTimeout) * time.Second
+	}
+	return transport
+}
+
+// writeJSON writes body as the json response with status
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		zap.S().Errorf("Failed to write response, error %v", err)
+	}
+}
+
+// rewriteTarget sends req to target the same way httputil.NewSingleHostReverseProxy does
+func rewriteTarget(req *http.Request, target *url.URL) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+	if target.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+	}
+	req.Host = target.Host
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// explicitly disable the default User-Agent so it's not set to the go client one
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// serveLocal logs and writes a response produced by treblle instead of calling the upstream
+func serveLocal(c *gin.Context, reqLogger RequestLogger, req *model.Request, resp *http.Response) {
+	_, err := reqLogger.LogResponse(req, resp)
+	// the logger may replace the body to capture it, the request is stored once it's closed
+	defer resp.Body.Close()
+	if err != nil {
+		zap.S().Errorf("Failed to log response, error %v", err)
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	header := c.Writer.Header()
+	for key, values := range resp.Header {
+		header[key] = values
+	}
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		zap.S().Errorf("Failed to write response, error %v", err)
+	}
+}
+
+// saveViolations saves the violations of a tail sampled request answered by treblle, serveLocal has stored it by now
+func saveViolations(validator ContractValidator, req *model.Request) {
+	if validator == nil {
+		return
+	}
+	if err := validator.SaveViolations(req); err != nil {
+		zap.S().Errorf("Failed to save violations, error %v", err)
+	}
+}
+
+// closeHook calls hook once after the body is closed
+type closeHook struct {
+	io.ReadCloser
+	hook func()
+	once sync.Once
+}
+
+func (b *closeHook) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.hook)
+	return err
+}
@@ -0,0 +1,9 @@
+package app
+
+import "treblle/model"
+
+// RuntimeConfig provides the settings that can be changed while the server runs,
+// they should be read on every use instead of being copied at startup
+type RuntimeConfig interface {
+	Runtime() model.RuntimeConfig
+}
@@ -3,8 +3,10 @@ package app
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
-	"treblle/model"
+	"treblle/util/ws"
 
 	"go.uber.org/dig"
 	"go.uber.org/zap"
@@ -43,6 +45,20 @@ func Setup() {
 
 	LoadConfig()
 
+	// commands that only need the config don't connect to the database
+	if runConfigOnlyCommand() {
+		os.Exit(0)
+	}
+
+	// Websocket setup
+	{
+		for origin := range strings.SplitSeq(AllowedOrigins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				ws.AllowedOrigins = append(ws.AllowedOrigins, origin)
+			}
+		}
+	}
+
 	// Dig setup
 	{
 		digContainer = dig.New()
@@ -58,10 +74,14 @@ func Setup() {
 
 		sqlDB.SetMaxIdleConns(10)
 		sqlDB.SetMaxOpenConns(100)
+		if DbDriver == DbDriverSqlite {
+			// sqlite allows a single writer, one connection avoids database is locked errors
+			sqlDB.SetMaxOpenConns(1)
+		}
 		sqlDB.SetConnMaxLifetime(time.Hour)
 
-		if err = db.AutoMigrate(model.GetAllModels()...); err != nil {
-			zap.S().Panicf("Can't run AutoMigrate err = %+v", err)
+		if !runsSchemaCommand() {
+			migrateOnStartup(db)
 		}
 
 		Provide(newDbConn)
@@ -5,6 +5,21 @@ const (
 	BuildProd = "prod"
 )
 
+const (
+	DbDriverPostgres = "postgres"
+	DbDriverSqlite   = "sqlite" // DbDriverSqlite keeps the database in a single file, DbConn is its path
+
+	StorageDatabase = "database" // StorageDatabase stores captured requests in the database
+	StorageEmbedded = "embedded" // StorageEmbedded stores captured requests in the embedded store of the binary
+
+	PayloadsWithRequests = "requests" // PayloadsWithRequests stores captured headers and bodies with the requests
+	PayloadsMongo        = "mongo"    // PayloadsMongo stores captured headers and bodies in mongo, MongoConn is required
+
+	PartitionsNone   = "none"   // PartitionsNone keeps the requests table unpartitioned
+	PartitionsDaily  = "daily"  // PartitionsDaily partitions the requests table by day
+	PartitionsWeekly = "weekly" // PartitionsWeekly partitions the requests table by week, starting on monday
+)
+
 var (
 	// Build describes app build type
 	//
@@ -21,8 +36,53 @@ var (
 // Envirment variables
 
 var (
-	Port      int    // Port is app port
-	DbConn    string // Postgress Connection string
-	MongoConn string // MongoConn is mongo db connection string
-	ProxyUrl  string // ProxyUrl is the url to api
+	Port          int    // Port is app port
+	DbDriver      string // DbDriver is the database driver, one of postgres, sqlite
+	DbConn        string // Postgress Connection string or sqlite file
+	DbAutoMigrate bool   // DbAutoMigrate applies pending schema migrations at startup, otherwise the server refuses to start on an outdated schema
+	MongoConn     string // MongoConn is mongo db connection string
+	ProxyUrl      string // ProxyUrl is the url to api
+	ProxyTimeout  int    // ProxyTimeout is the number of seconds to wait for the upstream to answer, 0 waits as long as the client
+
+	StorageBackend string // StorageBackend is where captured requests are stored, one of database, embedded
+	StoragePath    string // StoragePath is the file of the embedded store, empty keeps requests in memory only
+	// StoragePayloads is where captured headers and bodies are stored, one of requests, mongo
+	StoragePayloads string
+	// StoragePartitions partitions the requests table by creation time, one of none, daily, weekly
+	StoragePartitions      string
+	StoragePartitionsAhead int // StoragePartitionsAhead is the number of future partitions created ahead of time
+
+	CaptureBodyLimit int // CaptureBodyLimit is the max number of body bytes stored per request, 0 disables body capture
+
+	MockMode     bool   // MockMode answers every proxied route from recorded traffic unless a mock route says otherwise
+	MockStrategy string // MockStrategy is the default matching strategy, one of path, query, body
+	MockFallback string // MockFallback is the default behavior without a match, one of 404, passthrough, synthetic
+
+	ContractEnforce bool // ContractEnforce rejects proxied requests violating the uploaded api spec with 400
+
+	RateLimit          int    // RateLimit is the default number of requests allowed per window, 0 disables the default limit
+	RateLimitWindow    int    // RateLimitWindow is the default window in seconds
+	RateLimitAlgorithm string // RateLimitAlgorithm is the default algorithm, one of token_bucket, sliding_window
+	RateLimitKey       string // RateLimitKey is the default key, one of ip, api_key, route
+	RateLimitKeyHeader string // RateLimitKeyHeader is the header holding the client api key
+
+	ConsumerSources   string // ConsumerSources is a comma separated list of api_key, jwt, basic, ip, the first one found identifies the consumer
+	ConsumerKeyHeader string // ConsumerKeyHeader is the header holding the consumer api key
+	ConsumerJwtClaim  string // ConsumerJwtClaim is the bearer token claim naming the consumer
+	ConsumerJwtKey    string // ConsumerJwtKey verifies bearer tokens before their claim is used, an hmac secret or a pem public key
+
+	AuthSecret        string // AuthSecret signs dashboard api tokens, a random secret is used if empty
+	AuthTokenTtl      int    // AuthTokenTtl is the dashboard api token lifetime in minutes
+	AuthAdminEmail    string // AuthAdminEmail is the admin created on startup when there are no users
+	AuthAdminPassword string // AuthAdminPassword is the password of the startup admin
+	AllowedOrigins    string // AllowedOrigins is a comma separated list of origins allowed to open websockets, * allows all
+
+	AnalyticsUrl           string // AnalyticsUrl is the http interface of the analytics store, empty disables the analytics sink
+	AnalyticsDatabase      string // AnalyticsDatabase is the database of the analytics table
+	AnalyticsTable         string // AnalyticsTable is the table completed requests are inserted into
+	AnalyticsUser          string // AnalyticsUser is the user of the analytics store
+	AnalyticsPassword      string // AnalyticsPassword is the password of the analytics user
+	AnalyticsBatchSize     int    // AnalyticsBatchSize is the number of requests inserted at once
+	AnalyticsFlushInterval int    // AnalyticsFlushInterval is the number of seconds between inserts of partial batches
+	AnalyticsQueries       bool   // AnalyticsQueries computes request statistics in the analytics store
 )
@@ -0,0 +1,13 @@
+package app
+
+import "context"
+
+// Worker is a long running background task, it should return when ctx is done
+type Worker func(ctx context.Context)
+
+var workers []Worker
+
+// RegisterWorker registers a background task started together with the http server
+func RegisterWorker(newWorker func() Worker) {
+	workers = append(workers, newWorker())
+}
@@ -0,0 +1,88 @@
+// Package command contains cli sub commands
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+
+	"gorm.io/gorm"
+)
+
+type importCmd struct {
+	importSrv  service.IImportService
+	projectSrv service.IProjectService
+}
+
+// NewImportCmd creates the `import` command that imports a HAR or NDJSON file into the request store
+func NewImportCmd() app.Command {
+	var cmd importCmd
+	app.Invoke(func(importSrv service.IImportService, projectSrv service.IProjectService) {
+		cmd.importSrv = importSrv
+		cmd.projectSrv = projectSrv
+	})
+
+	return app.Command{
+		Name:  "import",
+		Usage: "import -source <label> [-format har|ndjson] [-project <id>] <file>, imports traffic, rerun to resume",
+		Run:   cmd.run,
+	}
+}
+
+func (cmd *importCmd) run(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	source := flags.String("source", "", "source label the imported requests are tagged with")
+	format := flags.String("format", "", "file format (har, ndjson), guessed from the extension if not set")
+	project := flags.Uint("project", model.DefaultProjectID, "project the requests are imported into")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *source == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("source and exactly one file are required")
+	}
+
+	// requests of a missing project would be imported where no dashboard shows them
+	_, err := cmd.projectSrv.Get(*project)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("project %d doesn't exist", *project)
+	}
+	if err != nil {
+		return err
+	}
+
+	filePath := flags.Arg(0)
+	importFormat := service.ImportFormat(*format)
+	if *format == "" {
+		if importFormat, err = service.ImportFormatFromFileName(filePath); err != nil {
+			return err
+		}
+	}
+
+	job, err := cmd.importSrv.CreateFromPath(model.CliActor, *project, *source, importFormat, filePath)
+	if err != nil {
+		return err
+	}
+
+	// on ctrl-c the job is left unfinished and continues on the next run
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Printf("Importing %s as job %d\n", filePath, job.ID)
+	err = cmd.importSrv.Run(ctx, job, func(job model.ImportJob) {
+		fmt.Printf("\rprocessed %d, imported %d, skipped %d, failed %d", job.Processed, job.Imported, job.Skipped, job.Failed)
+	})
+	fmt.Println()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Import interrupted, run the same command again to resume")
+		return nil
+	}
+	return err
+}
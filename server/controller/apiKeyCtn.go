@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ApiKeyCtn struct {
+	Logger    *zap.SugaredLogger
+	ApiKeySrv service.IApiKeyService
+}
+
+// NewApiKeyCtn crates new controller with its dependencies
+func NewApiKeyCtn() app.Controller {
+	var controller *ApiKeyCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IApiKeyService) {
+		controller = &ApiKeyCtn{
+			Logger:    logger,
+			ApiKeySrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the admin only api key endpoints.
+func (cnt *ApiKeyCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	keys := router.Group("/api-keys", app.RequireRole(model.RoleAdmin))
+	keys.GET("", cnt.ListApiKeys)
+	keys.POST("", cnt.CreateApiKey)
+	keys.DELETE("/:id", cnt.RevokeApiKey)
+}
+
+// ListApiKeys godoc
+//
+//	@Summary		List api keys
+//	@Description	Lists the api keys of the dashboard api including revoked and expired ones, admin only.
+//	@Tags			ApiKey
+//	@Produce		json
+//	@Success		200	{array}		dto.ApiKeyDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/api-keys [get]
+func (cnt *ApiKeyCtn) ListApiKeys(c *gin.Context) {
+	keys, err := cnt.ApiKeySrv.ListKeys()
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list api keys: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve api keys"})
+		return
+	}
+
+	ret := make([]dto.ApiKeyDto, len(keys))
+	for i := range keys {
+		ret[i].FromModel(keys[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateApiKey godoc
+//
+//	@Summary		Create api key
+//	@Description	Creates an api key for scripts, send it in the X-Api-Key header of /api requests. The key is only returned once. read_requests lists, exports and reads requests, read_stats reads statistics, consumers, violations and the inferred spec, manage_config reads and changes everything else. Users and api keys can't be managed with a key. A key only reads the project it was created for, keys of other projects than the default one can't change the config and rate limits shared by every project.
+//	@Tags			ApiKey
+//	@Accept			json
+//	@Produce		json
+//	@Param			key	body		dto.NewApiKeyDto	true	"Api key"
+//	@Success		201	{object}	dto.CreatedApiKeyDto
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/api-keys [post]
+func (cnt *ApiKeyCtn) CreateApiKey(c *gin.Context) {
+	var body dto.NewApiKeyDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid api key: " + err.Error()})
+		return
+	}
+
+	apiKey := body.ToModel()
+	if user := app.CurrentUser(c); user != nil {
+		apiKey.CreatedByID = user.ID
+	}
+	key, err := cnt.ApiKeySrv.CreateKey(app.Actor(c), &apiKey)
+	if errors.Is(err, cerror.ErrUnknownApiKeyScope) || errors.Is(err, cerror.ErrBadApiKeyExpiry) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Project not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create api key: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create api key"})
+		return
+	}
+
+	ret := dto.CreatedApiKeyDto{Key: key}
+	ret.FromModel(apiKey)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// RevokeApiKey godoc
+//
+//	@Summary		Revoke api key
+//	@Description	Revokes an api key, it stops working immediately. The key is kept for the audit log.
+//	@Tags			ApiKey
+//	@Produce		json
+//	@Param			id	path		int	true	"Api key id"
+//	@Success		200	{object}	dto.ApiKeyDto
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/api-keys/{id} [delete]
+func (cnt *ApiKeyCtn) RevokeApiKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	apiKey, err := cnt.ApiKeySrv.RevokeKey(app.Actor(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Api key not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to revoke api key: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not revoke api key"})
+		return
+	}
+
+	var ret dto.ApiKeyDto
+	ret.FromModel(*apiKey)
+	c.JSON(http.StatusOK, ret)
+}
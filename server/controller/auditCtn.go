@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type AuditCtn struct {
+	Logger   *zap.SugaredLogger
+	AuditSrv service.IAuditService
+}
+
+// NewAuditCtn crates new controller with its dependencies
+func NewAuditCtn() app.Controller {
+	var controller *AuditCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IAuditService) {
+		controller = &AuditCtn{
+			Logger:   logger,
+			AuditSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the admin only audit log endpoints.
+func (cnt *AuditCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/audit", app.RequireRole(model.RoleAdmin), cnt.ListAuditEntries)
+}
+
+// ListAuditEntries godoc
+//
+//	@Summary		List audit log
+//	@Description	Returns a page of recorded administrative changes, newest first, with the before and after value of every changed field. Secrets are redacted. Admin only.
+//	@Tags			Audit
+//	@Produce		json
+//	@Param			actor		query		string	false	"Filter by actor, e.g. user:admin@example.com or api_key:trbl_abcdefgh"
+//	@Param			action		query		string	false	"Filter by action, e.g. project.updated"
+//	@Param			target		query		string	false	"Filter by target, e.g. project:3, or by kind, e.g. project"
+//	@Param			start_time	query		string	false	"Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)"	format(date-time)
+//	@Param			end_time	query		string	false	"End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)"	format(date-time)
+//	@Param			limit		query		int		false	"Pagination limit"	default(20)
+//	@Param			offset		query		int		false	"Pagination offset"
+//	@Success		200			{object}	dto.AuditEntriesDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		401			{object}	dto.ErrorDto
+//	@Failure		403			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/audit [get]
+func (cnt *AuditCtn) ListAuditEntries(c *gin.Context) {
+	var q dto.AuditQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid query parameters: " + err.Error()})
+		return
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	startTime, endTime, ok := timeRange(c, cnt.Logger)
+	if !ok {
+		return
+	}
+
+	params := service.ListAuditParams{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+	}
+	if q.Actor != "" {
+		params.Actor = &q.Actor
+	}
+	if q.Action != "" {
+		params.Action = &q.Action
+	}
+	if q.Target != "" {
+		params.Target = &q.Target
+	}
+
+	entries, total, err := cnt.AuditSrv.List(params)
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list audit entries: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve audit entries"})
+		return
+	}
+
+	ret := dto.AuditEntriesDto{
+		Data: make([]dto.AuditEntryDto, len(entries)),
+		Pagination: dto.Pagination{
+			Total:  total,
+			Limit:  q.Limit,
+			Offset: q.Offset,
+		},
+	}
+	for i := range entries {
+		ret.Data[i].FromModel(entries[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
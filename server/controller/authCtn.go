@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type AuthCtn struct {
+	Logger  *zap.SugaredLogger
+	AuthSrv service.IAuthService
+}
+
+// NewAuthCtn crates new controller with its dependencies
+func NewAuthCtn() app.Controller {
+	var controller *AuthCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IAuthService) {
+		controller = &AuthCtn{
+			Logger:  logger,
+			AuthSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterPublicEndpoints registers the login endpoint.
+func (cnt *AuthCtn) RegisterPublicEndpoints(router *gin.RouterGroup) {
+	router.POST("/auth/login", cnt.Login)
+}
+
+// RegisterEndpoints registers the current user and the admin only user management endpoints.
+func (cnt *AuthCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/auth/me", cnt.Me)
+
+	users := router.Group("/users", app.RequireRole(model.RoleAdmin))
+	users.GET("", cnt.ListUsers)
+	users.POST("", cnt.CreateUser)
+	users.PUT("/:id", cnt.UpdateUser)
+	users.DELETE("/:id", cnt.DeleteUser)
+}
+
+// Login godoc
+//
+//	@Summary		Log in
+//	@Description	Issues a bearer token for the dashboard api, send it as `Authorization: Bearer <token>` or as the access_token query of websockets. Viewers can only read and save their own views, admins can also change configuration and manage users. An email is locked out for 15 minutes after 5 failed logins, tokens are revoked when the password of their user changes.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			credentials	body		dto.LoginDto	true	"User credentials"
+//	@Success		200			{object}	dto.TokenDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		401			{object}	dto.ErrorDto
+//	@Failure		429			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/auth/login [post]
+func (cnt *AuthCtn) Login(c *gin.Context) {
+	var body dto.LoginDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid credentials: " + err.Error()})
+		return
+	}
+
+	token, expiresAt, user, err := cnt.AuthSrv.Login(body.Email, body.Password)
+	if errors.Is(err, cerror.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, cerror.ErrTooManyLogins) {
+		c.JSON(http.StatusTooManyRequests, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to log in user: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not log in"})
+		return
+	}
+
+	ret := dto.TokenDto{Token: token, ExpiresAt: expiresAt.String()}
+	ret.User.FromModel(*user)
+	c.JSON(http.StatusOK, ret)
+}
+
+// Me godoc
+//
+//	@Summary		Current user
+//	@Description	Returns the user the bearer token was issued to.
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		200	{object}	dto.UserDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Router			/auth/me [get]
+func (cnt *AuthCtn) Me(c *gin.Context) {
+	user := app.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorDto{Error: cerror.ErrUserIsNil.Error()})
+		return
+	}
+
+	var ret dto.UserDto
+	ret.FromModel(*user)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ListUsers godoc
+//
+//	@Summary		List users
+//	@Description	Lists the dashboard users, admin only.
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		200	{array}		dto.UserDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/users [get]
+func (cnt *AuthCtn) ListUsers(c *gin.Context) {
+	users, err := cnt.AuthSrv.ListUsers()
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve users"})
+		return
+	}
+
+	ret := make([]dto.UserDto, len(users))
+	for i := range users {
+		ret[i].FromModel(users[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateUser godoc
+//
+//	@Summary		Create user
+//	@Description	Creates a dashboard user, admin only. Passwords need 8 to 72 characters.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			user	body		dto.NewUserDto	true	"New user"
+//	@Success		201		{object}	dto.UserDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		401		{object}	dto.ErrorDto
+//	@Failure		403		{object}	dto.ErrorDto
+//	@Failure		409		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/users [post]
+func (cnt *AuthCtn) CreateUser(c *gin.Context) {
+	var body dto.NewUserDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid user: " + err.Error()})
+		return
+	}
+
+	user, err := cnt.AuthSrv.CreateUser(app.Actor(c), body.Email, body.Password, model.Role(body.Role))
+	if cnt.userError(c, err, "Could not create user") {
+		return
+	}
+
+	var ret dto.UserDto
+	ret.FromModel(*user)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateUser godoc
+//
+//	@Summary		Update user
+//	@Description	Changes the role or password of a dashboard user, admin only. The last admin can't be demoted.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"User id"
+//	@Param			user	body		dto.UpdateUserDto	true	"Changes"
+//	@Success		200		{object}	dto.UserDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		401		{object}	dto.ErrorDto
+//	@Failure		403		{object}	dto.ErrorDto
+//	@Failure		404		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/users/{id} [put]
+func (cnt *AuthCtn) UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var body dto.UpdateUserDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid user: " + err.Error()})
+		return
+	}
+
+	user, err := cnt.AuthSrv.UpdateUser(app.Actor(c), uint(id), body.Password, model.Role(body.Role))
+	if cnt.userError(c, err, "Could not update user") {
+		return
+	}
+
+	var ret dto.UserDto
+	ret.FromModel(*user)
+	c.JSON(http.StatusOK, ret)
+}
+
+// DeleteUser godoc
+//
+//	@Summary		Delete user
+//	@Description	Deletes a dashboard user, their tokens stop working immediately. Admin only, the last admin can't be deleted.
+//	@Tags			Auth
+//	@Param			id	path	int	true	"User id"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		401	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/users/{id} [delete]
+func (cnt *AuthCtn) DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	err = cnt.AuthSrv.DeleteUser(app.Actor(c), uint(id))
+	if cnt.userError(c, err, "Could not delete user") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// userError writes the response of a failed user change, returns false if there is no error
+func (cnt *AuthCtn) userError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, cerror.ErrEmailTaken):
+		c.JSON(http.StatusConflict, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, cerror.ErrBadEmail), errors.Is(err, cerror.ErrWeakPassword),
+		errors.Is(err, cerror.ErrUnknownRole), errors.Is(err, cerror.ErrLastAdmin):
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "User not found"})
+	default:
+		cnt.Logger.Errorf("Service failed to change user: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: message})
+	}
+	return true
+}
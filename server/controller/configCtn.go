@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type ConfigCtn struct {
+	Logger    *zap.SugaredLogger
+	ConfigSrv service.IConfigService
+}
+
+// NewConfigCtn crates new controller with its dependencies
+func NewConfigCtn() app.Controller {
+	var controller *ConfigCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IConfigService) {
+		controller = &ConfigCtn{
+			Logger:    logger,
+			ConfigSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the runtime config endpoints.
+func (cnt *ConfigCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/config", cnt.GetConfig)
+	router.GET("/config/schema", cnt.GetConfigSchema)
+	router.PATCH("/config", app.RequireRole(model.RoleAdmin), cnt.UpdateConfig)
+}
+
+// GetConfig godoc
+//
+//	@Summary		Get runtime config
+//	@Description	Returns the settings the proxy currently runs with, stored settings override PROXY_URL and CAPTURE_BODY_LIMIT. The password of the upstream url is redacted.
+//	@Tags			Config
+//	@Produce		json
+//	@Success		200	{object}	model.RuntimeConfig
+//	@Router			/config [get]
+func (cnt *ConfigCtn) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, service.RedactedConfig(cnt.ConfigSrv.Runtime()))
+}
+
+// GetConfigSchema godoc
+//
+//	@Summary		Get runtime config schema
+//	@Description	Describes every runtime setting with its type and allowed range.
+//	@Tags			Config
+//	@Produce		json
+//	@Success		200	{array}	model.ConfigField
+//	@Router			/config/schema [get]
+func (cnt *ConfigCtn) GetConfigSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, model.RuntimeConfigSchema)
+}
+
+// UpdateConfig godoc
+//
+//	@Summary		Update runtime config
+//	@Description	Changes only the sent settings. Changes apply to the next proxied request, requests in flight finish with the old settings. An upstream url sent back with its password redacted keeps the stored password. Admin only.
+//	@Tags			Config
+//	@Accept			json
+//	@Produce		json
+//	@Param			config	body		model.RuntimeConfig	true	"Settings to change"
+//	@Success		200		{object}	model.RuntimeConfig
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		401		{object}	dto.ErrorDto
+//	@Failure		403		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/config [patch]
+func (cnt *ConfigCtn) UpdateConfig(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Could not read request body"})
+		return
+	}
+
+	config, err := cnt.ConfigSrv.Update(app.Actor(c), body)
+	if errors.Is(err, cerror.ErrBadConfig) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to update runtime config: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not update runtime config"})
+		return
+	}
+	c.JSON(http.StatusOK, service.RedactedConfig(*config))
+}
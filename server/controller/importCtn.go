@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ImportCtn struct {
+	Logger    *zap.SugaredLogger
+	ImportSrv service.IImportService
+}
+
+// NewImportCtn crates new controller with its dependencies
+func NewImportCtn() app.Controller {
+	var controller *ImportCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IImportService) {
+		controller = &ImportCtn{
+			Logger:    logger,
+			ImportSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the import endpoints.
+func (cnt *ImportCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.POST("/imports", cnt.CreateImport)
+	router.GET("/imports", cnt.ListImports)
+	router.GET("/imports/:id", cnt.GetImport)
+}
+
+// CreateImport godoc
+//
+//	@Summary		Import traffic
+//	@Description	Uploads a HAR 1.2 or NDJSON (as produced by the export endpoint) file and imports it into the request store as a background job.
+//	@Tags			Imports
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Traffic file"
+//	@Param			source	formData	string	true	"Source label the imported requests are tagged with"
+//	@Param			format		formData	string	false	"File format, guessed from the file extension if not set"	enums(har, ndjson)
+//	@Param			project_id	query		int		false	"Project the requests are imported into, the default project if not set"
+//	@Success		202			{object}	dto.ImportJobDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/imports [post]
+func (cnt *ImportCtn) CreateImport(c *gin.Context) {
+	var form dto.ImportForm
+	if err := c.ShouldBind(&form); err != nil {
+		cnt.Logger.Errorf("Failed to bind import form: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid form: " + err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Missing file"})
+		return
+	}
+
+	format := service.ImportFormat(form.Format)
+	if form.Format == "" {
+		format, err = service.ImportFormatFromFileName(fileHeader.Filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+			return
+		}
+	} else if format != service.ImportHar && format != service.ImportNdjson {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Unknown format, should be one of har, ndjson"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		cnt.Logger.Errorf("Failed to open uploaded file: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Could not read file"})
+		return
+	}
+	defer file.Close()
+
+	job, err := cnt.ImportSrv.Create(app.Actor(c), app.CurrentProjectID(c), form.Source, format, fileHeader.Filename, file)
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create import: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create import"})
+		return
+	}
+
+	var ret dto.ImportJobDto
+	ret.FromModel(*job)
+	c.JSON(http.StatusAccepted, ret)
+}
+
+// ListImports godoc
+//
+//	@Summary		List imports
+//	@Description	Lists the import jobs of the selected project with their progress, newest first.
+//	@Tags			Imports
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project of the imports, the default project if not set"
+//	@Success		200			{array}		dto.ImportJobDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/imports [get]
+func (cnt *ImportCtn) ListImports(c *gin.Context) {
+	jobs, err := cnt.ImportSrv.List(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list imports: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve imports"})
+		return
+	}
+
+	ret := make([]dto.ImportJobDto, len(jobs))
+	for i := range jobs {
+		ret[i].FromModel(jobs[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetImport godoc
+//
+//	@Summary		Get import
+//	@Description	Returns an import job of the selected project and its progress.
+//	@Tags			Imports
+//	@Produce		json
+//	@Param			id			path		int	true	"Import job id"
+//	@Param			project_id	query		int	false	"Project of the import, the default project if not set"
+//	@Success		200			{object}	dto.ImportJobDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/imports/{id} [get]
+func (cnt *ImportCtn) GetImport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	job, err := cnt.ImportSrv.Get(app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Import not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get import: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve import"})
+		return
+	}
+
+	var ret dto.ImportJobDto
+	ret.FromModel(*job)
+	c.JSON(http.StatusOK, ret)
+}
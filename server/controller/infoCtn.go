@@ -25,7 +25,10 @@ func NewInfoCnt() app.Controller {
 }
 
 // RegisterEndpoints registers the image manipulation endpoints.
-func (cnt *InfoCtn) RegisterEndpoints(router *gin.RouterGroup) {
+func (cnt *InfoCtn) RegisterEndpoints(router *gin.RouterGroup) {}
+
+// RegisterPublicEndpoints registers the endpoints reachable without a token, used for health checks.
+func (cnt *InfoCtn) RegisterPublicEndpoints(router *gin.RouterGroup) {
 	router.GET("/info", cnt.getServerInfo)
 }
 
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockCtn struct {
+	Logger  *zap.SugaredLogger
+	MockSrv service.IMockService
+}
+
+// NewMockCtn crates new controller with its dependencies
+func NewMockCtn() app.Controller {
+	var controller *MockCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IMockService) {
+		controller = &MockCtn{
+			Logger:  logger,
+			MockSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the mock route endpoints.
+func (cnt *MockCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/mock/routes", cnt.ListMockRoutes)
+	router.POST("/mock/routes", cnt.CreateMockRoute)
+	router.PUT("/mock/routes/:id", cnt.UpdateMockRoute)
+	router.DELETE("/mock/routes/:id", cnt.DeleteMockRoute)
+}
+
+// ListMockRoutes godoc
+//
+//	@Summary		List mock routes
+//	@Description	Lists the per route mock mode overrides of a project. Routes without an override use MOCK_MODE, MOCK_STRATEGY and MOCK_FALLBACK.
+//	@Tags			Mock
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project of the routes, the default project if not set"
+//	@Success		200	{array}		dto.MockRouteDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/mock/routes [get]
+func (cnt *MockCtn) ListMockRoutes(c *gin.Context) {
+	routes, err := cnt.MockSrv.ListRoutes(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list mock routes: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve mock routes"})
+		return
+	}
+
+	ret := make([]dto.MockRouteDto, len(routes))
+	for i := range routes {
+		ret[i].FromModel(routes[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateMockRoute godoc
+//
+//	@Summary		Create mock route
+//	@Description	Turns mock mode on or off for every proxied path under path. The most specific route wins, a route with a method wins over one without.
+//	@Tags			Mock
+//	@Accept			json
+//	@Produce		json
+//	@Param			route		body		dto.MockRouteDto	true	"Mock route"
+//	@Param			project_id	query		int					false	"Project of the route, the default project if not set"
+//	@Success		201		{object}	dto.MockRouteDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/mock/routes [post]
+func (cnt *MockCtn) CreateMockRoute(c *gin.Context) {
+	var body dto.MockRouteDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind mock route: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid mock route: " + err.Error()})
+		return
+	}
+
+	route := body.ToModel()
+	route.ProjectID = app.CurrentProjectID(c)
+	err := cnt.MockSrv.CreateRoute(app.Actor(c), &route)
+	if errors.Is(err, cerror.ErrUnknownMockStrategy) || errors.Is(err, cerror.ErrUnknownMockFallback) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create mock route: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create mock route"})
+		return
+	}
+
+	var ret dto.MockRouteDto
+	ret.FromModel(route)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateMockRoute godoc
+//
+//	@Summary		Update mock route
+//	@Description	Replaces a mock route, the change applies to the next proxied request.
+//	@Tags			Mock
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Mock route id"
+//	@Param			route		body		dto.MockRouteDto	true	"Mock route"
+//	@Param			project_id	query		int					false	"Project of the route, the default project if not set"
+//	@Success		200		{object}	dto.MockRouteDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		404		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/mock/routes/{id} [put]
+func (cnt *MockCtn) UpdateMockRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var body dto.MockRouteDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind mock route: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid mock route: " + err.Error()})
+		return
+	}
+
+	route := body.ToModel()
+	route.ID = uint(id)
+	route.ProjectID = app.CurrentProjectID(c)
+	err = cnt.MockSrv.UpdateRoute(app.Actor(c), &route)
+	if errors.Is(err, cerror.ErrUnknownMockStrategy) || errors.Is(err, cerror.ErrUnknownMockFallback) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Mock route not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to update mock route: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not update mock route"})
+		return
+	}
+
+	var ret dto.MockRouteDto
+	ret.FromModel(route)
+	c.JSON(http.StatusOK, ret)
+}
+
+// DeleteMockRoute godoc
+//
+//	@Summary		Delete mock route
+//	@Description	Deletes a mock route, its paths fall back to MOCK_MODE.
+//	@Tags			Mock
+//	@Param			id			path	int	true	"Mock route id"
+//	@Param			project_id	query	int	false	"Project of the route, the default project if not set"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/mock/routes/{id} [delete]
+func (cnt *MockCtn) DeleteMockRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	err = cnt.MockSrv.DeleteRoute(app.Actor(c), app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Mock route not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to delete mock route: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not delete mock route"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
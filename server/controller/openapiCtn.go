@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// _MAX_SPEC_SIZE is the max size of an uploaded api spec
+const _MAX_SPEC_SIZE = 10 << 20
+
+type OpenApiCtn struct {
+	Logger      *zap.SugaredLogger
+	InferSrv    service.IOpenApiInferenceService
+	ContractSrv service.IContractService
+}
+
+// NewOpenApiCtn crates new controller with its dependencies
+func NewOpenApiCtn() app.Controller {
+	var controller *OpenApiCtn
+	app.Invoke(func(logger *zap.SugaredLogger, inferSrv service.IOpenApiInferenceService, contractSrv service.IContractService) {
+		controller = &OpenApiCtn{
+			Logger:      logger,
+			InferSrv:    inferSrv,
+			ContractSrv: contractSrv,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the openapi endpoints.
+func (cnt *OpenApiCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/openapi/inferred", cnt.GetInferredSpec)
+	router.POST("/openapi/specs", cnt.UploadSpec)
+	router.GET("/openapi/specs", cnt.ListSpecs)
+	router.GET("/openapi/specs/:id", cnt.GetSpec)
+	router.GET("/openapi/specs/:id/report", cnt.GetSpecReport)
+	router.GET("/openapi/violations", cnt.ListViolations)
+}
+
+// GetInferredSpec godoc
+//
+//	@Summary		Get inferred OpenAPI document
+//	@Description	Returns an OpenAPI 3 document of the proxied API built from the recorded traffic of the selected project: endpoints, methods, query parameters, status codes and json schemas of request and response bodies. Requests recorded since the last call are merged in before returning.
+//	@Tags			OpenAPI
+//	@Produce		json
+//	@Success		200	{object}	object	"OpenAPI 3 document"
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/openapi/inferred [get]
+func (cnt *OpenApiCtn) GetInferredSpec(c *gin.Context) {
+	doc, err := cnt.InferSrv.Inferred(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to infer openapi document: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not infer openapi document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+// UploadSpec godoc
+//
+//	@Summary		Upload api spec
+//	@Description	Uploads a new version of the OpenAPI 3 spec of the project's upstream in json or yaml. Proxied requests and responses of the project are validated against its newest spec, with CONTRACT_ENFORCE requests violating it are rejected with 400.
+//	@Tags			OpenAPI
+//	@Accept			json
+//	@Accept			application/yaml
+//	@Produce		json
+//	@Param			spec		body		object	true	"OpenAPI 3 document"
+//	@Param			project_id	query		int		false	"Project of the spec, the default project if not set"
+//	@Success		201			{object}	dto.ApiSpecDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/openapi/specs [post]
+func (cnt *OpenApiCtn) UploadSpec(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, _MAX_SPEC_SIZE))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Could not read spec: " + err.Error()})
+		return
+	}
+
+	spec, err := cnt.ContractSrv.Upload(app.Actor(c), app.CurrentProjectID(c), data)
+	if errors.Is(err, cerror.ErrBadApiSpec) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to upload api spec: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not upload spec"})
+		return
+	}
+
+	var ret dto.ApiSpecDto
+	ret.FromModel(*spec)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// ListSpecs godoc
+//
+//	@Summary		List api specs
+//	@Description	Lists uploaded versions of the project's api spec, newest first. The newest one is used for validation.
+//	@Tags			OpenAPI
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project of the specs, the default project if not set"
+//	@Success		200			{array}		dto.ApiSpecDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/openapi/specs [get]
+func (cnt *OpenApiCtn) ListSpecs(c *gin.Context) {
+	specs, err := cnt.ContractSrv.Specs(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list api specs: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve specs"})
+		return
+	}
+
+	ret := make([]dto.ApiSpecDto, len(specs))
+	for i := range specs {
+		ret[i].FromModel(specs[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetSpec godoc
+//
+//	@Summary		Get api spec
+//	@Description	Returns an uploaded version of the project's api spec as json.
+//	@Tags			OpenAPI
+//	@Produce		json
+//	@Param			id			path		int		true	"Spec id"
+//	@Param			project_id	query		int		false	"Project of the spec, the default project if not set"
+//	@Success		200			{object}	object	"OpenAPI 3 document"
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/openapi/specs/{id} [get]
+func (cnt *OpenApiCtn) GetSpec(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	spec, err := cnt.ContractSrv.Spec(app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Spec not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get api spec: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve spec"})
+		return
+	}
+
+	c.JSON(http.StatusOK, json.RawMessage(spec.Document))
+}
+
+// GetSpecReport godoc
+//
+//	@Summary		Breaking change report
+//	@Description	Compares an uploaded spec version to the previous one of its project and to the traffic of the selected project recorded since start_time (default last 7 days). Reports removed endpoints still receiving traffic, new required parameters that callers don't send and changed response shapes, with the number of recorded calls that would break.
+//	@Tags			OpenAPI
+//	@Produce		json
+//	@Param			id			path		int		true	"Spec id"
+//	@Param			start_time	query		string	false	"Start of the checked traffic (RFC3339 format, e.g., 2023-10-26T00:00:00Z)"	format(date-time)
+//	@Param			project_id	query		int		false	"Project of the spec, the default project if not set"
+//	@Success		200			{object}	dto.BreakingChangeReportDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/openapi/specs/{id}/report [get]
+func (cnt *OpenApiCtn) GetSpecReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var since time.Time
+	if startTimeStr := c.Query("start_time"); startTimeStr != "" {
+		since, err = time.Parse(time.RFC3339, startTimeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid start_time format. Use RFC3339 (e.g., 2023-10-26T00:00:00Z)"})
+			return
+		}
+	}
+
+	report, err := cnt.ContractSrv.Report(app.CurrentProjectID(c), uint(id), since)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Spec not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to build breaking change report: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not build report"})
+		return
+	}
+
+	var ret dto.BreakingChangeReportDto
+	ret.FromModel(*report)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ListViolations godoc
+//
+//	@Summary		List contract violations
+//	@Description	Lists violations of the api spec found in proxied requests and responses of the selected project, newest first.
+//	@Tags			OpenAPI
+//	@Produce		json
+//	@Param			request_id	query		int		false	"Filter by request id"
+//	@Param			kind		query		string	false	"Filter by kind"	Enums(unknown_endpoint, bad_parameter, bad_request_body, bad_request, bad_response_body, undocumented_status)
+//	@Param			endpoint	query		string	false	"Filter by spec endpoint, e.g. /users/{id}"
+//	@Param			limit		query		int		false	"Pagination limit"	default(20)
+//	@Param			offset		query		int		false	"Pagination offset"
+//	@Success		200			{object}	dto.ViolationsDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/openapi/violations [get]
+func (cnt *OpenApiCtn) ListViolations(c *gin.Context) {
+	var q dto.ViolationsQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid query parameters: " + err.Error()})
+		return
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	params := service.ViolationsParams{ProjectID: app.CurrentProjectID(c), Limit: q.Limit, Offset: q.Offset}
+	if q.RequestID != 0 {
+		params.RequestID = &q.RequestID
+	}
+	if q.Kind != "" {
+		params.Kind = &q.Kind
+	}
+	if q.Endpoint != "" {
+		params.Endpoint = &q.Endpoint
+	}
+
+	violations, total, err := cnt.ContractSrv.Violations(params)
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list violations: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve violations"})
+		return
+	}
+
+	ret := dto.ViolationsDto{
+		Data: make([]dto.ViolationDto, len(violations)),
+		Pagination: dto.Pagination{
+			Total:  total,
+			Limit:  q.Limit,
+			Offset: q.Offset,
+		},
+	}
+	for i := range violations {
+		ret.Data[i].FromModel(violations[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
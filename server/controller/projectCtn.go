@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ProjectCtn struct {
+	Logger     *zap.SugaredLogger
+	ProjectSrv service.IProjectService
+}
+
+// NewProjectCtn crates new controller with its dependencies
+func NewProjectCtn() app.Controller {
+	var controller *ProjectCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IProjectService) {
+		controller = &ProjectCtn{
+			Logger:     logger,
+			ProjectSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the project endpoints, everything but listing is admin only.
+func (cnt *ProjectCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/projects", cnt.ListProjects)
+
+	admin := router.Group("/projects", app.RequireRole(model.RoleAdmin))
+	admin.POST("", cnt.CreateProject)
+	admin.PUT("/:id", cnt.UpdateProject)
+	admin.POST("/:id/ingestion-key", cnt.RotateIngestionKey)
+	admin.GET("/:id/members", cnt.ListProjectMembers)
+	admin.POST("/:id/members", cnt.AddProjectMember)
+	admin.DELETE("/:id/members/:userId", cnt.RemoveProjectMember)
+}
+
+// ListProjects godoc
+//
+//	@Summary		List projects
+//	@Description	Lists the projects the caller can read, admins see every project. Project 0 is the default project, it gets the traffic without an ingestion key or project prefix and is sent to PROXY_URL. Select a project in other endpoints with the project_id query or the X-Project-Id header.
+//	@Tags			Project
+//	@Produce		json
+//	@Success		200	{array}		dto.ProjectDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/projects [get]
+func (cnt *ProjectCtn) ListProjects(c *gin.Context) {
+	projects, err := cnt.ProjectSrv.List(app.CurrentUser(c), app.CurrentApiKey(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list projects: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve projects"})
+		return
+	}
+
+	ret := make([]dto.ProjectDto, len(projects))
+	for i := range projects {
+		ret[i].FromModel(projects[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateProject godoc
+//
+//	@Summary		Create project
+//	@Description	Creates a project, its traffic is proxied from /proxy/<slug>/ or from any /proxy path with the returned ingestion key in the X-Project-Key header. The key is only returned once. A slug the default project has traffic under is rejected, its requests would go to the new project.
+//	@Tags			Project
+//	@Accept			json
+//	@Produce		json
+//	@Param			project	body		dto.ProjectDto	true	"Project"
+//	@Success		201		{object}	dto.IngestionKeyDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		409		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/projects [post]
+func (cnt *ProjectCtn) CreateProject(c *gin.Context) {
+	var body dto.ProjectDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid project: " + err.Error()})
+		return
+	}
+
+	project := body.ToModel()
+	key, err := cnt.ProjectSrv.Create(app.Actor(c), &project)
+	if cnt.projectError(c, err, "Could not create project") {
+		return
+	}
+
+	ret := dto.IngestionKeyDto{IngestionKey: key}
+	ret.FromModel(project)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateProject godoc
+//
+//	@Summary		Update project
+//	@Description	Changes the name, slug or upstream of a project, the ingestion key is kept. The default project is configured with PROXY_URL. A new slug the default project has traffic under is rejected.
+//	@Tags			Project
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Project id"
+//	@Param			project	body		dto.ProjectDto	true	"Project"
+//	@Success		200		{object}	dto.ProjectDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		404		{object}	dto.ErrorDto
+//	@Failure		409		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/projects/{id} [put]
+func (cnt *ProjectCtn) UpdateProject(c *gin.Context) {
+	id, ok := cnt.id(c, "id")
+	if !ok {
+		return
+	}
+
+	var body dto.ProjectDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid project: " + err.Error()})
+		return
+	}
+
+	project := body.ToModel()
+	project.ID = id
+	err := cnt.ProjectSrv.Update(app.Actor(c), &project)
+	if cnt.projectError(c, err, "Could not update project") {
+		return
+	}
+
+	var ret dto.ProjectDto
+	ret.FromModel(project)
+	c.JSON(http.StatusOK, ret)
+}
+
+// RotateIngestionKey godoc
+//
+//	@Summary		Rotate ingestion key
+//	@Description	Replaces the ingestion key of a project, the old key stops working immediately.
+//	@Tags			Project
+//	@Produce		json
+//	@Param			id	path		int	true	"Project id"
+//	@Success		200	{object}	dto.IngestionKeyDto
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/projects/{id}/ingestion-key [post]
+func (cnt *ProjectCtn) RotateIngestionKey(c *gin.Context) {
+	id, ok := cnt.id(c, "id")
+	if !ok {
+		return
+	}
+
+	key, err := cnt.ProjectSrv.RotateIngestionKey(app.Actor(c), id)
+	if cnt.projectError(c, err, "Could not rotate ingestion key") {
+		return
+	}
+	project, err := cnt.ProjectSrv.Get(id)
+	if cnt.projectError(c, err, "Could not rotate ingestion key") {
+		return
+	}
+
+	ret := dto.IngestionKeyDto{IngestionKey: key}
+	ret.FromModel(*project)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ListProjectMembers godoc
+//
+//	@Summary		List project members
+//	@Description	Lists the users that can read a project besides the admins.
+//	@Tags			Project
+//	@Produce		json
+//	@Param			id	path		int	true	"Project id"
+//	@Success		200	{array}		dto.UserDto
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/projects/{id}/members [get]
+func (cnt *ProjectCtn) ListProjectMembers(c *gin.Context) {
+	id, ok := cnt.id(c, "id")
+	if !ok {
+		return
+	}
+
+	users, err := cnt.ProjectSrv.ListMembers(id)
+	if cnt.projectError(c, err, "Could not retrieve project members") {
+		return
+	}
+
+	ret := make([]dto.UserDto, len(users))
+	for i := range users {
+		ret[i].FromModel(users[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// AddProjectMember godoc
+//
+//	@Summary		Add project member
+//	@Description	Lets a user read a project, every user can read the default project.
+//	@Tags			Project
+//	@Accept			json
+//	@Param			id		path	int						true	"Project id"
+//	@Param			member	body	dto.ProjectMemberDto	true	"Member"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/projects/{id}/members [post]
+func (cnt *ProjectCtn) AddProjectMember(c *gin.Context) {
+	id, ok := cnt.id(c, "id")
+	if !ok {
+		return
+	}
+
+	var body dto.ProjectMemberDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid member: " + err.Error()})
+		return
+	}
+
+	err := cnt.ProjectSrv.AddMember(app.Actor(c), id, body.UserID)
+	if cnt.projectError(c, err, "Could not add project member") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveProjectMember godoc
+//
+//	@Summary		Remove project member
+//	@Description	Stops a user from reading a project.
+//	@Tags			Project
+//	@Param			id		path	int	true	"Project id"
+//	@Param			userId	path	int	true	"User id"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/projects/{id}/members/{userId} [delete]
+func (cnt *ProjectCtn) RemoveProjectMember(c *gin.Context) {
+	id, ok := cnt.id(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := cnt.id(c, "userId")
+	if !ok {
+		return
+	}
+
+	err := cnt.ProjectSrv.RemoveMember(app.Actor(c), id, userID)
+	if cnt.projectError(c, err, "Could not remove project member") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// id parses an id path parameter, it writes a 400 response if it isn't a number
+func (cnt *ProjectCtn) id(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// projectError writes the response of a failed project change, returns false if there is no error
+func (cnt *ProjectCtn) projectError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, cerror.ErrProjectSlugTaken), errors.Is(err, cerror.ErrProjectSlugRouted):
+		c.JSON(http.StatusConflict, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, cerror.ErrBadProjectSlug), errors.Is(err, cerror.ErrBadTargetUrl):
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Project or user not found"})
+	default:
+		cnt.Logger.Errorf("Service failed to change project: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: message})
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RateLimitCtn struct {
+	Logger       *zap.SugaredLogger
+	RateLimitSrv service.IRateLimitService
+}
+
+// NewRateLimitCtn crates new controller with its dependencies
+func NewRateLimitCtn() app.Controller {
+	var controller *RateLimitCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IRateLimitService) {
+		controller = &RateLimitCtn{
+			Logger:       logger,
+			RateLimitSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the rate limit rule endpoints.
+func (cnt *RateLimitCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/rate-limits", cnt.ListRateLimitRules)
+	router.POST("/rate-limits", cnt.CreateRateLimitRule)
+	router.PUT("/rate-limits/:id", cnt.UpdateRateLimitRule)
+	router.DELETE("/rate-limits/:id", cnt.DeleteRateLimitRule)
+}
+
+// ListRateLimitRules godoc
+//
+//	@Summary		List rate limit rules
+//	@Description	Lists the per route rate limits. Routes without a rule use RATE_LIMIT, RATE_LIMIT_WINDOW, RATE_LIMIT_ALGORITHM and RATE_LIMIT_KEY.
+//	@Tags			RateLimit
+//	@Produce		json
+//	@Success		200	{array}		dto.RateLimitRuleDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/rate-limits [get]
+func (cnt *RateLimitCtn) ListRateLimitRules(c *gin.Context) {
+	rules, err := cnt.RateLimitSrv.ListRules()
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list rate limit rules: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve rate limit rules"})
+		return
+	}
+
+	ret := make([]dto.RateLimitRuleDto, len(rules))
+	for i := range rules {
+		ret[i].FromModel(rules[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateRateLimitRule godoc
+//
+//	@Summary		Create rate limit rule
+//	@Description	Limits every proxied path under path, a disabled rule exempts the paths from the default limit. The most specific rule wins, a rule with a method wins over one without. Requests over the limit get 429 with Retry-After and RateLimit-* headers.
+//	@Tags			RateLimit
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule	body		dto.RateLimitRuleDto	true	"Rate limit rule"
+//	@Success		201		{object}	dto.RateLimitRuleDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/rate-limits [post]
+func (cnt *RateLimitCtn) CreateRateLimitRule(c *gin.Context) {
+	var body dto.RateLimitRuleDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind rate limit rule: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid rate limit rule: " + err.Error()})
+		return
+	}
+
+	rule := body.ToModel()
+	err := cnt.RateLimitSrv.CreateRule(app.Actor(c), &rule)
+	if isRateLimitRuleError(err) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create rate limit rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create rate limit rule"})
+		return
+	}
+
+	var ret dto.RateLimitRuleDto
+	ret.FromModel(rule)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateRateLimitRule godoc
+//
+//	@Summary		Update rate limit rule
+//	@Description	Replaces a rate limit rule, the change applies to the next proxied request.
+//	@Tags			RateLimit
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Rate limit rule id"
+//	@Param			rule	body		dto.RateLimitRuleDto	true	"Rate limit rule"
+//	@Success		200		{object}	dto.RateLimitRuleDto
+//	@Failure		400		{object}	dto.ErrorDto
+//	@Failure		404		{object}	dto.ErrorDto
+//	@Failure		500		{object}	dto.ErrorDto
+//	@Router			/rate-limits/{id} [put]
+func (cnt *RateLimitCtn) UpdateRateLimitRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var body dto.RateLimitRuleDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind rate limit rule: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid rate limit rule: " + err.Error()})
+		return
+	}
+
+	rule := body.ToModel()
+	rule.ID = uint(id)
+	err = cnt.RateLimitSrv.UpdateRule(app.Actor(c), &rule)
+	if isRateLimitRuleError(err) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Rate limit rule not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to update rate limit rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not update rate limit rule"})
+		return
+	}
+
+	var ret dto.RateLimitRuleDto
+	ret.FromModel(rule)
+	c.JSON(http.StatusOK, ret)
+}
+
+// DeleteRateLimitRule godoc
+//
+//	@Summary		Delete rate limit rule
+//	@Description	Deletes a rate limit rule, its paths fall back to the default limit.
+//	@Tags			RateLimit
+//	@Param			id	path	int	true	"Rate limit rule id"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/rate-limits/{id} [delete]
+func (cnt *RateLimitCtn) DeleteRateLimitRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	err = cnt.RateLimitSrv.DeleteRule(app.Actor(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Rate limit rule not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to delete rate limit rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not delete rate limit rule"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// isRateLimitRuleError reports if err is caused by an invalid rule
+func isRateLimitRuleError(err error) bool {
+	return errors.Is(err, cerror.ErrUnknownRateLimitAlgorithm) ||
+		errors.Is(err, cerror.ErrUnknownRateLimitKey) ||
+		errors.Is(err, cerror.ErrBadRateLimitRule)
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ReplayCtn struct {
+	Logger    *zap.SugaredLogger
+	ReplaySrv service.IReplayService
+}
+
+// NewReplayCtn crates new controller with its dependencies
+func NewReplayCtn() app.Controller {
+	var controller *ReplayCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IReplayService) {
+		controller = &ReplayCtn{
+			Logger:    logger,
+			ReplaySrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the replay endpoints.
+func (cnt *ReplayCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.POST("/replays", cnt.CreateReplay)
+	router.GET("/replays", cnt.ListReplays)
+	router.GET("/replays/:id", cnt.GetReplay)
+	router.GET("/replays/:id/results", cnt.ListReplayResults)
+}
+
+// CreateReplay godoc
+//
+//	@Summary		Replay recorded traffic
+//	@Description	Replays recorded requests of the selected project chosen by ids or by a filter against a target url as a background job. Requests are sent in the order they were recorded, optionally keeping the original timing or capped to a rate.
+//	@Tags			Replays
+//	@Accept			json
+//	@Produce		json
+//	@Param			replay		body		dto.CreateReplayDto	true	"Replay definition"
+//	@Param			project_id	query		int					false	"Project of the replayed requests, the default project if not set"
+//	@Success		202			{object}	dto.ReplayDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/replays [post]
+func (cnt *ReplayCtn) CreateReplay(c *gin.Context) {
+	var body dto.CreateReplayDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind replay: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid replay: " + err.Error()})
+		return
+	}
+
+	selection := service.ReplaySelection{
+		IDs:   body.RequestIDs,
+		Limit: body.Limit,
+	}
+	if f := body.Filter; f != nil {
+		if f.Search != "" {
+			selection.Search = &f.Search
+		}
+		if f.Method != "" {
+			selection.Method = &f.Method
+		}
+		if f.Response != 0 {
+			selection.Response = &f.Response
+		}
+		if f.Source != "" {
+			selection.Source = &f.Source
+		}
+	}
+
+	replay, err := cnt.ReplaySrv.Create(app.Actor(c), app.CurrentProjectID(c), body.TargetUrl, selection, body.PreserveTiming, body.RateLimit)
+	if errors.Is(err, cerror.ErrBadTargetUrl) || errors.Is(err, cerror.ErrBadRateLimit) || errors.Is(err, cerror.ErrBadSearch) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create replay: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create replay"})
+		return
+	}
+
+	var ret dto.ReplayDto
+	ret.FromModel(*replay)
+	c.JSON(http.StatusAccepted, ret)
+}
+
+// ListReplays godoc
+//
+//	@Summary		List replays
+//	@Description	Lists the replays of the selected project with their progress, newest first.
+//	@Tags			Replays
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project of the replays, the default project if not set"
+//	@Success		200			{array}		dto.ReplayDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/replays [get]
+func (cnt *ReplayCtn) ListReplays(c *gin.Context) {
+	replays, err := cnt.ReplaySrv.List(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list replays: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve replays"})
+		return
+	}
+
+	ret := make([]dto.ReplayDto, len(replays))
+	for i := range replays {
+		ret[i].FromModel(replays[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetReplay godoc
+//
+//	@Summary		Get replay
+//	@Description	Returns a replay of the selected project with its progress and diff counters.
+//	@Tags			Replays
+//	@Produce		json
+//	@Param			id			path		int	true	"Replay id"
+//	@Param			project_id	query		int	false	"Project of the replay, the default project if not set"
+//	@Success		200			{object}	dto.ReplayDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/replays/{id} [get]
+func (cnt *ReplayCtn) GetReplay(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	replay, err := cnt.ReplaySrv.Get(app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Replay not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get replay: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve replay"})
+		return
+	}
+
+	var ret dto.ReplayDto
+	ret.FromModel(*replay)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ListReplayResults godoc
+//
+//	@Summary		List replay results
+//	@Description	Returns the per request diff between the original and the replayed response (status, latency, body hash) of a replay of the selected project.
+//	@Tags			Replays
+//	@Produce		json
+//	@Param			id			path		int		true	"Replay id"
+//	@Param			only_diffs	query		bool	false	"Return only results that differ from the original"
+//	@Param			limit		query		int		false	"Pagination limit"	default(20)
+//	@Param			offset		query		int		false	"Pagination offset"
+//	@Param			project_id	query		int		false	"Project of the replay, the default project if not set"
+//	@Success		200			{object}	dto.ReplayResultsDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/replays/{id}/results [get]
+func (cnt *ReplayCtn) ListReplayResults(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var q dto.ReplayResultsQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid query parameters: " + err.Error()})
+		return
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	results, total, err := cnt.ReplaySrv.Results(app.CurrentProjectID(c), uint(id), q.OnlyDiffs, q.Limit, q.Offset)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Replay not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list replay results: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve replay results"})
+		return
+	}
+
+	ret := dto.ReplayResultsDto{
+		Data: make([]dto.ReplayResultDto, len(results)),
+		Pagination: dto.Pagination{
+			Total:  total,
+			Limit:  q.Limit,
+			Offset: q.Offset,
+		},
+	}
+	for i := range results {
+		ret.Data[i].FromModel(results[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
@@ -1,30 +1,37 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 	"treblle/app"
 	"treblle/dto"
+	"treblle/model"
 	"treblle/service"
+	"treblle/util/cerror"
 	"treblle/util/ws"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type RequestCtn struct {
 	Logger  *zap.SugaredLogger
 	CrudSrv service.IRequestCrudService
+	ViewSrv service.IViewService
 	Hub     *ws.Hub
 }
 
 // NewRequestCtn crates new controller with its sependencies
 func NewRequestCtn() app.Controller {
 	var controller *RequestCtn
-	app.Invoke(func(logger *zap.SugaredLogger, service service.IRequestCrudService) {
+	app.Invoke(func(logger *zap.SugaredLogger, service service.IRequestCrudService, viewSrv service.IViewService) {
 		controller = &RequestCtn{
 			Logger:  logger,
 			CrudSrv: service,
+			ViewSrv: viewSrv,
 		}
 	})
 	return controller
@@ -34,6 +41,9 @@ func NewRequestCtn() app.Controller {
 func (cnt *RequestCtn) RegisterEndpoints(router *gin.RouterGroup) {
 	router.GET("/requests", cnt.ListRequests)
 	router.GET("/requests/statistics", cnt.GetRequestStatistics)
+	router.GET("/requests/consumers", cnt.GetTopConsumers)
+	router.GET("/requests/export", cnt.ExportRequests)
+	router.GET("/requests/:id", cnt.GetRequest)
 	router.GET("/ws/requests/statistics", cnt.serveChartWs)
 }
 
@@ -44,13 +54,16 @@ func (cnt *RequestCtn) RegisterEndpoints(router *gin.RouterGroup) {
 //	@Tags			Requests
 //	@Accept			json
 //	@Produce		json
-//	@Param			search		query		string	false	"Search term for request path"
+//	@Param			search		query		string	false	"Search query, e.g. status:5xx latency:>500ms body:timeout, or text in the path"
 //	@Param			method		query		string	false	"Filter by HTTP method (e.Example, GET, POST)"	enums(GET, POST, PUT, DELETE, PATCH, HEAD, OPTION, TRACE,CONNECT)
 //	@Param			response	query		int		false	"Filter by response status code (e.Example, 200, 404)"
+//	@Param			source		query		string	false	"Filter by source label (proxy or an import label)"
+//	@Param			consumer	query		string	false	"Filter by consumer"
 //	@Param			limit		query		int		false	"Pagination limit"	default(20)
 //	@Param			offset		query		int		false	"Pagination offset"
 //	@Param			sort_by		query		string	false	"Sort by field (created_at or response_time)"	enums(created_at, response_time, latency)
 //	@Param			order		query		string	false	"Sort order (asc or desc)"						enums(asc, desc)
+//	@Param			project_id	query	int	false	"Project to read, the default project if not set"
 //	@Success		200			{object}	dto.ResDataDto
 //	@Failure		400			{object}	dto.ErrorDto
 //	@Failure		500			{object}	dto.ErrorDto
@@ -71,36 +84,13 @@ func (cnt *RequestCtn) ListRequests(c *gin.Context) {
 		q.Offset = 0
 	}
 
-	// TODO: add sart and end date
-	params := service.ListRequestsParams{
-		Limit:  q.Limit,
-		Offset: q.Offset,
-		Order:  q.Order,
-	}
-
-	if q.Search != "" {
-		params.Search = &q.Search
-	}
-
-	switch q.SortBy {
-	case "createdAt":
-		params.SortBy = "created_at"
-	case "responseTime":
-		params.SortBy = "response_time"
-	default:
-		params.SortBy = q.SortBy
-	}
-
-	if q.Method != "" {
-		params.Method = &q.Method
-	}
-	// 'response' is an int. If it's '0', it's likely not set by the user.
-	// Adjust this logic if '0' is a valid response code you want to filter by.
-	if q.Response != 0 {
-		params.Response = &q.Response
-	}
+	params := listParams(app.CurrentProjectID(c), q)
 
 	requests, total, err := cnt.CrudSrv.List(params)
+	if errors.Is(err, cerror.ErrBadSearch) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		cnt.Logger.Errorf("Service failed to list requests: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve requests"})
@@ -123,6 +113,123 @@ func (cnt *RequestCtn) ListRequests(c *gin.Context) {
 	})
 }
 
+// GetRequest godoc
+//
+//	@Summary		Get API request
+//	@Description	Returns a recorded API request with its captured headers and bodies, which the list leaves out.
+//	@Tags			Requests
+//	@Produce		json
+//	@Param			id			path		int	true	"Request id"
+//	@Param			project_id	query		int	false	"Project to read, the default project if not set"
+//	@Success		200			{object}	dto.RequestExportDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/requests/{id} [get]
+func (cnt *RequestCtn) GetRequest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	request, err := cnt.CrudSrv.Get(app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Request not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get request: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve request"})
+		return
+	}
+
+	var ret dto.RequestExportDto
+	ret.FromModel(*request)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ExportRequests godoc
+//
+//	@Summary		Export API requests
+//	@Description	Streams all recorded API requests matching the ListRequests filters as CSV, NDJSON or HAR 1.2, including captured headers and bodies.
+//	@Tags			Requests
+//	@Produce		text/csv
+//	@Produce		application/x-ndjson
+//	@Produce		json
+//	@Param			format		query	string	false	"Export format"	enums(csv, ndjson, har)	default(ndjson)
+//	@Param			search		query	string	false	"Search query, e.g. status:5xx latency:>500ms body:timeout, or text in the path"
+//	@Param			method		query	string	false	"Filter by HTTP method (e.Example, GET, POST)"	enums(GET, POST, PUT, DELETE, PATCH, HEAD, OPTION, TRACE,CONNECT)
+//	@Param			response	query	int		false	"Filter by response status code (e.Example, 200, 404)"
+//	@Param			source		query	string	false	"Filter by source label (proxy or an import label)"
+//	@Param			consumer	query	string	false	"Filter by consumer"
+//	@Param			limit		query	int		false	"Max number of exported requests, all if not set"
+//	@Param			offset		query	int		false	"Pagination offset"
+//	@Param			sort_by		query	string	false	"Sort by field (created_at or response_time)"	enums(created_at, response_time, latency)
+//	@Param			order		query	string	false	"Sort order (asc or desc)"						enums(asc, desc)
+//	@Param			project_id	query	int	false	"Project to read, the default project if not set"
+//	@Success		200
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/requests/export [get]
+func (cnt *RequestCtn) ExportRequests(c *gin.Context) {
+	var q dto.ExportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		cnt.Logger.Errorf("Failed to bind query params: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid query parameters: " + err.Error()})
+		return
+	}
+	if q.Format == "" {
+		q.Format = string(service.ExportNdjson)
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	format := service.ExportFormat(q.Format)
+	exporter, err := service.NewRequestExporter(format, c.Writer, app.ProxyUrl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	// the search is checked before the response starts
+	if _, err := service.ParseSearch(q.Search); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+
+	// Exports can take longer than the server write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		cnt.Logger.Warnf("Failed to clear write deadline for export: %v", err)
+	}
+
+	// No Content-Length is set so the response is sent with chunked transfer encoding
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="requests.`+q.Format+`"`)
+	c.Status(http.StatusOK)
+
+	err = exporter.Begin()
+	if err == nil {
+		err = cnt.CrudSrv.Stream(listParams(app.CurrentProjectID(c), q.ListQuery), func(request *model.Request) error {
+			if err := exporter.Write(request); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		})
+	}
+	if err == nil {
+		err = exporter.End()
+	}
+	if err != nil {
+		// Headers are already sent, the client will receive a truncated file
+		cnt.Logger.Errorf("Failed to export requests: %v", err)
+		c.Abort()
+		return
+	}
+	c.Writer.Flush()
+}
+
 // GetRequestStatistics godoc
 //
 //	@Summary		Get request statistics
@@ -132,23 +239,109 @@ func (cnt *RequestCtn) ListRequests(c *gin.Context) {
 //	@Produce		json
 //	@Param			start_time	query		string					false	"Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)"	format(date-time)
 //	@Param			end_time	query		string					false	"End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)"	format(date-time)
+//	@Param			consumer	query		string					false	"Only aggregate the requests of one consumer"
+//	@Param			project_id	query	int	false	"Project to read, the default project if not set"
 //	@Success		200			{object}	dto.RequestStatistics	"Aggregated statistics per path"
 //	@Failure		400			{object}	dto.ErrorDto
 //	@Failure		500			{object}	dto.ErrorDto
 //	@Router			/requests/statistics [get]
 func (cnt *RequestCtn) GetRequestStatistics(c *gin.Context) {
+	startTimePtr, endTimePtr, ok := timeRange(c, cnt.Logger)
+	if !ok {
+		return
+	}
+
+	// Call the service
+	var stats *model.AllRequestStatistics
+	var err error
+	if consumer := c.Query("consumer"); consumer != "" {
+		stats, err = cnt.CrudSrv.GetConsumerStatistics(app.CurrentProjectID(c), consumer, startTimePtr, endTimePtr)
+	} else {
+		stats, err = cnt.CrudSrv.GetStatistics(app.CurrentProjectID(c), startTimePtr, endTimePtr)
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get request statistics: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve request statistics"})
+		return
+	}
+	var ret dto.RequestStatistics
+	ret.FromModel(stats)
+
+	// Return the statistics
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetTopConsumers godoc
+//
+//	@Summary		Top API consumers
+//	@Description	Get the consumers generating the most requests, errors or latency. Consumers are identified by CONSUMER_SOURCES, api keys are shown as a fingerprint.
+//	@Tags			Requests
+//	@Produce		json
+//	@Param			start_time	query		string	false	"Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)"	format(date-time)
+//	@Param			end_time	query		string	false	"End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)"	format(date-time)
+//	@Param			sort_by		query		string	false	"Rank consumers by"	enums(requests, errors, latency)	default(requests)
+//	@Param			limit		query		int		false	"Number of consumers"	default(10)
+//	@Param			project_id	query	int	false	"Project to read, the default project if not set"
+//	@Success		200			{array}		dto.ConsumerStatistics
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/requests/consumers [get]
+func (cnt *RequestCtn) GetTopConsumers(c *gin.Context) {
+	startTimePtr, endTimePtr, ok := timeRange(c, cnt.Logger)
+	if !ok {
+		return
+	}
+
+	params := service.TopConsumersParams{
+		ProjectID: app.CurrentProjectID(c),
+		StartTime: startTimePtr,
+		EndTime:   endTimePtr,
+		SortBy:    c.DefaultQuery("sort_by", "requests"),
+		Limit:     10,
+	}
+	switch params.SortBy {
+	case "requests", "errors", "latency":
+	default:
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid sort_by, should be one of requests, errors, latency"})
+		return
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid limit"})
+			return
+		}
+		params.Limit = limit
+	}
+
+	consumers, err := cnt.CrudSrv.TopConsumers(params)
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get top consumers: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve consumers"})
+		return
+	}
+
+	ret := make([]dto.ConsumerStatistics, len(consumers))
+	for i := range consumers {
+		ret[i].FromModel(consumers[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// timeRange parses the optional start_time and end_time query parameters,
+// on invalid input it writes the error response and returns false
+func timeRange(c *gin.Context, logger *zap.SugaredLogger) (*time.Time, *time.Time, bool) {
 	var startTimePtr *time.Time
 	var endTimePtr *time.Time
-	var err error
 
 	// Parse optional start_time
 	startTimeStr := c.Query("start_time")
 	if startTimeStr != "" {
 		parsedTime, err := time.Parse(time.RFC3339, startTimeStr)
 		if err != nil {
-			cnt.Logger.Warnf("Invalid start_time format: %v", err)
+			logger.Warnf("Invalid start_time format: %v", err)
 			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid start_time format. Use RFC3339 (e.g., 2023-10-26T00:00:00Z)"})
-			return
+			return nil, nil, false
 		}
 		startTimePtr = &parsedTime
 	}
@@ -158,9 +351,9 @@ func (cnt *RequestCtn) GetRequestStatistics(c *gin.Context) {
 	if endTimeStr != "" {
 		parsedTime, err := time.Parse(time.RFC3339, endTimeStr)
 		if err != nil {
-			cnt.Logger.Warnf("Invalid end_time format: %v", err)
+			logger.Warnf("Invalid end_time format: %v", err)
 			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid end_time format. Use RFC3339 (e.g., 2023-10-26T23:59:59Z)"})
-			return
+			return nil, nil, false
 		}
 		endTimePtr = &parsedTime
 	}
@@ -168,32 +361,44 @@ func (cnt *RequestCtn) GetRequestStatistics(c *gin.Context) {
 	// Validate time range if both are provided
 	if startTimePtr != nil && endTimePtr != nil && startTimePtr.After(*endTimePtr) {
 		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "start_time cannot be after end_time"})
-		return
-	}
-
-	// Call the service
-	stats, err := cnt.CrudSrv.GetStatistics(startTimePtr, endTimePtr)
-	if err != nil {
-		cnt.Logger.Errorf("Service failed to get request statistics: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve request statistics"})
-		return
+		return nil, nil, false
 	}
-	var ret dto.RequestStatistics
-	ret.FromModel(stats)
-
-	// Return the statistics
-	c.JSON(http.StatusOK, ret)
+	return startTimePtr, endTimePtr, true
 }
 
 // serveChartWs godoc
 //
 //	@Summary		web socket for streaming chart data
-//	@Description	Web socket
+//	@Description	Web socket, browsers pass the bearer token in the access_token query. Origins other than the server need to be in ALLOWED_ORIGINS.
+//	@Description	With view_id only the requests matching the filters of a saved view are counted, the stream covers the time since the last update instead of the view's time range.
 //	@Tags			chart
 //	@Produce		json
+//	@Param			project_id	query	int	false	"Project to read, the default project if not set"
+//	@Param			view_id		query	int	false	"Saved view to filter the statistics by"
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
 //	@Failure		500
 //	@Router			/ws/requests/statistics [get]
 func (cnt *RequestCtn) serveChartWs(c *gin.Context) {
+	var view *model.View
+	if viewID := c.Query("view_id"); viewID != "" {
+		id, err := strconv.ParseUint(viewID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid view_id"})
+			return
+		}
+		view, err = cnt.ViewSrv.Get(app.CurrentProjectID(c), app.CurrentUser(c), uint(id))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "View not found"})
+			return
+		}
+		if err != nil {
+			cnt.Logger.Errorf("Service failed to get view: %v", err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve view"})
+			return
+		}
+	}
+
 	conn, err := ws.Upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		cnt.Logger.Errorf("Failed to upgrade connection: %v", err)
@@ -202,8 +407,48 @@ func (cnt *RequestCtn) serveChartWs(c *gin.Context) {
 	}
 
 	// crate new lobby
-	cnt.Hub = &service.NewLobby().Hub
+	cnt.Hub = &service.NewLobby(app.CurrentProjectID(c), view).Hub
 
 	// if lobby exists add new connection
 	ws.NewClient(cnt.Hub, conn)
 }
+
+// listParams maps ListRequests query parameters of a project to service parameters
+func listParams(projectID uint, q dto.ListQuery) service.ListRequestsParams {
+	// TODO: add sart and end date
+	params := service.ListRequestsParams{
+		ProjectID: &projectID,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+		Order:     q.Order,
+	}
+
+	if q.Search != "" {
+		params.Search = &q.Search
+	}
+
+	switch q.SortBy {
+	case "createdAt":
+		params.SortBy = "created_at"
+	case "responseTime":
+		params.SortBy = "response_time"
+	default:
+		params.SortBy = q.SortBy
+	}
+
+	if q.Method != "" {
+		params.Method = &q.Method
+	}
+	if q.Source != "" {
+		params.Source = &q.Source
+	}
+	if q.Consumer != "" {
+		params.Consumer = &q.Consumer
+	}
+	// 'response' is an int. If it's '0', it's likely not set by the user.
+	// Adjust this logic if '0' is a valid response code you want to filter by.
+	if q.Response != 0 {
+		params.Response = &q.Response
+	}
+	return params
+}
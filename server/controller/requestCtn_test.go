@@ -1,10 +1,13 @@
 package controller_test
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"treblle/dto"
 	"treblle/model"
 	"treblle/service"
+	"treblle/util/cerror"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -20,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
 )
 
 // --- Mock RequestCrudService ---
@@ -38,8 +43,20 @@ func (m *MockRequestCrudService) List(params service.ListRequestsParams) ([]mode
 	return requests, args.Get(1).(int64), args.Error(2)
 }
 
-func (m *MockRequestCrudService) GetStatistics(start, end *time.Time) (*model.AllRequestStatistics, error) {
-	args := m.Called(start, end)
+func (m *MockRequestCrudService) Stream(params service.ListRequestsParams, fn func(*model.Request) error) error {
+	args := m.Called(params)
+	if args.Get(0) != nil {
+		for _, request := range args.Get(0).([]model.Request) {
+			if err := fn(&request); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockRequestCrudService) GetStatistics(projectID uint, start, end *time.Time) (*model.AllRequestStatistics, error) {
+	args := m.Called(projectID, start, end)
 	// Handle potential nil return for the slice
 	var requests model.AllRequestStatistics
 	if args.Get(0) != nil {
@@ -48,6 +65,46 @@ func (m *MockRequestCrudService) GetStatistics(start, end *time.Time) (*model.Al
 	return &requests, args.Error(1)
 }
 
+func (m *MockRequestCrudService) GetConsumerStatistics(projectID uint, consumer string, start, end *time.Time) (*model.AllRequestStatistics, error) {
+	args := m.Called(projectID, consumer, start, end)
+	var stats model.AllRequestStatistics
+	if args.Get(0) != nil {
+		stats = args.Get(0).(model.AllRequestStatistics)
+	}
+	return &stats, args.Error(1)
+}
+
+func (m *MockRequestCrudService) GetFilteredStatistics(params service.ListRequestsParams) (*model.AllRequestStatistics, error) {
+	args := m.Called(params)
+	var stats model.AllRequestStatistics
+	if args.Get(0) != nil {
+		stats = args.Get(0).(model.AllRequestStatistics)
+	}
+	return &stats, args.Error(1)
+}
+
+func (m *MockRequestCrudService) TopConsumers(params service.TopConsumersParams) ([]model.ConsumerStatistics, error) {
+	args := m.Called(params)
+	var consumers []model.ConsumerStatistics
+	if args.Get(0) != nil {
+		consumers = args.Get(0).([]model.ConsumerStatistics)
+	}
+	return consumers, args.Error(1)
+}
+
+func (m *MockRequestCrudService) Get(projectID, id uint) (*model.Request, error) {
+	args := m.Called(projectID, id)
+	var request *model.Request
+	if args.Get(0) != nil {
+		request = args.Get(0).(*model.Request)
+	}
+	return request, args.Error(1)
+}
+
+func (m *MockRequestCrudService) LoadPayloads(requests []model.Request) error {
+	return m.Called(requests).Error(0)
+}
+
 // --- RequestController Test Suite ---
 type RequestControllerTestSuite struct {
 	suite.Suite
@@ -57,6 +114,12 @@ type RequestControllerTestSuite struct {
 	logObserver            *observer.ObservedLogs
 }
 
+// defaultProject is the project requests are scoped to without a project_id query
+func defaultProject() *uint {
+	id := model.DefaultProjectID
+	return &id
+}
+
 // SetupSuite runs once before all tests in the suite
 func (suite *RequestControllerTestSuite) SetupSuite() {
 	core, obs := observer.New(zap.InfoLevel)
@@ -112,8 +175,9 @@ func (suite *RequestControllerTestSuite) TestListRequests_Success_Defaults() {
 
 	// Expect the service's List method to be called with default params
 	expectedParams := service.ListRequestsParams{
-		Limit:  20, // Default limit from controller
-		Offset: 0,  // Default offset
+		ProjectID: defaultProject(),
+		Limit:     20, // Default limit from controller
+		Offset:    0,  // Default offset
 		// SortBy and Order are empty, service should apply default sorting
 	}
 	suite.mockRequestCrudService.On("List", expectedParams).Return(mockRequests, mockTotal, nil).Once()
@@ -154,13 +218,14 @@ func (suite *RequestControllerTestSuite) TestListRequests_Success_WithParams() {
 
 	// Expect the service's List method to be called with specific params
 	expectedParams := service.ListRequestsParams{
-		Search:   &search,
-		Method:   &method,
-		Response: &responseCode,
-		Limit:    10,
-		Offset:   5,
-		SortBy:   "response_time",
-		Order:    "asc",
+		ProjectID: defaultProject(),
+		Search:    &search,
+		Method:    &method,
+		Response:  &responseCode,
+		Limit:     10,
+		Offset:    5,
+		SortBy:    "response_time",
+		Order:     "asc",
 	}
 	suite.mockRequestCrudService.On("List", expectedParams).Return(mockRequests, mockTotal, nil).Once()
 
@@ -237,8 +302,9 @@ func (suite *RequestControllerTestSuite) TestListRequests_Success_BadOffset() {
 
 	// Expect the service's List method to be called with default params
 	expectedParams := service.ListRequestsParams{
-		Limit:  20,
-		Offset: 0,
+		ProjectID: defaultProject(),
+		Limit:     20,
+		Offset:    0,
 	}
 	suite.mockRequestCrudService.On("List", expectedParams).Return(mockRequests, mockTotal, nil).Once()
 
@@ -264,3 +330,216 @@ func (suite *RequestControllerTestSuite) TestListRequests_Success_BadOffset() {
 
 	suite.mockRequestCrudService.AssertExpectations(suite.T())
 }
+
+func (suite *RequestControllerTestSuite) TestExportRequests_Ndjson() {
+	// Arrange
+	mockRequests := []model.Request{
+		{ID: 1, Method: "POST", Path: "/api/items", Query: "a=1", Response: 201, CreatedAt: time.Now(), Latency: 20 * time.Millisecond,
+			RequestHeaders: model.Headers{"Content-Type": {"application/json"}}, RequestBody: []byte(`{"name":"x"}`)},
+		{ID: 2, Method: "GET", Path: "/api/items", Response: 200, CreatedAt: time.Now(), ResponseBody: []byte{0xff, 0x00}},
+	}
+	method := "POST"
+	expectedParams := service.ListRequestsParams{ProjectID: defaultProject(), Method: &method}
+	suite.mockRequestCrudService.On("Stream", expectedParams).Return(mockRequests, nil).Once()
+
+	// Act
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/export?format=ndjson&method=POST", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(suite.T(), lines, 2)
+
+	var first, second dto.RequestExportDto
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lines[0]), &first))
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(suite.T(), `{"name":"x"}`, first.RequestBody)
+	assert.Equal(suite.T(), "a=1", first.Query)
+	assert.Equal(suite.T(), "base64", second.ResponseBodyEncoding)
+
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestExportRequests_Har() {
+	// Arrange
+	mockRequests := []model.Request{
+		{ID: 1, Method: "GET", Path: "/api/items", Query: "page=2", Response: 200, CreatedAt: time.Now(), Latency: 20 * time.Millisecond,
+			ResponseHeaders: model.Headers{"Content-Type": {"application/json"}}, ResponseBody: []byte(`[]`)},
+	}
+	suite.mockRequestCrudService.On("Stream", service.ListRequestsParams{ProjectID: defaultProject()}).Return(mockRequests, nil).Once()
+
+	// Act
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/export?format=har", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var har dto.HarDto
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &har))
+	assert.Equal(suite.T(), dto.HarVersion, har.Log.Version)
+	assert.Len(suite.T(), har.Log.Entries, 1)
+	assert.Equal(suite.T(), 200, har.Log.Entries[0].Response.Status)
+	assert.Equal(suite.T(), "application/json", har.Log.Entries[0].Response.Content.MimeType)
+	assert.Equal(suite.T(), "[]", har.Log.Entries[0].Response.Content.Text)
+	assert.Equal(suite.T(), []dto.HarNameValue{{Name: "page", Value: "2"}}, har.Log.Entries[0].Request.QueryString)
+
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestExportRequests_Csv() {
+	// Arrange
+	mockRequests := []model.Request{
+		{ID: 7, Method: "GET", Path: "/api/items", Response: 404, CreatedAt: time.Now()},
+	}
+	suite.mockRequestCrudService.On("Stream", service.ListRequestsParams{ProjectID: defaultProject()}).Return(mockRequests, nil).Once()
+
+	// Act
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/export?format=csv", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), records, 2) // header + one request
+	assert.Equal(suite.T(), "id", records[0][0])
+	assert.Equal(suite.T(), "7", records[1][0])
+	assert.Equal(suite.T(), "404", records[1][4])
+
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestExportRequests_UnknownFormat() {
+	// Act
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/export?format=xml", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockRequestCrudService.AssertNotCalled(suite.T(), "Stream", mock.Anything)
+}
+
+func (suite *RequestControllerTestSuite) TestListRequests_BadSearch() {
+	searchErr := fmt.Errorf("%w: unknown field \"http\", quote the term to search for it at 1", cerror.ErrBadSearch)
+	suite.mockRequestCrudService.On("List", mock.AnythingOfType("service.ListRequestsParams")).Return(nil, int64(0), searchErr).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests?search=http://example.com", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "unknown field")
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestExportRequests_BadSearch() {
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/export?search=status:teapot", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid search query")
+	suite.mockRequestCrudService.AssertNotCalled(suite.T(), "Stream", mock.Anything)
+}
+
+func (suite *RequestControllerTestSuite) TestListRequests_ConsumerFilter() {
+	consumer := "10.0.0.1"
+	expectedParams := service.ListRequestsParams{ProjectID: defaultProject(), Consumer: &consumer, Limit: 20}
+	suite.mockRequestCrudService.On("List", expectedParams).
+		Return([]model.Request{{ID: 1, Method: "GET", Path: "/a", Consumer: consumer}}, int64(1), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests?consumer=10.0.0.1", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var responseDto dto.ResDataDto
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &responseDto))
+	assert.Equal(suite.T(), consumer, responseDto.Data[0].Consumer)
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestGetRequestStatistics_Consumer() {
+	stats := model.AllRequestStatistics{StatsPerPath: []model.PathStatistics{{Path: "/a", RequestCount: 3, ServerErrorCount: 1}}}
+	suite.mockRequestCrudService.On("GetConsumerStatistics", uint(0), "alice", (*time.Time)(nil), (*time.Time)(nil)).Return(stats, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/statistics?consumer=alice", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var responseDto dto.RequestStatistics
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &responseDto))
+	assert.Equal(suite.T(), int64(3), responseDto.RequestCount)
+	assert.Equal(suite.T(), int64(1), responseDto.ServerErrorCount)
+	suite.mockRequestCrudService.AssertNotCalled(suite.T(), "GetStatistics", mock.Anything, mock.Anything, mock.Anything)
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestGetTopConsumers() {
+	expectedParams := service.TopConsumersParams{ProjectID: model.DefaultProjectID, SortBy: "errors", Limit: 5}
+	consumers := []model.ConsumerStatistics{{Consumer: "alice", ConsumerSource: "basic", RequestCount: 7, ServerErrorCount: 2}}
+	suite.mockRequestCrudService.On("TopConsumers", expectedParams).Return(consumers, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/consumers?sort_by=errors&limit=5", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var responseDto []dto.ConsumerStatistics
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &responseDto))
+	suite.Require().Len(responseDto, 1)
+	assert.Equal(suite.T(), "alice", responseDto[0].Consumer)
+	assert.Equal(suite.T(), "basic", responseDto[0].ConsumerSource)
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestGetTopConsumers_BadSort() {
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/consumers?sort_by=name", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockRequestCrudService.AssertNotCalled(suite.T(), "TopConsumers", mock.Anything)
+}
+
+func (suite *RequestControllerTestSuite) TestGetRequest() {
+	request := &model.Request{ID: 4, Method: "POST", Path: "/users", Response: 201, RequestHeaders: model.Headers{"Content-Type": {"application/json"}}, RequestBody: []byte(`{"name":"ana"}`)}
+	suite.mockRequestCrudService.On("Get", model.DefaultProjectID, uint(4)).Return(request, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/4", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var responseDto dto.RequestExportDto
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &responseDto))
+	assert.Equal(suite.T(), uint(4), responseDto.ID)
+	assert.Equal(suite.T(), `{"name":"ana"}`, responseDto.RequestBody)
+	assert.Equal(suite.T(), []string{"application/json"}, responseDto.RequestHeaders["Content-Type"])
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *RequestControllerTestSuite) TestGetRequest_NotFound() {
+	suite.mockRequestCrudService.On("Get", model.DefaultProjectID, uint(5)).Return(nil, gorm.ErrRecordNotFound).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/requests/5", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/requests/abc", nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockRequestCrudService.AssertExpectations(suite.T())
+}
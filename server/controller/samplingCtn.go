@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type SamplingCtn struct {
+	Logger      *zap.SugaredLogger
+	SamplingSrv service.ISamplingService
+}
+
+// NewSamplingCtn crates new controller with its dependencies
+func NewSamplingCtn() app.Controller {
+	var controller *SamplingCtn
+	app.Invoke(func(logger *zap.SugaredLogger, service service.ISamplingService) {
+		controller = &SamplingCtn{
+			Logger:      logger,
+			SamplingSrv: service,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the sampling rule endpoints.
+func (cnt *SamplingCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/sampling/rules", cnt.ListSamplingRules)
+	router.POST("/sampling/rules", cnt.CreateSamplingRule)
+	router.PUT("/sampling/rules/:id", cnt.UpdateSamplingRule)
+	router.DELETE("/sampling/rules/:id", cnt.DeleteSamplingRule)
+}
+
+// ListSamplingRules godoc
+//
+//	@Summary		List sampling rules
+//	@Description	Lists the per route sampling rules of a project. Routes without a rule are head sampled at the sampleRate of the runtime config.
+//	@Tags			Sampling
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project of the rules, the default project if not set"
+//	@Success		200			{array}		dto.SamplingRuleDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/sampling/rules [get]
+func (cnt *SamplingCtn) ListSamplingRules(c *gin.Context) {
+	rules, err := cnt.SamplingSrv.ListRules(app.CurrentProjectID(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list sampling rules: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve sampling rules"})
+		return
+	}
+
+	ret := make([]dto.SamplingRuleDto, len(rules))
+	for i := range rules {
+		ret[i].FromModel(rules[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateSamplingRule godoc
+//
+//	@Summary		Create sampling rule
+//	@Description	Stores rate of the requests to every proxied path under path, the most specific rule wins and a rule with a method wins over one without.
+//	@Description	Head rules decide when the request arrives, tail rules when the response arrives and always keep responses from keepStatus up and requests slower than slowThresholdMs.
+//	@Description	Requests with the keyHeader, e.g. traceparent or X-Request-Id, are sampled by its value so a trace is kept or left out as a whole. Stored requests carry the number of requests they stand for, statistics count them with it.
+//	@Tags			Sampling
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule		body		dto.SamplingRuleDto	true	"Sampling rule"
+//	@Param			project_id	query		int					false	"Project of the rule, the default project if not set"
+//	@Success		201			{object}	dto.SamplingRuleDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/sampling/rules [post]
+func (cnt *SamplingCtn) CreateSamplingRule(c *gin.Context) {
+	var body dto.SamplingRuleDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind sampling rule: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid sampling rule: " + err.Error()})
+		return
+	}
+
+	rule := body.ToModel()
+	rule.ProjectID = app.CurrentProjectID(c)
+	err := cnt.SamplingSrv.CreateRule(app.Actor(c), &rule)
+	if errors.Is(err, cerror.ErrBadSamplingRule) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to create sampling rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not create sampling rule"})
+		return
+	}
+
+	var ret dto.SamplingRuleDto
+	ret.FromModel(rule)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateSamplingRule godoc
+//
+//	@Summary		Update sampling rule
+//	@Description	Replaces a sampling rule, the change applies to the next proxied request.
+//	@Tags			Sampling
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int					true	"Sampling rule id"
+//	@Param			rule		body		dto.SamplingRuleDto	true	"Sampling rule"
+//	@Param			project_id	query		int					false	"Project of the rule, the default project if not set"
+//	@Success		200			{object}	dto.SamplingRuleDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/sampling/rules/{id} [put]
+func (cnt *SamplingCtn) UpdateSamplingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	var body dto.SamplingRuleDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind sampling rule: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid sampling rule: " + err.Error()})
+		return
+	}
+
+	rule := body.ToModel()
+	rule.ID = uint(id)
+	rule.ProjectID = app.CurrentProjectID(c)
+	err = cnt.SamplingSrv.UpdateRule(app.Actor(c), &rule)
+	if errors.Is(err, cerror.ErrBadSamplingRule) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Sampling rule not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to update sampling rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not update sampling rule"})
+		return
+	}
+
+	var ret dto.SamplingRuleDto
+	ret.FromModel(rule)
+	c.JSON(http.StatusOK, ret)
+}
+
+// DeleteSamplingRule godoc
+//
+//	@Summary		Delete sampling rule
+//	@Description	Deletes a sampling rule, its paths fall back to the runtime sample rate.
+//	@Tags			Sampling
+//	@Param			id			path	int	true	"Sampling rule id"
+//	@Param			project_id	query	int	false	"Project of the rule, the default project if not set"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/sampling/rules/{id} [delete]
+func (cnt *SamplingCtn) DeleteSamplingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	err = cnt.SamplingSrv.DeleteRule(app.Actor(c), app.CurrentProjectID(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "Sampling rule not found"})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to delete sampling rule: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not delete sampling rule"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,352 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ViewCtn struct {
+	Logger  *zap.SugaredLogger
+	ViewSrv service.IViewService
+	CrudSrv service.IRequestCrudService
+}
+
+// NewViewCtn crates new controller with its dependencies
+func NewViewCtn() app.Controller {
+	var controller *ViewCtn
+	app.Invoke(func(logger *zap.SugaredLogger, viewSrv service.IViewService, crudSrv service.IRequestCrudService) {
+		controller = &ViewCtn{
+			Logger:  logger,
+			ViewSrv: viewSrv,
+			CrudSrv: crudSrv,
+		}
+	})
+	return controller
+}
+
+// RegisterEndpoints registers the saved view endpoints.
+func (cnt *ViewCtn) RegisterEndpoints(router *gin.RouterGroup) {
+	router.GET("/views", cnt.ListViews)
+	router.POST("/views", cnt.CreateView)
+	router.GET("/views/:id", cnt.GetView)
+	router.PUT("/views/:id", cnt.UpdateView)
+	router.DELETE("/views/:id", cnt.DeleteView)
+	router.GET("/views/:id/requests", cnt.ListViewRequests)
+	router.GET("/views/:id/statistics", cnt.GetViewStatistics)
+}
+
+// ListViews godoc
+//
+//	@Summary		List views
+//	@Description	Lists the saved views of the project, the shared ones and the private views of the user.
+//	@Tags			Views
+//	@Produce		json
+//	@Param			project_id	query		int	false	"Project to read, the default project if not set"
+//	@Success		200			{array}		dto.ViewDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views [get]
+func (cnt *ViewCtn) ListViews(c *gin.Context) {
+	views, err := cnt.ViewSrv.List(app.CurrentProjectID(c), app.CurrentUser(c))
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list views: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve views"})
+		return
+	}
+
+	ret := make([]dto.ViewDto, len(views))
+	for i := range views {
+		ret[i].FromModel(views[i])
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// GetView godoc
+//
+//	@Summary		Get view
+//	@Description	Returns a saved view of the project.
+//	@Tags			Views
+//	@Produce		json
+//	@Param			id			path		int	true	"View id"
+//	@Param			project_id	query		int	false	"Project to read, the default project if not set"
+//	@Success		200			{object}	dto.ViewDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views/{id} [get]
+func (cnt *ViewCtn) GetView(c *gin.Context) {
+	view, ok := cnt.view(c)
+	if !ok {
+		return
+	}
+
+	var ret dto.ViewDto
+	ret.FromModel(*view)
+	c.JSON(http.StatusOK, ret)
+}
+
+// CreateView godoc
+//
+//	@Summary		Create view
+//	@Description	Saves a filter, sort and time range of the request log. The time range is either relative with last, e.g. 1h, or absolute with start and end time.
+//	@Description	Views are private to the user unless shared, only admins can share views. Views of api keys are always shared.
+//	@Tags			Views
+//	@Accept			json
+//	@Produce		json
+//	@Param			view		body		dto.ViewDto	true	"View"
+//	@Param			project_id	query		int			false	"Project of the view, the default project if not set"
+//	@Success		201			{object}	dto.ViewDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		403			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views [post]
+func (cnt *ViewCtn) CreateView(c *gin.Context) {
+	view, ok := cnt.bindView(c)
+	if !ok {
+		return
+	}
+
+	err := cnt.ViewSrv.Create(app.Actor(c), app.CurrentUser(c), &view)
+	if !cnt.checkChange(c, err, "create") {
+		return
+	}
+
+	var ret dto.ViewDto
+	ret.FromModel(view)
+	c.JSON(http.StatusCreated, ret)
+}
+
+// UpdateView godoc
+//
+//	@Summary		Update view
+//	@Description	Replaces a saved view. Users change their private views, admins also the shared ones.
+//	@Tags			Views
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int			true	"View id"
+//	@Param			view		body		dto.ViewDto	true	"View"
+//	@Param			project_id	query		int			false	"Project of the view, the default project if not set"
+//	@Success		200			{object}	dto.ViewDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		403			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views/{id} [put]
+func (cnt *ViewCtn) UpdateView(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+	view, ok := cnt.bindView(c)
+	if !ok {
+		return
+	}
+
+	view.ID = uint(id)
+	err = cnt.ViewSrv.Update(app.Actor(c), app.CurrentUser(c), &view)
+	if !cnt.checkChange(c, err, "update") {
+		return
+	}
+
+	var ret dto.ViewDto
+	ret.FromModel(view)
+	c.JSON(http.StatusOK, ret)
+}
+
+// DeleteView godoc
+//
+//	@Summary		Delete view
+//	@Description	Deletes a saved view. Users delete their private views, admins also the shared ones.
+//	@Tags			Views
+//	@Param			id			path	int	true	"View id"
+//	@Param			project_id	query	int	false	"Project of the view, the default project if not set"
+//	@Success		204
+//	@Failure		400	{object}	dto.ErrorDto
+//	@Failure		403	{object}	dto.ErrorDto
+//	@Failure		404	{object}	dto.ErrorDto
+//	@Failure		500	{object}	dto.ErrorDto
+//	@Router			/views/{id} [delete]
+func (cnt *ViewCtn) DeleteView(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return
+	}
+
+	err = cnt.ViewSrv.Delete(app.Actor(c), app.CurrentUser(c), app.CurrentProjectID(c), uint(id))
+	if !cnt.checkChange(c, err, "delete") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListViewRequests godoc
+//
+//	@Summary		List requests of a view
+//	@Description	Lists the recorded requests matching a saved view, sorted as the view. A relative time range ends now.
+//	@Tags			Views
+//	@Produce		json
+//	@Param			id			path		int	true	"View id"
+//	@Param			limit		query		int	false	"Pagination limit"	default(20)
+//	@Param			offset		query		int	false	"Pagination offset"
+//	@Param			project_id	query		int	false	"Project to read, the default project if not set"
+//	@Success		200			{object}	dto.ResDataDto
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views/{id}/requests [get]
+func (cnt *ViewCtn) ListViewRequests(c *gin.Context) {
+	var q dto.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		cnt.Logger.Errorf("Failed to bind query params: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid query parameters: " + err.Error()})
+		return
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	view, ok := cnt.view(c)
+	if !ok {
+		return
+	}
+
+	params := service.ViewParams(view, time.Now())
+	params.Limit, params.Offset = q.Limit, q.Offset
+	requests, total, err := cnt.CrudSrv.List(params)
+	if errors.Is(err, cerror.ErrBadSearch) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to list requests of view: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve requests"})
+		return
+	}
+
+	var reqDto = make([]dto.RequestsDto, len(requests))
+	for i := range reqDto {
+		reqDto[i].FromModel(requests[i])
+	}
+	c.JSON(http.StatusOK, dto.ResDataDto{
+		Data: reqDto,
+		Pagination: dto.Pagination{
+			Total:  total,
+			Limit:  q.Limit,
+			Offset: q.Offset,
+		},
+	})
+}
+
+// GetViewStatistics godoc
+//
+//	@Summary		Statistics of a view
+//	@Description	Aggregates the requests matching a saved view per path, with the contract violations found in its time range. A relative time range ends now.
+//	@Tags			Views
+//	@Produce		json
+//	@Param			id			path		int	true	"View id"
+//	@Param			project_id	query		int	false	"Project to read, the default project if not set"
+//	@Success		200			{object}	dto.RequestStatistics
+//	@Failure		400			{object}	dto.ErrorDto
+//	@Failure		404			{object}	dto.ErrorDto
+//	@Failure		500			{object}	dto.ErrorDto
+//	@Router			/views/{id}/statistics [get]
+func (cnt *ViewCtn) GetViewStatistics(c *gin.Context) {
+	view, ok := cnt.view(c)
+	if !ok {
+		return
+	}
+
+	stats, err := cnt.CrudSrv.GetFilteredStatistics(service.ViewParams(view, time.Now()))
+	if errors.Is(err, cerror.ErrBadSearch) {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get statistics of view: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve request statistics"})
+		return
+	}
+
+	var ret dto.RequestStatistics
+	ret.FromModel(stats)
+	c.JSON(http.StatusOK, ret)
+}
+
+// view returns the view in the id path parameter, on failure it writes the error response and returns false
+func (cnt *ViewCtn) view(c *gin.Context) (*model.View, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid id"})
+		return nil, false
+	}
+
+	view, err := cnt.ViewSrv.Get(app.CurrentProjectID(c), app.CurrentUser(c), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "View not found"})
+		return nil, false
+	}
+	if err != nil {
+		cnt.Logger.Errorf("Service failed to get view: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not retrieve view"})
+		return nil, false
+	}
+	return view, true
+}
+
+// bindView binds the view of the request body to the current project, private views belong to the current user.
+// On failure it writes the error response and returns false
+func (cnt *ViewCtn) bindView(c *gin.Context) (model.View, bool) {
+	var body dto.ViewDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		cnt.Logger.Errorf("Failed to bind view: %v", err)
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid view: " + err.Error()})
+		return model.View{}, false
+	}
+
+	view, err := body.ToModel(app.CurrentProjectID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid view: " + err.Error()})
+		return model.View{}, false
+	}
+	if !body.Shared {
+		user := app.CurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: "Invalid view: views of api keys have to be shared"})
+			return model.View{}, false
+		}
+		view.OwnerID = &user.ID
+	}
+	return view, true
+}
+
+// checkChange writes the error response of a failed change of a view and returns false, true if err is nil
+func (cnt *ViewCtn) checkChange(c *gin.Context, err error, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, cerror.ErrBadView):
+		c.JSON(http.StatusBadRequest, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, cerror.ErrViewAccess):
+		c.JSON(http.StatusForbidden, dto.ErrorDto{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorDto{Error: "View not found"})
+	default:
+		cnt.Logger.Errorf("Service failed to %s view: %v", action, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorDto{Error: "Could not " + action + " view"})
+	}
+	return false
+}
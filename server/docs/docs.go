@@ -15,67 +15,203 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/info": {
+        "/api-keys": {
             "get": {
-                "description": "return information about the server build, version, etc ...",
+                "description": "Lists the api keys of the dashboard api including revoked and expired ones, admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "info"
+                    "ApiKey"
                 ],
-                "summary": "Get server info",
+                "summary": "List api keys",
                 "responses": {
                     "200": {
-                        "description": "Information about server",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.ServerInfoDto"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ApiKeyDto"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates an api key for scripts, send it in the X-Api-Key header of /api requests. The key is only returned once. read_requests lists, exports and reads requests, read_stats reads statistics, consumers, violations and the inferred spec, manage_config reads and changes everything else. Users and api keys can't be managed with a key. A key only reads the project it was created for, keys of other projects than the default one can't change the config and rate limits shared by every project.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ApiKey"
+                ],
+                "summary": "Create api key",
+                "parameters": [
+                    {
+                        "description": "Api key",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.NewApiKeyDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreatedApiKeyDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
                         }
                     }
                 }
             }
         },
-        "/requests": {
-            "get": {
-                "description": "Get a paginated list of recorded API requests, with filtering and sorting.",
-                "consumes": [
+        "/api-keys/{id}": {
+            "delete": {
+                "description": "Revokes an api key, it stops working immediately. The key is kept for the audit log.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "ApiKey"
+                ],
+                "summary": "Revoke api key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Api key id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ApiKeyDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/audit": {
+            "get": {
+                "description": "Returns a page of recorded administrative changes, newest first, with the before and after value of every changed field. Secrets are redacted. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Requests"
+                    "Audit"
                 ],
-                "summary": "List API requests",
+                "summary": "List audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Search term for request path",
-                        "name": "search",
+                        "description": "Filter by actor, e.g. user:admin@example.com or api_key:trbl_abcdefgh",
+                        "name": "actor",
                         "in": "query"
                     },
                     {
-                        "enum": [
-                            "GET",
-                            "POST",
-                            "PUT",
-                            "DELETE",
-                            "PATCH",
-                            "HEAD",
-                            "OPTION",
-                            "TRACE",
-                            "CONNECT"
-                        ],
                         "type": "string",
-                        "description": "Filter by HTTP method (e.Example, GET, POST)",
-                        "name": "method",
+                        "description": "Filter by action, e.g. project.updated",
+                        "name": "action",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Filter by response status code (e.Example, 200, 404)",
-                        "name": "response",
+                        "type": "string",
+                        "description": "Filter by target, e.g. project:3, or by kind, e.g. project",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)",
+                        "name": "end_time",
                         "in": "query"
                     },
                     {
@@ -90,34 +226,13 @@ const docTemplate = `{
                         "description": "Pagination offset",
                         "name": "offset",
                         "in": "query"
-                    },
-                    {
-                        "enum": [
-                            "created_at",
-                            "response_time",
-                            "latency"
-                        ],
-                        "type": "string",
-                        "description": "Sort by field (created_at or response_time)",
-                        "name": "sort_by",
-                        "in": "query"
-                    },
-                    {
-                        "enum": [
-                            "asc",
-                            "desc"
-                        ],
-                        "type": "string",
-                        "description": "Sort order (asc or desc)",
-                        "name": "order",
-                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.ResDataDto"
+                            "$ref": "#/definitions/dto.AuditEntriesDto"
                         }
                     },
                     "400": {
@@ -126,6 +241,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -135,9 +262,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/requests/statistics": {
-            "get": {
-                "description": "Calculates statistics like average latency and error counts per path, optionally filtered by a time range.",
+        "/auth/login": {
+            "post": {
+                "description": "Issues a bearer token for the dashboard api, send it as ` + "`" + `Authorization: Bearer \u003ctoken\u003e` + "`" + ` or as the access_token query of websockets. Viewers can only read and save their own views, admins can also change configuration and manage users. An email is locked out for 15 minutes after 5 failed logins, tokens are revoked when the password of their user changes.",
                 "consumes": [
                     "application/json"
                 ],
@@ -145,30 +272,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Requests"
+                    "Auth"
                 ],
-                "summary": "Get request statistics",
+                "summary": "Log in",
                 "parameters": [
                     {
-                        "type": "string",
-                        "format": "date-time",
-                        "description": "Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)",
-                        "name": "start_time",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "format": "date-time",
-                        "description": "End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)",
-                        "name": "end_time",
-                        "in": "query"
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.LoginDto"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Aggregated statistics per path",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.RequestStatistics"
+                            "$ref": "#/definitions/dto.TokenDto"
                         }
                     },
                     "400": {
@@ -177,6 +299,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorDto"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -186,66 +320,3646 @@ const docTemplate = `{
                 }
             }
         },
-        "/requests/statistics/ws": {
+        "/auth/me": {
             "get": {
-                "description": "Web socket",
+                "description": "Returns the user the bearer token was issued to.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "chart"
+                    "Auth"
                 ],
-                "summary": "web socket for streaming chart data",
+                "summary": "Current user",
                 "responses": {
-                    "500": {
-                        "description": "Internal Server Error"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "dto.ErrorDto": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string"
-                }
-            }
         },
-        "dto.Pagination": {
-            "type": "object",
-            "properties": {
-                "limit": {
-                    "type": "integer"
-                },
-                "offset": {
-                    "type": "integer"
-                },
-                "total": {
-                    "type": "integer"
+        "/config": {
+            "get": {
+                "description": "Returns the settings the proxy currently runs with, stored settings override PROXY_URL and CAPTURE_BODY_LIMIT. The password of the upstream url is redacted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Config"
+                ],
+                "summary": "Get runtime config",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.RuntimeConfig"
+                        }
+                    }
                 }
-            }
-        },
-        "dto.PathStatistics": {
-            "type": "object",
-            "properties": {
-                "average_latency_ms": {
-                    "type": "number"
-                },
-                "client_error_count": {
-                    "type": "integer"
-                },
+            },
+            "patch": {
+                "description": "Changes only the sent settings. Changes apply to the next proxied request, requests in flight finish with the old settings. An upstream url sent back with its password redacted keeps the stored password. Admin only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Config"
+                ],
+                "summary": "Update runtime config",
+                "parameters": [
+                    {
+                        "description": "Settings to change",
+                        "name": "config",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.RuntimeConfig"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.RuntimeConfig"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/config/schema": {
+            "get": {
+                "description": "Describes every runtime setting with its type and allowed range.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Config"
+                ],
+                "summary": "Get runtime config schema",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.ConfigField"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/imports": {
+            "get": {
+                "description": "Lists the import jobs of the selected project with their progress, newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "List imports",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project of the imports, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ImportJobDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Uploads a HAR 1.2 or NDJSON (as produced by the export endpoint) file and imports it into the request store as a background job.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Import traffic",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Traffic file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Source label the imported requests are tagged with",
+                        "name": "source",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "har",
+                            "ndjson"
+                        ],
+                        "type": "string",
+                        "description": "File format, guessed from the file extension if not set",
+                        "name": "format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project the requests are imported into, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ImportJobDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/imports/{id}": {
+            "get": {
+                "description": "Returns an import job of the selected project and its progress.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Imports"
+                ],
+                "summary": "Get import",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the import, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ImportJobDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/info": {
+            "get": {
+                "description": "return information about the server build, version, etc ...",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "info"
+                ],
+                "summary": "Get server info",
+                "responses": {
+                    "200": {
+                        "description": "Information about server",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ServerInfoDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/mock/routes": {
+            "get": {
+                "description": "Lists the per route mock mode overrides of a project. Routes without an override use MOCK_MODE, MOCK_STRATEGY and MOCK_FALLBACK.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Mock"
+                ],
+                "summary": "List mock routes",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project of the routes, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.MockRouteDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Turns mock mode on or off for every proxied path under path. The most specific route wins, a route with a method wins over one without.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Mock"
+                ],
+                "summary": "Create mock route",
+                "parameters": [
+                    {
+                        "description": "Mock route",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.MockRouteDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the route, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.MockRouteDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/mock/routes/{id}": {
+            "put": {
+                "description": "Replaces a mock route, the change applies to the next proxied request.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Mock"
+                ],
+                "summary": "Update mock route",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Mock route id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Mock route",
+                        "name": "route",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.MockRouteDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the route, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.MockRouteDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a mock route, its paths fall back to MOCK_MODE.",
+                "tags": [
+                    "Mock"
+                ],
+                "summary": "Delete mock route",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Mock route id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the route, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi/inferred": {
+            "get": {
+                "description": "Returns an OpenAPI 3 document of the proxied API built from the recorded traffic of the selected project: endpoints, methods, query parameters, status codes and json schemas of request and response bodies. Requests recorded since the last call are merged in before returning.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "Get inferred OpenAPI document",
+                "responses": {
+                    "200": {
+                        "description": "OpenAPI 3 document",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi/specs": {
+            "get": {
+                "description": "Lists uploaded versions of the project's api spec, newest first. The newest one is used for validation.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "List api specs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project of the specs, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ApiSpecDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Uploads a new version of the OpenAPI 3 spec of the project's upstream in json or yaml. Proxied requests and responses of the project are validated against its newest spec, with CONTRACT_ENFORCE requests violating it are rejected with 400.",
+                "consumes": [
+                    "application/json",
+                    "application/yaml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "Upload api spec",
+                "parameters": [
+                    {
+                        "description": "OpenAPI 3 document",
+                        "name": "spec",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the spec, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ApiSpecDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi/specs/{id}": {
+            "get": {
+                "description": "Returns an uploaded version of the project's api spec as json.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "Get api spec",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Spec id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the spec, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OpenAPI 3 document",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi/specs/{id}/report": {
+            "get": {
+                "description": "Compares an uploaded spec version to the previous one of its project and to the traffic of the selected project recorded since start_time (default last 7 days). Reports removed endpoints still receiving traffic, new required parameters that callers don't send and changed response shapes, with the number of recorded calls that would break.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "Breaking change report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Spec id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "Start of the checked traffic (RFC3339 format, e.g., 2023-10-26T00:00:00Z)",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the spec, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BreakingChangeReportDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi/violations": {
+            "get": {
+                "description": "Lists violations of the api spec found in proxied requests and responses of the selected project, newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OpenAPI"
+                ],
+                "summary": "List contract violations",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by request id",
+                        "name": "request_id",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "unknown_endpoint",
+                            "bad_parameter",
+                            "bad_request_body",
+                            "bad_request",
+                            "bad_response_body",
+                            "undocumented_status"
+                        ],
+                        "type": "string",
+                        "description": "Filter by kind",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by spec endpoint, e.g. /users/{id}",
+                        "name": "endpoint",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Pagination limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViolationsDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects": {
+            "get": {
+                "description": "Lists the projects the caller can read, admins see every project. Project 0 is the default project, it gets the traffic without an ingestion key or project prefix and is sent to PROXY_URL. Select a project in other endpoints with the project_id query or the X-Project-Id header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "List projects",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ProjectDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a project, its traffic is proxied from /proxy/\u003cslug\u003e/ or from any /proxy path with the returned ingestion key in the X-Project-Key header. The key is only returned once. A slug the default project has traffic under is rejected, its requests would go to the new project.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "Create project",
+                "parameters": [
+                    {
+                        "description": "Project",
+                        "name": "project",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ProjectDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.IngestionKeyDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{id}": {
+            "put": {
+                "description": "Changes the name, slug or upstream of a project, the ingestion key is kept. The default project is configured with PROXY_URL. A new slug the default project has traffic under is rejected.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "Update project",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Project",
+                        "name": "project",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ProjectDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ProjectDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{id}/ingestion-key": {
+            "post": {
+                "description": "Replaces the ingestion key of a project, the old key stops working immediately.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "Rotate ingestion key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.IngestionKeyDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{id}/members": {
+            "get": {
+                "description": "Lists the users that can read a project besides the admins.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "List project members",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.UserDto"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Lets a user read a project, every user can read the default project.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Project"
+                ],
+                "summary": "Add project member",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Member",
+                        "name": "member",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ProjectMemberDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{id}/members/{userId}": {
+            "delete": {
+                "description": "Stops a user from reading a project.",
+                "tags": [
+                    "Project"
+                ],
+                "summary": "Remove project member",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/rate-limits": {
+            "get": {
+                "description": "Lists the per route rate limits. Routes without a rule use RATE_LIMIT, RATE_LIMIT_WINDOW, RATE_LIMIT_ALGORITHM and RATE_LIMIT_KEY.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "RateLimit"
+                ],
+                "summary": "List rate limit rules",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.RateLimitRuleDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Limits every proxied path under path, a disabled rule exempts the paths from the default limit. The most specific rule wins, a rule with a method wins over one without. Requests over the limit get 429 with Retry-After and RateLimit-* headers.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "RateLimit"
+                ],
+                "summary": "Create rate limit rule",
+                "parameters": [
+                    {
+                        "description": "Rate limit rule",
+                        "name": "rule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.RateLimitRuleDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RateLimitRuleDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/rate-limits/{id}": {
+            "put": {
+                "description": "Replaces a rate limit rule, the change applies to the next proxied request.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "RateLimit"
+                ],
+                "summary": "Update rate limit rule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Rate limit rule id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Rate limit rule",
+                        "name": "rule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.RateLimitRuleDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RateLimitRuleDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a rate limit rule, its paths fall back to the default limit.",
+                "tags": [
+                    "RateLimit"
+                ],
+                "summary": "Delete rate limit rule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Rate limit rule id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/replays": {
+            "get": {
+                "description": "Lists the replays of the selected project with their progress, newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Replays"
+                ],
+                "summary": "List replays",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project of the replays, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ReplayDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Replays recorded requests of the selected project chosen by ids or by a filter against a target url as a background job. Requests are sent in the order they were recorded, optionally keeping the original timing or capped to a rate.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Replays"
+                ],
+                "summary": "Replay recorded traffic",
+                "parameters": [
+                    {
+                        "description": "Replay definition",
+                        "name": "replay",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreateReplayDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the replayed requests, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReplayDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/replays/{id}": {
+            "get": {
+                "description": "Returns a replay of the selected project with its progress and diff counters.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Replays"
+                ],
+                "summary": "Get replay",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Replay id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the replay, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReplayDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/replays/{id}/results": {
+            "get": {
+                "description": "Returns the per request diff between the original and the replayed response (status, latency, body hash) of a replay of the selected project.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Replays"
+                ],
+                "summary": "List replay results",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Replay id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return only results that differ from the original",
+                        "name": "only_diffs",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Pagination limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the replay, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ReplayResultsDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/requests": {
+            "get": {
+                "description": "Get a paginated list of recorded API requests, with filtering and sorting.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Requests"
+                ],
+                "summary": "List API requests",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query, e.g. status:5xx latency:\u003e500ms body:timeout, or text in the path",
+                        "name": "search",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "GET",
+                            "POST",
+                            "PUT",
+                            "DELETE",
+                            "PATCH",
+                            "HEAD",
+                            "OPTION",
+                            "TRACE",
+                            "CONNECT"
+                        ],
+                        "type": "string",
+                        "description": "Filter by HTTP method (e.Example, GET, POST)",
+                        "name": "method",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by response status code (e.Example, 200, 404)",
+                        "name": "response",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by source label (proxy or an import label)",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by consumer",
+                        "name": "consumer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Pagination limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "response_time",
+                            "latency"
+                        ],
+                        "type": "string",
+                        "description": "Sort by field (created_at or response_time)",
+                        "name": "sort_by",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort order (asc or desc)",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ResDataDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/requests/consumers": {
+            "get": {
+                "description": "Get the consumers generating the most requests, errors or latency. Consumers are identified by CONSUMER_SOURCES, api keys are shown as a fingerprint.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Requests"
+                ],
+                "summary": "Top API consumers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)",
+                        "name": "end_time",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "requests",
+                            "errors",
+                            "latency"
+                        ],
+                        "type": "string",
+                        "default": "requests",
+                        "description": "Rank consumers by",
+                        "name": "sort_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Number of consumers",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ConsumerStatistics"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/requests/export": {
+            "get": {
+                "description": "Streams all recorded API requests matching the ListRequests filters as CSV, NDJSON or HAR 1.2, including captured headers and bodies.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/json"
+                ],
+                "tags": [
+                    "Requests"
+                ],
+                "summary": "Export API requests",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "ndjson",
+                            "har"
+                        ],
+                        "type": "string",
+                        "default": "ndjson",
+                        "description": "Export format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search query, e.g. status:5xx latency:\u003e500ms body:timeout, or text in the path",
+                        "name": "search",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "GET",
+                            "POST",
+                            "PUT",
+                            "DELETE",
+                            "PATCH",
+                            "HEAD",
+                            "OPTION",
+                            "TRACE",
+                            "CONNECT"
+                        ],
+                        "type": "string",
+                        "description": "Filter by HTTP method (e.Example, GET, POST)",
+                        "name": "method",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by response status code (e.Example, 200, 404)",
+                        "name": "response",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by source label (proxy or an import label)",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by consumer",
+                        "name": "consumer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Max number of exported requests, all if not set",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "response_time",
+                            "latency"
+                        ],
+                        "type": "string",
+                        "description": "Sort by field (created_at or response_time)",
+                        "name": "sort_by",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort order (asc or desc)",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/requests/statistics": {
+            "get": {
+                "description": "Calculates statistics like average latency and error counts per path, optionally filtered by a time range.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Requests"
+                ],
+                "summary": "Get request statistics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "Start time for filtering (RFC3339 format, e.g., 2023-10-26T00:00:00Z)",
+                        "name": "start_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "date-time",
+                        "description": "End time for filtering (RFC3339 format, e.g., 2023-10-26T23:59:59Z)",
+                        "name": "end_time",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only aggregate the requests of one consumer",
+                        "name": "consumer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Aggregated statistics per path",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RequestStatistics"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/requests/{id}": {
+            "get": {
+                "description": "Returns a recorded API request with its captured headers and bodies, which the list leaves out.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Requests"
+                ],
+                "summary": "Get API request",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Request id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RequestExportDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/sampling/rules": {
+            "get": {
+                "description": "Lists the per route sampling rules of a project. Routes without a rule are head sampled at the sampleRate of the runtime config.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sampling"
+                ],
+                "summary": "List sampling rules",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project of the rules, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.SamplingRuleDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Stores rate of the requests to every proxied path under path, the most specific rule wins and a rule with a method wins over one without.\nHead rules decide when the request arrives, tail rules when the response arrives and always keep responses from keepStatus up and requests slower than slowThresholdMs.\nRequests with the keyHeader, e.g. traceparent or X-Request-Id, are sampled by its value so a trace is kept or left out as a whole. Stored requests carry the number of requests they stand for, statistics count them with it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sampling"
+                ],
+                "summary": "Create sampling rule",
+                "parameters": [
+                    {
+                        "description": "Sampling rule",
+                        "name": "rule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SamplingRuleDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the rule, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SamplingRuleDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/sampling/rules/{id}": {
+            "put": {
+                "description": "Replaces a sampling rule, the change applies to the next proxied request.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sampling"
+                ],
+                "summary": "Update sampling rule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sampling rule id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Sampling rule",
+                        "name": "rule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.SamplingRuleDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the rule, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SamplingRuleDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a sampling rule, its paths fall back to the runtime sample rate.",
+                "tags": [
+                    "Sampling"
+                ],
+                "summary": "Delete sampling rule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sampling rule id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the rule, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "Lists the dashboard users, admin only.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "List users",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.UserDto"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a dashboard user, admin only. Passwords need 8 to 72 characters.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Create user",
+                "parameters": [
+                    {
+                        "description": "New user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.NewUserDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "put": {
+                "description": "Changes the role or password of a dashboard user, admin only. The last admin can't be demoted.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Update user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changes",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.UpdateUserDto"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a dashboard user, their tokens stop working immediately. Admin only, the last admin can't be deleted.",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/views": {
+            "get": {
+                "description": "Lists the saved views of the project, the shared ones and the private views of the user.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "List views",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.ViewDto"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Saves a filter, sort and time range of the request log. The time range is either relative with last, e.g. 1h, or absolute with start and end time.\nViews are private to the user unless shared, only admins can share views. Views of api keys are always shared.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "Create view",
+                "parameters": [
+                    {
+                        "description": "View",
+                        "name": "view",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViewDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the view, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViewDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/views/{id}": {
+            "get": {
+                "description": "Returns a saved view of the project.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "Get view",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "View id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViewDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replaces a saved view. Users change their private views, admins also the shared ones.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "Update view",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "View id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "View",
+                        "name": "view",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViewDto"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the view, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ViewDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a saved view. Users delete their private views, admins also the shared ones.",
+                "tags": [
+                    "Views"
+                ],
+                "summary": "Delete view",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "View id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project of the view, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/views/{id}/requests": {
+            "get": {
+                "description": "Lists the recorded requests matching a saved view, sorted as the view. A relative time range ends now.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "List requests of a view",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "View id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Pagination limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ResDataDto"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/views/{id}/statistics": {
+            "get": {
+                "description": "Aggregates the requests matching a saved view per path, with the contract violations found in its time range. A relative time range ends now.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Views"
+                ],
+                "summary": "Statistics of a view",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "View id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.RequestStatistics"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/requests/statistics": {
+            "get": {
+                "description": "Web socket, browsers pass the bearer token in the access_token query. Origins other than the server need to be in ALLOWED_ORIGINS.\nWith view_id only the requests matching the filters of a saved view are counted, the stream covers the time since the last update instead of the view's time range.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "chart"
+                ],
+                "summary": "web socket for streaming chart data",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Project to read, the default project if not set",
+                        "name": "project_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Saved view to filter the statistics by",
+                        "name": "view_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorDto"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "dto.ApiKeyDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is the start of the key",
+                    "type": "string"
+                },
+                "projectId": {
+                    "type": "integer"
+                },
+                "revokedAt": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.ApiSpecDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.AuditEntriesDto": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.AuditEntryDto"
+                    }
+                },
+                "pagination": {
+                    "$ref": "#/definitions/dto.Pagination"
+                }
+            }
+        },
+        "dto.AuditEntryDto": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "changes": {
+                    "$ref": "#/definitions/model.AuditChanges"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.BreakingChangeDto": {
+            "type": "object",
+            "properties": {
+                "calls": {
+                    "type": "integer"
+                },
+                "details": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "parameter": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.BreakingChangeReportDto": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.BreakingChangeDto"
+                    }
+                },
+                "observed": {
+                    "type": "integer"
+                },
+                "previousSpecId": {
+                    "type": "integer"
+                },
+                "since": {
+                    "type": "string"
+                },
+                "specId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ConsumerStatistics": {
+            "type": "object",
+            "properties": {
+                "average_latency_ms": {
+                    "type": "number"
+                },
+                "client_error_count": {
+                    "type": "integer"
+                },
+                "consumer": {
+                    "type": "string"
+                },
+                "consumer_source": {
+                    "description": "ConsumerSource is how the consumer was identified, one of api_key, jwt, jwt_unverified, basic, ip",
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "proxy_error_count": {
+                    "type": "integer"
+                },
+                "rate_limited_count": {
+                    "type": "integer"
+                },
+                "request_count": {
+                    "type": "integer"
+                },
+                "server_error_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.CreateReplayDto": {
+            "type": "object",
+            "required": [
+                "targetUrl"
+            ],
+            "properties": {
+                "filter": {
+                    "$ref": "#/definitions/dto.ReplayFilterDto"
+                },
+                "limit": {
+                    "description": "Limit is the max number of replayed requests, 0 is all",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "preserveTiming": {
+                    "description": "PreserveTiming keeps the original delays between requests",
+                    "type": "boolean"
+                },
+                "rateLimit": {
+                    "description": "RateLimit is the max number of requests per second, 0 is unlimited",
+                    "type": "number",
+                    "minimum": 0
+                },
+                "requestIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "targetUrl": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreatedApiKeyDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is the start of the key",
+                    "type": "string"
+                },
+                "projectId": {
+                    "type": "integer"
+                },
+                "revokedAt": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.EndpointViolations": {
+            "type": "object",
+            "properties": {
+                "endpoint": {
+                    "type": "string"
+                },
+                "kinds": {
+                    "description": "Kinds counts violations by kind, e.g. bad_parameter",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "method": {
+                    "type": "string"
+                },
+                "request_count": {
+                    "type": "integer"
+                },
+                "violation_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ErrorDto": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ImportJobDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "fileName": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "imported": {
+                    "type": "integer"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "progress": {
+                    "description": "Progress in percent of the file read",
+                    "type": "number"
+                },
+                "skipped": {
+                    "description": "Skipped counts duplicates",
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.IngestionKeyDto": {
+            "type": "object",
+            "required": [
+                "name",
+                "slug",
+                "upstreamUrl"
+            ],
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ingestionKey": {
+                    "type": "string"
+                },
+                "ingestionKeyPrefix": {
+                    "description": "IngestionKeyPrefix is the start of the ingestion key",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "slug": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "upstreamUrl": {
+                    "type": "string",
+                    "maxLength": 500
+                }
+            }
+        },
+        "dto.LoginDto": {
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.MockRouteDto": {
+            "type": "object",
+            "required": [
+                "path"
+            ],
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "fallback": {
+                    "description": "Fallback overrides MOCK_FALLBACK if set",
+                    "type": "string",
+                    "enum": [
+                        "404",
+                        "passthrough",
+                        "synthetic"
+                    ]
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "Method limits the route to one method, empty is any",
+                    "type": "string",
+                    "maxLength": 10
+                },
+                "path": {
+                    "type": "string",
+                    "maxLength": 150
+                },
+                "strategy": {
+                    "description": "Strategy overrides MOCK_STRATEGY if set",
+                    "type": "string",
+                    "enum": [
+                        "path",
+                        "query",
+                        "body"
+                    ]
+                },
+                "syntheticBody": {
+                    "type": "string"
+                },
+                "syntheticContentType": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "syntheticStatus": {
+                    "type": "integer",
+                    "maximum": 599,
+                    "minimum": 100
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.NewApiKeyDto": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expiresAt": {
+                    "description": "ExpiresAt is an RFC3339 time, keys without it don't expire",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "projectId": {
+                    "description": "ProjectID is the only project the key can read, 0 is the default project",
+                    "type": "integer"
+                },
+                "scopes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.NewUserDto": {
+            "type": "object",
+            "required": [
+                "email",
+                "password",
+                "role"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 320
+                },
+                "password": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "admin"
+                    ]
+                }
+            }
+        },
+        "dto.Pagination": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.PathStatistics": {
+            "type": "object",
+            "properties": {
+                "average_latency_ms": {
+                    "type": "number"
+                },
+                "client_error_count": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "proxy_error_count": {
+                    "type": "integer"
+                },
+                "rate_limited_count": {
+                    "type": "integer"
+                },
+                "request_count": {
+                    "type": "integer"
+                },
+                "server_error_count": {
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ProjectDto": {
+            "type": "object",
+            "required": [
+                "name",
+                "slug",
+                "upstreamUrl"
+            ],
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ingestionKeyPrefix": {
+                    "description": "IngestionKeyPrefix is the start of the ingestion key",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "slug": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "upstreamUrl": {
+                    "type": "string",
+                    "maxLength": 500
+                }
+            }
+        },
+        "dto.ProjectMemberDto": {
+            "type": "object",
+            "required": [
+                "userId"
+            ],
+            "properties": {
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.RateLimitRuleDto": {
+            "type": "object",
+            "required": [
+                "path"
+            ],
+            "properties": {
+                "algorithm": {
+                    "type": "string",
+                    "enum": [
+                        "token_bucket",
+                        "sliding_window"
+                    ]
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string",
+                    "enum": [
+                        "ip",
+                        "api_key",
+                        "route"
+                    ]
+                },
+                "limit": {
+                    "description": "Limit is the number of requests allowed per window",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "method": {
+                    "description": "Method limits the rule to one method, empty is any",
+                    "type": "string",
+                    "maxLength": 10
+                },
+                "path": {
+                    "type": "string",
+                    "maxLength": 150
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "windowSeconds": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "dto.ReplayDto": {
+            "type": "object",
+            "properties": {
+                "bodyDiffs": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "integer"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "preserveTiming": {
+                    "type": "boolean"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "rateLimit": {
+                    "type": "number"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "statusDiffs": {
+                    "type": "integer"
+                },
+                "targetUrl": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ReplayFilterDto": {
+            "type": "object",
+            "properties": {
+                "method": {
+                    "type": "string"
+                },
+                "response": {
+                    "type": "integer"
+                },
+                "search": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ReplayResultDto": {
+            "type": "object",
+            "properties": {
+                "bodyMatch": {
+                    "description": "BodyMatch is null when the recorded body is missing or cut",
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "latencyDiff": {
+                    "description": "LatencyDiff in Milliseconds, positive if the replay was slower",
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "originalBodyHash": {
+                    "type": "string"
+                },
+                "originalLatency": {
+                    "description": "OriginalLatency in Milliseconds",
+                    "type": "integer"
+                },
+                "originalStatus": {
+                    "type": "integer"
+                },
                 "path": {
                     "type": "string"
                 },
-                "request_count": {
+                "replayBodyHash": {
+                    "type": "string"
+                },
+                "replayLatency": {
+                    "description": "ReplayLatency in Milliseconds",
                     "type": "integer"
                 },
-                "server_error_count": {
+                "replayStatus": {
                     "type": "integer"
                 },
-                "timestamp": {
+                "requestId": {
+                    "type": "integer"
+                },
+                "statusMatch": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "dto.ReplayResultsDto": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ReplayResultDto"
+                    }
+                },
+                "pagination": {
+                    "$ref": "#/definitions/dto.Pagination"
+                }
+            }
+        },
+        "dto.RequestExportDto": {
+            "type": "object",
+            "properties": {
+                "consumer": {
+                    "type": "string"
+                },
+                "consumerSource": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "latency": {
+                    "description": "Latency in Milliseconds",
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "proxyError": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "requestBody": {
+                    "type": "string"
+                },
+                "requestBodyEncoding": {
+                    "type": "string"
+                },
+                "requestHeaders": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "requestTruncated": {
+                    "type": "boolean"
+                },
+                "response": {
+                    "type": "integer"
+                },
+                "responseBody": {
+                    "type": "string"
+                },
+                "responseBodyEncoding": {
+                    "type": "string"
+                },
+                "responseHeaders": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "responseTime": {
+                    "type": "string"
+                },
+                "responseTruncated": {
+                    "type": "boolean"
+                },
+                "source": {
                     "type": "string"
                 }
             }
@@ -259,6 +3973,13 @@ const docTemplate = `{
                 "client_error_count": {
                     "type": "integer"
                 },
+                "proxy_error_count": {
+                    "description": "ProxyErrorCount counts requests the upstream never answered, apart from the server errors",
+                    "type": "integer"
+                },
+                "rate_limited_count": {
+                    "type": "integer"
+                },
                 "request_count": {
                     "type": "integer"
                 },
@@ -272,13 +3993,23 @@ const docTemplate = `{
                     "type": "integer"
                 },
                 "timestamp": {
-                    "type": "string"
+                    "type": "integer"
+                },
+                "violations_per_endpoint": {
+                    "description": "ViolationsPerEndpoint aggregates api contract violations, empty without an uploaded spec",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.EndpointViolations"
+                    }
                 }
             }
         },
         "dto.RequestsDto": {
             "type": "object",
             "properties": {
+                "consumer": {
+                    "type": "string"
+                },
                 "createdAt": {
                     "type": "string"
                 },
@@ -295,11 +4026,22 @@ const docTemplate = `{
                 "path": {
                     "type": "string"
                 },
+                "proxyError": {
+                    "description": "ProxyError is why the upstream never answered, e.g. timeout, the response is synthetic then",
+                    "type": "string"
+                },
                 "response": {
                     "type": "integer"
                 },
                 "responseTime": {
                     "type": "string"
+                },
+                "sampleWeight": {
+                    "description": "SampleWeight is the number of proxied requests this one stands for",
+                    "type": "number"
+                },
+                "source": {
+                    "type": "string"
                 }
             }
         },
@@ -317,6 +4059,63 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.SamplingRuleDto": {
+            "type": "object",
+            "required": [
+                "path",
+                "rate"
+            ],
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "keepStatus": {
+                    "description": "KeepStatus keeps every response with a status from it up, tail only",
+                    "type": "integer",
+                    "maximum": 599,
+                    "minimum": 100
+                },
+                "keyHeader": {
+                    "description": "KeyHeader holds the trace or request id requests are sampled by",
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "method": {
+                    "description": "Method limits the rule to one method, empty is any",
+                    "type": "string",
+                    "maxLength": 10
+                },
+                "mode": {
+                    "description": "Mode is head by default, tail decides when the response arrives",
+                    "type": "string",
+                    "enum": [
+                        "head",
+                        "tail"
+                    ]
+                },
+                "path": {
+                    "type": "string",
+                    "maxLength": 150
+                },
+                "rate": {
+                    "description": "Rate is the share of requests that are stored",
+                    "type": "number",
+                    "maximum": 1,
+                    "minimum": 0
+                },
+                "slowThresholdMs": {
+                    "description": "SlowThresholdMs keeps every request at least as slow, tail only",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
         "dto.ServerInfoDto": {
             "type": "object",
             "properties": {
@@ -333,6 +4132,226 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "dto.TokenDto": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/dto.UserDto"
+                }
+            }
+        },
+        "dto.UpdateUserDto": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "admin"
+                    ]
+                }
+            }
+        },
+        "dto.UserDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "role": {
+                    "description": "Role is one of viewer, admin",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ViewDto": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "consumer": {
+                    "type": "string",
+                    "maxLength": 200
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "endTime": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last": {
+                    "description": "Last is a relative time range ending when the view is applied, e.g. 1h or 15m",
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string",
+                    "maxLength": 10
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "order": {
+                    "type": "string",
+                    "enum": [
+                        "asc",
+                        "desc"
+                    ]
+                },
+                "response": {
+                    "type": "integer",
+                    "maximum": 599,
+                    "minimum": 100
+                },
+                "search": {
+                    "type": "string",
+                    "maxLength": 1000
+                },
+                "shared": {
+                    "description": "Shared views are seen by everyone with access to the project, others only by their owner",
+                    "type": "boolean"
+                },
+                "sortBy": {
+                    "type": "string",
+                    "enum": [
+                        "created_at",
+                        "response_time",
+                        "latency"
+                    ]
+                },
+                "source": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "startTime": {
+                    "description": "StartTime and EndTime are an absolute RFC3339 time range, used without last",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ViolationDto": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "type": "integer"
+                },
+                "specId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.ViolationsDto": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ViolationDto"
+                    }
+                },
+                "pagination": {
+                    "$ref": "#/definitions/dto.Pagination"
+                }
+            }
+        },
+        "model.AuditChange": {
+            "type": "object",
+            "properties": {
+                "after": {},
+                "before": {}
+            }
+        },
+        "model.AuditChanges": {
+            "type": "object",
+            "additionalProperties": {
+                "$ref": "#/definitions/model.AuditChange"
+            }
+        },
+        "model.ConfigField": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "maximum": {
+                    "type": "number"
+                },
+                "minimum": {
+                    "type": "number"
+                },
+                "type": {
+                    "description": "Type is the json type, one of string, integer, number",
+                    "type": "string"
+                }
+            }
+        },
+        "model.RuntimeConfig": {
+            "type": "object",
+            "properties": {
+                "captureBodyLimit": {
+                    "description": "CaptureBodyLimit is the max number of body bytes stored per request, 0 disables body capture",
+                    "type": "integer"
+                },
+                "retentionDays": {
+                    "description": "RetentionDays is how long requests are kept, 0 keeps them forever",
+                    "type": "integer"
+                },
+                "sampleRate": {
+                    "description": "SampleRate is the share of proxied requests that are stored on routes without a sampling rule, from 0 to 1",
+                    "type": "number"
+                },
+                "upstreamUrl": {
+                    "description": "UpstreamUrl is the upstream of the default project",
+                    "type": "string"
+                }
+            }
         }
     }
 }`
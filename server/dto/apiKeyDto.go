@@ -0,0 +1,66 @@
+package dto
+
+import (
+	"time"
+	"treblle/model"
+)
+
+type ApiKeyDto struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // Prefix is the start of the key
+	Scopes     []string `json:"scopes"`
+	ProjectID  uint     `json:"projectId"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	RevokedAt  string   `json:"revokedAt,omitempty"`
+	CreatedAt  string   `json:"createdAt"`
+}
+
+func (dto *ApiKeyDto) FromModel(m model.ApiKey) {
+	dto.ID = m.ID
+	dto.Name = m.Name
+	dto.Prefix = m.Prefix
+	dto.ProjectID = m.ProjectID
+	dto.Scopes = make([]string, len(m.Scopes))
+	for i, scope := range m.Scopes {
+		dto.Scopes[i] = string(scope)
+	}
+	if m.ExpiresAt != nil {
+		dto.ExpiresAt = m.ExpiresAt.String()
+	}
+	if m.LastUsedAt != nil {
+		dto.LastUsedAt = m.LastUsedAt.String()
+	}
+	if m.RevokedAt != nil {
+		dto.RevokedAt = m.RevokedAt.String()
+	}
+	dto.CreatedAt = m.CreatedAt.String()
+}
+
+// NewApiKeyDto creates an api key, scopes are read_requests, read_stats and manage_config
+type NewApiKeyDto struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=read_requests read_stats manage_config"`
+	ProjectID uint       `json:"projectId"` // ProjectID is the only project the key can read, 0 is the default project
+	ExpiresAt *time.Time `json:"expiresAt"` // ExpiresAt is an RFC3339 time, keys without it don't expire
+}
+
+func (dto NewApiKeyDto) ToModel() model.ApiKey {
+	scopes := make(model.ApiKeyScopes, len(dto.Scopes))
+	for i, scope := range dto.Scopes {
+		scopes[i] = model.ApiKeyScope(scope)
+	}
+	return model.ApiKey{
+		Name:      dto.Name,
+		Scopes:    scopes,
+		ProjectID: dto.ProjectID,
+		ExpiresAt: dto.ExpiresAt,
+	}
+}
+
+// CreatedApiKeyDto is only returned once, the key can't be read again
+type CreatedApiKeyDto struct {
+	ApiKeyDto
+	Key string `json:"key"`
+}
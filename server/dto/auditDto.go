@@ -0,0 +1,38 @@
+package dto
+
+import "treblle/model"
+
+// AuditQuery filters the audit log
+type AuditQuery struct {
+	Actor  string `form:"actor"`
+	Action string `form:"action"`
+	Target string `form:"target"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// AuditEntryDto is a recorded change, changes holds the before and after value of every changed field
+type AuditEntryDto struct {
+	ID        uint               `json:"id"`
+	Actor     string             `json:"actor"`
+	Action    string             `json:"action"`
+	Target    string             `json:"target"`
+	Changes   model.AuditChanges `json:"changes,omitempty"`
+	CreatedAt string             `json:"createdAt"`
+}
+
+func (dto *AuditEntryDto) FromModel(m model.AuditEntry) error {
+	dto.ID = m.ID
+	dto.Actor = m.Actor
+	dto.Action = string(m.Action)
+	dto.Target = m.Target
+	dto.Changes = m.Changes
+	dto.CreatedAt = m.CreatedAt.String()
+
+	return nil
+}
+
+type AuditEntriesDto struct {
+	Data       []AuditEntryDto `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
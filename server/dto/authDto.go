@@ -0,0 +1,45 @@
+package dto
+
+import "treblle/model"
+
+// LoginDto holds the credentials of a dashboard user
+type LoginDto struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// TokenDto is a bearer token for the dashboard api, websockets take it in the access_token query
+type TokenDto struct {
+	Token     string  `json:"token"`
+	ExpiresAt string  `json:"expiresAt"`
+	User      UserDto `json:"user"`
+}
+
+type UserDto struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"` // Role is one of viewer, admin
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+func (dto *UserDto) FromModel(m model.User) {
+	dto.ID = m.ID
+	dto.Email = m.Email
+	dto.Role = string(m.Role)
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+}
+
+// NewUserDto creates a dashboard user
+type NewUserDto struct {
+	Email    string `json:"email" binding:"required,max=320"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=viewer admin"`
+}
+
+// UpdateUserDto changes a dashboard user, empty fields are left unchanged
+type UpdateUserDto struct {
+	Password string `json:"password"`
+	Role     string `json:"role" binding:"omitempty,oneof=viewer admin"`
+}
@@ -0,0 +1,107 @@
+package dto
+
+import (
+	"treblle/model"
+)
+
+type ApiSpecDto struct {
+	ID        uint   `json:"id"`
+	Title     string `json:"title"`
+	Version   string `json:"version"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (dto *ApiSpecDto) FromModel(m model.ApiSpec) error {
+	dto.ID = m.ID
+	dto.Title = m.Title
+	dto.Version = m.Version
+	dto.CreatedAt = m.CreatedAt.String()
+
+	return nil
+}
+
+type ViolationDto struct {
+	ID        uint   `json:"id"`
+	RequestID uint   `json:"requestId"`
+	SpecID    uint   `json:"specId"`
+	Kind      string `json:"kind"`
+	Method    string `json:"method"`
+	Endpoint  string `json:"endpoint"`
+	Message   string `json:"message"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (dto *ViolationDto) FromModel(m model.Violation) error {
+	dto.ID = m.ID
+	dto.RequestID = m.RequestID
+	dto.SpecID = m.SpecID
+	dto.Kind = string(m.Kind)
+	dto.Method = m.Method
+	dto.Endpoint = m.Endpoint
+	dto.Message = m.Message
+	dto.CreatedAt = m.CreatedAt.String()
+
+	return nil
+}
+
+type ViolationsDto struct {
+	Data       []ViolationDto `json:"data"`
+	Pagination Pagination     `json:"pagination"`
+}
+
+type ViolationsQuery struct {
+	RequestID uint   `form:"request_id"`
+	Kind      string `form:"kind"`
+	Endpoint  string `form:"endpoint"`
+	Limit     int    `form:"limit"`
+	Offset    int    `form:"offset"`
+}
+
+// ContractErrorDto is returned to proxy clients when an enforced api spec rejects their request
+type ContractErrorDto struct {
+	Error      string         `json:"error"`
+	Violations []ViolationDto `json:"violations"`
+}
+
+type BreakingChangeDto struct {
+	Kind      string   `json:"kind"`
+	Method    string   `json:"method"`
+	Endpoint  string   `json:"endpoint"`
+	Parameter string   `json:"parameter,omitempty"`
+	Status    int      `json:"status,omitempty"`
+	Details   []string `json:"details,omitempty"`
+	Calls     int64    `json:"calls"`
+}
+
+func (dto *BreakingChangeDto) FromModel(m model.BreakingChange) error {
+	dto.Kind = string(m.Kind)
+	dto.Method = m.Method
+	dto.Endpoint = m.Endpoint
+	dto.Parameter = m.Parameter
+	dto.Status = m.Status
+	dto.Details = m.Details
+	dto.Calls = m.Calls
+
+	return nil
+}
+
+type BreakingChangeReportDto struct {
+	SpecID         uint                `json:"specId"`
+	PreviousSpecID *uint               `json:"previousSpecId"`
+	Since          string              `json:"since"`
+	Observed       int64               `json:"observed"`
+	Changes        []BreakingChangeDto `json:"changes"`
+}
+
+func (dto *BreakingChangeReportDto) FromModel(m model.BreakingChangeReport) error {
+	dto.SpecID = m.SpecID
+	dto.PreviousSpecID = m.PreviousSpecID
+	dto.Since = m.Since.String()
+	dto.Observed = m.Observed
+	dto.Changes = make([]BreakingChangeDto, len(m.Changes))
+	for i := range m.Changes {
+		dto.Changes[i].FromModel(m.Changes[i])
+	}
+
+	return nil
+}
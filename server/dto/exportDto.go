@@ -0,0 +1,123 @@
+package dto
+
+import (
+	"encoding/base64"
+	"time"
+	"treblle/model"
+	"unicode/utf8"
+)
+
+const _BASE64_ENCODING = "base64"
+
+// ExportQuery holds the ListRequests filters and the requested export format
+type ExportQuery struct {
+	ListQuery
+	Format string `form:"format"`
+}
+
+// RequestExportDto is a single exported request including captured headers and bodies
+type RequestExportDto struct {
+	ID                   uint                `json:"id"`
+	Source               string              `json:"source,omitempty"`
+	Method               string              `json:"method"`
+	Path                 string              `json:"path"`
+	Query                string              `json:"query,omitempty"`
+	Consumer             string              `json:"consumer,omitempty"`
+	ConsumerSource       string              `json:"consumerSource,omitempty"`
+	Response             int                 `json:"response"`
+	CreatedAt            time.Time           `json:"createdAt"`
+	ResponseTime         time.Time           `json:"responseTime"`
+	Latency              int64               `json:"latency"` //Latency in Milliseconds
+	ProxyError           string              `json:"proxyError,omitempty"`
+	RequestHeaders       map[string][]string `json:"requestHeaders,omitempty"`
+	RequestBody          string              `json:"requestBody,omitempty"`
+	RequestBodyEncoding  string              `json:"requestBodyEncoding,omitempty"`
+	RequestTruncated     bool                `json:"requestTruncated,omitempty"`
+	ResponseHeaders      map[string][]string `json:"responseHeaders,omitempty"`
+	ResponseBody         string              `json:"responseBody,omitempty"`
+	ResponseBodyEncoding string              `json:"responseBodyEncoding,omitempty"`
+	ResponseTruncated    bool                `json:"responseTruncated,omitempty"`
+}
+
+func (dto *RequestExportDto) FromModel(m model.Request) error {
+	dto.ID = m.ID
+	dto.Source = m.Source
+	dto.Method = m.Method
+	dto.Path = m.Path
+	dto.Query = m.Query
+	dto.Consumer = m.Consumer
+	dto.ConsumerSource = m.ConsumerSource
+	dto.Response = m.Response
+	dto.CreatedAt = m.CreatedAt
+	dto.ResponseTime = m.ResponseTime
+	dto.Latency = m.Latency.Milliseconds()
+	dto.ProxyError = m.ProxyError
+	dto.RequestHeaders = m.RequestHeaders
+	dto.RequestBody, dto.RequestBodyEncoding = EncodeBody(m.RequestBody)
+	dto.RequestTruncated = m.RequestTruncated
+	dto.ResponseHeaders = m.ResponseHeaders
+	dto.ResponseBody, dto.ResponseBodyEncoding = EncodeBody(m.ResponseBody)
+	dto.ResponseTruncated = m.ResponseTruncated
+
+	return nil
+}
+
+// ToModel converts the exported request back to a model, used when importing
+func (dto *RequestExportDto) ToModel() (*model.Request, error) {
+	requestBody, err := DecodeBody(dto.RequestBody, dto.RequestBodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := DecodeBody(dto.ResponseBody, dto.ResponseBodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	responseTime := dto.ResponseTime
+	latency := time.Duration(dto.Latency) * time.Millisecond
+	if responseTime.IsZero() && dto.Response != 0 {
+		responseTime = dto.CreatedAt.Add(latency)
+	}
+
+	return &model.Request{
+		Method:            dto.Method,
+		Path:              dto.Path,
+		Query:             dto.Query,
+		Consumer:          dto.Consumer,
+		ConsumerSource:    dto.ConsumerSource,
+		Response:          dto.Response,
+		CreatedAt:         dto.CreatedAt,
+		ResponseTime:      responseTime,
+		Latency:           latency,
+		ProxyError:        dto.ProxyError,
+		RequestHeaders:    dto.RequestHeaders,
+		RequestBody:       requestBody,
+		RequestTruncated:  dto.RequestTruncated,
+		ResponseHeaders:   dto.ResponseHeaders,
+		ResponseBody:      responseBody,
+		ResponseTruncated: dto.ResponseTruncated,
+	}, nil
+}
+
+// EncodeBody returns body as text, binary bodies are base64 encoded and
+// the returned encoding is set to "base64"
+func EncodeBody(body []byte) (text string, encoding string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), _BASE64_ENCODING
+}
+
+// DecodeBody reverses EncodeBody
+func DecodeBody(text, encoding string) ([]byte, error) {
+	if text == "" {
+		return nil, nil
+	}
+	if encoding == _BASE64_ENCODING {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,235 @@
+package dto
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"treblle/model"
+)
+
+// HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+
+const (
+	HarVersion     = "1.2"
+	_HTTP_VERSION  = "HTTP/1.1"
+	_HAR_UNKNOWN   = -1
+	_HAR_MIME_TYPE = "application/octet-stream"
+)
+
+type HarDto struct {
+	Log HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // not in the spec but used by browsers for binary bodies
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HarTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHarCreator returns the creator block written to exported HAR files
+func NewHarCreator(version string) HarCreator {
+	return HarCreator{Name: "treblle", Version: version}
+}
+
+// FromModel populates the HAR entry from a request, baseUrl is prepended to the
+// stored path because the request log does not keep the upstream host
+func (dto *HarEntry) FromModel(m model.Request, baseUrl string) error {
+	reqUrl := strings.TrimSuffix(baseUrl, "/") + m.Path
+	if m.Query != "" {
+		reqUrl += "?" + m.Query
+	}
+	latencyMs := float64(m.Latency) / float64(time.Millisecond)
+
+	dto.StartedDateTime = m.CreatedAt
+	dto.Time = latencyMs
+	dto.Timings = HarTimings{Send: 0, Wait: latencyMs, Receive: 0}
+
+	dto.Request = HarRequest{
+		Method:      m.Method,
+		Url:         reqUrl,
+		HttpVersion: _HTTP_VERSION,
+		Cookies:     []HarNameValue{},
+		Headers:     harHeaders(m.RequestHeaders),
+		QueryString: harQuery(m.Query),
+		HeadersSize: _HAR_UNKNOWN,
+		BodySize:    len(m.RequestBody),
+	}
+	if len(m.RequestBody) > 0 {
+		text, encoding := EncodeBody(m.RequestBody)
+		dto.Request.PostData = &HarPostData{
+			MimeType: harMimeType(m.RequestHeaders),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+
+	text, encoding := EncodeBody(m.ResponseBody)
+	dto.Response = HarResponse{
+		Status:      m.Response,
+		StatusText:  http.StatusText(m.Response),
+		HttpVersion: _HTTP_VERSION,
+		Cookies:     []HarNameValue{},
+		Headers:     harHeaders(m.ResponseHeaders),
+		Content: HarContent{
+			Size:     len(m.ResponseBody),
+			MimeType: harMimeType(m.ResponseHeaders),
+			Text:     text,
+			Encoding: encoding,
+		},
+		HeadersSize: _HAR_UNKNOWN,
+		BodySize:    len(m.ResponseBody),
+	}
+
+	return nil
+}
+
+// ToModel converts the HAR entry to a request, the host of the url is dropped
+// because the request log only keeps the path of the upstream api
+func (dto *HarEntry) ToModel() (*model.Request, error) {
+	reqUrl, err := url.Parse(dto.Request.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	var requestBody []byte
+	if dto.Request.PostData != nil {
+		requestBody, err = DecodeBody(dto.Request.PostData.Text, dto.Request.PostData.Encoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	responseBody, err := DecodeBody(dto.Response.Content.Text, dto.Response.Content.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	path := reqUrl.Path
+	if path == "" {
+		path = "/"
+	}
+	latency := time.Duration(dto.Time * float64(time.Millisecond))
+
+	return &model.Request{
+		Method:          strings.ToUpper(dto.Request.Method),
+		Path:            path,
+		Query:           reqUrl.RawQuery,
+		Response:        dto.Response.Status,
+		CreatedAt:       dto.StartedDateTime,
+		ResponseTime:    dto.StartedDateTime.Add(latency),
+		Latency:         latency,
+		RequestHeaders:  modelHeaders(dto.Request.Headers),
+		RequestBody:     requestBody,
+		ResponseHeaders: modelHeaders(dto.Response.Headers),
+		ResponseBody:    responseBody,
+	}, nil
+}
+
+func modelHeaders(headers []HarNameValue) model.Headers {
+	h := http.Header{}
+	for _, header := range headers {
+		// HTTP/2 pseudo headers like :authority are not real headers
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		h.Add(header.Name, header.Value)
+	}
+	return model.HeadersFrom(h)
+}
+
+func harHeaders(headers model.Headers) []HarNameValue {
+	rez := make([]HarNameValue, 0, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			rez = append(rez, HarNameValue{Name: name, Value: value})
+		}
+	}
+	// map iteration order is random, keep exports stable
+	sort.SliceStable(rez, func(i, j int) bool { return rez[i].Name < rez[j].Name })
+	return rez
+}
+
+func harQuery(rawQuery string) []HarNameValue {
+	rez := []HarNameValue{}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rez
+	}
+	for name, list := range values {
+		for _, value := range list {
+			rez = append(rez, HarNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(rez, func(i, j int) bool { return rez[i].Name < rez[j].Name })
+	return rez
+}
+
+func harMimeType(headers model.Headers) string {
+	if values := headers.Http().Values("Content-Type"); len(values) > 0 {
+		return values[0]
+	}
+	return _HAR_MIME_TYPE
+}
@@ -0,0 +1,51 @@
+package dto
+
+import (
+	"treblle/model"
+)
+
+// ImportForm is the multipart form for uploading a traffic file
+type ImportForm struct {
+	Source string `form:"source" binding:"required,max=50"`
+	Format string `form:"format"`
+}
+
+type ImportJobDto struct {
+	ID        uint    `json:"id"`
+	Source    string  `json:"source"`
+	Format    string  `json:"format"`
+	FileName  string  `json:"fileName"`
+	Status    string  `json:"status"`
+	Progress  float64 `json:"progress"` // Progress in percent of the file read
+	Processed int64   `json:"processed"`
+	Imported  int64   `json:"imported"`
+	Skipped   int64   `json:"skipped"` // Skipped counts duplicates
+	Failed    int64   `json:"failed"`
+	Error     string  `json:"error,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+func (dto *ImportJobDto) FromModel(m model.ImportJob) error {
+	dto.ID = m.ID
+	dto.Source = m.Source
+	dto.Format = m.Format
+	dto.FileName = m.FileName
+	dto.Status = string(m.Status)
+	dto.Processed = m.Processed
+	dto.Imported = m.Imported
+	dto.Skipped = m.Skipped
+	dto.Failed = m.Failed
+	dto.Error = m.Error
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+
+	switch {
+	case m.Status == model.ImportCompleted:
+		dto.Progress = 100
+	case m.FileSize > 0:
+		dto.Progress = float64(m.Offset) / float64(m.FileSize) * 100
+	}
+
+	return nil
+}
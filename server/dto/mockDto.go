@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"treblle/model"
+)
+
+// MockRouteDto turns mock mode on or off for every proxied path under path
+type MockRouteDto struct {
+	ID                   uint   `json:"id"`
+	Method               string `json:"method" binding:"max=10"` // Method limits the route to one method, empty is any
+	Path                 string `json:"path" binding:"required,max=150"`
+	Enabled              bool   `json:"enabled"`
+	Strategy             string `json:"strategy" binding:"omitempty,oneof=path query body"`           // Strategy overrides MOCK_STRATEGY if set
+	Fallback             string `json:"fallback" binding:"omitempty,oneof=404 passthrough synthetic"` // Fallback overrides MOCK_FALLBACK if set
+	SyntheticStatus      int    `json:"syntheticStatus" binding:"omitempty,min=100,max=599"`
+	SyntheticContentType string `json:"syntheticContentType" binding:"max=100"`
+	SyntheticBody        string `json:"syntheticBody"`
+	CreatedAt            string `json:"createdAt"`
+	UpdatedAt            string `json:"updatedAt"`
+}
+
+func (dto *MockRouteDto) FromModel(m model.MockRoute) error {
+	dto.ID = m.ID
+	dto.Method = m.Method
+	dto.Path = m.Path
+	dto.Enabled = m.Enabled
+	dto.Strategy = string(m.Strategy)
+	dto.Fallback = string(m.Fallback)
+	dto.SyntheticStatus = m.SyntheticStatus
+	dto.SyntheticContentType = m.SyntheticContentType
+	dto.SyntheticBody = m.SyntheticBody
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+
+	return nil
+}
+
+func (dto *MockRouteDto) ToModel() model.MockRoute {
+	return model.MockRoute{
+		ID:                   dto.ID,
+		Method:               dto.Method,
+		Path:                 dto.Path,
+		Enabled:              dto.Enabled,
+		Strategy:             model.MockStrategy(dto.Strategy),
+		Fallback:             model.MockFallback(dto.Fallback),
+		SyntheticStatus:      dto.SyntheticStatus,
+		SyntheticContentType: dto.SyntheticContentType,
+		SyntheticBody:        dto.SyntheticBody,
+	}
+}
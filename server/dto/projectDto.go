@@ -0,0 +1,45 @@
+package dto
+
+import "treblle/model"
+
+// ProjectDto is a team's share of the traffic, proxied requests reach it by the X-Project-Key header or the /proxy/<slug>/ prefix
+type ProjectDto struct {
+	ID                 uint   `json:"id"`
+	Name               string `json:"name" binding:"required,max=100"`
+	Slug               string `json:"slug" binding:"required,max=50"`
+	UpstreamUrl        string `json:"upstreamUrl" binding:"required,url,max=500"`
+	IngestionKeyPrefix string `json:"ingestionKeyPrefix"` // IngestionKeyPrefix is the start of the ingestion key
+	CreatedAt          string `json:"createdAt,omitempty"`
+	UpdatedAt          string `json:"updatedAt,omitempty"`
+}
+
+func (dto *ProjectDto) FromModel(m model.Project) {
+	dto.ID = m.ID
+	dto.Name = m.Name
+	dto.Slug = m.Slug
+	dto.UpstreamUrl = m.UpstreamUrl
+	dto.IngestionKeyPrefix = m.IngestionKeyPrefix
+	if !m.CreatedAt.IsZero() {
+		dto.CreatedAt = m.CreatedAt.String()
+		dto.UpdatedAt = m.UpdatedAt.String()
+	}
+}
+
+func (dto ProjectDto) ToModel() model.Project {
+	return model.Project{
+		Name:        dto.Name,
+		Slug:        dto.Slug,
+		UpstreamUrl: dto.UpstreamUrl,
+	}
+}
+
+// IngestionKeyDto is only returned once, the key can't be read again
+type IngestionKeyDto struct {
+	ProjectDto
+	IngestionKey string `json:"ingestionKey"`
+}
+
+// ProjectMemberDto adds a user to a project
+type ProjectMemberDto struct {
+	UserID uint `json:"userId" binding:"required"`
+}
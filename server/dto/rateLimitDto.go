@@ -0,0 +1,48 @@
+package dto
+
+import (
+	"time"
+	"treblle/model"
+)
+
+// RateLimitRuleDto limits every proxied path under path, or exempts it from the default limit when disabled
+type RateLimitRuleDto struct {
+	ID            uint   `json:"id"`
+	Method        string `json:"method" binding:"max=10"` // Method limits the rule to one method, empty is any
+	Path          string `json:"path" binding:"required,max=150"`
+	Enabled       bool   `json:"enabled"`
+	Algorithm     string `json:"algorithm" binding:"required_if=Enabled true,omitempty,oneof=token_bucket sliding_window"`
+	Key           string `json:"key" binding:"required_if=Enabled true,omitempty,oneof=ip api_key route"`
+	Limit         int    `json:"limit" binding:"required_if=Enabled true,min=0"` // Limit is the number of requests allowed per window
+	WindowSeconds int    `json:"windowSeconds" binding:"required_if=Enabled true,min=0"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+func (dto *RateLimitRuleDto) FromModel(m model.RateLimitRule) error {
+	dto.ID = m.ID
+	dto.Method = m.Method
+	dto.Path = m.Path
+	dto.Enabled = m.Enabled
+	dto.Algorithm = string(m.Algorithm)
+	dto.Key = string(m.Key)
+	dto.Limit = m.Limit
+	dto.WindowSeconds = int(m.Window / time.Second)
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+
+	return nil
+}
+
+func (dto *RateLimitRuleDto) ToModel() model.RateLimitRule {
+	return model.RateLimitRule{
+		ID:        dto.ID,
+		Method:    dto.Method,
+		Path:      dto.Path,
+		Enabled:   dto.Enabled,
+		Algorithm: model.RateLimitAlgorithm(dto.Algorithm),
+		Key:       model.RateLimitKey(dto.Key),
+		Limit:     dto.Limit,
+		Window:    time.Duration(dto.WindowSeconds) * time.Second,
+	}
+}
@@ -0,0 +1,109 @@
+package dto
+
+import (
+	"treblle/model"
+)
+
+// CreateReplayDto selects recorded requests by ids or by a filter and replays them against targetUrl
+type CreateReplayDto struct {
+	TargetUrl      string           `json:"targetUrl" binding:"required,url"`
+	RequestIDs     []uint           `json:"requestIds"`
+	Filter         *ReplayFilterDto `json:"filter"`
+	Limit          int              `json:"limit" binding:"gte=0"`     // Limit is the max number of replayed requests, 0 is all
+	PreserveTiming bool             `json:"preserveTiming"`            // PreserveTiming keeps the original delays between requests
+	RateLimit      float64          `json:"rateLimit" binding:"gte=0"` // RateLimit is the max number of requests per second, 0 is unlimited
+}
+
+// ReplayFilterDto has the same meaning as the ListRequests query parameters
+type ReplayFilterDto struct {
+	Search   string `json:"search"`
+	Method   string `json:"method"`
+	Response int    `json:"response"`
+	Source   string `json:"source"`
+}
+
+type ReplayDto struct {
+	ID             uint    `json:"id"`
+	TargetUrl      string  `json:"targetUrl"`
+	PreserveTiming bool    `json:"preserveTiming"`
+	RateLimit      float64 `json:"rateLimit"`
+	Status         string  `json:"status"`
+	Total          int64   `json:"total"`
+	Processed      int64   `json:"processed"`
+	StatusDiffs    int64   `json:"statusDiffs"`
+	BodyDiffs      int64   `json:"bodyDiffs"`
+	Errors         int64   `json:"errors"`
+	Error          string  `json:"error,omitempty"`
+	CreatedAt      string  `json:"createdAt"`
+	FinishedAt     string  `json:"finishedAt,omitempty"`
+}
+
+func (dto *ReplayDto) FromModel(m model.Replay) error {
+	dto.ID = m.ID
+	dto.TargetUrl = m.TargetUrl
+	dto.PreserveTiming = m.PreserveTiming
+	dto.RateLimit = m.RateLimit
+	dto.Status = string(m.Status)
+	dto.Total = m.Total
+	dto.Processed = m.Processed
+	dto.StatusDiffs = m.StatusDiffs
+	dto.BodyDiffs = m.BodyDiffs
+	dto.Errors = m.Errors
+	dto.Error = m.Error
+	dto.CreatedAt = m.CreatedAt.String()
+	if m.FinishedAt != nil {
+		dto.FinishedAt = m.FinishedAt.String()
+	}
+
+	return nil
+}
+
+type ReplayResultsDto struct {
+	Data       []ReplayResultDto `json:"data"`
+	Pagination Pagination        `json:"pagination"`
+}
+
+type ReplayResultDto struct {
+	ID               uint   `json:"id"`
+	RequestID        uint   `json:"requestId"`
+	Method           string `json:"method"`
+	Path             string `json:"path"`
+	OriginalStatus   int    `json:"originalStatus"`
+	ReplayStatus     int    `json:"replayStatus"`
+	OriginalLatency  int64  `json:"originalLatency"` // OriginalLatency in Milliseconds
+	ReplayLatency    int64  `json:"replayLatency"`   // ReplayLatency in Milliseconds
+	LatencyDiff      int64  `json:"latencyDiff"`     // LatencyDiff in Milliseconds, positive if the replay was slower
+	OriginalBodyHash string `json:"originalBodyHash"`
+	ReplayBodyHash   string `json:"replayBodyHash"`
+	StatusMatch      bool   `json:"statusMatch"`
+	BodyMatch        *bool  `json:"bodyMatch"` // BodyMatch is null when the recorded body is missing or cut
+	Error            string `json:"error,omitempty"`
+}
+
+func (dto *ReplayResultDto) FromModel(m model.ReplayResult) error {
+	dto.ID = m.ID
+	dto.RequestID = m.RequestID
+	dto.Method = m.Method
+	dto.Path = m.Path
+	dto.OriginalStatus = m.OriginalStatus
+	dto.ReplayStatus = m.ReplayStatus
+	dto.OriginalLatency = m.OriginalLatency.Milliseconds()
+	dto.ReplayLatency = m.ReplayLatency.Milliseconds()
+	dto.LatencyDiff = dto.ReplayLatency - dto.OriginalLatency
+	dto.OriginalBodyHash = m.OriginalBodyHash
+	dto.ReplayBodyHash = m.ReplayBodyHash
+	dto.StatusMatch = m.StatusMatch
+	if !m.BodyUnknown {
+		dto.BodyMatch = &m.BodyMatch
+	}
+	dto.Error = m.Error
+
+	return nil
+}
+
+// ReplayResultsQuery holds the pagination of replay results
+type ReplayResultsQuery struct {
+	OnlyDiffs bool `form:"only_diffs"`
+	Limit     int  `form:"limit"`
+	Offset    int  `form:"offset"`
+}
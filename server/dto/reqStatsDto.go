@@ -10,8 +10,12 @@ type RequestStatistics struct {
 	AverageLatencyMs float64          `json:"average_latency_ms"`
 	ClientErrorCount int64            `json:"client_error_count"`
 	ServerErrorCount int64            `json:"server_error_count"`
+	RateLimitedCount int64            `json:"rate_limited_count"`
+	ProxyErrorCount  int64            `json:"proxy_error_count"` // ProxyErrorCount counts requests the upstream never answered, apart from the server errors
 	RequestsPerPath  []PathStatistics `json:"requests_per_path"`
-	Timestamp        int64            `json:"timestamp,omitempty"`
+	// ViolationsPerEndpoint aggregates api contract violations, empty without an uploaded spec
+	ViolationsPerEndpoint []EndpointViolations `json:"violations_per_endpoint"`
+	Timestamp             int64                `json:"timestamp,omitempty"`
 }
 
 // PathStatistics holds the detailed statistics grouped by path
@@ -21,17 +25,44 @@ type PathStatistics struct {
 	AverageLatencyMs float64 `json:"average_latency_ms"`
 	ClientErrorCount int64   `json:"client_error_count"`
 	ServerErrorCount int64   `json:"server_error_count"`
+	RateLimitedCount int64   `json:"rate_limited_count"`
+	ProxyErrorCount  int64   `json:"proxy_error_count"`
 	Timestamp        int64   `json:"timestamp,omitempty"`
 }
 
+// EndpointViolations holds the api contract violations of one spec endpoint
+type EndpointViolations struct {
+	Method         string           `json:"method"`
+	Endpoint       string           `json:"endpoint"`
+	RequestCount   int64            `json:"request_count"`
+	ViolationCount int64            `json:"violation_count"`
+	Kinds          map[string]int64 `json:"kinds"` // Kinds counts violations by kind, e.g. bad_parameter
+}
+
 // FromModel populates the RequestStatistics DTO from the service's AllRequestStatistics struct.
 // It receives a pointer to modify the DTO instance directly.
 func (dto *RequestStatistics) FromModel(stats *model.AllRequestStatistics) {
 	if stats == nil || stats.StatsPerPath == nil {
 		// Ensure it's an empty slice, not nil
 		dto.RequestsPerPath = []PathStatistics{}
+		dto.ViolationsPerEndpoint = []EndpointViolations{}
 		return
 	}
+
+	dto.ViolationsPerEndpoint = make([]EndpointViolations, len(stats.ViolationsPerEndpoint))
+	for i, serviceStat := range stats.ViolationsPerEndpoint {
+		kinds := make(map[string]int64, len(serviceStat.Kinds))
+		for kind, count := range serviceStat.Kinds {
+			kinds[string(kind)] = count
+		}
+		dto.ViolationsPerEndpoint[i] = EndpointViolations{
+			Method:         serviceStat.Method,
+			Endpoint:       serviceStat.Endpoint,
+			RequestCount:   serviceStat.RequestCount,
+			ViolationCount: serviceStat.ViolationCount,
+			Kinds:          kinds,
+		}
+	}
 	var sum float64
 	now := time.Now()
 
@@ -40,6 +71,8 @@ func (dto *RequestStatistics) FromModel(stats *model.AllRequestStatistics) {
 
 		dto.ClientErrorCount += serviceStat.ClientErrorCount
 		dto.ServerErrorCount += serviceStat.ServerErrorCount
+		dto.RateLimitedCount += serviceStat.RateLimitedCount
+		dto.ProxyErrorCount += serviceStat.ProxyErrorCount
 		dto.RequestCount += serviceStat.RequestCount
 		sum += serviceStat.AverageLatencyMs * float64(serviceStat.RequestCount)
 
@@ -49,6 +82,8 @@ func (dto *RequestStatistics) FromModel(stats *model.AllRequestStatistics) {
 			AverageLatencyMs: serviceStat.AverageLatencyMs, // Already in ms from the service
 			ClientErrorCount: serviceStat.ClientErrorCount,
 			ServerErrorCount: serviceStat.ServerErrorCount,
+			RateLimitedCount: serviceStat.RateLimitedCount,
+			ProxyErrorCount:  serviceStat.ProxyErrorCount,
 			Timestamp:        now.UnixMilli(),
 		}
 	}
@@ -57,3 +92,28 @@ func (dto *RequestStatistics) FromModel(stats *model.AllRequestStatistics) {
 	}
 	dto.Timestamp = now.UnixMilli()
 }
+
+// ConsumerStatistics holds the aggregated statistics of one api consumer
+type ConsumerStatistics struct {
+	Consumer         string  `json:"consumer"`
+	ConsumerSource   string  `json:"consumer_source"` // ConsumerSource is how the consumer was identified, one of api_key, jwt, jwt_unverified, basic, ip
+	RequestCount     int64   `json:"request_count"`
+	AverageLatencyMs float64 `json:"average_latency_ms"`
+	ClientErrorCount int64   `json:"client_error_count"`
+	ServerErrorCount int64   `json:"server_error_count"`
+	RateLimitedCount int64   `json:"rate_limited_count"`
+	ProxyErrorCount  int64   `json:"proxy_error_count"`
+	LastSeen         string  `json:"last_seen"`
+}
+
+func (dto *ConsumerStatistics) FromModel(m model.ConsumerStatistics) {
+	dto.Consumer = m.Consumer
+	dto.ConsumerSource = m.ConsumerSource
+	dto.RequestCount = m.RequestCount
+	dto.AverageLatencyMs = m.AverageLatencyMs
+	dto.ClientErrorCount = m.ClientErrorCount
+	dto.ServerErrorCount = m.ServerErrorCount
+	dto.RateLimitedCount = m.RateLimitedCount
+	dto.ProxyErrorCount = m.ProxyErrorCount
+	dto.LastSeen = m.LastSeen.String()
+}
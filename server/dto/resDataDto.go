@@ -16,23 +16,31 @@ type Pagination struct {
 }
 
 type RequestsDto struct {
-	ID           uint   `json:"id"`
-	Method       string `json:"method"`
-	Response     int    `json:"response"`
-	Path         string `json:"path"`
-	ResponseTime string `json:"responseTime"`
-	CreatedAt    string `json:"createdAt"`
-	Latency      int64  `json:"latency"` //Latency in Milliseconds
+	ID           uint    `json:"id"`
+	Source       string  `json:"source"`
+	Method       string  `json:"method"`
+	Response     int     `json:"response"`
+	Path         string  `json:"path"`
+	Consumer     string  `json:"consumer"`
+	ResponseTime string  `json:"responseTime"`
+	CreatedAt    string  `json:"createdAt"`
+	Latency      int64   `json:"latency"`              //Latency in Milliseconds
+	SampleWeight float64 `json:"sampleWeight"`         // SampleWeight is the number of proxied requests this one stands for
+	ProxyError   string  `json:"proxyError,omitempty"` // ProxyError is why the upstream never answered, e.g. timeout, the response is synthetic then
 }
 
 func (dto *RequestsDto) FromModel(m model.Request) error {
 	dto.ID = m.ID
+	dto.Source = m.Source
 	dto.Method = m.Method
 	dto.Response = m.Response
 	dto.Path = m.Path
+	dto.Consumer = m.Consumer
 	dto.ResponseTime = m.ResponseTime.String()
 	dto.CreatedAt = m.CreatedAt.String()
 	dto.Latency = m.Latency.Milliseconds()
+	dto.SampleWeight = m.Weight()
+	dto.ProxyError = m.ProxyError
 
 	return nil
 }
@@ -4,6 +4,8 @@ type ListQuery struct {
 	Search    string `form:"search"`
 	Method    string `form:"method" `      //binding:"oneof=GET POST PUT DELETE PATCH HEAD OPTION TRACE CONNECT"
 	Response  int    `form:"response,one"` // Gin binds '0' if not present
+	Source    string `form:"source"`
+	Consumer  string `form:"consumer"`
 	Limit     int    `form:"limit"`
 	Offset    int    `form:"offset"`
 	SortBy    string `form:"sort_by"`
@@ -0,0 +1,51 @@
+package dto
+
+import (
+	"time"
+	"treblle/model"
+)
+
+// SamplingRuleDto samples every proxied path under path at rate instead of the runtime sample rate
+type SamplingRuleDto struct {
+	ID              uint     `json:"id"`
+	Method          string   `json:"method" binding:"max=10"` // Method limits the rule to one method, empty is any
+	Path            string   `json:"path" binding:"required,max=150"`
+	Rate            *float64 `json:"rate" binding:"required,min=0,max=1"`            // Rate is the share of requests that are stored
+	Mode            string   `json:"mode" binding:"omitempty,oneof=head tail"`       // Mode is head by default, tail decides when the response arrives
+	KeepStatus      int      `json:"keepStatus" binding:"omitempty,min=100,max=599"` // KeepStatus keeps every response with a status from it up, tail only
+	SlowThresholdMs int64    `json:"slowThresholdMs" binding:"min=0"`                // SlowThresholdMs keeps every request at least as slow, tail only
+	KeyHeader       string   `json:"keyHeader" binding:"max=100"`                    // KeyHeader holds the trace or request id requests are sampled by
+	CreatedAt       string   `json:"createdAt"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+
+func (dto *SamplingRuleDto) FromModel(m model.SamplingRule) error {
+	dto.ID = m.ID
+	dto.Method = m.Method
+	dto.Path = m.Path
+	dto.Rate = &m.Rate
+	dto.Mode = string(m.Mode)
+	dto.KeepStatus = m.KeepStatus
+	dto.SlowThresholdMs = m.SlowThreshold.Milliseconds()
+	dto.KeyHeader = m.KeyHeader
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+
+	return nil
+}
+
+func (dto *SamplingRuleDto) ToModel() model.SamplingRule {
+	rule := model.SamplingRule{
+		ID:            dto.ID,
+		Method:        dto.Method,
+		Path:          dto.Path,
+		Mode:          model.SamplingMode(dto.Mode),
+		KeepStatus:    dto.KeepStatus,
+		SlowThreshold: time.Duration(dto.SlowThresholdMs) * time.Millisecond,
+		KeyHeader:     dto.KeyHeader,
+	}
+	if dto.Rate != nil {
+		rule.Rate = *dto.Rate
+	}
+	return rule
+}
@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"fmt"
+	"time"
+	"treblle/model"
+)
+
+// ViewDto is a saved filter, sort and time range of the request log
+type ViewDto struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name" binding:"required,max=100"`
+	Shared    bool       `json:"shared"` // Shared views are seen by everyone with access to the project, others only by their owner
+	Search    string     `json:"search" binding:"max=1000"`
+	Method    string     `json:"method" binding:"max=10"`
+	Response  *int       `json:"response" binding:"omitempty,min=100,max=599"`
+	Source    string     `json:"source" binding:"max=50"`
+	Consumer  string     `json:"consumer" binding:"max=200"`
+	SortBy    string     `json:"sortBy" binding:"omitempty,oneof=created_at response_time latency"`
+	Order     string     `json:"order" binding:"omitempty,oneof=asc desc"`
+	Last      string     `json:"last,omitempty"`      // Last is a relative time range ending when the view is applied, e.g. 1h or 15m
+	StartTime *time.Time `json:"startTime,omitempty"` // StartTime and EndTime are an absolute RFC3339 time range, used without last
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	CreatedAt string     `json:"createdAt"`
+	UpdatedAt string     `json:"updatedAt"`
+}
+
+func (dto *ViewDto) FromModel(m model.View) {
+	dto.ID = m.ID
+	dto.Name = m.Name
+	dto.Shared = m.Shared()
+	dto.Search = m.Search
+	dto.Method = m.Method
+	dto.Response = m.Response
+	dto.Source = m.Source
+	dto.Consumer = m.Consumer
+	dto.SortBy = m.SortBy
+	dto.Order = m.Order
+	if m.Last > 0 {
+		dto.Last = m.Last.String()
+	}
+	dto.StartTime = m.StartTime
+	dto.EndTime = m.EndTime
+	dto.CreatedAt = m.CreatedAt.String()
+	dto.UpdatedAt = m.UpdatedAt.String()
+}
+
+// ToModel returns the view of a project, the owner of private views is set by the caller
+func (dto *ViewDto) ToModel(projectID uint) (model.View, error) {
+	view := model.View{
+		ID:        dto.ID,
+		ProjectID: projectID,
+		Name:      dto.Name,
+		Search:    dto.Search,
+		Method:    dto.Method,
+		Response:  dto.Response,
+		Source:    dto.Source,
+		Consumer:  dto.Consumer,
+		SortBy:    dto.SortBy,
+		Order:     dto.Order,
+		StartTime: dto.StartTime,
+		EndTime:   dto.EndTime,
+	}
+	if dto.Last != "" {
+		last, err := time.ParseDuration(dto.Last)
+		if err != nil || last <= 0 {
+			return view, fmt.Errorf("last should be a positive duration, e.g. 1h, got %q", dto.Last)
+		}
+		view.Last = last
+	}
+	return view, nil
+}
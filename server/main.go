@@ -2,6 +2,7 @@ package main
 
 import (
 	"treblle/app"
+	"treblle/command"
 	"treblle/controller"
 	"treblle/service"
 
@@ -16,11 +17,56 @@ func main() {
 	// Provide logger
 	app.Provide(zap.S)
 
+	app.Provide(service.NewRequestStore)
+	app.Provide(service.NewRequestPartitioner)
+	app.Provide(service.NewConfigService)
+	app.Provide(service.NewRuntimeConfig)
+	app.Provide(service.NewAnalyticsSink)
 	app.Provide(service.NewRequestLoggerService)
 	app.Provide(service.NewRequestCrudService)
+	app.Provide(service.NewImportService)
+	app.Provide(service.NewReplayService)
+	app.Provide(service.NewMockService)
+	app.Provide(service.NewMocker)
+	app.Provide(service.NewRateLimitService)
+	app.Provide(service.NewRateLimiter)
+	app.Provide(service.NewOpenApiInferenceService)
+	app.Provide(service.NewContractService)
+	app.Provide(service.NewContractValidator)
+	app.Provide(service.NewAuthService)
+	app.Provide(service.NewAuthenticator)
+	app.Provide(service.NewAuditService)
+	app.Provide(service.NewApiKeyService)
+	app.Provide(service.NewApiKeyAuthenticator)
+	app.Provide(service.NewProjectService)
+	app.Provide(service.NewProjectResolver)
+	app.Provide(service.NewProjectAuthorizer)
+	app.Provide(service.NewViewService)
+	app.Provide(service.NewSamplingService)
 
 	app.RegisterController(controller.NewInfoCnt)
+	app.RegisterController(controller.NewAuthCtn)
+	app.RegisterController(controller.NewApiKeyCtn)
+	app.RegisterController(controller.NewAuditCtn)
+	app.RegisterController(controller.NewProjectCtn)
+	app.RegisterController(controller.NewConfigCtn)
 	app.RegisterController(controller.NewRequestCtn)
+	app.RegisterController(controller.NewImportCtn)
+	app.RegisterController(controller.NewReplayCtn)
+	app.RegisterController(controller.NewMockCtn)
+	app.RegisterController(controller.NewRateLimitCtn)
+	app.RegisterController(controller.NewOpenApiCtn)
+	app.RegisterController(controller.NewViewCtn)
+	app.RegisterController(controller.NewSamplingCtn)
+
+	app.RegisterWorker(service.NewConfigWorker)
+	app.RegisterWorker(service.NewImportWorker)
+	app.RegisterWorker(service.NewReplayWorker)
+	app.RegisterWorker(service.NewOpenApiInferenceWorker)
+	app.RegisterWorker(service.NewAnalyticsWorker)
+	app.RegisterWorker(service.NewRequestPartitionWorker)
+
+	app.RegisterCommand(command.NewImportCmd)
 
 	app.Start()
 }
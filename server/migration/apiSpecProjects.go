@@ -0,0 +1,33 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectApiSpec is the column the migration adds to the api_specs table,
+// specs uploaded before described the only upstream and are kept in the default project
+type projectApiSpec struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectApiSpec) TableName() string {
+	return "api_specs"
+}
+
+var apiSpecProjects = Migration{
+	Version: 14,
+	Name:    "api_spec_projects",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&projectApiSpec{}, "project_id") {
+			return nil
+		}
+		if err := tx.Migrator().AddColumn(&projectApiSpec{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&projectApiSpec{}, "ProjectID")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&projectApiSpec{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&projectApiSpec{}, "project_id")
+	},
+}
@@ -0,0 +1,39 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectInferredSpec is the column the migration adds to the inferred_specs table,
+// a document built before mixes the traffic of every project so it's dropped and rebuilt per project
+type projectInferredSpec struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectInferredSpec) TableName() string {
+	return "inferred_specs"
+}
+
+var inferredSpecProjects = Migration{
+	Version: 8,
+	Name:    "inferred_spec_projects",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&projectInferredSpec{}, "project_id") {
+			return nil
+		}
+		if err := tx.Exec("DELETE FROM inferred_specs").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().AddColumn(&projectInferredSpec{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&projectInferredSpec{}, "ProjectID")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM inferred_specs").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&projectInferredSpec{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&projectInferredSpec{}, "project_id")
+	},
+}
@@ -0,0 +1,214 @@
+package migration
+
+import (
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// initialSchemaModels returns the tables as they were created by AutoMigrate before versioned migrations.
+// The structs are a frozen copy of the models, later model changes get their own migration.
+// On databases created by AutoMigrate the migration finds every table in place and only records itself
+func initialSchemaModels() []any {
+	type Request struct {
+		ID              uint    `gorm:"primarykey"`
+		ProjectID       uint    `gorm:"not null;default:0;index"`
+		Source          string  `gorm:"type:varchar(50);not null;default:proxy;index"`
+		Fingerprint     *string `gorm:"type:varchar(64);uniqueIndex"`
+		Method          string  `gorm:"type:varchar(10);not null"`
+		Response        int     `gorm:"type:int;null"`
+		Path            string  `gorm:"type:varchar(150);not null"`
+		Consumer        string  `gorm:"type:varchar(200);index"`
+		ConsumerSource  string  `gorm:"type:varchar(20)"`
+		Query           string  `gorm:"type:text"`
+		ResponseTime    time.Time
+		CreatedAt       time.Time     `gorm:"not null"`
+		Latency         time.Duration `gorm:"null"`
+		RequestHeaders  string        `gorm:"type:text"`
+		RequestBody     []byte
+		ResponseHeaders string `gorm:"type:text"`
+		ResponseBody    []byte
+	}
+	type ImportJob struct {
+		ID        uint      `gorm:"primarykey"`
+		Source    string    `gorm:"type:varchar(50);not null"`
+		Format    string    `gorm:"type:varchar(10);not null"`
+		FileName  string    `gorm:"type:varchar(255)"`
+		FilePath  string    `gorm:"type:varchar(255);not null"`
+		FileSize  int64     `gorm:"not null;default:0"`
+		Status    string    `gorm:"type:varchar(20);not null;index"`
+		Processed int64     `gorm:"not null;default:0"`
+		Offset    int64     `gorm:"not null;default:0"`
+		Imported  int64     `gorm:"not null;default:0"`
+		Skipped   int64     `gorm:"not null;default:0"`
+		Failed    int64     `gorm:"not null;default:0"`
+		Error     string    `gorm:"type:text"`
+		CreatedAt time.Time `gorm:"not null"`
+		UpdatedAt time.Time
+	}
+	type Replay struct {
+		ID             uint      `gorm:"primarykey"`
+		TargetUrl      string    `gorm:"type:varchar(255);not null"`
+		Selection      string    `gorm:"type:text;not null"`
+		PreserveTiming bool      `gorm:"not null;default:false"`
+		RateLimit      float64   `gorm:"not null;default:0"`
+		Status         string    `gorm:"type:varchar(20);not null;index"`
+		Total          int64     `gorm:"not null;default:0"`
+		Processed      int64     `gorm:"not null;default:0"`
+		StatusDiffs    int64     `gorm:"not null;default:0"`
+		BodyDiffs      int64     `gorm:"not null;default:0"`
+		Errors         int64     `gorm:"not null;default:0"`
+		Error          string    `gorm:"type:text"`
+		CreatedAt      time.Time `gorm:"not null"`
+		UpdatedAt      time.Time
+		FinishedAt     *time.Time
+	}
+	type ReplayResult struct {
+		ID               uint          `gorm:"primarykey"`
+		ReplayID         uint          `gorm:"not null;index"`
+		RequestID        uint          `gorm:"not null"`
+		Method           string        `gorm:"type:varchar(10);not null"`
+		Path             string        `gorm:"type:varchar(150);not null"`
+		OriginalStatus   int           `gorm:"not null"`
+		ReplayStatus     int           `gorm:"not null"`
+		OriginalLatency  time.Duration `gorm:"not null"`
+		ReplayLatency    time.Duration `gorm:"not null"`
+		OriginalBodyHash string        `gorm:"type:varchar(64)"`
+		ReplayBodyHash   string        `gorm:"type:varchar(64)"`
+		StatusMatch      bool          `gorm:"not null"`
+		BodyMatch        bool          `gorm:"not null"`
+		Error            string        `gorm:"type:text"`
+		CreatedAt        time.Time     `gorm:"not null"`
+	}
+	type MockRoute struct {
+		ID                   uint   `gorm:"primarykey"`
+		Method               string `gorm:"type:varchar(10)"`
+		Path                 string `gorm:"type:varchar(150);not null"`
+		Enabled              bool   `gorm:"not null"`
+		Strategy             string `gorm:"type:varchar(20)"`
+		Fallback             string `gorm:"type:varchar(20)"`
+		SyntheticStatus      int
+		SyntheticContentType string `gorm:"type:varchar(100)"`
+		SyntheticBody        string `gorm:"type:text"`
+		CreatedAt            time.Time
+		UpdatedAt            time.Time
+	}
+	type RateLimitRule struct {
+		ID        uint          `gorm:"primarykey"`
+		Method    string        `gorm:"type:varchar(10)"`
+		Path      string        `gorm:"type:varchar(150);not null"`
+		Enabled   bool          `gorm:"not null"`
+		Algorithm string        `gorm:"type:varchar(20);not null"`
+		Key       string        `gorm:"type:varchar(20);not null"`
+		Limit     int           `gorm:"not null"`
+		Window    time.Duration `gorm:"not null"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type InferredSpec struct {
+		ID            uint   `gorm:"primarykey"`
+		Document      string `gorm:"type:text;not null"`
+		LastRequestID uint   `gorm:"not null"`
+		Observed      int64  `gorm:"not null"`
+		CreatedAt     time.Time
+		UpdatedAt     time.Time
+	}
+	type ApiSpec struct {
+		ID        uint   `gorm:"primarykey"`
+		Title     string `gorm:"type:varchar(200)"`
+		Version   string `gorm:"type:varchar(50)"`
+		Document  string `gorm:"type:text;not null"`
+		CreatedAt time.Time
+	}
+	type Violation struct {
+		ID        uint      `gorm:"primarykey"`
+		RequestID uint      `gorm:"not null;index"`
+		SpecID    uint      `gorm:"not null"`
+		Kind      string    `gorm:"type:varchar(30);not null"`
+		Method    string    `gorm:"type:varchar(10);not null"`
+		Endpoint  string    `gorm:"type:varchar(150);not null"`
+		Message   string    `gorm:"type:text"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+	type User struct {
+		ID           uint   `gorm:"primarykey"`
+		Email        string `gorm:"type:varchar(320);uniqueIndex;not null"`
+		PasswordHash string `gorm:"type:varchar(100);not null"`
+		Role         string `gorm:"type:varchar(20);not null"`
+		CreatedAt    time.Time
+		UpdatedAt    time.Time
+	}
+	type ApiKey struct {
+		ID          uint   `gorm:"primarykey"`
+		Name        string `gorm:"type:varchar(100);not null"`
+		Prefix      string `gorm:"type:varchar(20);not null"`
+		KeyHash     string `gorm:"type:varchar(64);uniqueIndex;not null"`
+		Scopes      string `gorm:"type:varchar(200);not null"`
+		ProjectID   uint   `gorm:"not null;default:0"`
+		CreatedByID uint
+		ExpiresAt   *time.Time
+		LastUsedAt  *time.Time
+		RevokedAt   *time.Time
+		CreatedAt   time.Time
+	}
+	type AuditEntry struct {
+		ID        uint      `gorm:"primarykey"`
+		Actor     string    `gorm:"type:varchar(400);index;not null"`
+		Action    string    `gorm:"type:varchar(50);index;not null"`
+		Target    string    `gorm:"type:varchar(200);index"`
+		Changes   string    `gorm:"type:text"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+	type Project struct {
+		ID                 uint   `gorm:"primarykey"`
+		Name               string `gorm:"type:varchar(100);not null"`
+		Slug               string `gorm:"type:varchar(50);uniqueIndex;not null"`
+		UpstreamUrl        string `gorm:"type:varchar(500);not null"`
+		IngestionKeyPrefix string `gorm:"type:varchar(20)"`
+		IngestionKeyHash   string `gorm:"type:varchar(64);index"`
+		CreatedAt          time.Time
+		UpdatedAt          time.Time
+	}
+	type ProjectMember struct {
+		ProjectID uint `gorm:"primaryKey;autoIncrement:false"`
+		UserID    uint `gorm:"primaryKey;autoIncrement:false;index"`
+		CreatedAt time.Time
+	}
+	type Setting struct {
+		Key       string `gorm:"type:varchar(100);primarykey"`
+		Value     string `gorm:"type:text;not null"`
+		UpdatedAt time.Time
+	}
+
+	return []any{
+		&Request{},
+		&ImportJob{},
+		&Replay{},
+		&ReplayResult{},
+		&MockRoute{},
+		&RateLimitRule{},
+		&InferredSpec{},
+		&ApiSpec{},
+		&Violation{},
+		&User{},
+		&ApiKey{},
+		&AuditEntry{},
+		&Project{},
+		&ProjectMember{},
+		&Setting{},
+	}
+}
+
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(initialSchemaModels()...)
+	},
+	Down: func(tx *gorm.DB) error {
+		models := initialSchemaModels()
+		slices.Reverse(models)
+		return tx.Migrator().DropTable(models...)
+	},
+}
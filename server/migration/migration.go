@@ -0,0 +1,308 @@
+// Package migration applies the versioned database schema migrations and keeps track of them in the schema_migrations table
+package migration
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	_LOCK_TIMEOUT       = 5 * time.Minute
+	_LOCK_POLL_INTERVAL = 500 * time.Millisecond
+	_LOCK_STALE_AFTER   = 30 * time.Minute // _LOCK_STALE_AFTER is when a lock left by a crashed process is taken over, only used without advisory locks
+	_PG_LOCK_KEY        = 7412653001       // _PG_LOCK_KEY is the postgres advisory lock key of the migrations
+)
+
+// Migration is a versioned change of the database schema. Up and Down run in a transaction
+// together with the update of schema_migrations, a failed migration leaves nothing behind
+type Migration struct {
+	Version int // Version orders the migrations, released versions are never changed or reused
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // Down reverts Up, nil if the migration can't be reverted
+}
+
+// MigrationStatus is a known or applied migration
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // AppliedAt is nil for pending migrations
+	Unknown   bool       // Unknown is set for applied migrations this build doesn't have
+}
+
+// schemaMigration is a row of schema_migrations, one per applied migration
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(200);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// schemaMigrationLock holds the single row of the migration lock on databases without advisory locks
+type schemaMigrationLock struct {
+	ID       int       `gorm:"primaryKey;autoIncrement:false"`
+	LockedBy string    `gorm:"type:varchar(200);not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// Migrator applies and reverts migrations, only one migrator changes a database at a time
+type Migrator struct {
+	Db          *gorm.DB
+	Migrations  []Migration
+	Logger      *zap.SugaredLogger
+	LockTimeout time.Duration // LockTimeout is how long to wait for another process to finish migrating
+}
+
+// New creates a migrator of the migrations of this build
+func New(db *gorm.DB) *Migrator {
+	return &Migrator{
+		Db:          db,
+		Migrations:  Migrations,
+		Logger:      zap.S(),
+		LockTimeout: _LOCK_TIMEOUT,
+	}
+}
+
+// Up applies the pending migrations in order and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(func(db *gorm.DB) error {
+		done, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := m.transaction(db, func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("%w: %d %s: %v", cerror.ErrMigration, migration.Version, migration.Name, err)
+			}
+			m.Logger.Infof("Applied migration %d %s", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(func(db *gorm.DB) error {
+		var rows []schemaMigration
+		if err := db.Order("version desc").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			migration, ok := m.find(row.Version)
+			if !ok || migration.Down == nil {
+				return fmt.Errorf("%w: %d %s can't be reverted", cerror.ErrMigration, row.Version, row.Name)
+			}
+			err := m.transaction(db, func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, row.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("%w: reverting %d %s: %v", cerror.ErrMigration, migration.Version, migration.Name, err)
+			}
+			m.Logger.Infof("Reverted migration %d %s", migration.Version, migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the migrations of this build and the applied ones it doesn't know, ordered by version
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	done := map[int]schemaMigration{}
+	// nothing is applied before schema_migrations is created by the first migration
+	if m.Db.Migrator().HasTable(&schemaMigration{}) {
+		var err error
+		if done, err = appliedVersions(m.Db); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := done[migration.Version]; ok {
+			status.AppliedAt = &row.AppliedAt
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range done {
+		statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: &row.AppliedAt, Unknown: true})
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			migration, _ := m.find(status.Version)
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// validate checks that the migrations are ordered by version and can be applied
+func (m *Migrator) validate() error {
+	for i, migration := range m.Migrations {
+		if migration.Version <= 0 || migration.Up == nil {
+			return fmt.Errorf("%w: %d %s needs a positive version and an up step", cerror.ErrMigration, migration.Version, migration.Name)
+		}
+		if i > 0 && migration.Version <= m.Migrations[i-1].Version {
+			return fmt.Errorf("%w: %d %s is out of order", cerror.ErrMigration, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// locked runs fn while holding the migration lock, fn gets the connection the lock is held on
+func (m *Migrator) locked(fn func(db *gorm.DB) error) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	if m.Db.Dialector.Name() == "postgres" {
+		return m.Db.Connection(func(conn *gorm.DB) error {
+			return m.withLock(conn, fn, func() (bool, error) {
+				var ok bool
+				err := conn.Raw("SELECT pg_try_advisory_lock(?)", _PG_LOCK_KEY).Scan(&ok).Error
+				return ok, err
+			}, func() error {
+				return conn.Exec("SELECT pg_advisory_unlock(?)", _PG_LOCK_KEY).Error
+			})
+		})
+	}
+
+	// another migrator may create the table at the same time
+	if err := m.Db.AutoMigrate(&schemaMigrationLock{}); err != nil && !m.Db.Migrator().HasTable(&schemaMigrationLock{}) {
+		return err
+	}
+	owner := lockOwner()
+	return m.withLock(m.Db, fn, func() (bool, error) {
+		// a lock kept past _LOCK_STALE_AFTER was left by a crashed process
+		stale := time.Now().UTC().Add(-_LOCK_STALE_AFTER)
+		// waiting only reads, a write would keep the migrating transaction from getting its write lock
+		var held int64
+		if err := m.Db.Model(&schemaMigrationLock{}).Where("locked_at >= ?", stale).Count(&held).Error; err != nil || held != 0 {
+			return false, err
+		}
+		if err := m.Db.Where("locked_at < ?", stale).Delete(&schemaMigrationLock{}).Error; err != nil {
+			return false, err
+		}
+		res := m.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(&schemaMigrationLock{ID: 1, LockedBy: owner, LockedAt: time.Now().UTC()})
+		return res.RowsAffected == 1, res.Error
+	}, func() error {
+		return m.Db.Where("id = ? AND locked_by = ?", 1, owner).Delete(&schemaMigrationLock{}).Error
+	})
+}
+
+// transaction runs fn in a transaction of db. On sqlite it starts with a write refreshing the lock, sqlite fails
+// a transaction that read before writing instead of waiting when another connection is writing
+func (m *Migrator) transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			if err := tx.Model(&schemaMigrationLock{}).Where("id = ?", 1).Update("locked_at", time.Now().UTC()).Error; err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// withLock waits until acquire gets the lock or the lock timeout passes, then runs fn and releases the lock
+func (m *Migrator) withLock(db *gorm.DB, fn func(db *gorm.DB) error, acquire func() (bool, error), release func() error) error {
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		ok, err := acquire()
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return cerror.ErrMigrationLocked
+		}
+		m.Logger.Debugf("Waiting for another process to finish migrating")
+		time.Sleep(_LOCK_POLL_INTERVAL)
+	}
+	defer func() {
+		if err := release(); err != nil {
+			m.Logger.Errorf("Failed to release the migration lock, error = %v", err)
+		}
+	}()
+
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+func appliedVersions(db *gorm.DB) (map[int]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// lockOwner names the process holding the lock
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+}
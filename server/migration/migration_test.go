@@ -0,0 +1,275 @@
+package migration_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"treblle/migration"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const _PG_TEST_SCHEMA = "treblle_migration_test"
+
+// MigrationTestSuite runs the migrations on every dialect, openDb returns a new connection to the same empty database
+type MigrationTestSuite struct {
+	suite.Suite
+	newDb  func(t *testing.T) func() *gorm.DB
+	openDb func() *gorm.DB
+	db     *gorm.DB
+}
+
+func (suite *MigrationTestSuite) SetupTest() {
+	suite.openDb = suite.newDb(suite.T())
+	suite.db = suite.openDb()
+}
+
+func (suite *MigrationTestSuite) migrator(db *gorm.DB, migrations ...migration.Migration) *migration.Migrator {
+	m := migration.New(db)
+	m.Logger = zap.NewNop().Sugar()
+	m.Migrations = append(slices.Clone(migration.Migrations), migrations...)
+	return m
+}
+
+// renameConsumerSource renames a column and backfills it, the kind of change AutoMigrate can't make
+var renameConsumerSource = migration.Migration{
+	Version: 1000,
+	Name:    "rename_consumer_source",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().RenameColumn("requests", "consumer_source", "consumer_kind"); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE requests SET consumer_kind = ? WHERE consumer_kind = '' OR consumer_kind IS NULL", "unknown").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().RenameColumn("requests", "consumer_kind", "consumer_source")
+	},
+}
+
+func (suite *MigrationTestSuite) TestUp_CreatesModelSchema() {
+	applied, err := suite.migrator(suite.db).Up()
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), applied, len(migration.Migrations))
+
+	// a model change without a migration fails here
+	for _, m := range model.GetAllModels() {
+		stmt := &gorm.Statement{DB: suite.db}
+		suite.Require().NoError(stmt.Parse(m))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" {
+				assert.True(suite.T(), suite.db.Migrator().HasColumn(m, field.DBName), "%s.%s is not created by the migrations", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+	suite.Require().NoError(suite.db.Create(&model.Request{Method: "GET", Path: "/users", CreatedAt: time.Now()}).Error)
+
+	applied, err = suite.migrator(suite.db).Up()
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), applied)
+}
+
+func (suite *MigrationTestSuite) TestUp_AdoptsAutoMigratedDatabase() {
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+	suite.Require().NoError(suite.db.Create(&model.Request{Method: "GET", Path: "/users", CreatedAt: time.Now()}).Error)
+
+	applied, err := suite.migrator(suite.db).Up()
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), applied, len(migration.Migrations))
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&model.Request{}).Count(&count).Error)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *MigrationTestSuite) TestUpDown_RenamesAndBackfills() {
+	_, err := suite.migrator(suite.db).Up()
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Create(&model.Request{Method: "GET", Path: "/users", CreatedAt: time.Now()}).Error)
+
+	applied, err := suite.migrator(suite.db, renameConsumerSource).Up()
+	suite.Require().NoError(err)
+	suite.Require().Len(applied, 1)
+	assert.True(suite.T(), suite.db.Migrator().HasColumn("requests", "consumer_kind"))
+	var kinds []string
+	suite.Require().NoError(suite.db.Table("requests").Pluck("consumer_kind", &kinds).Error)
+	assert.Equal(suite.T(), []string{"unknown"}, kinds)
+
+	statuses, err := suite.migrator(suite.db, renameConsumerSource).Status()
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(statuses)
+	assert.NotNil(suite.T(), statuses[len(statuses)-1].AppliedAt)
+
+	reverted, err := suite.migrator(suite.db, renameConsumerSource).Down(1)
+	suite.Require().NoError(err)
+	suite.Require().Len(reverted, 1)
+	assert.Equal(suite.T(), 1000, reverted[0].Version)
+	assert.True(suite.T(), suite.db.Migrator().HasColumn("requests", "consumer_source"))
+	assert.False(suite.T(), suite.db.Migrator().HasColumn("requests", "consumer_kind"))
+
+	pending, err := suite.migrator(suite.db, renameConsumerSource).Pending()
+	suite.Require().NoError(err)
+	suite.Require().Len(pending, 1)
+	assert.Equal(suite.T(), "rename_consumer_source", pending[0].Name)
+}
+
+func (suite *MigrationTestSuite) TestUp_FailedMigrationLeavesNothing() {
+	failing := migration.Migration{Version: 1000, Name: "half_done", Up: func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE requests ADD COLUMN half_done varchar(10)").Error; err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	}}
+	later := migration.Migration{Version: 1001, Name: "later", Up: func(tx *gorm.DB) error { return nil }}
+
+	applied, err := suite.migrator(suite.db, failing, later).Up()
+	assert.ErrorIs(suite.T(), err, cerror.ErrMigration)
+	assert.Contains(suite.T(), err.Error(), "1000 half_done: backfill failed")
+	assert.Len(suite.T(), applied, len(migration.Migrations)) // the migrations before it are kept
+	assert.False(suite.T(), suite.db.Migrator().HasColumn("requests", "half_done"))
+
+	pending, err := suite.migrator(suite.db, failing, later).Pending()
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), pending, 2)
+}
+
+func (suite *MigrationTestSuite) TestUp_ConcurrentMigratorsApplyOnce() {
+	var runs atomic.Int32
+	counted := migration.Migration{Version: 1000, Name: "counted", Up: func(tx *gorm.DB) error {
+		runs.Add(1)
+		time.Sleep(100 * time.Millisecond) // the other migrator waits for the lock meanwhile
+		return tx.Exec("CREATE TABLE counted (id int)").Error
+	}}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = suite.migrator(suite.openDb(), counted).Up()
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(suite.T(), err)
+	}
+	assert.Equal(suite.T(), int32(1), runs.Load())
+}
+
+func (suite *MigrationTestSuite) TestUp_TimesOutWaitingForLock() {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := migration.Migration{Version: 1000, Name: "slow", Up: func(tx *gorm.DB) error {
+		close(started)
+		<-release
+		return nil
+	}}
+
+	done := make(chan error)
+	go func() {
+		_, err := suite.migrator(suite.openDb(), slow).Up()
+		done <- err
+	}()
+	<-started
+
+	waiting := suite.migrator(suite.openDb(), slow)
+	waiting.LockTimeout = 100 * time.Millisecond
+	_, err := waiting.Up()
+	assert.ErrorIs(suite.T(), err, cerror.ErrMigrationLocked)
+
+	close(release)
+	assert.NoError(suite.T(), <-done)
+	// the lock is released once the first migrator is done
+	applied, err := waiting.Up()
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), applied)
+}
+
+func (suite *MigrationTestSuite) TestDown_Irreversible() {
+	oneWay := migration.Migration{Version: 1000, Name: "one_way", Up: func(tx *gorm.DB) error { return nil }}
+	_, err := suite.migrator(suite.db, oneWay).Up()
+	suite.Require().NoError(err)
+
+	reverted, err := suite.migrator(suite.db, oneWay).Down(1)
+	assert.ErrorIs(suite.T(), err, cerror.ErrMigration)
+	assert.Empty(suite.T(), reverted)
+
+	// applied migrations of a newer build can't be reverted either
+	statuses, err := suite.migrator(suite.db).Status()
+	suite.Require().NoError(err)
+	last := statuses[len(statuses)-1]
+	assert.Equal(suite.T(), 1000, last.Version)
+	assert.True(suite.T(), last.Unknown)
+	_, err = suite.migrator(suite.db).Down(1)
+	assert.ErrorIs(suite.T(), err, cerror.ErrMigration)
+}
+
+func (suite *MigrationTestSuite) TestUp_RejectsUnorderedMigrations() {
+	first := migration.Migration{Version: 1001, Name: "first", Up: func(tx *gorm.DB) error { return nil }}
+	second := migration.Migration{Version: 1000, Name: "second", Up: func(tx *gorm.DB) error { return nil }}
+
+	_, err := suite.migrator(suite.db, first, second).Up()
+	assert.ErrorIs(suite.T(), err, cerror.ErrMigration)
+	assert.False(suite.T(), suite.db.Migrator().HasTable("requests")) // nothing is applied
+}
+
+func openTestDb(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open the test database, err = %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestMigration_Sqlite(t *testing.T) {
+	suite.Run(t, &MigrationTestSuite{newDb: func(t *testing.T) func() *gorm.DB {
+		file := filepath.Join(t.TempDir(), "treblle.db") + "?_busy_timeout=5000"
+		return func() *gorm.DB { return openTestDb(t, sqlite.Open(file)) }
+	}})
+}
+
+// TestMigration_Postgres runs against the database in TEST_POSTGRES_DSN, in its own schema that is recreated for every test
+func TestMigration_Postgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	switch {
+	case strings.Contains(dsn, "://") && strings.Contains(dsn, "?"):
+		dsn += "&search_path=" + _PG_TEST_SCHEMA
+	case strings.Contains(dsn, "://"):
+		dsn += "?search_path=" + _PG_TEST_SCHEMA
+	default:
+		dsn += " search_path=" + _PG_TEST_SCHEMA
+	}
+
+	suite.Run(t, &MigrationTestSuite{newDb: func(t *testing.T) func() *gorm.DB {
+		db := openTestDb(t, postgres.Open(dsn))
+		if err := db.Exec("DROP SCHEMA IF EXISTS " + _PG_TEST_SCHEMA + " CASCADE").Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("CREATE SCHEMA " + _PG_TEST_SCHEMA).Error; err != nil {
+			t.Fatal(err)
+		}
+		return func() *gorm.DB { return openTestDb(t, postgres.Open(dsn)) }
+	}})
+}
@@ -0,0 +1,22 @@
+package migration
+
+// NOTE: every change of a model needs a migration, append it here with the next version
+
+// Migrations are the schema migrations of this build ordered by version
+var Migrations = []Migration{
+	initialSchema,
+	requestLogIndexes,
+	savedViews,
+	requestSampling,
+	requestProxyErrors,
+	requestTruncatedBodies,
+	userTokenVersions,
+	inferredSpecProjects,
+	mockRouteProjects,
+	replayImportProjects,
+	violationProjects,
+	requestTruncatedRequests,
+	samplingRuleProjects,
+	apiSpecProjects,
+	replayResultUnknownBodies,
+}
@@ -0,0 +1,33 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectMockRoute is the column the migration adds to the mock_routes table,
+// routes created before applied to every project and are kept in the default project
+type projectMockRoute struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectMockRoute) TableName() string {
+	return "mock_routes"
+}
+
+var mockRouteProjects = Migration{
+	Version: 9,
+	Name:    "mock_route_projects",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&projectMockRoute{}, "project_id") {
+			return nil
+		}
+		if err := tx.Migrator().AddColumn(&projectMockRoute{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&projectMockRoute{}, "ProjectID")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&projectMockRoute{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&projectMockRoute{}, "project_id")
+	},
+}
@@ -0,0 +1,53 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectReplay is the column the migration adds to the replays table,
+// replays created before are kept in the default project
+type projectReplay struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectReplay) TableName() string {
+	return "replays"
+}
+
+// projectImportJob is the column the migration adds to the import_jobs table,
+// jobs created before imported into the default project and are kept there
+type projectImportJob struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectImportJob) TableName() string {
+	return "import_jobs"
+}
+
+var replayImportProjects = Migration{
+	Version: 10,
+	Name:    "replay_import_projects",
+	Up: func(tx *gorm.DB) error {
+		for _, table := range []any{&projectReplay{}, &projectImportJob{}} {
+			if tx.Migrator().HasColumn(table, "project_id") {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(table, "ProjectID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(table, "ProjectID"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, table := range []any{&projectReplay{}, &projectImportJob{}} {
+			if err := tx.Migrator().DropIndex(table, "ProjectID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(table, "project_id"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// unknownReplayBody is the column the migration adds to the replay_results table,
+// bodies of results stored before were compared whatever was recorded so they stay unflagged
+type unknownReplayBody struct {
+	BodyUnknown bool `gorm:"not null;default:false"`
+}
+
+func (unknownReplayBody) TableName() string {
+	return "replay_results"
+}
+
+var replayResultUnknownBodies = Migration{
+	Version: 15,
+	Name:    "replay_result_unknown_bodies",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&unknownReplayBody{}, "body_unknown") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&unknownReplayBody{}, "BodyUnknown")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&unknownReplayBody{}, "body_unknown")
+	},
+}
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// requestIndexes are the indexes of the request log queries, every list and statistic is filtered by project.
+// The retention reads the oldest ids, which the primary key serves.
+// Indexes are created while the migration holds its lock, on a large table startup waits for them
+var requestIndexes = []struct {
+	name    string
+	columns string
+}{
+	// default list order and the time range of statistics
+	{"idx_requests_project_created", "project_id, created_at, id"},
+	// statistics grouped by path and the path filter
+	{"idx_requests_project_path", "project_id, path, created_at"},
+	{"idx_requests_project_method", "project_id, method, created_at"},
+	{"idx_requests_project_response", "project_id, response, created_at"},
+}
+
+var requestLogIndexes = Migration{
+	Version: 2,
+	Name:    "request_log_indexes",
+	Up: func(tx *gorm.DB) error {
+		for _, index := range requestIndexes {
+			if err := tx.Exec("CREATE INDEX IF NOT EXISTS " + index.name + " ON requests (" + index.columns + ")").Error; err != nil {
+				return err
+			}
+		}
+		// the composite indexes start with project_id
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_requests_project_id").Error; err != nil {
+			return err
+		}
+		if tx.Dialector.Name() != "postgres" {
+			return nil
+		}
+
+		// path search matches substrings, only a trigram index serves it on postgres
+		var available bool
+		if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'pg_trgm')").Scan(&available).Error; err != nil {
+			return err
+		}
+		if !available {
+			zap.S().Warnf("The pg_trgm extension is not available, path search won't use an index")
+			return nil
+		}
+		if err := tx.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_requests_path_trgm ON requests USING gin (path gin_trgm_ops)").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, index := range requestIndexes {
+			if err := tx.Exec("DROP INDEX IF EXISTS " + index.name).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_requests_path_trgm").Error; err != nil {
+			return err
+		}
+		// the extension is left installed, other tables may use it
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_requests_project_id ON requests (project_id)").Error
+	},
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// failedRequest is the column the migration adds to the requests table,
+// existing requests all got an upstream response so it stays empty
+type failedRequest struct {
+	ProxyError string `gorm:"type:varchar(20)"`
+}
+
+func (failedRequest) TableName() string {
+	return "requests"
+}
+
+var requestProxyErrors = Migration{
+	Version: 5,
+	Name:    "request_proxy_errors",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&failedRequest{}, "proxy_error") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&failedRequest{}, "ProxyError")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&failedRequest{}, "proxy_error")
+	},
+}
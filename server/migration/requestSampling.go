@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// samplingRule is a frozen copy of model.SamplingRule as the migration creates it
+type samplingRule struct {
+	ID            uint    `gorm:"primarykey"`
+	Method        string  `gorm:"type:varchar(10)"`
+	Path          string  `gorm:"type:varchar(150);not null"`
+	Rate          float64 `gorm:"not null"`
+	Mode          string  `gorm:"type:varchar(10);not null"`
+	KeepStatus    int     `gorm:"not null;default:0"`
+	SlowThreshold int64   `gorm:"not null;default:0"`
+	KeyHeader     string  `gorm:"type:varchar(100)"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (samplingRule) TableName() string {
+	return "sampling_rules"
+}
+
+// sampledRequest is the column the migration adds to the requests table,
+// existing requests were all stored so they count once
+type sampledRequest struct {
+	SampleWeight float64 `gorm:"not null;default:1"`
+}
+
+func (sampledRequest) TableName() string {
+	return "requests"
+}
+
+var requestSampling = Migration{
+	Version: 4,
+	Name:    "request_sampling",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&samplingRule{}); err != nil {
+			return err
+		}
+		if tx.Migrator().HasColumn(&sampledRequest{}, "sample_weight") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&sampledRequest{}, "SampleWeight")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&sampledRequest{}, "sample_weight"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&samplingRule{})
+	},
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// truncatedRequest is the column the migration adds to the requests table,
+// it's unknown if bodies captured before were cut so they stay unflagged
+type truncatedRequest struct {
+	ResponseTruncated bool `gorm:"not null;default:false"`
+}
+
+func (truncatedRequest) TableName() string {
+	return "requests"
+}
+
+var requestTruncatedBodies = Migration{
+	Version: 6,
+	Name:    "request_truncated_bodies",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&truncatedRequest{}, "response_truncated") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&truncatedRequest{}, "ResponseTruncated")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&truncatedRequest{}, "response_truncated")
+	},
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// truncatedRequestBody is the column the migration adds to the requests table,
+// it's unknown if request bodies captured before were cut so they stay unflagged
+type truncatedRequestBody struct {
+	RequestTruncated bool `gorm:"not null;default:false"`
+}
+
+func (truncatedRequestBody) TableName() string {
+	return "requests"
+}
+
+var requestTruncatedRequests = Migration{
+	Version: 12,
+	Name:    "request_truncated_requests",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&truncatedRequestBody{}, "request_truncated") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&truncatedRequestBody{}, "RequestTruncated")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&truncatedRequestBody{}, "request_truncated")
+	},
+}
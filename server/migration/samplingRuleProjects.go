@@ -0,0 +1,33 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectSamplingRule is the column the migration adds to the sampling_rules table,
+// rules created before sampled every project and are kept in the default project
+type projectSamplingRule struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectSamplingRule) TableName() string {
+	return "sampling_rules"
+}
+
+var samplingRuleProjects = Migration{
+	Version: 13,
+	Name:    "sampling_rule_projects",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&projectSamplingRule{}, "project_id") {
+			return nil
+		}
+		if err := tx.Migrator().AddColumn(&projectSamplingRule{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&projectSamplingRule{}, "ProjectID")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&projectSamplingRule{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&projectSamplingRule{}, "project_id")
+	},
+}
@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// savedView is a frozen copy of model.View as the migration creates it
+type savedView struct {
+	ID        uint   `gorm:"primarykey"`
+	ProjectID uint   `gorm:"not null;default:0;index"`
+	OwnerID   *uint  `gorm:"index"`
+	Name      string `gorm:"type:varchar(100);not null"`
+	Search    string `gorm:"type:varchar(1000)"`
+	Method    string `gorm:"type:varchar(10)"`
+	Response  *int
+	Source    string `gorm:"type:varchar(50)"`
+	Consumer  string `gorm:"type:varchar(200)"`
+	SortBy    string `gorm:"type:varchar(20)"`
+	Order     string `gorm:"type:varchar(4)"`
+	Last      time.Duration
+	StartTime *time.Time
+	EndTime   *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (savedView) TableName() string {
+	return "views"
+}
+
+var savedViews = Migration{
+	Version: 3,
+	Name:    "saved_views",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&savedView{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&savedView{})
+	},
+}
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// versionedUser is the column the migration adds to the users table,
+// tokens issued before carry no version and match the initial 0
+type versionedUser struct {
+	TokenVersion int `gorm:"not null;default:0"`
+}
+
+func (versionedUser) TableName() string {
+	return "users"
+}
+
+var userTokenVersions = Migration{
+	Version: 7,
+	Name:    "user_token_versions",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&versionedUser{}, "token_version") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&versionedUser{}, "TokenVersion")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&versionedUser{}, "token_version")
+	},
+}
@@ -0,0 +1,37 @@
+package migration
+
+import "gorm.io/gorm"
+
+// projectViolation is the column the migration adds to the violations table,
+// it is copied from the requests of existing violations, requests kept in another store stay in the default project
+type projectViolation struct {
+	ProjectID uint `gorm:"not null;default:0;index"`
+}
+
+func (projectViolation) TableName() string {
+	return "violations"
+}
+
+var violationProjects = Migration{
+	Version: 11,
+	Name:    "violation_projects",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&projectViolation{}, "project_id") {
+			return nil
+		}
+		if err := tx.Migrator().AddColumn(&projectViolation{}, "ProjectID"); err != nil {
+			return err
+		}
+		err := tx.Exec("UPDATE violations SET project_id = COALESCE((SELECT project_id FROM requests WHERE requests.id = violations.request_id), 0)").Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&projectViolation{}, "ProjectID")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&projectViolation{}, "ProjectID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&projectViolation{}, "project_id")
+	},
+}
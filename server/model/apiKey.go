@@ -0,0 +1,91 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ApiKeyScope is a part of the dashboard api an api key can use
+type ApiKeyScope string
+
+const (
+	ScopeReadRequests ApiKeyScope = "read_requests" // ScopeReadRequests lists and exports the request log
+	ScopeReadStats    ApiKeyScope = "read_stats"    // ScopeReadStats reads statistics, consumers, violations and the inferred spec
+	ScopeManageConfig ApiKeyScope = "manage_config" // ScopeManageConfig reads and changes mocks, rate limits, specs, imports and replays
+)
+
+// IsValid reports if s is a known scope
+func (s ApiKeyScope) IsValid() bool {
+	switch s {
+	case ScopeReadRequests, ScopeReadStats, ScopeManageConfig:
+		return true
+	}
+	return false
+}
+
+// ApiKeyScopes stores scopes as a comma separated column
+type ApiKeyScopes []ApiKeyScope
+
+// Value implements driver.Valuer
+func (s ApiKeyScopes) Value() (driver.Value, error) {
+	names := make([]string, len(s))
+	for i, scope := range s {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (s *ApiKeyScopes) Scan(value any) error {
+	var data string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		return errors.New("unsupported type for scopes column")
+	}
+
+	*s = nil
+	for name := range strings.SplitSeq(data, ",") {
+		if name != "" {
+			*s = append(*s, ApiKeyScope(name))
+		}
+	}
+	return nil
+}
+
+// ApiKey gives scripts access to parts of the dashboard api, only a hash of the key is stored
+type ApiKey struct {
+	ID          uint         `gorm:"primarykey"`
+	Name        string       `gorm:"type:varchar(100);not null"`
+	Prefix      string       `gorm:"type:varchar(20);not null"` // Prefix is the start of the key, shown to tell keys apart
+	KeyHash     string       `gorm:"type:varchar(64);uniqueIndex;not null"`
+	Scopes      ApiKeyScopes `gorm:"type:varchar(200);not null"`
+	ProjectID   uint         `gorm:"not null;default:0"` // ProjectID is the only project the key can read
+	CreatedByID uint
+	ExpiresAt   *time.Time // ExpiresAt is nil for keys that don't expire
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// HasScope reports if the key grants scope
+func (k *ApiKey) HasScope(scope ApiKeyScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// IsActive reports if the key can be used at now
+func (k *ApiKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Actor names the key in audit entries
+func (k *ApiKey) Actor() string {
+	return "api_key:" + k.Prefix
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+	"treblle/util/cerror"
+
+	"gorm.io/gorm"
+)
+
+// SystemActor is the actor of changes made by the server itself, e.g. the first admin created at startup
+const SystemActor = "system"
+
+// CliActor is the actor of changes made from the command line
+const CliActor = "cli"
+
+// AuditAction names what happened in an audit entry
+type AuditAction string
+
+const (
+	AuditUserCreated AuditAction = "user.created"
+	AuditUserUpdated AuditAction = "user.updated"
+	AuditUserDeleted AuditAction = "user.deleted"
+
+	AuditApiKeyCreated AuditAction = "api_key.created"
+	AuditApiKeyUsed    AuditAction = "api_key.used"
+	AuditApiKeyRevoked AuditAction = "api_key.revoked"
+
+	AuditProjectCreated       AuditAction = "project.created"
+	AuditProjectUpdated       AuditAction = "project.updated"
+	AuditProjectKeyRotated    AuditAction = "project.ingestion_key_rotated"
+	AuditProjectMemberAdded   AuditAction = "project.member_added"
+	AuditProjectMemberRemoved AuditAction = "project.member_removed"
+
+	AuditRateLimitCreated AuditAction = "rate_limit.created"
+	AuditRateLimitUpdated AuditAction = "rate_limit.updated"
+	AuditRateLimitDeleted AuditAction = "rate_limit.deleted"
+
+	AuditMockRouteCreated AuditAction = "mock_route.created"
+	AuditMockRouteUpdated AuditAction = "mock_route.updated"
+	AuditMockRouteDeleted AuditAction = "mock_route.deleted"
+
+	AuditViewCreated AuditAction = "view.created"
+	AuditViewUpdated AuditAction = "view.updated"
+	AuditViewDeleted AuditAction = "view.deleted"
+
+	AuditSamplingRuleCreated AuditAction = "sampling_rule.created"
+	AuditSamplingRuleUpdated AuditAction = "sampling_rule.updated"
+	AuditSamplingRuleDeleted AuditAction = "sampling_rule.deleted"
+
+	AuditConfigUpdated   AuditAction = "config.updated"
+	AuditApiSpecUploaded AuditAction = "api_spec.uploaded"
+	AuditImportCreated   AuditAction = "import.created"
+	AuditReplayCreated   AuditAction = "replay.created"
+)
+
+// auditRedactedFields are secrets, only the fact that they changed is recorded
+var auditRedactedFields = map[string]bool{
+	"PasswordHash":     true,
+	"KeyHash":          true,
+	"IngestionKeyHash": true,
+}
+
+// auditHashedFields are too large to store, their sha256 is recorded instead
+var auditHashedFields = map[string]bool{
+	"Document": true,
+}
+
+// auditIgnoredFields change with every write and would only add noise
+var auditIgnoredFields = map[string]bool{
+	"CreatedAt": true,
+	"UpdatedAt": true,
+}
+
+// AuditEntry records who did what to which object, entries are never changed or deleted
+type AuditEntry struct {
+	ID        uint         `gorm:"primarykey"`
+	Actor     string       `gorm:"type:varchar(400);index;not null"` // Actor is user:<email>, api_key:<prefix>, system or cli
+	Action    AuditAction  `gorm:"type:varchar(50);index;not null"`
+	Target    string       `gorm:"type:varchar(200);index"` // Target is <kind>:<id> of the changed object
+	Changes   AuditChanges `gorm:"type:text"`
+	CreatedAt time.Time    `gorm:"index"`
+}
+
+// BeforeUpdate keeps entries append-only
+func (e *AuditEntry) BeforeUpdate(tx *gorm.DB) error {
+	return cerror.ErrAuditAppendOnly
+}
+
+// BeforeDelete keeps entries append-only
+func (e *AuditEntry) BeforeDelete(tx *gorm.DB) error {
+	return cerror.ErrAuditAppendOnly
+}
+
+// AuditTarget formats the target of an audit entry
+func AuditTarget(kind string, id uint) string {
+	return kind + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+// AuditChange is the value of a field before and after a change, nil when the object didn't exist
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditChanges are the changed fields of a target by field name
+type AuditChanges map[string]AuditChange
+
+// DiffAudit returns the fields that differ between before and after, either can be nil when the object
+// was created or deleted
+func DiffAudit(before, after any) AuditChanges {
+	old, err := auditFields(before)
+	if err != nil {
+		return AuditChanges{"error": {After: err.Error()}}
+	}
+	current, err := auditFields(after)
+	if err != nil {
+		return AuditChanges{"error": {After: err.Error()}}
+	}
+
+	changes := AuditChanges{}
+	for name, value := range old {
+		if newValue, ok := current[name]; !ok || !reflect.DeepEqual(value, newValue) {
+			changes[name] = AuditChange{Before: value, After: newValue}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	for name, change := range changes {
+		if auditRedactedFields[name] {
+			changes[name] = AuditChange{Before: redact(change.Before), After: redact(change.After)}
+		}
+	}
+	return changes
+}
+
+// auditFields flattens v to its json fields with large fields hashed
+func auditFields(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		switch {
+		case auditIgnoredFields[name]:
+			delete(fields, name)
+		case auditHashedFields[name]:
+			sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+			fields[name] = "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return fields, nil
+}
+
+func redact(value any) any {
+	if value == nil {
+		return nil
+	}
+	return RedactedValue
+}
+
+// Value implements driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (c *AuditChanges) Scan(value any) error {
+	switch data := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), c)
+	case []byte:
+		return json.Unmarshal(data, c)
+	default:
+		return errors.New("unsupported type for audit changes column")
+	}
+}
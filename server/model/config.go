@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+	"treblle/util/cerror"
+)
+
+const (
+	_MAX_CAPTURE_BODY_LIMIT = 10 << 20
+	_MAX_RETENTION_DAYS     = 3650
+)
+
+// RuntimeConfig are the settings that can be changed while the server runs,
+// they are read on every use so a change applies to the next proxied request
+type RuntimeConfig struct {
+	UpstreamUrl      string  `json:"upstreamUrl"`      // UpstreamUrl is the upstream of the default project
+	CaptureBodyLimit int     `json:"captureBodyLimit"` // CaptureBodyLimit is the max number of body bytes stored per request, 0 disables body capture
+	SampleRate       float64 `json:"sampleRate"`       // SampleRate is the share of proxied requests that are stored on routes without a sampling rule, from 0 to 1
+	RetentionDays    int     `json:"retentionDays"`    // RetentionDays is how long requests are kept, 0 keeps them forever
+}
+
+// DefaultRuntimeConfig is used for settings that are neither stored nor configured by env
+var DefaultRuntimeConfig = RuntimeConfig{
+	SampleRate: 1,
+}
+
+// Runtime returns c, so a fixed config can be used where no config service is running
+func (c RuntimeConfig) Runtime() RuntimeConfig {
+	return c
+}
+
+// Validate checks every setting is in range
+func (c *RuntimeConfig) Validate() error {
+	upstream, err := url.Parse(c.UpstreamUrl)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return fmt.Errorf("%w: upstreamUrl should be an http or https url", cerror.ErrBadConfig)
+	}
+	if c.CaptureBodyLimit < 0 || c.CaptureBodyLimit > _MAX_CAPTURE_BODY_LIMIT {
+		return fmt.Errorf("%w: captureBodyLimit should be between 0 and %d", cerror.ErrBadConfig, _MAX_CAPTURE_BODY_LIMIT)
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("%w: sampleRate should be between 0 and 1", cerror.ErrBadConfig)
+	}
+	if c.RetentionDays < 0 || c.RetentionDays > _MAX_RETENTION_DAYS {
+		return fmt.Errorf("%w: retentionDays should be between 0 and %d", cerror.ErrBadConfig, _MAX_RETENTION_DAYS)
+	}
+	return nil
+}
+
+// ConfigField describes a runtime setting
+type ConfigField struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"` // Type is the json type, one of string, integer, number
+	Description string   `json:"description"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// RuntimeConfigSchema describes every field of RuntimeConfig
+var RuntimeConfigSchema = []ConfigField{
+	{Key: "upstreamUrl", Type: "string", Description: "Upstream of the default project, an http or https url"},
+	{Key: "captureBodyLimit", Type: "integer", Description: "Max number of body bytes stored per request, 0 disables body capture", Minimum: bound(0), Maximum: bound(_MAX_CAPTURE_BODY_LIMIT)},
+	{Key: "sampleRate", Type: "number", Description: "Share of proxied requests stored on routes without a sampling rule, 1 stores every request", Minimum: bound(0), Maximum: bound(1)},
+	{Key: "retentionDays", Type: "integer", Description: "Days requests are kept, 0 keeps them forever", Minimum: bound(0), Maximum: bound(_MAX_RETENTION_DAYS)},
+}
+
+// Setting is a stored runtime setting, Value is json encoded
+type Setting struct {
+	Key       string `gorm:"type:varchar(100);primarykey"`
+	Value     string `gorm:"type:text;not null"`
+	UpdatedAt time.Time
+}
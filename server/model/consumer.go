@@ -0,0 +1,23 @@
+package model
+
+// ConsumerSource is where the consumer of a request is read from
+type ConsumerSource string
+
+const (
+	ConsumerApiKey ConsumerSource = "api_key" // ConsumerApiKey identifies consumers by a fingerprint of their api key header
+	ConsumerJwt    ConsumerSource = "jwt"     // ConsumerJwt identifies consumers by a claim of their bearer token
+	ConsumerBasic  ConsumerSource = "basic"   // ConsumerBasic identifies consumers by their basic auth user
+	ConsumerIP     ConsumerSource = "ip"      // ConsumerIP identifies consumers by their ip
+
+	// ConsumerJwtUnverified labels consumers read from a bearer token without a key to verify it, clients can send any value
+	ConsumerJwtUnverified ConsumerSource = "jwt_unverified"
+)
+
+// IsValid reports if s is a source that can be configured
+func (s ConsumerSource) IsValid() bool {
+	switch s {
+	case ConsumerApiKey, ConsumerJwt, ConsumerBasic, ConsumerIP:
+		return true
+	}
+	return false
+}
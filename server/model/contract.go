@@ -0,0 +1,76 @@
+package model
+
+import "time"
+
+// ApiSpec is an uploaded OpenAPI 3 document of a project's upstream, the newest one of the project is validated against
+type ApiSpec struct {
+	ID        uint   `gorm:"primarykey"`
+	ProjectID uint   `gorm:"not null;default:0;index"` // ProjectID is the project whose upstream the document describes
+	Title     string `gorm:"type:varchar(200)"`
+	Version   string `gorm:"type:varchar(50)"` // Version is the info.version of the document
+	Document  string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+}
+
+// ViolationKind is the part of the contract a request or response broke
+type ViolationKind string
+
+const (
+	ViolationUnknownEndpoint    ViolationKind = "unknown_endpoint"
+	ViolationBadParameter       ViolationKind = "bad_parameter"
+	ViolationBadRequestBody     ViolationKind = "bad_request_body"
+	ViolationBadRequest         ViolationKind = "bad_request"
+	ViolationBadResponseBody    ViolationKind = "bad_response_body"
+	ViolationUndocumentedStatus ViolationKind = "undocumented_status"
+)
+
+// IsRequestViolation reports if the violation was caused by the client
+func (k ViolationKind) IsRequestViolation() bool {
+	switch k {
+	case ViolationUnknownEndpoint, ViolationBadParameter, ViolationBadRequestBody, ViolationBadRequest:
+		return true
+	}
+	return false
+}
+
+// Violation is a difference between a proxied request or response and the api spec
+type Violation struct {
+	ID        uint          `gorm:"primarykey"`
+	RequestID uint          `gorm:"not null;index"`
+	ProjectID uint          `gorm:"not null;default:0;index"` // ProjectID is the project of the request
+	SpecID    uint          `gorm:"not null"`
+	Kind      ViolationKind `gorm:"type:varchar(30);not null"`
+	Method    string        `gorm:"type:varchar(10);not null"`
+	Endpoint  string        `gorm:"type:varchar(150);not null"` // Endpoint is the spec path, or the request path for unknown endpoints
+	Message   string        `gorm:"type:text"`
+	CreatedAt time.Time     `gorm:"index"`
+}
+
+// BreakingChangeKind is the way a spec version breaks current callers
+type BreakingChangeKind string
+
+const (
+	BreakingRemovedEndpoint   BreakingChangeKind = "removed_endpoint"
+	BreakingRequiredParameter BreakingChangeKind = "new_required_parameter"
+	BreakingChangedResponse   BreakingChangeKind = "changed_response"
+)
+
+// BreakingChange is a difference between two spec versions that recorded traffic would run into
+type BreakingChange struct {
+	Kind      BreakingChangeKind `json:"kind"`
+	Method    string             `json:"method"`
+	Endpoint  string             `json:"endpoint"`            // Endpoint is the path in the spec version it exists in
+	Parameter string             `json:"parameter,omitempty"` // Parameter is set for new required parameters, e.g. query.page
+	Status    int                `json:"status,omitempty"`    // Status is set for changed responses
+	Details   []string           `json:"details,omitempty"`
+	Calls     int64              `json:"calls"` // Calls is the number of recorded requests that would break
+}
+
+// BreakingChangeReport holds the breaking changes of a spec version compared to the previous one
+type BreakingChangeReport struct {
+	SpecID         uint             `json:"spec_id"`
+	PreviousSpecID *uint            `json:"previous_spec_id"`
+	Since          time.Time        `json:"since"`
+	Observed       int64            `json:"observed"` // Observed is the number of recorded requests checked
+	Changes        []BreakingChange `json:"changes"`
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// RedactedValue replaces the value of sensitive headers before they are stored
+const RedactedValue = "[REDACTED]"
+
+// sensitiveHeaders are never persisted in clear text
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	ProjectKeyHeader,
+}
+
+// Headers stores http headers as a json column
+type Headers map[string][]string
+
+// HeadersFrom copies http headers redacting the sensitive ones
+func HeadersFrom(h http.Header) Headers {
+	if len(h) == 0 {
+		return nil
+	}
+
+	rez := make(Headers, len(h))
+	for key, values := range h {
+		rez[key] = append([]string(nil), values...)
+	}
+	for _, key := range sensitiveHeaders {
+		if _, ok := rez[key]; ok {
+			rez[key] = []string{RedactedValue}
+		}
+	}
+	return rez
+}
+
+// Http converts headers back to http.Header
+func (h Headers) Http() http.Header {
+	rez := make(http.Header, len(h))
+	for key, values := range h {
+		rez[key] = append([]string(nil), values...)
+	}
+	return rez
+}
+
+// Value implements driver.Valuer
+func (h Headers) Value() (driver.Value, error) {
+	if h == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (h *Headers) Scan(value any) error {
+	switch data := value.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), h)
+	case []byte:
+		return json.Unmarshal(data, h)
+	default:
+		return errors.New("unsupported type for headers column")
+	}
+}
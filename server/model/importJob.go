@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+type ImportStatus string
+
+const (
+	ImportPending   ImportStatus = "pending"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportJob tracks a background import of a traffic file into the request store.
+// Offset is where an interrupted job continues reading the file, so already
+// handled entries are never read again. A running job belongs to the process
+// that claimed it until it is released or stops making progress.
+type ImportJob struct {
+	ID        uint         `gorm:"primarykey"`
+	ProjectID uint         `gorm:"not null;default:0;index"` // ProjectID is the project the requests are imported into
+	Source    string       `gorm:"type:varchar(50);not null"`
+	Format    string       `gorm:"type:varchar(10);not null"`
+	FileName  string       `gorm:"type:varchar(255)"`
+	FilePath  string       `gorm:"type:varchar(255);not null"`
+	FileSize  int64        `gorm:"not null;default:0"`
+	Status    ImportStatus `gorm:"type:varchar(20);not null;index"`
+	Processed int64        `gorm:"not null;default:0"`
+	Offset    int64        `gorm:"not null;default:0"` // Offset is the number of file bytes of handled entries
+	Imported  int64        `gorm:"not null;default:0"`
+	Skipped   int64        `gorm:"not null;default:0"` // Skipped counts duplicates
+	Failed    int64        `gorm:"not null;default:0"`
+	Error     string       `gorm:"type:text"`
+	CreatedAt time.Time    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// IsFinished returns true if the job will not be processed anymore
+func (j *ImportJob) IsFinished() bool {
+	return j.Status == ImportCompleted || j.Status == ImportFailed
+}
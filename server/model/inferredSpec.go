@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// InferredSpec is an OpenAPI document built from the recorded traffic of a project,
+// requests up to LastRequestID are already merged into it
+type InferredSpec struct {
+	ID            uint   `gorm:"primarykey"`
+	ProjectID     uint   `gorm:"not null;default:0;index"` // ProjectID is the project whose traffic is merged, 0 is the default project
+	Document      string `gorm:"type:text;not null"`
+	LastRequestID uint   `gorm:"not null"`
+	Observed      int64  `gorm:"not null"` // Observed is the number of merged requests
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// SourceMock is the source of requests answered by the mock server instead of the upstream
+const SourceMock = "mock"
+
+// MockStrategy decides which parts of a request have to be equal to a recorded one
+type MockStrategy string
+
+const (
+	MockMatchPath  MockStrategy = "path"  // MockMatchPath matches method and normalized path
+	MockMatchQuery MockStrategy = "query" // MockMatchQuery also matches the normalized query
+	MockMatchBody  MockStrategy = "body"  // MockMatchBody also matches the request body hash
+)
+
+// IsValid reports if s is a known strategy
+func (s MockStrategy) IsValid() bool {
+	switch s {
+	case MockMatchPath, MockMatchQuery, MockMatchBody:
+		return true
+	}
+	return false
+}
+
+// MockFallback decides what happens when no recorded request matches
+type MockFallback string
+
+const (
+	MockFallbackNotFound    MockFallback = "404"         // MockFallbackNotFound answers with 404
+	MockFallbackPassthrough MockFallback = "passthrough" // MockFallbackPassthrough sends the request to the upstream
+	MockFallbackSynthetic   MockFallback = "synthetic"   // MockFallbackSynthetic answers with the configured synthetic response
+)
+
+// IsValid reports if f is a known fallback
+func (f MockFallback) IsValid() bool {
+	switch f {
+	case MockFallbackNotFound, MockFallbackPassthrough, MockFallbackSynthetic:
+		return true
+	}
+	return false
+}
+
+// MockRoute overrides the mock mode for every proxied path under Path of one project
+type MockRoute struct {
+	ID                   uint         `gorm:"primarykey"`
+	ProjectID            uint         `gorm:"not null;default:0;index"` // ProjectID is the project whose traffic the route mocks
+	Method               string       `gorm:"type:varchar(10)"`         // Method limits the route to one method, empty is any
+	Path                 string       `gorm:"type:varchar(150);not null"`
+	Enabled              bool         `gorm:"not null"`
+	Strategy             MockStrategy `gorm:"type:varchar(20)"` // Strategy overrides the default strategy if set
+	Fallback             MockFallback `gorm:"type:varchar(20)"` // Fallback overrides the default fallback if set
+	SyntheticStatus      int
+	SyntheticContentType string `gorm:"type:varchar(100)"`
+	SyntheticBody        string `gorm:"type:text"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Covers reports if the route applies to a request with method and normalized path
+func (r *MockRoute) Covers(method, path string) bool {
+	return routeCovers(r.Method, r.Path, method, path)
+}
+
+// routeCovers reports if a route with routeMethod and routePath applies to a request with method and normalized path,
+// an empty routeMethod is any method and routePath covers every path under it
+func routeCovers(routeMethod, routePath, method, path string) bool {
+	if routeMethod != "" && !strings.EqualFold(routeMethod, method) {
+		return false
+	}
+	if routePath == "/" || routePath == path {
+		return true
+	}
+	return strings.HasPrefix(path, routePath+"/")
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+const (
+	// DefaultProjectID is the project of traffic without an ingestion key or project route prefix,
+	// it isn't stored and every user can see it
+	DefaultProjectID uint = 0
+	// ProjectKeyHeader holds the ingestion key sending proxied traffic to a project, it isn't forwarded
+	ProjectKeyHeader = "X-Project-Key"
+)
+
+// Project isolates the traffic of one team, it has its own upstream and members
+type Project struct {
+	ID                 uint   `gorm:"primarykey"`
+	Name               string `gorm:"type:varchar(100);not null"`
+	Slug               string `gorm:"type:varchar(50);uniqueIndex;not null"` // Slug is the route prefix, /proxy/<slug>/... is sent to the project
+	UpstreamUrl        string `gorm:"type:varchar(500);not null"`
+	IngestionKeyPrefix string `gorm:"type:varchar(20)"`
+	IngestionKeyHash   string `gorm:"type:varchar(64);index"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// ProjectMember lets a viewer see a project, admins see every project
+type ProjectMember struct {
+	ProjectID uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time
+}
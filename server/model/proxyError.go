@@ -0,0 +1,60 @@
+package model
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// ProxyErrorKind is why the proxy got no response from the upstream
+type ProxyErrorKind string
+
+const (
+	ProxyErrorDns               ProxyErrorKind = "dns"                // ProxyErrorDns means the upstream host could not be resolved
+	ProxyErrorConnectionRefused ProxyErrorKind = "connection_refused" // ProxyErrorConnectionRefused means nothing listens on the upstream port
+	ProxyErrorTls               ProxyErrorKind = "tls"                // ProxyErrorTls means the tls handshake with the upstream failed
+	ProxyErrorTimeout           ProxyErrorKind = "timeout"            // ProxyErrorTimeout means the upstream didn't answer in time
+	ProxyErrorCanceled          ProxyErrorKind = "canceled"           // ProxyErrorCanceled means the client went away before the upstream answered
+	ProxyErrorOther             ProxyErrorKind = "other"              // ProxyErrorOther is any other transport error, e.g. a reset connection
+)
+
+// ProxyErrorOf classifies the error the proxy got instead of an upstream response
+func ProxyErrorOf(err error) ProxyErrorKind {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ProxyErrorDns
+	case errors.Is(err, context.Canceled):
+		return ProxyErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ProxyErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ProxyErrorConnectionRefused
+	case errors.As(err, &recordErr), errors.As(err, &verifyErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		strings.Contains(err.Error(), "tls: "):
+		return ProxyErrorTls
+	}
+	return ProxyErrorOther
+}
+
+// Status is the status the proxy answers with instead of an upstream response
+func (k ProxyErrorKind) Status() int {
+	if k == ProxyErrorTimeout {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
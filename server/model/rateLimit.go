@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// SourceRateLimit is the source of requests rejected by the rate limiter instead of reaching the upstream
+const SourceRateLimit = "rate_limit"
+
+// RateLimitAlgorithm decides how requests are counted against a limit
+type RateLimitAlgorithm string
+
+const (
+	// RateLimitTokenBucket allows bursts of Limit requests, refilled evenly over the window
+	RateLimitTokenBucket RateLimitAlgorithm = "token_bucket"
+	// RateLimitSlidingWindow allows Limit requests in any window, weighting the previous window by its overlap
+	RateLimitSlidingWindow RateLimitAlgorithm = "sliding_window"
+)
+
+// IsValid reports if a is a known algorithm
+func (a RateLimitAlgorithm) IsValid() bool {
+	switch a {
+	case RateLimitTokenBucket, RateLimitSlidingWindow:
+		return true
+	}
+	return false
+}
+
+// RateLimitKey decides who shares a quota
+type RateLimitKey string
+
+const (
+	RateLimitByIP     RateLimitKey = "ip"      // RateLimitByIP gives every client ip its own quota
+	RateLimitByApiKey RateLimitKey = "api_key" // RateLimitByApiKey gives every api key its own quota, requests without a key are limited by ip
+	RateLimitByRoute  RateLimitKey = "route"   // RateLimitByRoute shares one quota between all clients of the route
+)
+
+// IsValid reports if k is a known key
+func (k RateLimitKey) IsValid() bool {
+	switch k {
+	case RateLimitByIP, RateLimitByApiKey, RateLimitByRoute:
+		return true
+	}
+	return false
+}
+
+// RateLimitRule overrides the default rate limit for every proxied path under Path
+type RateLimitRule struct {
+	ID        uint               `gorm:"primarykey"`
+	Method    string             `gorm:"type:varchar(10)"` // Method limits the rule to one method, empty is any
+	Path      string             `gorm:"type:varchar(150);not null"`
+	Enabled   bool               `gorm:"not null"` // Enabled false exempts the route from the default limit
+	Algorithm RateLimitAlgorithm `gorm:"type:varchar(20);not null"`
+	Key       RateLimitKey       `gorm:"type:varchar(20);not null"`
+	Limit     int                `gorm:"not null"` // Limit is the number of requests allowed per window
+	Window    time.Duration      `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Covers reports if the rule applies to a request with method and normalized path
+func (r *RateLimitRule) Covers(method, path string) bool {
+	return routeCovers(r.Method, r.Path, method, path)
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+type ReplayStatus string
+
+const (
+	ReplayPending   ReplayStatus = "pending"
+	ReplayRunning   ReplayStatus = "running"
+	ReplayCompleted ReplayStatus = "completed"
+	ReplayFailed    ReplayStatus = "failed"
+)
+
+// Replay is a job sending recorded requests of a project to a target environment
+type Replay struct {
+	ID             uint         `gorm:"primarykey"`
+	ProjectID      uint         `gorm:"not null;default:0;index"` // ProjectID is the project of the replayed requests
+	TargetUrl      string       `gorm:"type:varchar(255);not null"`
+	Selection      string       `gorm:"type:text;not null"` // Selection is the json encoded filter or ids of replayed requests
+	PreserveTiming bool         `gorm:"not null;default:false"`
+	RateLimit      float64      `gorm:"not null;default:0"` // RateLimit is the max number of requests per second, 0 is unlimited
+	Status         ReplayStatus `gorm:"type:varchar(20);not null;index"`
+	Total          int64        `gorm:"not null;default:0"`
+	Processed      int64        `gorm:"not null;default:0"`
+	StatusDiffs    int64        `gorm:"not null;default:0"`
+	BodyDiffs      int64        `gorm:"not null;default:0"`
+	Errors         int64        `gorm:"not null;default:0"`
+	Error          string       `gorm:"type:text"`
+	CreatedAt      time.Time    `gorm:"not null"`
+	UpdatedAt      time.Time
+	FinishedAt     *time.Time
+}
+
+// IsFinished returns true if the replay will not be processed anymore
+func (r *Replay) IsFinished() bool {
+	return r.Status == ReplayCompleted || r.Status == ReplayFailed
+}
+
+// ReplayResult is the diff between a recorded request and its replay
+type ReplayResult struct {
+	ID               uint          `gorm:"primarykey"`
+	ReplayID         uint          `gorm:"not null;index"`
+	RequestID        uint          `gorm:"not null"`
+	Method           string        `gorm:"type:varchar(10);not null"`
+	Path             string        `gorm:"type:varchar(150);not null"`
+	OriginalStatus   int           `gorm:"not null"`
+	ReplayStatus     int           `gorm:"not null"`
+	OriginalLatency  time.Duration `gorm:"not null"`
+	ReplayLatency    time.Duration `gorm:"not null"`
+	OriginalBodyHash string        `gorm:"type:varchar(64)"`
+	ReplayBodyHash   string        `gorm:"type:varchar(64)"`
+	StatusMatch      bool          `gorm:"not null"`
+	BodyMatch        bool          `gorm:"not null"`
+	BodyUnknown      bool          `gorm:"not null;default:false"` // BodyUnknown is set when the recorded body is missing or cut, the bodies are not compared then
+	Error            string        `gorm:"type:text"`
+	CreatedAt        time.Time     `gorm:"not null"`
+}
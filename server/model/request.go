@@ -1,6 +1,9 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -8,21 +11,64 @@ import (
 	"go.uber.org/zap"
 )
 
+// SourceProxy is the source of requests captured by the proxy
+const SourceProxy = "proxy"
+
 type Request struct {
-	ID           uint   `gorm:"primarykey"`
-	Method       string `gorm:"type:varchar(5);not null"`
-	Response     int    `gorm:"type:int;null"`
-	Path         string `gorm:"type:varchar(150);not null"`
-	ResponseTime time.Time
-	CreatedAt    time.Time     `gorm:"not null"`
-	Latency      time.Duration `gorm:"null"`
+	ID                uint    `gorm:"primarykey"`
+	ProjectID         uint    `gorm:"not null;default:0"` // ProjectID is the project the request was sent to, 0 is the default project
+	Source            string  `gorm:"type:varchar(50);not null;default:proxy;index"`
+	Fingerprint       *string `gorm:"type:varchar(64);uniqueIndex"` // Fingerprint is set for imported requests and used for deduplication
+	Method            string  `gorm:"type:varchar(10);not null"`
+	Response          int     `gorm:"type:int;null"`
+	Path              string  `gorm:"type:varchar(150);not null"`
+	Consumer          string  `gorm:"type:varchar(200);index"` // Consumer identifies the client that sent the request, empty if unknown
+	ConsumerSource    string  `gorm:"type:varchar(20)"`        // ConsumerSource is how the consumer was identified, e.g. api_key or ip
+	Query             string  `gorm:"type:text"`
+	ResponseTime      time.Time
+	CreatedAt         time.Time     `gorm:"not null"`
+	Latency           time.Duration `gorm:"null"`
+	RequestHeaders    Headers       `gorm:"type:text"`
+	RequestBody       []byte
+	RequestTruncated  bool    `gorm:"not null;default:false"` // RequestTruncated is set if the request body was cut at the capture limit
+	ResponseHeaders   Headers `gorm:"type:text"`
+	ResponseBody      []byte
+	ResponseTruncated bool    `gorm:"not null;default:false"` // ResponseTruncated is set if the response body was cut at the capture limit
+	SampleWeight      float64 `gorm:"not null;default:1"`     // SampleWeight is the number of proxied requests the stored one stands for
+	ProxyError        string  `gorm:"type:varchar(20)"`       // ProxyError is the ProxyErrorKind of requests the upstream never answered, their response is synthetic
+
+	Sample *SampleDecision `gorm:"-" json:"-"` // Sample holds the decision of a tail sampled request until its response is logged
+}
+
+// Weight returns the number of requests r stands for, requests stored before sampling weights count once
+func (r *Request) Weight() float64 {
+	if r.SampleWeight <= 0 {
+		return 1
+	}
+	return r.SampleWeight
 }
 
 func (r *Request) FromRequest(req *http.Request) error {
+	r.Source = SourceProxy
 	r.Method = req.Method
 	r.Path = strings.TrimPrefix(req.URL.Path, "/proxy")
+	r.Query = req.URL.RawQuery
+	r.RequestHeaders = HeadersFrom(req.Header)
 	r.CreatedAt = time.Now()
 
 	zap.S().Debugf("Populating request data, rez %+v", *r)
 	return nil
 }
+
+// SetFingerprint sets the fingerprint identifying the same request imported more than once into the same project
+func (r *Request) SetFingerprint() {
+	bodyHash := sha256.Sum256(r.RequestBody)
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%s|%s|%d|%d|%x", r.Source, r.Method, r.Path, r.Query, r.CreatedAt.UnixNano(), r.Response, bodyHash)
+	// fingerprints of the default project are kept as they were before projects
+	if r.ProjectID != DefaultProjectID {
+		fmt.Fprintf(hash, "|%d", r.ProjectID)
+	}
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+	r.Fingerprint = &fingerprint
+}
@@ -1,8 +1,11 @@
 package model
 
+import "time"
+
 // AllRequestStatistics holds the aggregated statistics for the requested period
 type AllRequestStatistics struct {
-	StatsPerPath []PathStatistics `json:"stats_per_path"`
+	StatsPerPath          []PathStatistics     `json:"stats_per_path"`
+	ViolationsPerEndpoint []EndpointViolations `json:"violations_per_endpoint"`
 }
 
 // PathStatistics holds the detailed statistics grouped by path
@@ -12,4 +15,28 @@ type PathStatistics struct {
 	AverageLatencyMs float64 `json:"average_latency_ms"`
 	ClientErrorCount int64   `json:"client_error_count"`
 	ServerErrorCount int64   `json:"server_error_count"`
+	RateLimitedCount int64   `json:"rate_limited_count"` // RateLimitedCount is the number of requests rejected by the proxy rate limiter
+	ProxyErrorCount  int64   `json:"proxy_error_count"`  // ProxyErrorCount is the number of requests the upstream never answered, they aren't server errors
+}
+
+// ConsumerStatistics holds the aggregated statistics of one api consumer
+type ConsumerStatistics struct {
+	Consumer         string    `json:"consumer"`
+	ConsumerSource   string    `json:"consumer_source"`
+	RequestCount     int64     `json:"request_count"`
+	AverageLatencyMs float64   `json:"average_latency_ms"`
+	ClientErrorCount int64     `json:"client_error_count"`
+	ServerErrorCount int64     `json:"server_error_count"`
+	RateLimitedCount int64     `json:"rate_limited_count"`
+	ProxyErrorCount  int64     `json:"proxy_error_count"`
+	LastSeen         time.Time `json:"last_seen"`
+}
+
+// EndpointViolations holds the api contract violations grouped by spec endpoint
+type EndpointViolations struct {
+	Method         string                  `json:"method"`
+	Endpoint       string                  `json:"endpoint"`
+	RequestCount   int64                   `json:"request_count"` // RequestCount is the number of requests with at least one violation
+	ViolationCount int64                   `json:"violation_count"`
+	Kinds          map[ViolationKind]int64 `json:"kinds"`
 }
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// RequestPayload holds the captured headers and bodies of a request when they are stored apart
+// from the request, linked to it by the request id
+type RequestPayload struct {
+	RequestID       uint      `bson:"_id"`
+	CreatedAt       time.Time `bson:"created_at"` // CreatedAt is the creation time of the request, used by the retention
+	RequestHeaders  Headers   `bson:"request_headers,omitempty"`
+	RequestBody     []byte    `bson:"request_body,omitempty"`
+	ResponseHeaders Headers   `bson:"response_headers,omitempty"`
+	ResponseBody    []byte    `bson:"response_body,omitempty"`
+}
+
+// TakePayload moves the headers and bodies of the request into a payload
+func (r *Request) TakePayload() RequestPayload {
+	payload := RequestPayload{
+		RequestID:       r.ID,
+		CreatedAt:       r.CreatedAt,
+		RequestHeaders:  r.RequestHeaders,
+		RequestBody:     r.RequestBody,
+		ResponseHeaders: r.ResponseHeaders,
+		ResponseBody:    r.ResponseBody,
+	}
+	r.RequestHeaders, r.RequestBody, r.ResponseHeaders, r.ResponseBody = nil, nil, nil, nil
+	return payload
+}
+
+// SetPayload sets the headers and bodies of the request from its payload
+func (r *Request) SetPayload(payload RequestPayload) {
+	r.RequestHeaders = payload.RequestHeaders
+	r.RequestBody = payload.RequestBody
+	r.ResponseHeaders = payload.ResponseHeaders
+	r.ResponseBody = payload.ResponseBody
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// SamplingMode decides when a request is sampled
+type SamplingMode string
+
+const (
+	// SamplingHead decides when the request arrives, sampled requests are stored right away
+	SamplingHead SamplingMode = "head"
+	// SamplingTail decides when the response arrives, so errors and slow requests are always kept
+	SamplingTail SamplingMode = "tail"
+)
+
+// IsValid reports if m is a known mode
+func (m SamplingMode) IsValid() bool {
+	switch m {
+	case SamplingHead, SamplingTail:
+		return true
+	}
+	return false
+}
+
+// SamplingRule overrides the runtime sample rate for every proxied path under Path
+type SamplingRule struct {
+	ID            uint          `gorm:"primarykey"`
+	ProjectID     uint          `gorm:"not null;default:0;index"` // ProjectID is the project whose traffic the rule samples
+	Method        string        `gorm:"type:varchar(10)"`         // Method limits the rule to one method, empty is any
+	Path          string        `gorm:"type:varchar(150);not null"`
+	Rate          float64       `gorm:"not null"` // Rate is the share of requests that are stored, from 0 to 1
+	Mode          SamplingMode  `gorm:"type:varchar(10);not null"`
+	KeepStatus    int           `gorm:"not null;default:0"` // KeepStatus keeps every response with a status from it up, 0 keeps none, tail only
+	SlowThreshold time.Duration `gorm:"not null;default:0"` // SlowThreshold keeps every request at least as slow, 0 keeps none, tail only
+	KeyHeader     string        `gorm:"type:varchar(100)"`  // KeyHeader holds the trace or request id requests are sampled by, empty samples at random
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Covers reports if the rule applies to a request with method and normalized path
+func (r *SamplingRule) Covers(method, path string) bool {
+	return routeCovers(r.Method, r.Path, method, path)
+}
+
+// Keeps reports if the rule keeps a completed request regardless of the rate
+func (r *SamplingRule) Keeps(req *Request) bool {
+	if r.Mode != SamplingTail {
+		return false
+	}
+	if r.KeepStatus > 0 && req.Response >= r.KeepStatus {
+		return true
+	}
+	return r.SlowThreshold > 0 && req.Latency >= r.SlowThreshold
+}
+
+// SampleKey returns the value requests are sampled by from the key header,
+// a w3c traceparent is reduced to its trace id so every span of a trace gets the same decision
+func SampleKey(header, value string) string {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(header, "traceparent") {
+		if parts := strings.Split(value, "-"); len(parts) == 4 {
+			return parts[1]
+		}
+	}
+	return value
+}
+
+// SampleDecision is the sampling decision of a tail sampled request waiting for its response
+type SampleDecision struct {
+	Rule       *SamplingRule
+	Sampled    bool        // Sampled is the decision of the rate, requests kept by the rule are stored even if it's false
+	Violations []Violation // Violations of the request are saved with the response once the request is stored
+}
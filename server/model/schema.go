@@ -1,10 +1,26 @@
 package model
 
-// NOTE: Here register all models to be used in migration
+// NOTE: Here register all models, migration tests check that the schema migrations create their columns
 
 // GetAllModels returns an array of all models
 func GetAllModels() []any {
 	return []any{
 		&Request{},
+		&ImportJob{},
+		&Replay{},
+		&ReplayResult{},
+		&MockRoute{},
+		&RateLimitRule{},
+		&InferredSpec{},
+		&ApiSpec{},
+		&Violation{},
+		&User{},
+		&ApiKey{},
+		&AuditEntry{},
+		&Project{},
+		&ProjectMember{},
+		&Setting{},
+		&View{},
+		&SamplingRule{},
 	}
 }
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Role decides what a dashboard user is allowed to do
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // RoleViewer can read the request log, statistics and configuration
+	RoleAdmin  Role = "admin"  // RoleAdmin can also change configuration and manage users
+)
+
+// IsValid reports if r is a known role
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleViewer, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// User is a dashboard api user, the password is stored as a bcrypt hash
+type User struct {
+	ID           uint   `gorm:"primarykey"`
+	Email        string `gorm:"type:varchar(320);uniqueIndex;not null"`
+	PasswordHash string `gorm:"type:varchar(100);not null"`
+	Role         Role   `gorm:"type:varchar(20);not null"`
+	TokenVersion int    `gorm:"not null;default:0"` // TokenVersion is bumped on password changes, tokens of other versions are rejected
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Actor names the user in audit entries
+func (u *User) Actor() string {
+	return "user:" + u.Email
+}
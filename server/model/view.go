@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// View is a saved filter, sort and time range of the request log, shared with its project or private to its owner
+type View struct {
+	ID        uint   `gorm:"primarykey"`
+	ProjectID uint   `gorm:"not null;default:0;index"`
+	OwnerID   *uint  `gorm:"index"` // OwnerID is the user the view is private to, nil for views shared with the project
+	Name      string `gorm:"type:varchar(100);not null"`
+	Search    string `gorm:"type:varchar(1000)"` // Search is a search query over the requests
+	Method    string `gorm:"type:varchar(10)"`
+	Response  *int
+	Source    string `gorm:"type:varchar(50)"`
+	Consumer  string `gorm:"type:varchar(200)"`
+	SortBy    string `gorm:"type:varchar(20)"` // SortBy is one of created_at, response_time, latency, created_at if empty
+	Order     string `gorm:"type:varchar(4)"`  // Order is asc or desc
+	// Last selects the requests of the last duration before the view is applied, 0 uses StartTime and EndTime
+	Last      time.Duration
+	StartTime *time.Time
+	EndTime   *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Shared reports if everyone with access to the project sees the view
+func (v *View) Shared() bool {
+	return v.OwnerID == nil
+}
+
+// TimeRange returns the time range of the view applied at now, nil bounds are open
+func (v *View) TimeRange(now time.Time) (*time.Time, *time.Time) {
+	if v.Last > 0 {
+		start := now.Add(-v.Last)
+		return &start, &now
+	}
+	return v.StartTime, v.EndTime
+}
@@ -0,0 +1,488 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+)
+
+const (
+	_ANALYTICS_TIMEOUT         = 30 * time.Second
+	_ANALYTICS_BUFFER_BATCHES  = 10 // _ANALYTICS_BUFFER_BATCHES is the number of batches kept while the analytics store is down
+	_ANALYTICS_TIME_FORMAT     = "2006-01-02 15:04:05.000"
+	_ANALYTICS_ERROR_BODY_SIZE = 1024
+)
+
+// RequestSink receives completed requests, Record must not block the proxy
+type RequestSink interface {
+	Record(request *model.Request)
+}
+
+// analyticsRecord is a row of the analytics table, a completed request without headers and bodies
+type analyticsRecord struct {
+	ID             uint    `json:"id"`
+	ProjectID      uint    `json:"project_id"`
+	CreatedAt      string  `json:"created_at"`
+	Method         string  `json:"method"`
+	Path           string  `json:"path"`
+	Response       int     `json:"response"`
+	LatencyMs      float64 `json:"latency_ms"`
+	Source         string  `json:"source"`
+	Consumer       string  `json:"consumer"`
+	ConsumerSource string  `json:"consumer_source"`
+	SampleWeight   float64 `json:"sample_weight"`
+	ProxyError     string  `json:"proxy_error"`
+}
+
+func analyticsRecordOf(request *model.Request) analyticsRecord {
+	return analyticsRecord{
+		ID:             request.ID,
+		ProjectID:      request.ProjectID,
+		CreatedAt:      request.CreatedAt.UTC().Format(_ANALYTICS_TIME_FORMAT),
+		Method:         request.Method,
+		Path:           request.Path,
+		Response:       request.Response,
+		LatencyMs:      float64(request.Latency) / float64(time.Millisecond),
+		Source:         request.Source,
+		Consumer:       request.Consumer,
+		ConsumerSource: request.ConsumerSource,
+		SampleWeight:   request.Weight(),
+		ProxyError:     request.ProxyError,
+	}
+}
+
+// AnalyticsClient talks to the http interface of a clickhouse compatible analytics store.
+// Values are sent as query parameters, only the validated database and table names are part of the sql
+type AnalyticsClient struct {
+	Url      string
+	Database string
+	Table    string
+	User     string
+	Password string
+	Http     *http.Client // Http sends the queries, a client with a timeout is used if nil
+}
+
+// NewAnalyticsClient creates the client of the configured analytics store
+func NewAnalyticsClient() *AnalyticsClient {
+	return &AnalyticsClient{
+		Url:      app.AnalyticsUrl,
+		Database: app.AnalyticsDatabase,
+		Table:    app.AnalyticsTable,
+		User:     app.AnalyticsUser,
+		Password: app.AnalyticsPassword,
+	}
+}
+
+func (c *AnalyticsClient) table() string {
+	return c.Database + "." + c.Table
+}
+
+// do runs query with its parameters, body is the data of inserts
+func (c *AnalyticsClient) do(query string, params map[string]string, body io.Reader) (*http.Response, error) {
+	target, err := url.Parse(c.Url)
+	if err != nil {
+		return nil, err
+	}
+	values := target.Query()
+	values.Set("query", query)
+	values.Set("output_format_json_quote_64bit_integers", "0")
+	for name, value := range params {
+		values.Set("param_"+name, value)
+	}
+	target.RawQuery = values.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.User != "" {
+		req.Header.Set("X-ClickHouse-User", c.User)
+		req.Header.Set("X-ClickHouse-Key", c.Password)
+	}
+
+	client := c.Http
+	if client == nil {
+		client = &http.Client{Timeout: _ANALYTICS_TIMEOUT}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrAnalyticsStore, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, _ANALYTICS_ERROR_BODY_SIZE))
+		return nil, fmt.Errorf("%w: %s %s", cerror.ErrAnalyticsStore, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// exec runs a query without a result
+func (c *AnalyticsClient) exec(query string, params map[string]string, body io.Reader) error {
+	resp, err := c.do(query, params, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// query runs a select and decodes its rows into rows
+func (c *AnalyticsClient) query(query string, params map[string]string, rows any) error {
+	resp, err := c.do(query+" FORMAT JSON", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result := struct {
+		Data any `json:"data"`
+	}{Data: rows}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: %v", cerror.ErrAnalyticsStore, err)
+	}
+	return nil
+}
+
+// CreateTable creates the analytics table if it doesn't exist and adds the columns tables created by older versions miss
+func (c *AnalyticsClient) CreateTable() error {
+	err := c.exec(`CREATE TABLE IF NOT EXISTS `+c.table()+` (
+		id UInt64,
+		project_id UInt32,
+		created_at DateTime64(3, 'UTC'),
+		method LowCardinality(String),
+		path String,
+		response UInt16,
+		latency_ms Float64,
+		source LowCardinality(String),
+		consumer String,
+		consumer_source LowCardinality(String),
+		sample_weight Float64 DEFAULT 1,
+		proxy_error LowCardinality(String) DEFAULT ''
+	) ENGINE = MergeTree PARTITION BY toYYYYMM(created_at) ORDER BY (project_id, created_at)`, nil, nil)
+	if err != nil {
+		return err
+	}
+	// tables created by older versions get the columns added since
+	return c.exec("ALTER TABLE "+c.table()+" ADD COLUMN IF NOT EXISTS sample_weight Float64 DEFAULT 1, ADD COLUMN IF NOT EXISTS proxy_error LowCardinality(String) DEFAULT ''", nil, nil)
+}
+
+// Insert inserts records in one request
+func (c *AnalyticsClient) Insert(records []analyticsRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+	return c.exec("INSERT INTO "+c.table()+" FORMAT JSONEachRow", nil, &body)
+}
+
+// analyticsWhere returns the where clause of filter and its parameters
+func analyticsWhere(filter RequestFilter) (string, map[string]string) {
+	var conditions []string
+	params := map[string]string{}
+	param := func(name, typ, value string) string {
+		params[name] = value
+		return "{" + name + ":" + typ + "}"
+	}
+	list := func(name, typ string, values []string) string {
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			placeholders[i] = param(name+"_"+strconv.Itoa(i), typ, value)
+		}
+		return strings.Join(placeholders, ", ")
+	}
+
+	if filter.ProjectID != nil {
+		conditions = append(conditions, "project_id = "+param("project_id", "UInt32", strconv.FormatUint(uint64(*filter.ProjectID), 10)))
+	}
+	if len(filter.IDs) > 0 {
+		ids := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			ids[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		conditions = append(conditions, "id IN ("+list("id", "UInt64", ids)+")")
+	}
+	if filter.AfterID > 0 {
+		conditions = append(conditions, "id > "+param("after_id", "UInt64", strconv.FormatUint(uint64(filter.AfterID), 10)))
+	}
+	if filter.Search != nil && *filter.Search != "" {
+		conditions = append(conditions, "position(path, "+param("search", "String", *filter.Search)+") > 0")
+	}
+	if filter.Method != nil && *filter.Method != "" {
+		conditions = append(conditions, "method = "+param("method", "String", *filter.Method))
+	}
+	if filter.Response != nil {
+		conditions = append(conditions, "response = "+param("response", "UInt16", strconv.Itoa(*filter.Response)))
+	}
+	if filter.Source != nil && *filter.Source != "" {
+		conditions = append(conditions, "source = "+param("source", "String", *filter.Source))
+	}
+	if filter.Consumer != nil {
+		conditions = append(conditions, "consumer = "+param("consumer", "String", *filter.Consumer))
+	}
+	if len(filter.Paths) > 0 {
+		conditions = append(conditions, "path IN ("+list("path", "String", filter.Paths)+")")
+	}
+	if filter.PathPrefix != "" {
+		conditions = append(conditions, "startsWith(path, "+param("path_prefix", "String", filter.PathPrefix)+")")
+	}
+	if len(filter.ExcludeSources) > 0 {
+		conditions = append(conditions, "source NOT IN ("+list("exclude_source", "String", filter.ExcludeSources)+")")
+	}
+	if filter.Answered {
+		conditions = append(conditions, "response > 0")
+	}
+	if filter.ExcludeProxyErrors {
+		conditions = append(conditions, "proxy_error = ''")
+	}
+	if filter.WithConsumer {
+		conditions = append(conditions, "consumer <> ''")
+	}
+	if filter.StartTime != nil {
+		conditions = append(conditions, "created_at >= "+param("start_time", "DateTime64(3, 'UTC')", filter.StartTime.UTC().Format(_ANALYTICS_TIME_FORMAT)))
+	}
+	if filter.EndTime != nil {
+		conditions = append(conditions, "created_at <= "+param("end_time", "DateTime64(3, 'UTC')", filter.EndTime.UTC().Format(_ANALYTICS_TIME_FORMAT)))
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+type analyticsStatsRow struct {
+	Path             string  `json:"path"`
+	Consumer         string  `json:"consumer"`
+	ConsumerSource   string  `json:"consumer_source"`
+	RequestCount     int64   `json:"request_count"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	ClientErrorCount int64   `json:"client_error_count"`
+	ServerErrorCount int64   `json:"server_error_count"`
+	RateLimitedCount int64   `json:"rate_limited_count"`
+	ProxyErrorCount  int64   `json:"proxy_error_count"`
+	LastSeen         string  `json:"last_seen"`
+}
+
+// analyticsStatsColumns aggregates a group of requests, sampled requests count as the requests they stand for
+// and proxy errors apart from the server errors of the upstream
+const analyticsStatsColumns = `toInt64(round(sum(sample_weight))) AS request_count,
+		avgWeighted(latency_ms, sample_weight) AS avg_latency_ms,
+		toInt64(round(sumIf(sample_weight, response >= 400 AND response < 500))) AS client_error_count,
+		toInt64(round(sumIf(sample_weight, response >= 500 AND proxy_error = ''))) AS server_error_count,
+		toInt64(round(sumIf(sample_weight, source = {rate_limit_source:String}))) AS rate_limited_count,
+		toInt64(round(sumIf(sample_weight, proxy_error != ''))) AS proxy_error_count`
+
+func (c *AnalyticsClient) PathStatistics(filter RequestFilter) ([]model.PathStatistics, error) {
+	where, params := analyticsWhere(filter)
+	params["rate_limit_source"] = model.SourceRateLimit
+
+	var rows []analyticsStatsRow
+	query := "SELECT path, " + analyticsStatsColumns + " FROM " + c.table() + where + " GROUP BY path ORDER BY request_count DESC"
+	if err := c.query(query, params, &rows); err != nil {
+		return nil, err
+	}
+
+	stats := make([]model.PathStatistics, len(rows))
+	for i, row := range rows {
+		stats[i] = model.PathStatistics{
+			Path:             row.Path,
+			RequestCount:     row.RequestCount,
+			AverageLatencyMs: row.AvgLatencyMs,
+			ClientErrorCount: row.ClientErrorCount,
+			ServerErrorCount: row.ServerErrorCount,
+			RateLimitedCount: row.RateLimitedCount,
+			ProxyErrorCount:  row.ProxyErrorCount,
+		}
+	}
+	return stats, nil
+}
+
+func (c *AnalyticsClient) ConsumerStatistics(filter RequestFilter, sortBy string, limit int) ([]model.ConsumerStatistics, error) {
+	where, params := analyticsWhere(filter)
+	params["rate_limit_source"] = model.SourceRateLimit
+
+	order := "request_count DESC"
+	switch sortBy {
+	case "errors":
+		order = "sumIf(sample_weight, response >= 400) DESC, request_count DESC"
+	case "latency":
+		order = "avg_latency_ms DESC"
+	}
+	query := "SELECT consumer, max(consumer_source) AS consumer_source, " + analyticsStatsColumns + ", max(created_at) AS last_seen FROM " +
+		c.table() + where + " GROUP BY consumer ORDER BY " + order
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	var rows []analyticsStatsRow
+	if err := c.query(query, params, &rows); err != nil {
+		return nil, err
+	}
+
+	stats := make([]model.ConsumerStatistics, len(rows))
+	for i, row := range rows {
+		stats[i] = model.ConsumerStatistics{
+			Consumer:         row.Consumer,
+			ConsumerSource:   row.ConsumerSource,
+			RequestCount:     row.RequestCount,
+			AverageLatencyMs: row.AvgLatencyMs,
+			ClientErrorCount: row.ClientErrorCount,
+			ServerErrorCount: row.ServerErrorCount,
+			RateLimitedCount: row.RateLimitedCount,
+			ProxyErrorCount:  row.ProxyErrorCount,
+			LastSeen:         parseDbTime(row.LastSeen),
+		}
+	}
+	return stats, nil
+}
+
+// AnalyticsSink streams completed requests to the analytics store in batches. Records are buffered
+// in memory, when the store can't keep up the newest records are dropped instead of slowing the proxy
+type AnalyticsSink struct {
+	Client        *AnalyticsClient
+	Logger        *zap.SugaredLogger
+	BatchSize     int
+	FlushInterval time.Duration // FlushInterval is the time between inserts of partial batches
+
+	once    sync.Once
+	records chan analyticsRecord
+	dropped atomic.Int64
+	created bool // created is set once the table is created, only used by the worker
+	failing bool // failing is set while inserts fail, full batches then wait for the flush interval
+}
+
+// NewAnalyticsSink creates the sink of the configured analytics store, nil if no store is configured
+func NewAnalyticsSink() *AnalyticsSink {
+	if app.AnalyticsUrl == "" {
+		return nil
+	}
+
+	var sink *AnalyticsSink
+	app.Invoke(func(logger *zap.SugaredLogger) {
+		sink = &AnalyticsSink{
+			Client:        NewAnalyticsClient(),
+			Logger:        logger,
+			BatchSize:     app.AnalyticsBatchSize,
+			FlushInterval: time.Duration(app.AnalyticsFlushInterval) * time.Second,
+		}
+	})
+	return sink
+}
+
+// NewAnalyticsWorker creates the background worker inserting the buffered requests
+func NewAnalyticsWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(sink *AnalyticsSink) {
+		if sink == nil {
+			worker = func(ctx context.Context) {}
+			return
+		}
+		worker = sink.Worker()
+	})
+	return worker
+}
+
+func (s *AnalyticsSink) buffer() chan analyticsRecord {
+	s.once.Do(func() {
+		s.records = make(chan analyticsRecord, s.BatchSize*_ANALYTICS_BUFFER_BATCHES)
+	})
+	return s.records
+}
+
+func (s *AnalyticsSink) Record(request *model.Request) {
+	select {
+	case s.buffer() <- analyticsRecordOf(request):
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Worker inserts a batch once it is full or after the flush interval, the rest is inserted when ctx is done.
+// After a failed insert the store is only retried after the flush interval
+func (s *AnalyticsSink) Worker() app.Worker {
+	return func(ctx context.Context) {
+		records := s.buffer()
+		ticker := time.NewTicker(s.FlushInterval)
+		defer ticker.Stop()
+
+		var pending []analyticsRecord
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case record := <-records:
+						pending = append(pending, record)
+					default:
+						s.flush(pending)
+						return
+					}
+				}
+			case record := <-records:
+				pending = append(pending, record)
+				if len(pending) >= s.BatchSize && !s.failing {
+					pending = s.flush(pending)
+				}
+			case <-ticker.C:
+				pending = s.flush(pending)
+			}
+		}
+	}
+}
+
+// flush inserts pending in batches and returns the records left for the next flush
+func (s *AnalyticsSink) flush(pending []analyticsRecord) []analyticsRecord {
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		s.Logger.Warnf("Dropped %d requests, the analytics store can't keep up", dropped)
+	}
+	if len(pending) == 0 {
+		return pending
+	}
+
+	if !s.created {
+		if err := s.Client.CreateTable(); err != nil {
+			s.Logger.Errorf("Failed to create the analytics table, error = %v", err)
+			s.failing = true
+			return s.keep(pending)
+		}
+		s.created = true
+	}
+	for len(pending) > 0 {
+		batch := pending[:min(s.BatchSize, len(pending))]
+		if err := s.Client.Insert(batch); err != nil {
+			s.Logger.Errorf("Failed to insert %d requests into the analytics store, error = %v", len(batch), err)
+			s.failing = true
+			return s.keep(pending)
+		}
+		pending = pending[len(batch):]
+	}
+	s.failing = false
+	return nil
+}
+
+// keep returns the records kept for a retry, the oldest are dropped when there are too many
+func (s *AnalyticsSink) keep(pending []analyticsRecord) []analyticsRecord {
+	if limit := s.BatchSize * _ANALYTICS_BUFFER_BATCHES; len(pending) > limit {
+		s.dropped.Add(int64(len(pending) - limit))
+		pending = pending[len(pending)-limit:]
+	}
+	return pending
+}
@@ -0,0 +1,321 @@
+package service_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// analyticsStub stands in for the http interface of the analytics store
+type analyticsStub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	queries  []analyticsQuery
+	inserted []map[string]any
+	data     string // data is the rows returned by selects
+	failures int    // failures is the number of requests answered with an error
+}
+
+type analyticsQuery struct {
+	query  string
+	params map[string]string
+	user   string
+	key    string
+}
+
+func newAnalyticsStub(t *testing.T) *analyticsStub {
+	stub := &analyticsStub{data: "[]"}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+
+		if stub.failures > 0 {
+			stub.failures--
+			http.Error(w, "Code: 241. DB::Exception: Memory limit exceeded", http.StatusInternalServerError)
+			return
+		}
+
+		received := analyticsQuery{query: r.URL.Query().Get("query"), params: map[string]string{}, user: r.Header.Get("X-ClickHouse-User"), key: r.Header.Get("X-ClickHouse-Key")}
+		for name, values := range r.URL.Query() {
+			if param, ok := strings.CutPrefix(name, "param_"); ok {
+				received.params[param] = values[0]
+			}
+		}
+		stub.queries = append(stub.queries, received)
+
+		switch {
+		case strings.HasPrefix(received.query, "INSERT"):
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				var row map[string]any
+				if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				stub.inserted = append(stub.inserted, row)
+			}
+		case strings.HasPrefix(received.query, "SELECT"):
+			io.WriteString(w, `{"meta":[],"data":`+stub.data+`,"rows":0}`)
+		}
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *analyticsStub) client() *service.AnalyticsClient {
+	return &service.AnalyticsClient{Url: s.URL, Database: "default", Table: "treblle_requests", User: "treblle", Password: "secret", Http: s.Client()}
+}
+
+func (s *analyticsStub) rows() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]any(nil), s.inserted...)
+}
+
+func (s *analyticsStub) received() []analyticsQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]analyticsQuery(nil), s.queries...)
+}
+
+func TestAnalyticsClient_PathStatistics(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.data = `[{"path":"/users","request_count":3,"avg_latency_ms":12.5,"client_error_count":1,"server_error_count":0,"rate_limited_count":1,"proxy_error_count":2}]`
+
+	projectID := uint(2)
+	consumer := "ana"
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stats, err := stub.client().PathStatistics(service.RequestFilter{
+		ProjectID: &projectID,
+		Consumer:  &consumer,
+		Paths:     []string{"/users", "/users'); DROP TABLE x; --"},
+		StartTime: &start,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.PathStatistics{{Path: "/users", RequestCount: 3, AverageLatencyMs: 12.5, ClientErrorCount: 1, RateLimitedCount: 1, ProxyErrorCount: 2}}, stats)
+
+	queries := stub.received()
+	require.Len(t, queries, 1)
+	query := queries[0]
+	assert.Equal(t, "treblle", query.user)
+	assert.Equal(t, "secret", query.key)
+	assert.Contains(t, query.query, "FROM default.treblle_requests WHERE project_id = {project_id:UInt32}")
+	assert.Contains(t, query.query, "path IN ({path_0:String}, {path_1:String})")
+	assert.True(t, strings.HasSuffix(query.query, "FORMAT JSON"))
+	assert.NotContains(t, query.query, "DROP") // values are only sent as parameters
+	assert.Equal(t, map[string]string{
+		"project_id":        "2",
+		"consumer":          "ana",
+		"path_0":            "/users",
+		"path_1":            "/users'); DROP TABLE x; --",
+		"start_time":        "2024-05-01 12:00:00.000",
+		"rate_limit_source": model.SourceRateLimit,
+	}, query.params)
+}
+
+func TestAnalyticsClient_ConsumerStatistics(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.data = `[{"consumer":"ana","consumer_source":"api_key","request_count":4,"avg_latency_ms":8,"client_error_count":0,"server_error_count":2,"rate_limited_count":0,"last_seen":"2024-05-01 12:30:00.250"}]`
+
+	stats, err := stub.client().ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "errors", 5)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, "ana", stats[0].Consumer)
+	assert.Equal(t, int64(2), stats[0].ServerErrorCount)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 250_000_000, time.UTC), stats[0].LastSeen)
+
+	query := stub.received()[0].query
+	assert.Contains(t, query, "consumer <> ''")
+	assert.Contains(t, query, "ORDER BY sumIf(sample_weight, response >= 400) DESC, request_count DESC LIMIT 5")
+}
+
+func TestAnalyticsClient_Error(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.failures = 1
+
+	_, err := stub.client().PathStatistics(service.RequestFilter{})
+	assert.ErrorIs(t, err, cerror.ErrAnalyticsStore)
+	assert.Contains(t, err.Error(), "Memory limit exceeded")
+}
+
+func analyticsRequest(id uint) *model.Request {
+	return &model.Request{
+		ID:           id,
+		ProjectID:    model.DefaultProjectID,
+		Method:       "GET",
+		Path:         "/users",
+		Response:     200,
+		Latency:      1500 * time.Microsecond,
+		Source:       model.SourceProxy,
+		CreatedAt:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		RequestBody:  []byte("left out"),
+		ResponseBody: []byte("left out"),
+	}
+}
+
+func TestAnalyticsSink_Batches(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	sink := &service.AnalyticsSink{Client: stub.client(), Logger: zap.NewNop().Sugar(), BatchSize: 2, FlushInterval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sink.Worker()(ctx)
+		close(done)
+	}()
+
+	for id := uint(1); id <= 3; id++ {
+		sink.Record(analyticsRequest(id))
+	}
+	// the full batch is inserted without waiting for the interval
+	assert.Eventually(t, func() bool { return len(stub.rows()) == 2 }, time.Second, 10*time.Millisecond)
+
+	// the rest is inserted on shutdown
+	cancel()
+	<-done
+	rows := stub.rows()
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]any{
+		"id":              float64(1),
+		"project_id":      float64(model.DefaultProjectID),
+		"created_at":      "2024-05-01 12:00:00.000",
+		"method":          "GET",
+		"path":            "/users",
+		"response":        float64(200),
+		"latency_ms":      1.5,
+		"source":          model.SourceProxy,
+		"consumer":        "",
+		"consumer_source": "",
+		"sample_weight":   1.0,
+		"proxy_error":     "",
+	}, rows[0])
+
+	queries := stub.received()
+	assert.True(t, strings.HasPrefix(queries[0].query, "CREATE TABLE IF NOT EXISTS default.treblle_requests"))
+	assert.True(t, strings.HasPrefix(queries[1].query, "ALTER TABLE default.treblle_requests ADD COLUMN IF NOT EXISTS sample_weight Float64 DEFAULT 1,"))
+	assert.Contains(t, queries[1].query, "ADD COLUMN IF NOT EXISTS proxy_error")
+	assert.Equal(t, "INSERT INTO default.treblle_requests FORMAT JSONEachRow", queries[2].query)
+}
+
+func TestAnalyticsSink_RetriesAfterFailure(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.failures = 2 // the table creation and its column upgrade
+	sink := &service.AnalyticsSink{Client: stub.client(), Logger: zap.NewNop().Sugar(), BatchSize: 100, FlushInterval: 20 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.Worker()(ctx)
+
+	sink.Record(analyticsRequest(1))
+	sink.Record(analyticsRequest(2))
+	assert.Eventually(t, func() bool { return len(stub.rows()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestAnalyticsSink_WaitsForIntervalWhileFailing(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.failures = 100
+	sink := &service.AnalyticsSink{Client: stub.client(), Logger: zap.NewNop().Sugar(), BatchSize: 1, FlushInterval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.Worker()(ctx)
+
+	for id := uint(1); id <= 5; id++ {
+		sink.Record(analyticsRequest(id))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// only the first full batch tried the store
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	assert.Equal(t, 99, stub.failures)
+}
+
+func TestAnalyticsSink_DropsWhenFull(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	sink := &service.AnalyticsSink{Client: stub.client(), Logger: zap.NewNop().Sugar(), BatchSize: 1, FlushInterval: time.Hour}
+
+	// nothing reads the buffer, recording never blocks
+	for id := uint(1); id <= 20; id++ {
+		sink.Record(analyticsRequest(id))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink.Worker()(ctx)
+	assert.Len(t, stub.rows(), 10)
+}
+
+func TestReqLogger_RecordsCompletedRequests(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:analytics_logger?mode=memory&cache=private"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Request{}))
+
+	recorded := &recordingSink{}
+	reqLogger := &service.ReqLogger{Requests: service.NewSQLRequestStore(db), Logger: zap.NewNop().Sugar(), Config: model.RuntimeConfig{SampleRate: 1}, Sink: recorded}
+
+	logged, err := reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	require.NoError(t, err)
+	assert.Empty(t, recorded.requests) // only completed requests are recorded
+
+	_, err = reqLogger.LogResponse(logged, &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody})
+	require.NoError(t, err)
+	require.Len(t, recorded.requests, 1)
+	assert.Equal(t, logged.ID, recorded.requests[0].ID)
+	assert.Equal(t, http.StatusNoContent, recorded.requests[0].Response)
+}
+
+type recordingSink struct {
+	requests []*model.Request
+}
+
+func (s *recordingSink) Record(request *model.Request) {
+	s.requests = append(s.requests, request)
+}
+
+func TestRequestCrudService_StatisticsFromAnalytics(t *testing.T) {
+	stub := newAnalyticsStub(t)
+	stub.data = `[{"path":"/users?page=1","request_count":2,"avg_latency_ms":10},{"path":"/users?page=2","request_count":2,"avg_latency_ms":20}]`
+
+	db, err := gorm.Open(sqlite.Open("file:analytics_crud?mode=memory&cache=private"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Request{}, &model.Violation{}))
+
+	app.AnalyticsUrl, app.AnalyticsDatabase, app.AnalyticsTable, app.AnalyticsQueries = stub.URL, "default", "treblle_requests", true
+	defer func() { app.AnalyticsUrl, app.AnalyticsQueries = "", false }()
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	crud := service.NewRequestCrudService()
+
+	stats, err := crud.GetStatistics(3, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, stats.StatsPerPath, 1)
+	assert.Equal(t, "/users", stats.StatsPerPath[0].Path)
+	assert.Equal(t, int64(4), stats.StatsPerPath[0].RequestCount)
+	assert.Equal(t, 15.0, stats.StatsPerPath[0].AverageLatencyMs)
+
+	queries := stub.received()
+	require.Len(t, queries, 1)
+	assert.Equal(t, "3", queries[0].params["project_id"])
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	_API_KEY_PREFIX     = "trbl_"
+	_API_KEY_PREFIX_LEN = len(_API_KEY_PREFIX) + 8
+	// _KEY_USE_INTERVAL limits how often the last use of a key is written, every use is audited
+	_KEY_USE_INTERVAL = time.Minute
+)
+
+type IApiKeyService interface {
+	app.ApiKeyAuthenticator
+	ListKeys() ([]model.ApiKey, error)
+	// CreateKey stores a new key and returns it, the key can't be read again afterwards
+	CreateKey(actor string, apiKey *model.ApiKey) (string, error)
+	RevokeKey(actor string, id uint) (*model.ApiKey, error)
+}
+
+// ApiKeyService manages the api keys of the dashboard api, keys are random so a sha256 hash is enough to store them
+type ApiKeyService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	AuditSrv IAuditService
+	Now      func() time.Time
+}
+
+func NewApiKeyService() IApiKeyService {
+	var service *ApiKeyService
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &ApiKeyService{
+			Db:       db,
+			Logger:   logger,
+			AuditSrv: auditSrv,
+			Now:      time.Now,
+		}
+	})
+
+	return service
+}
+
+// NewApiKeyAuthenticator exposes the api key service to the http server
+func NewApiKeyAuthenticator() app.ApiKeyAuthenticator {
+	var auth app.ApiKeyAuthenticator
+	app.Invoke(func(service IApiKeyService) {
+		auth = service
+	})
+	return auth
+}
+
+func (s *ApiKeyService) ListKeys() ([]model.ApiKey, error) {
+	var keys []model.ApiKey
+	if err := s.Db.Order("created_at desc").Order("id desc").Find(&keys).Error; err != nil {
+		s.Logger.Errorf("Failed to list api keys, error = %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *ApiKeyService) CreateKey(actor string, apiKey *model.ApiKey) (string, error) {
+	if len(apiKey.Scopes) == 0 {
+		return "", cerror.ErrUnknownApiKeyScope
+	}
+	for _, scope := range apiKey.Scopes {
+		if !scope.IsValid() {
+			return "", cerror.ErrUnknownApiKeyScope
+		}
+	}
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(s.Now()) {
+		return "", cerror.ErrBadApiKeyExpiry
+	}
+	if apiKey.ProjectID != model.DefaultProjectID {
+		if err := s.Db.First(&model.Project{}, apiKey.ProjectID).Error; err != nil {
+			return "", err
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		s.Logger.Errorf("Failed to generate api key, error = %v", err)
+		return "", err
+	}
+	key := _API_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey.ID = 0
+	apiKey.Prefix = key[:_API_KEY_PREFIX_LEN]
+	apiKey.KeyHash = hashApiKey(key)
+	apiKey.LastUsedAt = nil
+	apiKey.RevokedAt = nil
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(apiKey).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditApiKeyCreated, model.AuditTarget("api_key", apiKey.ID), nil, apiKey)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create api key, error = %v", err)
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *ApiKeyService) RevokeKey(actor string, id uint) (*model.ApiKey, error) {
+	var apiKey model.ApiKey
+	if err := s.Db.First(&apiKey, id).Error; err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt != nil {
+		return &apiKey, nil
+	}
+
+	before := apiKey
+	now := s.Now()
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		apiKey.RevokedAt = &now
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditApiKeyRevoked, model.AuditTarget("api_key", apiKey.ID), before, apiKey)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to revoke api key, error = %v", err)
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// AuthenticateKey returns the active key matching key. Every use is audited, the last use time is only
+// written once per _KEY_USE_INTERVAL so busy scripts don't update the key on every request
+func (s *ApiKeyService) AuthenticateKey(key string) (*model.ApiKey, error) {
+	var apiKey model.ApiKey
+	err := s.Db.Where("key_hash = ?", hashApiKey(key)).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, cerror.ErrInvalidApiKey
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read api key, error = %v", err)
+		return nil, err
+	}
+
+	now := s.Now()
+	if !apiKey.IsActive(now) {
+		return nil, cerror.ErrInvalidApiKey
+	}
+	// a use that can't be audited is refused
+	if err := recordAudit(s.Db, s.AuditSrv, apiKey.Actor(), model.AuditApiKeyUsed, model.AuditTarget("api_key", apiKey.ID), nil, nil); err != nil {
+		return nil, err
+	}
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < _KEY_USE_INTERVAL {
+		return &apiKey, nil
+	}
+
+	// the condition makes sure only one of concurrent requests writes the use
+	rez := s.Db.Model(&model.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-_KEY_USE_INTERVAL)).
+		Update("last_used_at", now)
+	if rez.Error != nil {
+		s.Logger.Errorf("Failed to track api key use, error = %v", rez.Error)
+		return &apiKey, nil
+	}
+	apiKey.LastUsedAt = &now
+	return &apiKey, nil
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
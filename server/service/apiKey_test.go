@@ -0,0 +1,243 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- ApiKeyService Test Suite ---
+type ApiKeyServiceTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	apiKeySrv *service.ApiKeyService
+	now       time.Time
+}
+
+func (suite *ApiKeyServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:api_key_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.ApiKey{}, &model.AuditEntry{}, &model.Project{}))
+
+	suite.db = db
+	suite.now = time.Unix(1700000000, 0)
+	suite.apiKeySrv = &service.ApiKeyService{
+		Db:       db,
+		Logger:   zap.NewNop().Sugar(),
+		AuditSrv: &service.AuditService{Db: db, Logger: zap.NewNop().Sugar()},
+		Now:      func() time.Time { return suite.now },
+	}
+}
+
+func (suite *ApiKeyServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestApiKeyServiceTestSuite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	suite.Run(t, new(ApiKeyServiceTestSuite))
+}
+
+func (suite *ApiKeyServiceTestSuite) create(scopes ...model.ApiKeyScope) (string, *model.ApiKey) {
+	apiKey := &model.ApiKey{Name: "ci", Scopes: scopes}
+	key, err := suite.apiKeySrv.CreateKey("user:admin@example.com", apiKey)
+	suite.Require().NoError(err)
+	return key, apiKey
+}
+
+func (suite *ApiKeyServiceTestSuite) audit() []model.AuditEntry {
+	var entries []model.AuditEntry
+	suite.Require().NoError(suite.db.Order("id").Find(&entries).Error)
+	return entries
+}
+
+// serve sends a request with key through the auth middleware to routes needing each scope
+func (suite *ApiKeyServiceTestSuite) serve(method, target, key string) int {
+	router := gin.New()
+	api := router.Group("/api", app.Authenticate(nil, suite.apiKeySrv))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/requests", ok)
+	api.GET("/requests/statistics", ok)
+	api.GET("/requests/:id", ok)
+	api.GET("/openapi/inferred", ok)
+	api.GET("/mock/routes", ok)
+	api.POST("/mock/routes", ok)
+	api.GET("/rate-limits", ok)
+	api.POST("/rate-limits", ok)
+	api.PATCH("/config", ok)
+	api.POST("/openapi/specs", ok)
+	api.GET("/auth/me", ok)
+	api.GET("/requests/:id/admin", app.RequireRole(model.RoleAdmin), ok)
+
+	req := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		req.Header.Set(app.ApiKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+// --- Test Cases ---
+
+func (suite *ApiKeyServiceTestSuite) TestCreateKey() {
+	key, apiKey := suite.create(model.ScopeReadRequests, model.ScopeReadStats)
+	assert.True(suite.T(), strings.HasPrefix(key, "trbl_"))
+	assert.Equal(suite.T(), key[:13], apiKey.Prefix)
+
+	var stored model.ApiKey
+	suite.Require().NoError(suite.db.First(&stored, apiKey.ID).Error)
+	assert.NotContains(suite.T(), stored.KeyHash, key[5:])
+	assert.Equal(suite.T(), model.ApiKeyScopes{model.ScopeReadRequests, model.ScopeReadStats}, stored.Scopes)
+
+	_, err := suite.apiKeySrv.CreateKey("user:a", &model.ApiKey{Name: "x"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownApiKeyScope)
+	_, err = suite.apiKeySrv.CreateKey("user:a", &model.ApiKey{Name: "x", Scopes: model.ApiKeyScopes{"write_everything"}})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownApiKeyScope)
+	past := suite.now.Add(-time.Hour)
+	_, err = suite.apiKeySrv.CreateKey("user:a", &model.ApiKey{Name: "x", Scopes: model.ApiKeyScopes{model.ScopeReadStats}, ExpiresAt: &past})
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadApiKeyExpiry)
+
+	entries := suite.audit()
+	suite.Require().Len(entries, 1)
+	assert.Equal(suite.T(), "user:admin@example.com", entries[0].Actor)
+	assert.Equal(suite.T(), model.AuditApiKeyCreated, entries[0].Action)
+	assert.Equal(suite.T(), fmt.Sprintf("api_key:%d", apiKey.ID), entries[0].Target)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestAuthenticateKey_TracksUse() {
+	key, apiKey := suite.create(model.ScopeReadStats)
+
+	authenticated, err := suite.apiKeySrv.AuthenticateKey(key)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), apiKey.ID, authenticated.ID)
+
+	// the last use is written once a minute
+	first := suite.now
+	suite.now = suite.now.Add(30 * time.Second)
+	_, err = suite.apiKeySrv.AuthenticateKey(key)
+	suite.Require().NoError(err)
+	var stored model.ApiKey
+	suite.Require().NoError(suite.db.First(&stored, apiKey.ID).Error)
+	assert.True(suite.T(), stored.LastUsedAt.Equal(first))
+	suite.now = suite.now.Add(time.Minute)
+	_, err = suite.apiKeySrv.AuthenticateKey(key)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.db.First(&stored, apiKey.ID).Error)
+	suite.Require().NotNil(stored.LastUsedAt)
+	assert.True(suite.T(), stored.LastUsedAt.Equal(suite.now))
+
+	// every use is audited
+	entries := suite.audit()
+	suite.Require().Len(entries, 4)
+	for _, entry := range entries[1:] {
+		assert.Equal(suite.T(), model.AuditApiKeyUsed, entry.Action)
+		assert.Equal(suite.T(), apiKey.Actor(), entry.Actor)
+	}
+}
+
+func (suite *ApiKeyServiceTestSuite) TestAuthenticateKey_RejectsInactiveKeys() {
+	_, err := suite.apiKeySrv.AuthenticateKey("trbl_unknown")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+
+	expiresAt := suite.now.Add(time.Hour)
+	expiring := &model.ApiKey{Name: "expiring", Scopes: model.ApiKeyScopes{model.ScopeReadStats}, ExpiresAt: &expiresAt}
+	expiringKey, err := suite.apiKeySrv.CreateKey("user:a", expiring)
+	suite.Require().NoError(err)
+	revokedKey, revoked := suite.create(model.ScopeReadStats)
+
+	_, err = suite.apiKeySrv.RevokeKey("user:b", revoked.ID)
+	suite.Require().NoError(err)
+	_, err = suite.apiKeySrv.AuthenticateKey(revokedKey)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+
+	_, err = suite.apiKeySrv.AuthenticateKey(expiringKey)
+	assert.NoError(suite.T(), err)
+	suite.now = expiresAt
+	_, err = suite.apiKeySrv.AuthenticateKey(expiringKey)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+
+	// revoking twice is only audited once
+	_, err = suite.apiKeySrv.RevokeKey("user:b", revoked.ID)
+	suite.Require().NoError(err)
+	_, err = suite.apiKeySrv.RevokeKey("user:b", revoked.ID+100)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	var revocations int64
+	suite.Require().NoError(suite.db.Model(&model.AuditEntry{}).Where("action = ?", model.AuditApiKeyRevoked).Count(&revocations).Error)
+	assert.Equal(suite.T(), int64(1), revocations)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestMiddleware_Scopes() {
+	requestsKey, _ := suite.create(model.ScopeReadRequests)
+	configKey, _ := suite.create(model.ScopeManageConfig)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.serve("GET", "/api/requests", ""))
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.serve("GET", "/api/requests", "trbl_unknown"))
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("GET", "/api/requests", requestsKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/requests/statistics", requestsKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/mock/routes", requestsKey))
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("GET", "/api/mock/routes", configKey))
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("POST", "/api/mock/routes", configKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/requests", configKey))
+
+	// keys never act as users
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/auth/me", configKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/requests/1/admin", configKey))
+}
+
+func (suite *ApiKeyServiceTestSuite) TestMiddleware_ProjectKeysCantChangeGlobalResources() {
+	project := model.Project{Name: "Shop", Slug: "shop"}
+	suite.Require().NoError(suite.db.Create(&project).Error)
+	defaultKey, _ := suite.create(model.ScopeManageConfig)
+	projectKey, err := suite.apiKeySrv.CreateKey("user:a", &model.ApiKey{Name: "shop", Scopes: model.ApiKeyScopes{model.ScopeManageConfig}, ProjectID: project.ID})
+	suite.Require().NoError(err)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("POST", "/api/rate-limits", defaultKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("POST", "/api/rate-limits", projectKey))
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("PATCH", "/api/config", defaultKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("PATCH", "/api/config", projectKey))
+
+	// reading them and changing resources of the key's project is allowed
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("GET", "/api/rate-limits", projectKey))
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("POST", "/api/mock/routes", projectKey))
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("POST", "/api/openapi/specs", projectKey))
+}
+
+func (suite *ApiKeyServiceTestSuite) TestMiddleware_RequestDetailNeedsReadRequests() {
+	requestsKey, _ := suite.create(model.ScopeReadRequests)
+	statsKey, _ := suite.create(model.ScopeReadStats)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("GET", "/api/requests/1", requestsKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/requests/1", statsKey))
+}
+
+func (suite *ApiKeyServiceTestSuite) TestMiddleware_InferredSpecNeedsReadStats() {
+	requestsKey, _ := suite.create(model.ScopeReadRequests)
+	statsKey, _ := suite.create(model.ScopeReadStats)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve("GET", "/api/openapi/inferred", statsKey))
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve("GET", "/api/openapi/inferred", requestsKey))
+}
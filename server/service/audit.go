@@ -0,0 +1,112 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"treblle/app"
+	"treblle/model"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IAuditService interface {
+	// Record appends an entry to the audit log in tx, the transaction of the audited change, so neither is kept
+	// without the other. Entries are never changed afterwards
+	Record(tx *gorm.DB, entry *model.AuditEntry) error
+	// List returns a page of entries matching params, newest first, and the total count
+	List(params ListAuditParams) ([]model.AuditEntry, int64, error)
+}
+
+// ListAuditParams filters the audit log, nil filters are not applied
+type ListAuditParams struct {
+	Actor     *string
+	Action    *string
+	Target    *string // Target is a <kind>:<id> target or a kind matching every object of the kind
+	StartTime *time.Time
+	EndTime   *time.Time
+
+	// Pagination
+	Limit  int
+	Offset int
+}
+
+// AuditService is the only writer of the audit log and never changes or deletes entries
+type AuditService struct {
+	Db     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewAuditService() IAuditService {
+	var service *AuditService
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &AuditService{
+			Db:     db,
+			Logger: logger,
+		}
+	})
+
+	return service
+}
+
+func (s *AuditService) Record(tx *gorm.DB, entry *model.AuditEntry) error {
+	entry.ID = 0
+	entry.CreatedAt = time.Time{} // always the time of the insert so entries can't be backdated
+	if err := tx.Create(entry).Error; err != nil {
+		s.Logger.Errorf("Failed to record audit entry %s of %s, error = %v", entry.Action, entry.Target, err)
+		return err
+	}
+	return nil
+}
+
+func (s *AuditService) List(params ListAuditParams) ([]model.AuditEntry, int64, error) {
+	query := s.Db.Model(&model.AuditEntry{})
+	if params.Actor != nil {
+		query = query.Where("actor = ?", *params.Actor)
+	}
+	if params.Action != nil {
+		query = query.Where("action = ?", *params.Action)
+	}
+	if params.Target != nil {
+		if strings.Contains(*params.Target, ":") {
+			query = query.Where("target = ?", *params.Target)
+		} else {
+			query = query.Where("target LIKE ?", *params.Target+":%")
+		}
+	}
+	if params.StartTime != nil {
+		query = query.Where("created_at >= ?", *params.StartTime)
+	}
+	if params.EndTime != nil {
+		query = query.Where("created_at <= ?", *params.EndTime)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		s.Logger.Errorf("Failed to count audit entries, error = %v", err)
+		return nil, 0, err
+	}
+
+	var entries []model.AuditEntry
+	err := query.Order("created_at desc").Order("id desc").Limit(params.Limit).Offset(params.Offset).Find(&entries).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to list audit entries, error = %v", err)
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// recordAudit records a change of target made by actor in tx, the transaction of the change. before and after
+// are the target before and after the change and nil when it didn't exist. A failure must undo the change
+func recordAudit(tx *gorm.DB, auditSrv IAuditService, actor string, action model.AuditAction, target string, before, after any) error {
+	if auditSrv == nil {
+		return nil
+	}
+	return auditSrv.Record(tx, &model.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Changes: model.DiffAudit(before, after),
+	})
+}
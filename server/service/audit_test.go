@@ -0,0 +1,197 @@
+package service_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testActor is the actor of changes made by tests
+const testActor = "user:admin@example.com"
+
+func TestDiffAudit(t *testing.T) {
+	rule := model.RateLimitRule{ID: 1, Path: "/users", Enabled: true, Limit: 10, CreatedAt: time.Now()}
+	changed := rule
+	changed.Limit = 20
+	changed.UpdatedAt = time.Now()
+
+	changes := model.DiffAudit(rule, changed)
+	assert.Equal(t, model.AuditChanges{"Limit": {Before: float64(10), After: float64(20)}}, changes)
+
+	changes = model.DiffAudit(nil, &rule)
+	assert.Equal(t, model.AuditChange{After: "/users"}, changes["Path"])
+	assert.NotContains(t, changes, "CreatedAt")
+
+	changes = model.DiffAudit(&rule, (*model.RateLimitRule)(nil))
+	assert.Equal(t, model.AuditChange{Before: "/users"}, changes["Path"])
+
+	assert.Nil(t, model.DiffAudit(rule, rule))
+	assert.Nil(t, model.DiffAudit(nil, nil))
+
+	// secrets are redacted but still reported when they change
+	user := model.User{ID: 1, Email: "a@example.com", PasswordHash: "old"}
+	newPassword := user
+	newPassword.PasswordHash = "new"
+	changes = model.DiffAudit(user, newPassword)
+	assert.Equal(t, model.AuditChanges{"PasswordHash": {Before: model.RedactedValue, After: model.RedactedValue}}, changes)
+
+	// large fields are hashed
+	changes = model.DiffAudit(nil, model.ApiSpec{Document: strings.Repeat("x", 10000)})
+	assert.True(t, strings.HasPrefix(changes["Document"].After.(string), "sha256:"))
+}
+
+// --- Audit Service Test Suite ---
+type AuditServiceTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	auditSrv service.IAuditService
+}
+
+func (suite *AuditServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:audit_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.AuditEntry{}, &model.RateLimitRule{}, &model.User{}))
+	suite.db = db
+	suite.auditSrv = &service.AuditService{Db: db, Logger: zap.NewNop().Sugar()}
+}
+
+func (suite *AuditServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestAuditServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditServiceTestSuite))
+}
+
+// --- Test Cases ---
+
+func (suite *AuditServiceTestSuite) TestRecord_IsAppendOnly() {
+	backdated := time.Now().Add(-24 * time.Hour)
+	entry := model.AuditEntry{ID: 42, Actor: testActor, Action: model.AuditProjectCreated, Target: "project:1", CreatedAt: backdated}
+	suite.Require().NoError(suite.auditSrv.Record(suite.db, &entry))
+	assert.NotEqual(suite.T(), uint(42), entry.ID)
+	assert.WithinDuration(suite.T(), time.Now(), entry.CreatedAt, 5*time.Second)
+
+	err := suite.db.Model(&entry).Update("actor", "someone else").Error
+	assert.ErrorIs(suite.T(), err, cerror.ErrAuditAppendOnly)
+	err = suite.db.Delete(&entry).Error
+	assert.ErrorIs(suite.T(), err, cerror.ErrAuditAppendOnly)
+
+	var stored model.AuditEntry
+	suite.Require().NoError(suite.db.First(&stored, entry.ID).Error)
+	assert.Equal(suite.T(), testActor, stored.Actor)
+}
+
+func (suite *AuditServiceTestSuite) TestList_FiltersAndPaginates() {
+	entries := []model.AuditEntry{
+		{Actor: testActor, Action: model.AuditProjectCreated, Target: "project:1"},
+		{Actor: testActor, Action: model.AuditProjectUpdated, Target: "project:1"},
+		{Actor: "api_key:trbl_abcdefgh", Action: model.AuditRateLimitCreated, Target: "rate_limit:1"},
+		{Actor: testActor, Action: model.AuditProjectCreated, Target: "project:12"},
+	}
+	for i := range entries {
+		suite.Require().NoError(suite.auditSrv.Record(suite.db, &entries[i]))
+	}
+
+	page, total, err := suite.auditSrv.List(service.ListAuditParams{Limit: 2})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(4), total)
+	suite.Require().Len(page, 2)
+	assert.Equal(suite.T(), entries[3].ID, page[0].ID) // newest first
+
+	page, _, err = suite.auditSrv.List(service.ListAuditParams{Limit: 2, Offset: 2})
+	suite.Require().NoError(err)
+	suite.Require().Len(page, 2)
+	assert.Equal(suite.T(), entries[0].ID, page[1].ID)
+
+	actor := "api_key:trbl_abcdefgh"
+	page, total, err = suite.auditSrv.List(service.ListAuditParams{Actor: &actor, Limit: 10})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+	assert.Equal(suite.T(), model.AuditRateLimitCreated, page[0].Action)
+
+	target := "project:1"
+	_, total, err = suite.auditSrv.List(service.ListAuditParams{Target: &target, Limit: 10})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+
+	kind := "project"
+	action := string(model.AuditProjectCreated)
+	_, total, err = suite.auditSrv.List(service.ListAuditParams{Target: &kind, Action: &action, Limit: 10})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+
+	future := time.Now().Add(time.Hour)
+	_, total, err = suite.auditSrv.List(service.ListAuditParams{StartTime: &future, Limit: 10})
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), total)
+}
+
+func (suite *AuditServiceTestSuite) TestServices_RecordChanges() {
+	rateLimitSrv := &service.RateLimitService{Db: suite.db, Logger: zap.NewNop().Sugar(), Store: service.NewMemoryRateLimitStore(), Now: time.Now, AuditSrv: suite.auditSrv}
+	rule := model.RateLimitRule{Path: "/users", Enabled: true, Algorithm: model.RateLimitTokenBucket, Key: model.RateLimitByIP, Limit: 10, Window: time.Minute}
+	suite.Require().NoError(rateLimitSrv.CreateRule(testActor, &rule))
+	updated := rule
+	updated.Limit = 5
+	suite.Require().NoError(rateLimitSrv.UpdateRule(testActor, &updated))
+	suite.Require().NoError(rateLimitSrv.DeleteRule(testActor, rule.ID))
+
+	target := model.AuditTarget("rate_limit", rule.ID)
+	entries, total, err := suite.auditSrv.List(service.ListAuditParams{Target: &target, Limit: 10})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(3), total)
+	assert.Equal(suite.T(), model.AuditRateLimitDeleted, entries[0].Action)
+	assert.Equal(suite.T(), model.AuditChange{Before: "/users"}, entries[0].Changes["Path"])
+	assert.Equal(suite.T(), model.AuditRateLimitUpdated, entries[1].Action)
+	assert.Equal(suite.T(), model.AuditChanges{"Limit": {Before: float64(10), After: float64(5)}}, entries[1].Changes)
+	assert.Equal(suite.T(), model.AuditRateLimitCreated, entries[2].Action)
+	assert.Equal(suite.T(), testActor, entries[2].Actor)
+
+	authSrv := &service.AuthService{Db: suite.db, Logger: zap.NewNop().Sugar(), Now: time.Now, AuditSrv: suite.auditSrv}
+	user, err := authSrv.CreateUser(testActor, "viewer@example.com", "password1", model.RoleViewer)
+	suite.Require().NoError(err)
+	_, err = authSrv.UpdateUser(testActor, user.ID, "password2", "")
+	suite.Require().NoError(err)
+
+	action := string(model.AuditUserUpdated)
+	entries, _, err = suite.auditSrv.List(service.ListAuditParams{Action: &action, Limit: 10})
+	suite.Require().NoError(err)
+	suite.Require().Len(entries, 1)
+	assert.Equal(suite.T(), model.AuditChanges{
+		"PasswordHash": {Before: model.RedactedValue, After: model.RedactedValue},
+		"TokenVersion": {Before: float64(0), After: float64(1)},
+	}, entries[0].Changes)
+
+	// a failed change is not recorded
+	suite.Require().Error(rateLimitSrv.DeleteRule(testActor, rule.ID))
+	_, total, err = suite.auditSrv.List(service.ListAuditParams{Target: &target, Limit: 10})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(3), total)
+}
+
+func (suite *AuditServiceTestSuite) TestServices_FailedAuditUndoesChange() {
+	rateLimitSrv := &service.RateLimitService{Db: suite.db, Logger: zap.NewNop().Sugar(), Store: service.NewMemoryRateLimitStore(), Now: time.Now, AuditSrv: suite.auditSrv}
+	suite.Require().NoError(suite.db.Migrator().DropTable(&model.AuditEntry{}))
+
+	rule := model.RateLimitRule{Path: "/users", Enabled: true, Algorithm: model.RateLimitTokenBucket, Key: model.RateLimitByIP, Limit: 10, Window: time.Minute}
+	suite.Require().Error(rateLimitSrv.CreateRule(testActor, &rule))
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&model.RateLimitRule{}).Count(&count).Error)
+	assert.Zero(suite.T(), count)
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	_DEFAULT_TOKEN_TTL   = 12 * time.Hour
+	_TOKEN_ISSUER        = "treblle"
+	_MIN_PASSWORD_LENGTH = 8
+	_MAX_PASSWORD_LENGTH = 72 // bcrypt ignores the rest
+	_LOGIN_MAX_FAILURES  = 5
+	_LOGIN_FAILURE_TTL   = 15 * time.Minute // failed logins count against an email for this long
+	_LOGIN_MAX_TRACKED   = 10000            // emails with failed logins kept before expired ones are dropped
+)
+
+// dummyHash is compared against when a login email is unknown so both cases take as long
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+type IAuthService interface {
+	app.Authenticator
+	Login(email, password string) (token string, expiresAt time.Time, user *model.User, err error)
+	ListUsers() ([]model.User, error)
+	GetUser(id uint) (*model.User, error)
+	CreateUser(actor string, email, password string, role model.Role) (*model.User, error)
+	// UpdateUser changes the role and password of a user, empty values are left unchanged
+	UpdateUser(actor string, id uint, password string, role model.Role) (*model.User, error)
+	DeleteUser(actor string, id uint) error
+}
+
+// AuthService keeps the dashboard users and issues the tokens of the dashboard api.
+// Tokens only carry the user id and token version, the user is read on every request so
+// role changes apply immediately and a password change revokes the tokens issued before
+type AuthService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Secret   []byte
+	TokenTtl time.Duration
+	Now      func() time.Time
+	AuditSrv IAuditService
+
+	mu       sync.Mutex
+	failures map[string][]time.Time // failures holds the recent failed logins per email
+}
+
+type tokenClaims struct {
+	Role    model.Role `json:"role"`
+	Version int        `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+func NewAuthService() IAuthService {
+	var service *AuthService
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &AuthService{
+			Db:       db,
+			Logger:   logger,
+			Secret:   []byte(app.AuthSecret),
+			TokenTtl: time.Duration(app.AuthTokenTtl) * time.Minute,
+			Now:      time.Now,
+			AuditSrv: auditSrv,
+		}
+
+		if len(service.Secret) == 0 {
+			logger.Warnf("AUTH_SECRET is not set, using a random secret, tokens won't survive a restart")
+			service.Secret = make([]byte, 32)
+			if _, err := rand.Read(service.Secret); err != nil {
+				logger.Fatalf("Failed to generate a secret, error = %v", err)
+			}
+		}
+		if service.TokenTtl <= 0 {
+			service.TokenTtl = _DEFAULT_TOKEN_TTL
+		}
+		if err := service.createFirstAdmin(app.AuthAdminEmail, app.AuthAdminPassword); err != nil {
+			logger.Fatalf("Failed to create the startup admin, error = %v", err)
+		}
+	})
+
+	return service
+}
+
+// NewAuthenticator exposes the auth service to the http server
+func NewAuthenticator() app.Authenticator {
+	var auth app.Authenticator
+	app.Invoke(func(service IAuthService) {
+		auth = service
+	})
+	return auth
+}
+
+// createFirstAdmin creates an admin when there are no users, so a fresh install can log in
+func (s *AuthService) createFirstAdmin(email, password string) error {
+	if email == "" || password == "" {
+		return nil
+	}
+
+	var count int64
+	if err := s.Db.Model(&model.User{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 0 {
+		return nil
+	}
+	if _, err := s.CreateUser(model.SystemActor, email, password, model.RoleAdmin); err != nil {
+		return err
+	}
+	s.Logger.Infof("Created admin %s", email)
+	return nil
+}
+
+func (s *AuthService) Login(email, password string) (string, time.Time, *model.User, error) {
+	email = normalizeEmail(email)
+	if s.throttled(email) {
+		return "", time.Time{}, nil, cerror.ErrTooManyLogins
+	}
+
+	var user model.User
+	err := s.Db.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		s.loginFailed(email)
+		return "", time.Time{}, nil, cerror.ErrInvalidCredentials
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read user, error = %v", err)
+		return "", time.Time{}, nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		s.loginFailed(email)
+		return "", time.Time{}, nil, cerror.ErrInvalidCredentials
+	}
+	s.mu.Lock()
+	delete(s.failures, email)
+	s.mu.Unlock()
+
+	token, expiresAt, err := s.issueToken(&user)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	return token, expiresAt, &user, nil
+}
+
+// throttled reports if email failed to log in too often recently
+func (s *AuthService) throttled(email string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.recentFailures(email)) >= _LOGIN_MAX_FAILURES
+}
+
+// loginFailed counts a failed login of email
+func (s *AuthService) loginFailed(email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == nil {
+		s.failures = map[string][]time.Time{}
+	}
+	if len(s.failures) >= _LOGIN_MAX_TRACKED {
+		for tracked := range s.failures {
+			s.recentFailures(tracked)
+		}
+	}
+	s.failures[email] = append(s.recentFailures(email), s.Now())
+}
+
+// recentFailures drops the expired failed logins of email and returns the rest, s.mu is held
+func (s *AuthService) recentFailures(email string) []time.Time {
+	since := s.Now().Add(-_LOGIN_FAILURE_TTL)
+	failures := s.failures[email]
+	for len(failures) > 0 && !failures[0].After(since) {
+		failures = failures[1:]
+	}
+	if len(failures) == 0 {
+		delete(s.failures, email)
+		return nil
+	}
+	s.failures[email] = failures
+	return failures
+}
+
+func (s *AuthService) issueToken(user *model.User) (string, time.Time, error) {
+	if user == nil {
+		return "", time.Time{}, cerror.ErrUserIsNil
+	}
+
+	now := s.Now()
+	expiresAt := now.Add(s.TokenTtl)
+	claims := tokenClaims{
+		Role:    user.Role,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    _TOKEN_ISSUER,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.Secret)
+	if err != nil {
+		s.Logger.Errorf("Failed to sign token, error = %v", err)
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Authenticate verifies the token and returns the current state of its user,
+// tokens of deleted users are rejected with ErrInvalidCredentials
+func (s *AuthService) Authenticate(token string) (*model.User, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return s.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(_TOKEN_ISSUER),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.Now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %v", cerror.ErrInvalidTokenFormat, err)
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, cerror.ErrInvalidTokenFormat
+	}
+
+	user, err := s.GetUser(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, cerror.ErrInvalidCredentials
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read user, error = %v", err)
+		return nil, err
+	}
+	if claims.Version != user.TokenVersion {
+		// the password changed since the token was issued
+		return nil, cerror.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *AuthService) ListUsers() ([]model.User, error) {
+	var users []model.User
+	if err := s.Db.Order("email asc").Find(&users).Error; err != nil {
+		s.Logger.Errorf("Failed to list users, error = %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *AuthService) GetUser(id uint) (*model.User, error) {
+	var user model.User
+	if err := s.Db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *AuthService) CreateUser(actor string, email, password string, role model.Role) (*model.User, error) {
+	email = normalizeEmail(email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, cerror.ErrBadEmail
+	}
+	if !role.IsValid() {
+		return nil, cerror.ErrUnknownRole
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.Db.Model(&model.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		s.Logger.Errorf("Failed to read user, error = %v", err)
+		return nil, err
+	}
+	if count != 0 {
+		return nil, cerror.ErrEmailTaken
+	}
+
+	user := model.User{Email: email, PasswordHash: hash, Role: role}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditUserCreated, model.AuditTarget("user", user.ID), nil, user)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create user, error = %v", err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *AuthService) UpdateUser(actor string, id uint, password string, role model.Role) (*model.User, error) {
+	if role != "" && !role.IsValid() {
+		return nil, cerror.ErrUnknownRole
+	}
+
+	var user, before model.User
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		before = user
+		if password != "" {
+			hash, err := hashPassword(password)
+			if err != nil {
+				return err
+			}
+			user.PasswordHash = hash
+			user.TokenVersion++
+		}
+		if role != "" && role != user.Role {
+			if user.Role == model.RoleAdmin {
+				if err := ensureOtherAdmin(tx, user.ID); err != nil {
+					return err
+				}
+			}
+			user.Role = role
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditUserUpdated, model.AuditTarget("user", user.ID), before, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *AuthService) DeleteUser(actor string, id uint) error {
+	var user model.User
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.Role == model.RoleAdmin {
+			if err := ensureOtherAdmin(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			s.Logger.Errorf("Failed to delete user, error = %v", err)
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditUserDeleted, model.AuditTarget("user", user.ID), user, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ensureOtherAdmin keeps at least one admin so users can still be managed
+func ensureOtherAdmin(tx *gorm.DB, id uint) error {
+	var count int64
+	if err := tx.Model(&model.User{}).Where("role = ? AND id <> ?", model.RoleAdmin, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return cerror.ErrLastAdmin
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < _MIN_PASSWORD_LENGTH || len(password) > _MAX_PASSWORD_LENGTH {
+		return "", cerror.ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
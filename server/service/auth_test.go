@@ -0,0 +1,272 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+	"treblle/util/ws"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- AuthService Test Suite ---
+type AuthServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	authSrv *service.AuthService
+	now     time.Time
+	admin   *model.User
+}
+
+func (suite *AuthServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:auth_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.User{}, &model.AuditEntry{}))
+
+	suite.db = db
+	suite.now = time.Now()
+	suite.authSrv = &service.AuthService{
+		Db:       db,
+		Logger:   zap.NewNop().Sugar(),
+		Secret:   []byte("test-secret"),
+		TokenTtl: time.Hour,
+		Now:      func() time.Time { return suite.now },
+	}
+
+	suite.admin, err = suite.authSrv.CreateUser(testActor, " Admin@Example.com", "admin-password", model.RoleAdmin)
+	suite.Require().NoError(err)
+}
+
+func (suite *AuthServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestAuthServiceTestSuite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	suite.Run(t, new(AuthServiceTestSuite))
+}
+
+func (suite *AuthServiceTestSuite) login(email, password string) string {
+	token, _, _, err := suite.authSrv.Login(email, password)
+	suite.Require().NoError(err)
+	return token
+}
+
+// serve sends a request through the auth middleware to a router with a read, two write and an admin only endpoint
+func (suite *AuthServiceTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	router := gin.New()
+	api := router.Group("/api", app.Authenticate(suite.authSrv, nil))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, app.CurrentUser(c).Email) }
+	api.GET("/requests", ok)
+	api.POST("/mocks", ok)
+	api.PUT("/views/:id", ok)
+	api.GET("/users", app.RequireRole(model.RoleAdmin), ok)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthServiceTestSuite) request(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// --- Test Cases ---
+
+func (suite *AuthServiceTestSuite) TestLogin() {
+	token, expiresAt, user, err := suite.authSrv.Login("admin@example.com", "admin-password")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.admin.ID, user.ID)
+	assert.Equal(suite.T(), suite.now.Add(time.Hour), expiresAt)
+
+	authenticated, err := suite.authSrv.Authenticate(token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "admin@example.com", authenticated.Email)
+	assert.NotEqual(suite.T(), "admin-password", authenticated.PasswordHash)
+
+	_, _, _, err = suite.authSrv.Login("admin@example.com", "wrong-password")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	_, _, _, err = suite.authSrv.Login("nobody@example.com", "admin-password")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+}
+
+func (suite *AuthServiceTestSuite) TestLogin_ThrottlesFailures() {
+	for range 5 {
+		_, _, _, err := suite.authSrv.Login("admin@example.com", "wrong-password")
+		assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	}
+
+	// the right password is rejected too until the failures expire
+	_, _, _, err := suite.authSrv.Login(" ADMIN@example.com", "admin-password")
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyLogins)
+	// other emails are not affected
+	_, _, _, err = suite.authSrv.Login("nobody@example.com", "admin-password")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	suite.now = suite.now.Add(16 * time.Minute)
+	suite.login("admin@example.com", "admin-password")
+}
+
+func (suite *AuthServiceTestSuite) TestAuthenticate_RejectsBadTokens() {
+	token := suite.login("admin@example.com", "admin-password")
+
+	_, err := suite.authSrv.Authenticate(token[:len(token)-2] + "xx")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidTokenFormat)
+	_, err = suite.authSrv.Authenticate("not-a-token")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidTokenFormat)
+
+	other := &service.AuthService{Db: suite.db, Logger: zap.NewNop().Sugar(), Secret: []byte("other-secret"), TokenTtl: time.Hour, Now: suite.authSrv.Now}
+	_, err = other.Authenticate(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidTokenFormat)
+
+	suite.now = suite.now.Add(2 * time.Hour)
+	_, err = suite.authSrv.Authenticate(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidTokenFormat)
+}
+
+func (suite *AuthServiceTestSuite) TestUsers_Management() {
+	_, err := suite.authSrv.CreateUser(testActor, "admin@example.com", "password1", model.RoleViewer)
+	assert.ErrorIs(suite.T(), err, cerror.ErrEmailTaken)
+	_, err = suite.authSrv.CreateUser(testActor, "viewer", "password1", model.RoleViewer)
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadEmail)
+	_, err = suite.authSrv.CreateUser(testActor, "viewer@example.com", "short", model.RoleViewer)
+	assert.ErrorIs(suite.T(), err, cerror.ErrWeakPassword)
+	_, err = suite.authSrv.CreateUser(testActor, "viewer@example.com", "password1", "owner")
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownRole)
+
+	viewer, err := suite.authSrv.CreateUser(testActor, "viewer@example.com", "password1", model.RoleViewer)
+	suite.Require().NoError(err)
+	token := suite.login("viewer@example.com", "password1")
+
+	// the last admin can't be demoted or deleted
+	_, err = suite.authSrv.UpdateUser(testActor, suite.admin.ID, "", model.RoleViewer)
+	assert.ErrorIs(suite.T(), err, cerror.ErrLastAdmin)
+	assert.ErrorIs(suite.T(), suite.authSrv.DeleteUser(testActor, suite.admin.ID), cerror.ErrLastAdmin)
+
+	// role changes apply to tokens that were already issued
+	_, err = suite.authSrv.UpdateUser(testActor, viewer.ID, "", model.RoleAdmin)
+	suite.Require().NoError(err)
+	user, err := suite.authSrv.Authenticate(token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.RoleAdmin, user.Role)
+
+	// password changes revoke tokens that were already issued
+	_, err = suite.authSrv.UpdateUser(testActor, viewer.ID, "password2", "")
+	suite.Require().NoError(err)
+	_, err = suite.authSrv.Authenticate(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	token = suite.login("viewer@example.com", "password2")
+
+	suite.Require().NoError(suite.authSrv.DeleteUser(testActor, suite.admin.ID))
+	assert.ErrorIs(suite.T(), suite.authSrv.DeleteUser(testActor, suite.admin.ID), gorm.ErrRecordNotFound)
+
+	// tokens of deleted users stop working
+	_, err = suite.authSrv.CreateUser(testActor, "second@example.com", "password1", model.RoleAdmin)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.authSrv.DeleteUser(testActor, viewer.ID))
+	_, err = suite.authSrv.Authenticate(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+}
+
+func (suite *AuthServiceTestSuite) TestNewAuthService_CreatesFirstAdmin() {
+	defer func(email, password string) {
+		app.AuthAdminEmail, app.AuthAdminPassword = email, password
+	}(app.AuthAdminEmail, app.AuthAdminPassword)
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&model.User{}).Error)
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewAuditService)
+	app.AuthAdminEmail, app.AuthAdminPassword = "root@example.com", "root-password"
+	authSrv := service.NewAuthService()
+
+	_, _, user, err := authSrv.Login("root@example.com", "root-password")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.RoleAdmin, user.Role)
+
+	var entry model.AuditEntry
+	suite.Require().NoError(suite.db.Where("action = ?", model.AuditUserCreated).First(&entry).Error)
+	assert.Equal(suite.T(), model.SystemActor, entry.Actor)
+
+	// existing users are kept as they are
+	app.AuthAdminEmail = "other@example.com"
+	service.NewAuthService()
+	users, err := authSrv.ListUsers()
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), users, 1)
+}
+
+func (suite *AuthServiceTestSuite) TestMiddleware_Roles() {
+	_, err := suite.authSrv.CreateUser(testActor, "viewer@example.com", "password1", model.RoleViewer)
+	suite.Require().NoError(err)
+	viewer := suite.login("viewer@example.com", "password1")
+	admin := suite.login("admin@example.com", "admin-password")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.serve(suite.request("GET", "/api/requests", "")).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.serve(suite.request("GET", "/api/requests", "bad")).Code)
+
+	w := suite.serve(suite.request("GET", "/api/requests", viewer))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "viewer@example.com", w.Body.String())
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve(suite.request("POST", "/api/mocks", viewer)).Code)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.serve(suite.request("GET", "/api/users", viewer)).Code)
+	// viewers save their own views
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(suite.request("PUT", "/api/views/1", viewer)).Code)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(suite.request("POST", "/api/mocks", admin)).Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(suite.request("GET", "/api/users", admin)).Code)
+}
+
+func (suite *AuthServiceTestSuite) TestMiddleware_WebsocketToken() {
+	token := suite.login("admin@example.com", "admin-password")
+
+	// the query token is only accepted on websocket upgrades
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.serve(suite.request("GET", "/api/requests?access_token="+token, "")).Code)
+
+	req := suite.request("GET", "/api/requests?access_token="+token, "")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(req).Code)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	defer func(origins []string) { ws.AllowedOrigins = origins }(ws.AllowedOrigins)
+	ws.AllowedOrigins = []string{"http://localhost:3000"}
+
+	check := func(host, origin string) bool {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/api/ws/requests/statistics", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return ws.CheckOrigin(req)
+	}
+	assert.True(t, check("localhost:8090", ""))
+	assert.True(t, check("localhost:8090", "http://localhost:8090"))
+	assert.True(t, check("localhost:8090", "http://localhost:3000"))
+	assert.False(t, check("localhost:8090", "http://evil.example.com"))
+
+	ws.AllowedOrigins = []string{"*"}
+	assert.True(t, check("localhost:8090", "http://evil.example.com"))
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	_CONFIG_RELOAD_PERIOD = time.Minute
+	_RETENTION_PERIOD     = time.Hour
+	_RETENTION_BATCH_SIZE = 1000
+)
+
+type IConfigService interface {
+	app.RuntimeConfig
+	// Update applies a partial json document to the runtime config, the result is validated and stored
+	Update(actor string, patch []byte) (*model.RuntimeConfig, error)
+	// Reload reads the stored settings, so changes made by other instances are picked up
+	Reload() error
+	// ApplyRetention deletes requests older than the retention and returns how many were deleted
+	ApplyRetention() (int64, error)
+	// Worker reloads the settings and applies the retention in the background
+	Worker() app.Worker
+}
+
+// ConfigService keeps the runtime config. Stored settings override Defaults,
+// the config is swapped at once so readers never see a half applied update
+type ConfigService struct {
+	Db       *gorm.DB
+	Requests RequestStore // Requests holds the requests the retention applies to
+	// Partitions drops expired partitions of the requests table before the retention deletes rows, nil if not partitioned
+	Partitions RequestPartitions
+	Logger     *zap.SugaredLogger
+	Defaults   model.RuntimeConfig // Defaults are used for settings that are not stored, set from env
+	AuditSrv   IAuditService
+	Now        func() time.Time
+
+	mu      sync.Mutex // mu serializes updates
+	current atomic.Pointer[model.RuntimeConfig]
+}
+
+func NewConfigService() IConfigService {
+	var service *ConfigService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, partitioner *RequestPartitioner, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		defaults := model.DefaultRuntimeConfig
+		defaults.UpstreamUrl = app.ProxyUrl
+		defaults.CaptureBodyLimit = app.CaptureBodyLimit
+
+		service = &ConfigService{
+			Db:       db,
+			Requests: requests,
+			Logger:   logger,
+			Defaults: defaults,
+			AuditSrv: auditSrv,
+			Now:      time.Now,
+		}
+		if partitioner != nil {
+			service.Partitions = partitioner
+		}
+		if err := service.Reload(); err != nil {
+			logger.Errorf("Failed to load runtime config, using defaults, error = %v", err)
+		}
+	})
+
+	return service
+}
+
+// NewRuntimeConfig exposes the config service to the proxy and the other services
+func NewRuntimeConfig() app.RuntimeConfig {
+	var config app.RuntimeConfig
+	app.Invoke(func(service IConfigService) {
+		config = service
+	})
+	return config
+}
+
+// NewConfigWorker creates the background worker reloading the config and applying the retention
+func NewConfigWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(service IConfigService) {
+		worker = service.Worker()
+	})
+	return worker
+}
+
+// runtimeConfig reads config, the defaults are used when no config is set
+func runtimeConfig(config app.RuntimeConfig) model.RuntimeConfig {
+	if config == nil {
+		return model.DefaultRuntimeConfig
+	}
+	return config.Runtime()
+}
+
+func (s *ConfigService) Runtime() model.RuntimeConfig {
+	if current := s.current.Load(); current != nil {
+		return *current
+	}
+	return s.Defaults
+}
+
+func (s *ConfigService) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := s.load()
+	if err != nil {
+		return err
+	}
+	s.current.Store(config)
+	return nil
+}
+
+// load applies the stored settings to the defaults
+func (s *ConfigService) load() (*model.RuntimeConfig, error) {
+	var settings []model.Setting
+	if err := s.Db.Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage, len(settings))
+	for _, setting := range settings {
+		values[setting.Key] = json.RawMessage(setting.Value)
+	}
+	stored, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	config := s.Defaults
+	if err := json.Unmarshal(stored, &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadConfig, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (s *ConfigService) Update(actor string, patch []byte) (*model.RuntimeConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadConfig, err)
+	}
+
+	before := s.Runtime()
+	config := before
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadConfig, err)
+	}
+	// the config is read with the password redacted, sending it back unchanged keeps the password
+	if config.UpstreamUrl != before.UpstreamUrl && config.UpstreamUrl == app.RedactCredentials(before.UpstreamUrl) {
+		config.UpstreamUrl = before.UpstreamUrl
+		for key := range changes {
+			if canonical, _ := settingKey(key); canonical == "upstreamUrl" {
+				delete(changes, key)
+			}
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// only the sent settings are stored, the others keep following the defaults
+	settings := make([]model.Setting, 0, len(changes))
+	for key, value := range changes {
+		canonical, ok := settingKey(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown setting %q", cerror.ErrBadConfig, key)
+		}
+		settings = append(settings, model.Setting{Key: canonical, Value: string(value), UpdatedAt: s.Now()})
+	}
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if len(settings) != 0 {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&settings).Error; err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditConfigUpdated, "config:runtime", RedactedConfig(before), RedactedConfig(config))
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to store runtime config, error = %v", err)
+		return nil, err
+	}
+
+	s.current.Store(&config)
+	return &config, nil
+}
+
+// RedactedConfig returns config with the password of the upstream url redacted,
+// the audit log and the config api are no place for secrets
+func RedactedConfig(config model.RuntimeConfig) model.RuntimeConfig {
+	config.UpstreamUrl = app.RedactCredentials(config.UpstreamUrl)
+	return config
+}
+
+// settingKey returns the schema key of a patch key, json decoding matches keys ignoring case
+// so the stored key has to be the one load reads back
+func settingKey(key string) (string, bool) {
+	for _, field := range model.RuntimeConfigSchema {
+		if strings.EqualFold(field.Key, key) {
+			return field.Key, true
+		}
+	}
+	return "", false
+}
+
+func (s *ConfigService) ApplyRetention() (int64, error) {
+	retention := s.Runtime().RetentionDays
+	if retention <= 0 {
+		return 0, nil
+	}
+	before := s.Now().AddDate(0, 0, -retention)
+
+	var deleted int64
+	if s.Partitions != nil {
+		dropped, err := s.Partitions.DropBefore(before)
+		deleted += dropped
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	// batches keep the deletes short on big tables
+	for {
+		ids, err := s.Requests.DeleteBefore(before, _RETENTION_BATCH_SIZE)
+		deleted += int64(len(ids))
+		if len(ids) > 0 {
+			if err := s.Db.Where("request_id IN ?", ids).Delete(&model.Violation{}).Error; err != nil {
+				return deleted, err
+			}
+		}
+		if err != nil || len(ids) == 0 {
+			return deleted, err
+		}
+	}
+}
+
+func (s *ConfigService) Worker() app.Worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(_CONFIG_RELOAD_PERIOD)
+		defer ticker.Stop()
+
+		var lastRetention time.Time
+		for {
+			if err := s.Reload(); err != nil {
+				s.Logger.Errorf("Failed to reload runtime config, error = %v", err)
+			}
+			if s.Now().Sub(lastRetention) >= _RETENTION_PERIOD {
+				lastRetention = s.Now()
+				if n, err := s.ApplyRetention(); err != nil {
+					s.Logger.Errorf("Failed to apply retention, error = %v", err)
+				} else if n > 0 {
+					s.Logger.Infof("Deleted %d requests older than the retention", n)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				s.Logger.Infof("Stopped config worker")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	_DEFAULT_JWT_CLAIM = "sub"
+	// _MAX_CONSUMER_LEN is the size of the consumer column
+	_MAX_CONSUMER_LEN = 200
+)
+
+// defaultConsumerSources are tried in order when CONSUMER_SOURCES is not set
+var defaultConsumerSources = []model.ConsumerSource{model.ConsumerApiKey, model.ConsumerJwt, model.ConsumerBasic, model.ConsumerIP}
+
+// ConsumerIdentifier names the client of a proxied request from the first source that has a value.
+// Api keys are stored as a fingerprint. Bearer tokens are verified with JwtKey, without a key they are
+// only decoded and their consumer is labeled jwt_unverified since clients can put any claim in them
+type ConsumerIdentifier struct {
+	Sources   []model.ConsumerSource
+	KeyHeader string // KeyHeader holds the consumer api key
+	JwtClaim  string // JwtClaim is the token claim naming the consumer
+	JwtKey    any    // JwtKey verifies bearer tokens, an hmac secret as []byte or a public key, nil leaves them unverified
+}
+
+func NewConsumerIdentifier() (*ConsumerIdentifier, error) {
+	identifier := &ConsumerIdentifier{
+		Sources:   defaultConsumerSources,
+		KeyHeader: app.ConsumerKeyHeader,
+		JwtClaim:  app.ConsumerJwtClaim,
+	}
+	if identifier.KeyHeader == "" {
+		identifier.KeyHeader = _DEFAULT_API_KEY_HEADER
+	}
+	if identifier.JwtClaim == "" {
+		identifier.JwtClaim = _DEFAULT_JWT_CLAIM
+	}
+
+	if app.ConsumerJwtKey != "" {
+		key, err := parseJwtKey(app.ConsumerJwtKey)
+		if err != nil {
+			return nil, err
+		}
+		identifier.JwtKey = key
+	}
+
+	if app.ConsumerSources != "" {
+		identifier.Sources = nil
+		for name := range strings.SplitSeq(app.ConsumerSources, ",") {
+			source := model.ConsumerSource(strings.TrimSpace(name))
+			if !source.IsValid() {
+				return nil, fmt.Errorf("%w, got %s", cerror.ErrUnknownConsumerSource, source)
+			}
+			identifier.Sources = append(identifier.Sources, source)
+		}
+	}
+	return identifier, nil
+}
+
+// Identify returns the consumer of req and the source it was read from, empty if no source has a value
+func (c *ConsumerIdentifier) Identify(req *http.Request) (string, model.ConsumerSource) {
+	for _, source := range c.Sources {
+		var consumer string
+		switch source {
+		case model.ConsumerApiKey:
+			if key := strings.TrimSpace(req.Header.Get(c.KeyHeader)); key != "" {
+				consumer = apiKeyFingerprint(key)
+			}
+		case model.ConsumerJwt:
+			if c.JwtKey == nil {
+				consumer = jwtClaim(req.Header.Get("Authorization"), c.JwtClaim)
+				source = model.ConsumerJwtUnverified
+			} else {
+				consumer = verifiedJwtClaim(req.Header.Get("Authorization"), c.JwtClaim, c.JwtKey)
+			}
+		case model.ConsumerBasic:
+			if user, _, ok := req.BasicAuth(); ok {
+				consumer = user
+			}
+		case model.ConsumerIP:
+			consumer = clientIP(req)
+		}
+
+		if consumer != "" {
+			if len(consumer) > _MAX_CONSUMER_LEN {
+				consumer = consumer[:_MAX_CONSUMER_LEN]
+			}
+			return consumer, source
+		}
+	}
+	return "", ""
+}
+
+// apiKeyFingerprint identifies an api key without storing it
+func apiKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
+// parseJwtKey returns the public key of a pem block or the hmac secret in key
+func parseJwtKey(key string) (any, error) {
+	if !strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		return []byte(key), nil
+	}
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(key)); err == nil {
+		return rsaKey, nil
+	}
+	if ecKey, err := jwt.ParseECPublicKeyFromPEM([]byte(key)); err == nil {
+		return ecKey, nil
+	}
+	if edKey, err := jwt.ParseEdPublicKeyFromPEM([]byte(key)); err == nil {
+		return edKey, nil
+	}
+	return nil, cerror.ErrBadConsumerJwtKey
+}
+
+// jwtMethods are the signing methods accepted for a key, so a token can't pick a method the key wasn't meant for
+func jwtMethods(key any) []string {
+	switch key.(type) {
+	case []byte:
+		return []string{"HS256", "HS384", "HS512"}
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case *ecdsa.PublicKey:
+		return []string{"ES256", "ES384", "ES512"}
+	case ed25519.PublicKey:
+		return []string{"EdDSA"}
+	}
+	return nil
+}
+
+// bearerToken returns the token of a bearer authorization header, empty if there is none
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// verifiedJwtClaim returns a string or number claim of a bearer token signed with key,
+// empty if the header holds no token or the token is invalid or expired
+func verifiedJwtClaim(authorization, claim string, key any) string {
+	token := bearerToken(authorization)
+	if token == "" {
+		return ""
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return key, nil
+	}, jwt.WithValidMethods(jwtMethods(key)), jwt.WithJSONNumber())
+	if err != nil {
+		return ""
+	}
+	return claimValue(claims, claim)
+}
+
+// jwtClaim returns a string or number claim of a bearer token without verifying it, empty if the header holds no token
+func jwtClaim(authorization, claim string) string {
+	parts := strings.Split(bearerToken(authorization), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims map[string]any
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return ""
+	}
+	return claimValue(claims, claim)
+}
+
+func claimValue(claims map[string]any, claim string) string {
+	switch value := claims[claim].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
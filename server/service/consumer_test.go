@@ -0,0 +1,227 @@
+package service_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func bearer(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return "Bearer " + encode([]byte(`{"alg":"HS256"}`)) + "." + encode([]byte(claims)) + ".signature"
+}
+
+func TestConsumerIdentifier_Identify(t *testing.T) {
+	identifier := &service.ConsumerIdentifier{
+		Sources:   []model.ConsumerSource{model.ConsumerApiKey, model.ConsumerJwt, model.ConsumerBasic, model.ConsumerIP},
+		KeyHeader: "X-Api-Key",
+		JwtClaim:  "sub",
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		consumer string
+		source   model.ConsumerSource
+	}{
+		{"api key", http.Header{"X-Api-Key": {"secret"}, "Authorization": {bearer(`{"sub":"alice"}`)}}, "key_2bb80d537b1da3e3", model.ConsumerApiKey},
+		{"jwt claim", http.Header{"Authorization": {bearer(`{"sub":"alice"}`)}}, "alice", model.ConsumerJwtUnverified},
+		{"numeric jwt claim", http.Header{"Authorization": {bearer(`{"sub":12345678901}`)}}, "12345678901", model.ConsumerJwtUnverified},
+		{"jwt without claim", http.Header{"Authorization": {bearer(`{"iss":"x"}`)}}, "192.0.2.1", model.ConsumerIP},
+		{"malformed jwt", http.Header{"Authorization": {"Bearer abc"}}, "192.0.2.1", model.ConsumerIP},
+		{"basic auth", http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("bob:pw"))}}, "bob", model.ConsumerBasic},
+		{"ip", http.Header{}, "192.0.2.1", model.ConsumerIP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+			req.Header = tt.header
+			consumer, source := identifier.Identify(req)
+			assert.Equal(t, tt.consumer, consumer)
+			assert.Equal(t, tt.source, source)
+		})
+	}
+
+	// sources that are not configured are skipped
+	identifier.Sources = []model.ConsumerSource{model.ConsumerBasic}
+	consumer, source := identifier.Identify(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	assert.Empty(t, consumer)
+	assert.Empty(t, source)
+}
+
+func TestConsumerIdentifier_VerifiesJwt(t *testing.T) {
+	identifier := &service.ConsumerIdentifier{
+		Sources:  []model.ConsumerSource{model.ConsumerJwt, model.ConsumerIP},
+		JwtClaim: "sub",
+		JwtKey:   []byte("consumer-secret"),
+	}
+	sign := func(key string, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		assert.NoError(t, err)
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		consumer string
+		source   model.ConsumerSource
+	}{
+		{"signed", sign("consumer-secret", jwt.MapClaims{"sub": "alice"}), "alice", model.ConsumerJwt},
+		{"numeric claim", sign("consumer-secret", jwt.MapClaims{"sub": 12345678901}), "12345678901", model.ConsumerJwt},
+		{"other key", sign("forged", jwt.MapClaims{"sub": "alice"}), "192.0.2.1", model.ConsumerIP},
+		{"expired", sign("consumer-secret", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()}), "192.0.2.1", model.ConsumerIP},
+		{"unsigned", bearer(`{"sub":"alice"}`), "192.0.2.1", model.ConsumerIP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+			req.Header.Set("Authorization", tt.token)
+			consumer, source := identifier.Identify(req)
+			assert.Equal(t, tt.consumer, consumer)
+			assert.Equal(t, tt.source, source)
+		})
+	}
+}
+
+func TestNewConsumerIdentifier(t *testing.T) {
+	defer func(sources string) { app.ConsumerSources = sources }(app.ConsumerSources)
+
+	app.ConsumerSources = "jwt, ip"
+	identifier, err := service.NewConsumerIdentifier()
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ConsumerSource{model.ConsumerJwt, model.ConsumerIP}, identifier.Sources)
+	assert.Equal(t, "sub", identifier.JwtClaim)
+
+	app.ConsumerSources = "jwt,cookie"
+	_, err = service.NewConsumerIdentifier()
+	assert.ErrorIs(t, err, cerror.ErrUnknownConsumerSource)
+
+	defer func(key string) { app.ConsumerJwtKey = key }(app.ConsumerJwtKey)
+	app.ConsumerSources = ""
+	app.ConsumerJwtKey = "consumer-secret"
+	identifier, err = service.NewConsumerIdentifier()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("consumer-secret"), identifier.JwtKey)
+
+	app.ConsumerJwtKey = "-----BEGIN PUBLIC KEY-----\nbm90IGEga2V5\n-----END PUBLIC KEY-----"
+	_, err = service.NewConsumerIdentifier()
+	assert.ErrorIs(t, err, cerror.ErrBadConsumerJwtKey)
+}
+
+// --- Consumer Statistics Test Suite ---
+type ConsumerStatisticsTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	crudService service.IRequestCrudService
+}
+
+func (suite *ConsumerStatisticsTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:consumer_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.Violation{}))
+	suite.db = db
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	suite.crudService = service.NewRequestCrudService()
+
+	now := time.Now()
+	requests := []model.Request{
+		{Method: "GET", Path: "/users", Consumer: "alice", ConsumerSource: "basic", Response: 200, Latency: 10 * time.Millisecond, CreatedAt: now.Add(-3 * time.Minute)},
+		{Method: "GET", Path: "/users", Consumer: "alice", ConsumerSource: "basic", Response: 200, Latency: 30 * time.Millisecond, CreatedAt: now.Add(-2 * time.Minute)},
+		{Method: "POST", Path: "/orders", Consumer: "alice", ConsumerSource: "basic", Response: 201, Latency: 20 * time.Millisecond, CreatedAt: now.Add(-time.Minute)},
+		{Method: "GET", Path: "/users", Consumer: "10.0.0.2", ConsumerSource: "ip", Response: 500, Latency: 900 * time.Millisecond, CreatedAt: now.Add(-time.Minute)},
+		{Method: "GET", Path: "/users", Consumer: "10.0.0.2", ConsumerSource: "ip", Response: 429, Source: model.SourceRateLimit, CreatedAt: now},
+		{Method: "GET", Path: "/users", Source: "import", Response: 404, CreatedAt: now},
+	}
+	suite.Require().NoError(db.Create(&requests).Error)
+	suite.Require().NoError(db.Create(&model.Violation{RequestID: requests[3].ID, Kind: model.ViolationBadParameter, Method: "GET", Endpoint: "/users"}).Error)
+}
+
+func (suite *ConsumerStatisticsTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestConsumerStatisticsTestSuite(t *testing.T) {
+	suite.Run(t, new(ConsumerStatisticsTestSuite))
+}
+
+// --- Test Cases ---
+
+func (suite *ConsumerStatisticsTestSuite) TestTopConsumers_ByRequests() {
+	consumers, err := suite.crudService.TopConsumers(service.TopConsumersParams{SortBy: "requests", Limit: 10})
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 2)
+
+	alice := consumers[0]
+	assert.Equal(suite.T(), "alice", alice.Consumer)
+	assert.Equal(suite.T(), "basic", alice.ConsumerSource)
+	assert.Equal(suite.T(), int64(3), alice.RequestCount)
+	assert.InDelta(suite.T(), 20.0, alice.AverageLatencyMs, 0.001)
+	assert.WithinDuration(suite.T(), time.Now().Add(-time.Minute), alice.LastSeen, 5*time.Second)
+
+	ip := consumers[1]
+	assert.Equal(suite.T(), int64(1), ip.ServerErrorCount)
+	assert.Equal(suite.T(), int64(1), ip.ClientErrorCount)
+	assert.Equal(suite.T(), int64(1), ip.RateLimitedCount)
+}
+
+func (suite *ConsumerStatisticsTestSuite) TestTopConsumers_ByErrorsWithLimit() {
+	consumers, err := suite.crudService.TopConsumers(service.TopConsumersParams{SortBy: "errors", Limit: 1})
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 1)
+	assert.Equal(suite.T(), "10.0.0.2", consumers[0].Consumer)
+
+	since := time.Now().Add(-90 * time.Second)
+	consumers, err = suite.crudService.TopConsumers(service.TopConsumersParams{StartTime: &since, SortBy: "latency"})
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 2)
+	assert.Equal(suite.T(), "10.0.0.2", consumers[0].Consumer)
+	assert.Equal(suite.T(), int64(1), consumers[1].RequestCount)
+}
+
+func (suite *ConsumerStatisticsTestSuite) TestGetConsumerStatistics() {
+	stats, err := suite.crudService.GetConsumerStatistics(model.DefaultProjectID, "10.0.0.2", nil, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(stats.StatsPerPath, 1)
+	assert.Equal(suite.T(), int64(2), stats.StatsPerPath[0].RequestCount)
+	suite.Require().Len(stats.ViolationsPerEndpoint, 1)
+
+	stats, err = suite.crudService.GetConsumerStatistics(model.DefaultProjectID, "alice", nil, nil)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), stats.StatsPerPath, 2)
+	assert.Empty(suite.T(), stats.ViolationsPerEndpoint)
+}
+
+func (suite *ConsumerStatisticsTestSuite) TestList_ConsumerFilter() {
+	consumer := "alice"
+	requests, total, err := suite.crudService.List(service.ListRequestsParams{Consumer: &consumer})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(3), total)
+	for _, request := range requests {
+		assert.Equal(suite.T(), consumer, request.Consumer)
+	}
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ViolationsParams struct {
+	ProjectID uint // ProjectID selects the violations of the project's requests
+	RequestID *uint
+	Kind      *string
+	Endpoint  *string
+	Limit     int
+	Offset    int
+}
+
+type IContractService interface {
+	app.ContractValidator
+	// Upload stores a new version of the project's api spec and starts validating the project's traffic against it
+	Upload(actor string, projectID uint, data []byte) (*model.ApiSpec, error)
+	Specs(projectID uint) ([]model.ApiSpec, error)
+	Spec(projectID uint, id uint) (*model.ApiSpec, error)
+	Violations(params ViolationsParams) ([]model.Violation, int64, error)
+	// Report compares a spec version to the previous one and to the traffic of the project recorded since the given time
+	Report(projectID uint, id uint, since time.Time) (*model.BreakingChangeReport, error)
+}
+
+// ContractService validates proxied traffic against the newest api spec uploaded for its project
+type ContractService struct {
+	Db           *gorm.DB
+	Requests     RequestStore // Requests is the request store the breaking change report reads traffic from
+	Logger       *zap.SugaredLogger
+	Enforce      bool              // Enforce rejects requests with violations with 400
+	UpstreamPath string            // UpstreamPath is the path of the proxy url, used when the default project has no upstream
+	Config       app.RuntimeConfig // Config holds the capture limit, bigger bodies are not validated, and the default upstream
+	AuditSrv     IAuditService
+
+	mu    sync.RWMutex
+	specs map[uint]*compiledSpec // specs are the loaded specs by project, nil for projects without a spec
+}
+
+// compiledSpec is a spec ready for validation
+type compiledSpec struct {
+	id        uint
+	router    routers.Router
+	basePaths []string // basePaths are the paths of the spec servers
+}
+
+func NewContractService() IContractService {
+	var service *ContractService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, logger *zap.SugaredLogger, config app.RuntimeConfig, auditSrv IAuditService) {
+		service = &ContractService{
+			Db:       db,
+			Requests: requests,
+			Logger:   logger,
+			Enforce:  app.ContractEnforce,
+			Config:   config,
+			AuditSrv: auditSrv,
+		}
+		if target, err := url.Parse(app.ProxyUrl); err == nil {
+			service.UpstreamPath = target.Path
+		}
+	})
+
+	return service
+}
+
+// NewContractValidator exposes the contract service to the proxy
+func NewContractValidator() app.ContractValidator {
+	var validator app.ContractValidator
+	app.Invoke(func(service IContractService) {
+		validator = service
+	})
+	return validator
+}
+
+func (s *ContractService) Upload(actor string, projectID uint, data []byte) (*model.ApiSpec, error) {
+	doc, err := parseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	spec := model.ApiSpec{
+		ProjectID: projectID,
+		Title:     doc.Info.Title,
+		Version:   doc.Info.Version,
+		Document:  string(document),
+	}
+
+	compiled, err := compileSpec(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadApiSpec, err)
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&spec).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditApiSpecUploaded, model.AuditTarget("api_spec", spec.ID), nil, spec)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to save api spec, error = %v", err)
+		return nil, err
+	}
+	compiled.id = spec.ID
+
+	s.mu.Lock()
+	if s.specs == nil {
+		s.specs = map[uint]*compiledSpec{}
+	}
+	s.specs[projectID] = compiled
+	s.mu.Unlock()
+
+	return &spec, nil
+}
+
+func (s *ContractService) Specs(projectID uint) ([]model.ApiSpec, error) {
+	var specs []model.ApiSpec
+	if err := s.Db.Omit("document").Where("project_id = ?", projectID).Order("id desc").Find(&specs).Error; err != nil {
+		s.Logger.Errorf("Failed to list api specs, error = %v", err)
+		return nil, err
+	}
+	return specs, nil
+}
+
+func (s *ContractService) Spec(projectID uint, id uint) (*model.ApiSpec, error) {
+	var spec model.ApiSpec
+	if err := s.Db.Where("project_id = ?", projectID).First(&spec, id).Error; err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func (s *ContractService) Violations(params ViolationsParams) ([]model.Violation, int64, error) {
+	query := s.Db.Model(&model.Violation{}).Where("project_id = ?", params.ProjectID)
+	if params.RequestID != nil {
+		query = query.Where("request_id = ?", *params.RequestID)
+	}
+	if params.Kind != nil {
+		query = query.Where("kind = ?", *params.Kind)
+	}
+	if params.Endpoint != nil {
+		query = query.Where("endpoint = ?", *params.Endpoint)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		s.Logger.Errorf("Failed to count violations, error = %v", err)
+		return nil, 0, err
+	}
+
+	var violations []model.Violation
+	if err := query.Order("id desc").Limit(params.Limit).Offset(params.Offset).Find(&violations).Error; err != nil {
+		s.Logger.Errorf("Failed to list violations, error = %v", err)
+		return nil, 0, err
+	}
+	return violations, total, nil
+}
+
+func (s *ContractService) ValidateRequest(req *http.Request, logged *model.Request) (*http.Response, error) {
+	spec, err := s.current(logged.ProjectID)
+	if spec == nil || err != nil {
+		return nil, err
+	}
+	upstreamPath, err := s.upstreamPath(logged.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	validationReq := req.Clone(req.Context())
+	validationReq.URL.Path = specPath(spec, upstreamPath, logged.Path)
+	validationReq.URL.RawPath = ""
+	complete := !logged.RequestTruncated && bodyComplete(req.Header, logged.RequestBody, req.ContentLength, runtimeConfig(s.Config).CaptureBodyLimit)
+	validationReq.Body = io.NopCloser(bytes.NewReader(logged.RequestBody))
+
+	var violations []model.Violation
+	route, pathParams, err := spec.router.FindRoute(validationReq)
+	if err != nil {
+		// identifiers are templated so the statistics have one row per unknown endpoint, not per id
+		endpoint, _ := templatePath(normalizePath(logged.Path))
+		violations = append(violations, newViolation(model.ViolationUnknownEndpoint, logged.Method, endpoint, err.Error()))
+	} else {
+		input := &openapi3filter.RequestValidationInput{
+			Request:    validationReq,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    validationOptions(!complete),
+		}
+		for _, err := range validationErrors(openapi3filter.ValidateRequest(context.Background(), input)) {
+			violations = append(violations, requestViolation(route, err))
+		}
+	}
+
+	if logged.ID == 0 && logged.Sample != nil {
+		// tail sampled requests are only stored with their response, their violations wait for it
+		logged.Sample.Violations = violations
+	} else if err := s.save(spec, logged, violations); err != nil {
+		return nil, err
+	}
+	if !s.Enforce || len(violations) == 0 {
+		return nil, nil
+	}
+	return rejectResponse(violations)
+}
+
+// SaveViolations saves the request violations a tail sampled request holds until it's stored,
+// requests answered by treblle have no response to validate and are only stored after it
+func (s *ContractService) SaveViolations(logged *model.Request) error {
+	if logged.Sample == nil || len(logged.Sample.Violations) == 0 || logged.ID == 0 {
+		return nil
+	}
+	spec, err := s.current(logged.ProjectID)
+	if spec == nil || err != nil {
+		return err
+	}
+	if err := s.save(spec, logged, logged.Sample.Violations); err != nil {
+		return err
+	}
+	logged.Sample.Violations = nil
+	return nil
+}
+
+func (s *ContractService) ValidateResponse(logged *model.Request, resp *http.Response) error {
+	if err := s.SaveViolations(logged); err != nil {
+		return err
+	}
+	spec, err := s.current(logged.ProjectID)
+	if spec == nil || err != nil {
+		return err
+	}
+
+	upstreamPath, err := s.upstreamPath(logged.ProjectID)
+	if err != nil {
+		return err
+	}
+	validationReq, err := routeRequest(spec, upstreamPath, logged)
+	if err != nil {
+		return err
+	}
+
+	route, pathParams, err := spec.router.FindRoute(validationReq)
+	if err != nil {
+		// already recorded as an unknown endpoint
+		return nil
+	}
+
+	complete := bodyComplete(resp.Header, logged.ResponseBody, resp.ContentLength, runtimeConfig(s.Config).CaptureBodyLimit)
+	options := validationOptions(false)
+	options.IncludeResponseStatus = true
+	options.ExcludeResponseBody = !complete
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    validationReq,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		},
+		Status:  logged.Response,
+		Header:  resp.Header,
+		Options: options,
+	}
+	input.SetBodyBytes(logged.ResponseBody)
+
+	var violations []model.Violation
+	for _, err := range validationErrors(openapi3filter.ValidateResponse(context.Background(), input)) {
+		kind := model.ViolationBadResponseBody
+		var responseErr *openapi3filter.ResponseError
+		if errors.As(err, &responseErr) && responseErr.Reason == "status is not supported" {
+			kind = model.ViolationUndocumentedStatus
+			err = fmt.Errorf("status %d is not documented", logged.Response)
+		}
+		violations = append(violations, newViolation(kind, route.Method, route.Path, err.Error()))
+	}
+	return s.save(spec, logged, violations)
+}
+
+func (s *ContractService) save(spec *compiledSpec, logged *model.Request, violations []model.Violation) error {
+	// requests left out by sampling are not stored, so neither are their violations
+	if len(violations) == 0 || logged.ID == 0 {
+		return nil
+	}
+	for i := range violations {
+		violations[i].RequestID = logged.ID
+		violations[i].ProjectID = logged.ProjectID
+		violations[i].SpecID = spec.id
+	}
+	if err := s.Db.Create(&violations).Error; err != nil {
+		s.Logger.Errorf("Failed to save violations, error = %v", err)
+		return err
+	}
+	return nil
+}
+
+// current returns the newest spec of the project, nil if none was uploaded
+func (s *ContractService) current(projectID uint) (*compiledSpec, error) {
+	s.mu.RLock()
+	if compiled, ok := s.specs[projectID]; ok {
+		defer s.mu.RUnlock()
+		return compiled, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if compiled, ok := s.specs[projectID]; ok {
+		return compiled, nil
+	}
+	if s.specs == nil {
+		s.specs = map[uint]*compiledSpec{}
+	}
+
+	var spec model.ApiSpec
+	err := s.Db.Where("project_id = ?", projectID).Order("id desc").First(&spec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.specs[projectID] = nil
+		return nil, nil
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read api spec of project %d, error = %v", projectID, err)
+		return nil, err
+	}
+
+	compiled, err := s.compileStored(&spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.specs[projectID] = compiled
+	return compiled, nil
+}
+
+// upstreamPath returns the path of the project's upstream, proxied paths are relative to it
+func (s *ContractService) upstreamPath(projectID uint) (string, error) {
+	upstream := runtimeConfig(s.Config).UpstreamUrl
+	if projectID != model.DefaultProjectID {
+		var project model.Project
+		if err := s.Db.Select("upstream_url").First(&project, projectID).Error; err != nil {
+			s.Logger.Errorf("Failed to read upstream of project %d, error = %v", projectID, err)
+			return "", err
+		}
+		upstream = project.UpstreamUrl
+	}
+	// the proxy falls back to the proxy url the same way
+	target, err := url.Parse(upstream)
+	if upstream == "" || err != nil {
+		return s.UpstreamPath, nil
+	}
+	return target.Path, nil
+}
+
+// compileStored compiles a spec read from the database
+func (s *ContractService) compileStored(spec *model.ApiSpec) (*compiledSpec, error) {
+	doc, err := parseSpec([]byte(spec.Document))
+	if err != nil {
+		s.Logger.Errorf("Failed to parse stored api spec %d, error = %v", spec.ID, err)
+		return nil, err
+	}
+	compiled, err := compileSpec(doc)
+	if err != nil {
+		s.Logger.Errorf("Failed to compile stored api spec %d, error = %v", spec.ID, err)
+		return nil, err
+	}
+	compiled.id = spec.ID
+	return compiled, nil
+}
+
+// routeRequest rebuilds a logged request with the path used in the spec, for route lookups
+func routeRequest(spec *compiledSpec, upstreamPath string, logged *model.Request) (*http.Request, error) {
+	target := &url.URL{Path: specPath(spec, upstreamPath, logged.Path), RawQuery: logged.Query}
+	req, err := http.NewRequest(logged.Method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = logged.RequestHeaders.Http()
+	return req, nil
+}
+
+// specPath converts a proxied path to the path used in the spec, without the server base path
+func specPath(spec *compiledSpec, upstreamPath string, proxied string) string {
+	upstream := path.Join("/", upstreamPath, proxied)
+	for _, base := range spec.basePaths {
+		if after, ok := strings.CutPrefix(upstream, base); ok && (after == "" || after[0] == '/') {
+			if after == "" {
+				return "/"
+			}
+			return after
+		}
+	}
+	return upstream
+}
+
+// parseSpec loads and validates an OpenAPI 3 document in json or yaml
+func parseSpec(data []byte) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadApiSpec, err)
+	}
+	if doc.Paths == nil || doc.Info == nil {
+		return nil, fmt.Errorf("%w: missing info or paths", cerror.ErrBadApiSpec)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrBadApiSpec, err)
+	}
+	return doc, nil
+}
+
+// compileSpec builds a router matching request paths without the server base paths
+func compileSpec(doc *openapi3.T) (*compiledSpec, error) {
+	compiled := &compiledSpec{}
+	for _, server := range doc.Servers {
+		serverUrl, err := url.Parse(server.URL)
+		if err != nil || strings.Contains(serverUrl.Path, "{") {
+			continue
+		}
+		if base := strings.TrimSuffix(serverUrl.Path, "/"); base != "" {
+			compiled.basePaths = append(compiled.basePaths, base)
+		}
+	}
+
+	routed := *doc
+	routed.Servers = nil
+	router, err := legacy.NewRouter(&routed)
+	if err != nil {
+		return nil, err
+	}
+	compiled.router = router
+	return compiled, nil
+}
+
+func validationOptions(excludeRequestBody bool) *openapi3filter.Options {
+	options := &openapi3filter.Options{
+		ExcludeRequestBody:  excludeRequestBody,
+		MultiError:          true,
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+	}
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		if pointer := err.JSONPointer(); len(pointer) > 0 {
+			return "/" + strings.Join(pointer, "/") + ": " + err.Reason
+		}
+		return err.Reason
+	})
+	return options
+}
+
+// bodyComplete reports if the captured body is the whole body, only whole bodies are validated
+func bodyComplete(header http.Header, captured []byte, contentLength int64, limit int) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	if contentLength >= 0 {
+		return int64(len(captured)) == contentLength
+	}
+	return len(captured) < limit
+}
+
+// validationErrors flattens the errors returned by a validation with MultiError
+func validationErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		return multi
+	}
+	return []error{err}
+}
+
+func requestViolation(route *routers.Route, err error) model.Violation {
+	kind := model.ViolationBadRequest
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		switch {
+		case requestErr.Parameter != nil:
+			kind = model.ViolationBadParameter
+		case requestErr.RequestBody != nil:
+			kind = model.ViolationBadRequestBody
+		}
+	}
+	return newViolation(kind, route.Method, route.Path, err.Error())
+}
+
+func newViolation(kind model.ViolationKind, method, endpoint, message string) model.Violation {
+	if len(endpoint) > 150 {
+		endpoint = endpoint[:150]
+	}
+	return model.Violation{
+		Kind:     kind,
+		Method:   method,
+		Endpoint: endpoint,
+		Message:  message,
+	}
+}
+
+func rejectResponse(violations []model.Violation) (*http.Response, error) {
+	body := dto.ContractErrorDto{
+		Error:      "request violates the api contract",
+		Violations: make([]dto.ViolationDto, len(violations)),
+	}
+	for i := range violations {
+		body.Violations[i].FromModel(violations[i])
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	return localResponse(http.StatusBadRequest, header, data), nil
+}
@@ -0,0 +1,436 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const contractSpec = `
+openapi: 3.0.3
+info:
+  title: Users
+  version: 1.0.0
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+      responses:
+        "201":
+          description: Created
+  /users/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: verbose
+          in: query
+          schema:
+            type: boolean
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id:
+                    type: integer
+`
+
+// --- ContractService Test Suite ---
+type ContractServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	contractSrv *service.ContractService
+}
+
+func (suite *ContractServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:contract_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.ApiSpec{}, &model.Violation{}, &model.Project{}))
+
+	suite.db = db
+	suite.contractSrv = &service.ContractService{
+		Db:           db,
+		Requests:     service.NewSQLRequestStore(db),
+		Logger:       zap.NewNop().Sugar(),
+		UpstreamPath: "/v1",
+		Config:       model.RuntimeConfig{CaptureBodyLimit: 1024},
+	}
+	_, err = suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(contractSpec))
+	suite.Require().NoError(err)
+}
+
+func (suite *ContractServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestContractServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ContractServiceTestSuite))
+}
+
+// proxied stores a request the way the proxy logs it and validates it
+func (suite *ContractServiceTestSuite) proxied(method, target, body string) (*model.Request, *http.Response) {
+	return suite.proxiedTo(model.DefaultProjectID, method, target, body)
+}
+
+// proxiedTo logs and validates a request proxied to the project
+func (suite *ContractServiceTestSuite) proxiedTo(projectID uint, method, target, body string) (*model.Request, *http.Response) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	logged := &model.Request{
+		ProjectID:      projectID,
+		Source:         model.SourceProxy,
+		Method:         method,
+		Path:           req.URL.Path,
+		Query:          req.URL.RawQuery,
+		RequestHeaders: model.Headers(req.Header),
+		RequestBody:    []byte(body),
+		CreatedAt:      time.Now(),
+	}
+	suite.Require().NoError(suite.db.Create(logged).Error)
+
+	resp, err := suite.contractSrv.ValidateRequest(req, logged)
+	suite.Require().NoError(err)
+	return logged, resp
+}
+
+// respond validates a response to a logged request
+func (suite *ContractServiceTestSuite) respond(logged *model.Request, status int, body string) {
+	logged.Response = status
+	logged.ResponseBody = []byte(body)
+	resp := &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+	}
+	suite.Require().NoError(suite.contractSrv.ValidateResponse(logged, resp))
+}
+
+func (suite *ContractServiceTestSuite) violations(requestID uint) []model.Violation {
+	return suite.projectViolations(model.DefaultProjectID, requestID)
+}
+
+func (suite *ContractServiceTestSuite) projectViolations(projectID, requestID uint) []model.Violation {
+	violations, _, err := suite.contractSrv.Violations(service.ViolationsParams{ProjectID: projectID, RequestID: &requestID, Limit: 20})
+	suite.Require().NoError(err)
+	return violations
+}
+
+// --- Test Cases ---
+
+func (suite *ContractServiceTestSuite) TestUpload_RejectsInvalidSpec() {
+	_, err := suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(`{"openapi":"3.0.3","info":{"title":"x"}}`))
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadApiSpec)
+
+	_, err = suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(`not a spec`))
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadApiSpec)
+
+	specs, err := suite.contractSrv.Specs(model.DefaultProjectID)
+	suite.Require().NoError(err)
+	suite.Require().Len(specs, 1)
+	assert.Equal(suite.T(), "Users", specs[0].Title)
+	assert.Empty(suite.T(), specs[0].Document)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_ValidTraffic() {
+	// the proxy url path /v1 and the server base path /v1 cancel out
+	logged, resp := suite.proxied("GET", "/users/7?verbose=true", "")
+	assert.Nil(suite.T(), resp)
+	suite.respond(logged, 200, `{"id":7}`)
+
+	logged, _ = suite.proxied("POST", "/users", `{"name":"ana"}`)
+	suite.respond(logged, 201, "")
+
+	_, total, err := suite.contractSrv.Violations(service.ViolationsParams{Limit: 20})
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), total)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_UnknownEndpoint() {
+	logged, _ := suite.proxied("DELETE", "/orders/1", "")
+	suite.respond(logged, 204, "")
+
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationUnknownEndpoint, violations[0].Kind)
+	assert.Equal(suite.T(), "/orders/{orderId}", violations[0].Endpoint)
+
+	// requests to the same endpoint with other ids share the endpoint
+	other, _ := suite.proxied("DELETE", "/orders//2", "")
+	suite.respond(other, 204, "")
+	violations = suite.violations(other.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), "/orders/{orderId}", violations[0].Endpoint)
+}
+
+// project stores a project proxied to upstream with its own api spec
+func (suite *ContractServiceTestSuite) project(slug, upstream, spec string) model.Project {
+	project := model.Project{Name: slug, Slug: slug, UpstreamUrl: upstream}
+	suite.Require().NoError(suite.db.Create(&project).Error)
+	if spec != "" {
+		_, err := suite.contractSrv.Upload(testActor, project.ID, []byte(spec))
+		suite.Require().NoError(err)
+	}
+	return project
+}
+
+func (suite *ContractServiceTestSuite) TestViolations_ScopedToProject() {
+	project := suite.project("shop", "https://shop.example.com/v1", contractSpec)
+	logged, _ := suite.proxiedTo(project.ID, "GET", "/users/abc", "")
+
+	_, total, err := suite.contractSrv.Violations(service.ViolationsParams{Limit: 20})
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), total)
+
+	violations, total, err := suite.contractSrv.Violations(service.ViolationsParams{ProjectID: project.ID, Limit: 20})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+	assert.Equal(suite.T(), logged.ID, violations[0].RequestID)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_SpecOfTheProject() {
+	// the project's upstream has no base path, its spec has no servers
+	project := suite.project("shop", "https://shop.example.com", `
+openapi: 3.0.3
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /orders/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: OK
+`)
+	bare := suite.project("other", "https://other.example.com/v1", "")
+
+	logged, _ := suite.proxiedTo(project.ID, "GET", "/orders/abc", "")
+	violations := suite.projectViolations(project.ID, logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationBadParameter, violations[0].Kind)
+	assert.Equal(suite.T(), "/orders/{id}", violations[0].Endpoint)
+	assert.Equal(suite.T(), project.ID, violations[0].ProjectID)
+
+	// the users spec is only the default project's
+	logged, _ = suite.proxiedTo(project.ID, "GET", "/users/7", "")
+	violations = suite.projectViolations(project.ID, logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationUnknownEndpoint, violations[0].Kind)
+	logged, _ = suite.proxied("GET", "/orders/1", "")
+	violations = suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationUnknownEndpoint, violations[0].Kind)
+
+	// projects without a spec are not validated
+	logged, _ = suite.proxiedTo(bare.ID, "GET", "/users/abc", "")
+	assert.Empty(suite.T(), suite.projectViolations(bare.ID, logged.ID))
+
+	specs, err := suite.contractSrv.Specs(project.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(specs, 1)
+	assert.Equal(suite.T(), "Shop", specs[0].Title)
+	_, err = suite.contractSrv.Spec(model.DefaultProjectID, specs[0].ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_BadParameter() {
+	logged, _ := suite.proxied("GET", "/users/abc?verbose=maybe", "")
+
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 2)
+	for _, violation := range violations {
+		assert.Equal(suite.T(), model.ViolationBadParameter, violation.Kind)
+		assert.Equal(suite.T(), "/users/{id}", violation.Endpoint)
+	}
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_TailSampledRequest() {
+	req := httptest.NewRequest("GET", "/users/abc", nil)
+	logged := &model.Request{Source: model.SourceProxy, Method: "GET", Path: req.URL.Path, CreatedAt: time.Now(),
+		Sample: &model.SampleDecision{Rule: &model.SamplingRule{Mode: model.SamplingTail}}}
+	_, err := suite.contractSrv.ValidateRequest(req, logged)
+	suite.Require().NoError(err)
+
+	// the violations wait until the request is stored with its response
+	var count int64
+	suite.Require().NoError(suite.db.Model(&model.Violation{}).Count(&count).Error)
+	assert.Zero(suite.T(), count)
+	assert.Len(suite.T(), logged.Sample.Violations, 1)
+
+	suite.Require().NoError(suite.db.Create(logged).Error)
+	suite.respond(logged, 200, `{"id":7}`)
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationBadParameter, violations[0].Kind)
+	assert.Empty(suite.T(), logged.Sample.Violations)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_RejectedTailSampledRequest() {
+	suite.contractSrv.Enforce = true
+	req := httptest.NewRequest("GET", "/users/abc", nil)
+	logged := &model.Request{Source: model.SourceProxy, Method: "GET", Path: req.URL.Path, CreatedAt: time.Now(),
+		Sample: &model.SampleDecision{Rule: &model.SamplingRule{Mode: model.SamplingTail}}}
+	resp, err := suite.contractSrv.ValidateRequest(req, logged)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(resp)
+
+	// the rejection is stored without a response to validate, the violations are saved after it
+	suite.Require().NoError(suite.contractSrv.SaveViolations(logged))
+	assert.Len(suite.T(), logged.Sample.Violations, 1)
+	suite.Require().NoError(suite.db.Create(logged).Error)
+	suite.Require().NoError(suite.contractSrv.SaveViolations(logged))
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationBadParameter, violations[0].Kind)
+	assert.Empty(suite.T(), logged.Sample.Violations)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_BadRequestBody() {
+	logged, _ := suite.proxied("POST", "/users", `{"age":3}`)
+
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationBadRequestBody, violations[0].Kind)
+	assert.Contains(suite.T(), violations[0].Message, "name")
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_IncompleteBodyIsSkipped() {
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"age":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	logged := &model.Request{Source: model.SourceProxy, Method: "POST", Path: "/users", RequestBody: []byte(`{"age"`), CreatedAt: time.Now()}
+	suite.Require().NoError(suite.db.Create(logged).Error)
+
+	_, err := suite.contractSrv.ValidateRequest(req, logged)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), suite.violations(logged.ID))
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_TruncatedBodyIsSkipped() {
+	// a chunked body cut at the capture limit is only known to be incomplete from its flag
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"age":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	logged := &model.Request{Source: model.SourceProxy, Method: "POST", Path: "/users", RequestBody: []byte(`{"age":3}`), RequestTruncated: true, CreatedAt: time.Now()}
+	suite.Require().NoError(suite.db.Create(logged).Error)
+
+	_, err := suite.contractSrv.ValidateRequest(req, logged)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), suite.violations(logged.ID))
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_Response() {
+	logged, _ := suite.proxied("GET", "/users/7", "")
+	suite.respond(logged, 200, `{"id":"seven"}`)
+
+	violations := suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationBadResponseBody, violations[0].Kind)
+
+	logged, _ = suite.proxied("GET", "/users/8", "")
+	suite.respond(logged, 500, `{"error":"boom"}`)
+
+	violations = suite.violations(logged.ID)
+	suite.Require().Len(violations, 1)
+	assert.Equal(suite.T(), model.ViolationUndocumentedStatus, violations[0].Kind)
+	assert.Equal(suite.T(), "status 500 is not documented", violations[0].Message)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_Enforce() {
+	suite.contractSrv.Enforce = true
+
+	_, resp := suite.proxied("GET", "/users/7", "")
+	assert.Nil(suite.T(), resp)
+
+	_, resp = suite.proxied("POST", "/users", `{}`)
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	data, err := io.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	var body dto.ContractErrorDto
+	suite.Require().NoError(json.Unmarshal(data, &body))
+	suite.Require().Len(body.Violations, 1)
+	assert.Equal(suite.T(), string(model.ViolationBadRequestBody), body.Violations[0].Kind)
+}
+
+func (suite *ContractServiceTestSuite) TestValidate_LoadsStoredSpec() {
+	// a fresh service reads the newest spec from the database
+	fresh := &service.ContractService{Db: suite.db, Requests: service.NewSQLRequestStore(suite.db), Logger: zap.NewNop().Sugar(), UpstreamPath: "/v1", Config: model.RuntimeConfig{CaptureBodyLimit: 1024}}
+	suite.contractSrv = fresh
+
+	logged, _ := suite.proxied("GET", "/users/abc", "")
+	assert.Len(suite.T(), suite.violations(logged.ID), 1)
+}
+
+func (suite *ContractServiceTestSuite) TestStatistics_ViolationsPerEndpoint() {
+	suite.proxied("GET", "/users/abc?verbose=maybe", "")
+	suite.proxied("GET", "/users/def", "")
+	suite.proxied("POST", "/users", `{}`)
+	suite.proxied("GET", "/users/1", "")
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	stats, err := service.NewRequestCrudService().GetStatistics(model.DefaultProjectID, nil, nil)
+	suite.Require().NoError(err)
+
+	suite.Require().Len(stats.ViolationsPerEndpoint, 2)
+	users := stats.ViolationsPerEndpoint[0]
+	assert.Equal(suite.T(), "GET", users.Method)
+	assert.Equal(suite.T(), "/users/{id}", users.Endpoint)
+	assert.Equal(suite.T(), int64(2), users.RequestCount)
+	assert.Equal(suite.T(), int64(3), users.ViolationCount)
+	assert.Equal(suite.T(), int64(3), users.Kinds[model.ViolationBadParameter])
+
+	create := stats.ViolationsPerEndpoint[1]
+	assert.Equal(suite.T(), "/users", create.Endpoint)
+	assert.Equal(suite.T(), int64(1), create.Kinds[model.ViolationBadRequestBody])
+}
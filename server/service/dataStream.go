@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 	"treblle/dto"
+	"treblle/model"
 	"treblle/util/ws"
 
 	"go.uber.org/zap"
@@ -22,17 +23,22 @@ const _ACTION_REFRESH chartDataAction = "refresh"
 const _ACTION_UPDATE_INTERVAL chartDataAction = "update_interval"
 
 type Lobby struct {
-	Hub                ws.Hub
+	Hub       ws.Hub
+	ProjectID uint // ProjectID is the only project the lobby streams statistics of
+	// View narrows the statistics to the filters of a saved view, the stream covers the time since the last update instead of its time range
+	View               *model.View
 	LastUpdate         *time.Time
 	requestCrudService IRequestCrudService
 	task               *PeriodicTask
 }
 
-// NewLobby creates a new lobby and runs its event loop
-func NewLobby() *Lobby {
+// NewLobby creates a new lobby streaming the statistics of a project, or of a view of it if view isn't nil, and runs its event loop
+func NewLobby(projectID uint, view *model.View) *Lobby {
 	now := time.Now()
 	var lobby = Lobby{
 		Hub:                ws.NewHub(),
+		ProjectID:          projectID,
+		View:               view,
 		requestCrudService: NewRequestCrudService(),
 		LastUpdate:         &now,
 	}
@@ -41,7 +47,7 @@ func NewLobby() *Lobby {
 	actionFunc := func() {
 		var state dto.RequestStatistics
 		now := time.Now()
-		data, err := lobby.requestCrudService.GetStatistics(lobby.LastUpdate, &now)
+		data, err := lobby.statistics(lobby.LastUpdate, &now)
 		if err != nil {
 			zap.S().Errorf("Error retriving statistics, error = %v", err)
 			return
@@ -63,6 +69,16 @@ func NewLobby() *Lobby {
 	return &lobby
 }
 
+// statistics returns the statistics of the lobby between startTime and endTime
+func (lobby *Lobby) statistics(startTime, endTime *time.Time) (*model.AllRequestStatistics, error) {
+	if lobby.View == nil {
+		return lobby.requestCrudService.GetStatistics(lobby.ProjectID, startTime, endTime)
+	}
+	params := ViewParams(lobby.View, *endTime)
+	params.StartTime, params.EndTime = startTime, endTime
+	return lobby.requestCrudService.GetFilteredStatistics(params)
+}
+
 // HandleMessage implements ws.MessageProcessor.
 func (lobby *Lobby) HandleMsg(data []byte) {
 	if data == nil {
@@ -80,7 +96,7 @@ func (lobby *Lobby) HandleMsg(data []byte) {
 	switch msg.Action {
 	case _ACTION_REFRESH:
 		now := time.Now()
-		data, err := lobby.requestCrudService.GetStatistics(lobby.LastUpdate, &now)
+		data, err := lobby.statistics(lobby.LastUpdate, &now)
 		if err != nil {
 			zap.S().Errorf("Error retriving statistics, error = %v", err)
 			return
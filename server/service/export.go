@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/util/cerror"
+)
+
+type ExportFormat string
+
+const (
+	ExportCsv    ExportFormat = "csv"
+	ExportNdjson ExportFormat = "ndjson"
+	ExportHar    ExportFormat = "har"
+)
+
+// RequestExporter writes requests to an output stream one by one
+type RequestExporter interface {
+	// Begin writes everything that comes before the first request
+	Begin() error
+	// Write writes a single request
+	Write(request *model.Request) error
+	// End writes everything that comes after the last request
+	End() error
+}
+
+// ContentType returns the mime type of the export format
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportCsv:
+		return "text/csv"
+	case ExportHar:
+		return "application/json"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// NewRequestExporter creates an exporter for the format writing to w.
+// baseUrl is used to build absolute urls where the format requires them.
+func NewRequestExporter(format ExportFormat, w io.Writer, baseUrl string) (RequestExporter, error) {
+	switch format {
+	case ExportCsv:
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case ExportNdjson:
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+	case ExportHar:
+		return &harExporter{w: w, baseUrl: baseUrl}, nil
+	default:
+		return nil, cerror.ErrUnknownExportFormat
+	}
+}
+
+// --- CSV ---
+
+var csvHeader = []string{
+	"id", "method", "path", "query", "response", "created_at", "response_time", "latency_ms",
+	"request_headers", "request_body", "request_body_encoding",
+	"response_headers", "response_body", "response_body_encoding",
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) Begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvExporter) Write(request *model.Request) error {
+	var rec dto.RequestExportDto
+	if err := rec.FromModel(*request); err != nil {
+		return err
+	}
+	reqHeaders, err := json.Marshal(rec.RequestHeaders)
+	if err != nil {
+		return err
+	}
+	respHeaders, err := json.Marshal(rec.ResponseHeaders)
+	if err != nil {
+		return err
+	}
+
+	err = e.w.Write([]string{
+		strconv.FormatUint(uint64(rec.ID), 10),
+		rec.Method,
+		rec.Path,
+		rec.Query,
+		strconv.Itoa(rec.Response),
+		rec.CreatedAt.Format(time.RFC3339Nano),
+		rec.ResponseTime.Format(time.RFC3339Nano),
+		strconv.FormatInt(rec.Latency, 10),
+		string(reqHeaders),
+		rec.RequestBody,
+		rec.RequestBodyEncoding,
+		string(respHeaders),
+		rec.ResponseBody,
+		rec.ResponseBodyEncoding,
+	})
+	if err != nil {
+		return err
+	}
+	// csv.Writer buffers internally, push rows out so the response is streamed
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// --- NDJSON ---
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) Begin() error {
+	return nil
+}
+
+func (e *ndjsonExporter) Write(request *model.Request) error {
+	var rec dto.RequestExportDto
+	if err := rec.FromModel(*request); err != nil {
+		return err
+	}
+	// Encode terminates every value with a new line
+	return e.enc.Encode(rec)
+}
+
+func (e *ndjsonExporter) End() error {
+	return nil
+}
+
+// --- HAR ---
+
+// harExporter writes the HAR envelope by hand so entries can be streamed
+// instead of building the whole dto.HarDto in memory
+type harExporter struct {
+	w       io.Writer
+	baseUrl string
+	count   int
+}
+
+func (e *harExporter) Begin() error {
+	creator, err := json.Marshal(dto.NewHarCreator(app.Version))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, `{"log":{"version":"`+dto.HarVersion+`","creator":`+string(creator)+`,"entries":[`)
+	return err
+}
+
+func (e *harExporter) Write(request *model.Request) error {
+	var entry dto.HarEntry
+	if err := entry.FromModel(*request, e.baseUrl); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *harExporter) End() error {
+	_, err := io.WriteString(e.w, "]}}")
+	return err
+}
@@ -0,0 +1,598 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ImportFormat string
+
+const (
+	ImportHar    ImportFormat = "har"
+	ImportNdjson ImportFormat = "ndjson"
+)
+
+const (
+	_IMPORT_FOLDER       = "./tmp/imports"
+	_IMPORT_BATCH_SIZE   = 100
+	_IMPORT_POLL_PERIOD  = 30 * time.Second
+	_IMPORT_MAX_PATH_LEN = 150             // same as model.Request.Path column
+	_IMPORT_STALE_AFTER  = 5 * time.Minute // a running job without progress for this long belongs to a dead process
+)
+
+// ImportFormatFromFileName guesses the import format from a file extension
+func ImportFormatFromFileName(name string) (ImportFormat, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".har":
+		return ImportHar, nil
+	case ".ndjson", ".jsonl":
+		return ImportNdjson, nil
+	default:
+		return "", cerror.ErrUnknownImportFormat
+	}
+}
+
+// ImportProgressFunc is called after every processed batch of an import job
+type ImportProgressFunc func(job model.ImportJob)
+
+type IImportService interface {
+	// Create stores the file and creates a pending job that the worker will pick up,
+	// the requests are imported into the given project
+	Create(actor string, projectID uint, source string, format ImportFormat, fileName string, file io.Reader) (*model.ImportJob, error)
+	// CreateFromPath creates a pending job for a file already on disk,
+	// an unfinished job for the same file, project and source is returned instead if it exists
+	CreateFromPath(actor string, projectID uint, source string, format ImportFormat, filePath string) (*model.ImportJob, error)
+	// Get returns gorm.ErrRecordNotFound for jobs of other projects
+	Get(projectID, id uint) (*model.ImportJob, error)
+	List(projectID uint) ([]model.ImportJob, error)
+	// Run processes the job until it is finished or ctx is done
+	Run(ctx context.Context, job *model.ImportJob, progress ImportProgressFunc) error
+	// Worker processes unfinished jobs in the background
+	Worker() app.Worker
+}
+
+type ImportService struct {
+	Db       *gorm.DB
+	Requests RequestStore // Requests stores the imported requests in the configured backend
+	Logger   *zap.SugaredLogger
+	AuditSrv IAuditService
+	wake     chan struct{}
+}
+
+func NewImportService() IImportService {
+	var service *ImportService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &ImportService{
+			Db:       db,
+			Requests: requests,
+			Logger:   logger,
+			AuditSrv: auditSrv,
+			wake:     make(chan struct{}, 1),
+		}
+	})
+
+	return service
+}
+
+// NewImportWorker creates the background worker running import jobs
+func NewImportWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(service IImportService) {
+		worker = service.Worker()
+	})
+	return worker
+}
+
+func (s *ImportService) Create(actor string, projectID uint, source string, format ImportFormat, fileName string, file io.Reader) (*model.ImportJob, error) {
+	if err := os.MkdirAll(_IMPORT_FOLDER, 0o755); err != nil {
+		s.Logger.Errorf("Failed to create import folder, error = %v", err)
+		return nil, err
+	}
+
+	filePath := filepath.Join(_IMPORT_FOLDER, uuid.NewString()+"."+string(format))
+	out, err := os.Create(filePath)
+	if err != nil {
+		s.Logger.Errorf("Failed to create import file, error = %v", err)
+		return nil, err
+	}
+	size, err := io.Copy(out, file)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to store import file, error = %v", err)
+		os.Remove(filePath)
+		return nil, err
+	}
+
+	job := model.ImportJob{
+		ProjectID: projectID,
+		Source:    source,
+		Format:    string(format),
+		FileName:  fileName,
+		FilePath:  filePath,
+		FileSize:  size,
+		Status:    model.ImportPending,
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditImportCreated, model.AuditTarget("import", job.ID), nil, job)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create import job, error = %v", err)
+		os.Remove(filePath)
+		return nil, err
+	}
+
+	// wake up the worker, if it is already awake the job is picked up in the same run
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return &job, nil
+}
+
+func (s *ImportService) CreateFromPath(actor string, projectID uint, source string, format ImportFormat, filePath string) (*model.ImportJob, error) {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var job model.ImportJob
+	rez := s.Db.
+		Where("file_path = ? AND project_id = ? AND source = ? AND status IN ?", filePath, projectID, source, []model.ImportStatus{model.ImportPending, model.ImportRunning}).
+		Order("id desc").
+		First(&job)
+	if rez.Error == nil {
+		s.Logger.Infof("Resuming import job %d", job.ID)
+		return &job, nil
+	}
+	if !errors.Is(rez.Error, gorm.ErrRecordNotFound) {
+		s.Logger.Errorf("Failed to read import jobs, error = %v", rez.Error)
+		return nil, rez.Error
+	}
+
+	job = model.ImportJob{
+		ProjectID: projectID,
+		Source:    source,
+		Format:    string(format),
+		FileName:  filepath.Base(filePath),
+		FilePath:  filePath,
+		FileSize:  info.Size(),
+		Status:    model.ImportPending,
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditImportCreated, model.AuditTarget("import", job.ID), nil, job)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create import job, error = %v", err)
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *ImportService) Get(projectID, id uint) (*model.ImportJob, error) {
+	var job model.ImportJob
+	if err := s.Db.Where("project_id = ?", projectID).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *ImportService) List(projectID uint) ([]model.ImportJob, error) {
+	var jobs []model.ImportJob
+	if err := s.Db.Where("project_id = ?", projectID).Order("id desc").Find(&jobs).Error; err != nil {
+		s.Logger.Errorf("Failed to list import jobs, error = %v", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *ImportService) Worker() app.Worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(_IMPORT_POLL_PERIOD)
+		defer ticker.Stop()
+
+		for {
+			s.runUnfinished(ctx)
+
+			select {
+			case <-ctx.Done():
+				s.Logger.Infof("Stopped import worker")
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// runUnfinished runs all pending and abandoned jobs in creation order,
+// jobs claimed by another process are skipped
+func (s *ImportService) runUnfinished(ctx context.Context) {
+	var jobs []model.ImportJob
+	err := s.Db.
+		Where("status IN ?", []model.ImportStatus{model.ImportPending, model.ImportRunning}).
+		Order("id asc").
+		Find(&jobs).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to read unfinished import jobs, error = %v", err)
+		return
+	}
+
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		err := s.Run(ctx, &jobs[i], nil)
+		if errors.Is(err, cerror.ErrImportJobClaimed) {
+			s.Logger.Debugf("Import job %d is running in another process", jobs[i].ID)
+			continue
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.Logger.Errorf("Import job %d failed, error = %v", jobs[i].ID, err)
+		}
+	}
+}
+
+func (s *ImportService) Run(ctx context.Context, job *model.ImportJob, progress ImportProgressFunc) error {
+	if job.IsFinished() {
+		return nil
+	}
+
+	if err := s.claim(job); err != nil {
+		return err
+	}
+
+	file, err := os.Open(job.FilePath)
+	if err != nil {
+		return s.fail(job, err)
+	}
+	defer file.Close()
+
+	// continue after the entries handled before the job was interrupted
+	reader, err := newEntryReader(ImportFormat(job.Format), file, job.Offset)
+	if err != nil {
+		return s.fail(job, err)
+	}
+
+	batch := make([]model.Request, 0, _IMPORT_BATCH_SIZE)
+	var processed, failed int64
+	for {
+		if ctx.Err() != nil {
+			// release the job so it is resumed by the next run
+			job.Status = model.ImportPending
+			if err := s.Db.Save(job).Error; err != nil {
+				s.Logger.Errorf("Failed to release import job %d, error = %v", job.ID, err)
+			}
+			return ctx.Err()
+		}
+
+		request, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		processed++
+		switch {
+		case isEntryError(err):
+			s.Logger.Warnf("Import job %d, skipping bad entry %d, error = %v", job.ID, job.Processed+processed, err)
+			failed++
+		case err != nil:
+			return s.fail(job, err)
+		default:
+			if len(request.Path) > _IMPORT_MAX_PATH_LEN {
+				s.Logger.Warnf("Import job %d, skipping entry %d with too long path", job.ID, job.Processed+processed)
+				failed++
+				break
+			}
+			request.ProjectID = job.ProjectID
+			request.Source = job.Source
+			request.SetFingerprint()
+			batch = append(batch, *request)
+		}
+
+		if processed >= _IMPORT_BATCH_SIZE {
+			if err := s.flush(job, batch, processed, failed, reader.Offset()); err != nil {
+				return s.fail(job, err)
+			}
+			if progress != nil {
+				progress(*job)
+			}
+			batch, processed, failed = batch[:0], 0, 0
+		}
+	}
+
+	if err := s.flush(job, batch, processed, failed, reader.Offset()); err != nil {
+		return s.fail(job, err)
+	}
+
+	job.Status = model.ImportCompleted
+	if err := s.Db.Save(job).Error; err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(*job)
+	}
+	s.Logger.Infof("Finished import job %d, imported %d, skipped %d, failed %d", job.ID, job.Imported, job.Skipped, job.Failed)
+
+	// uploaded files are owned by the job
+	if strings.HasPrefix(job.FilePath, filepath.Clean(_IMPORT_FOLDER)) {
+		os.Remove(job.FilePath)
+	}
+	return nil
+}
+
+// claim marks the job running for this process and reloads its progress.
+// Only pending jobs and running jobs left by a dead process can be claimed,
+// so the server worker and the cli never process the same job at once.
+func (s *ImportService) claim(job *model.ImportJob) error {
+	now := time.Now()
+	rez := s.Db.Model(&model.ImportJob{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))",
+			job.ID, model.ImportPending, model.ImportRunning, now.Add(-_IMPORT_STALE_AFTER)).
+		Updates(map[string]any{"status": model.ImportRunning, "updated_at": now})
+	if rez.Error != nil {
+		s.Logger.Errorf("Failed to claim import job %d, error = %v", job.ID, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return cerror.ErrImportJobClaimed
+	}
+	return s.Db.First(job, job.ID).Error
+}
+
+// flush stores the batch in the request store and then the job progress. The store may not be the
+// database of the job, a batch stored again after a crash is skipped by the fingerprints of its requests
+func (s *ImportService) flush(job *model.ImportJob, batch []model.Request, processed, failed, offset int64) error {
+	var imported int64
+	for i := range batch {
+		err := s.Requests.Create(&batch[i])
+		if errors.Is(err, cerror.ErrDuplicateRequest) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		imported++
+	}
+
+	job.Processed += processed
+	job.Offset = offset
+	job.Imported += imported
+	job.Skipped += int64(len(batch)) - imported
+	job.Failed += failed
+	return s.Db.Save(job).Error
+}
+
+func (s *ImportService) fail(job *model.ImportJob, cause error) error {
+	job.Status = model.ImportFailed
+	job.Error = cause.Error()
+	if err := s.Db.Save(job).Error; err != nil {
+		s.Logger.Errorf("Failed to save import job %d, error = %v", job.ID, err)
+	}
+	return cause
+}
+
+// --- Readers ---
+
+// entryError is returned by entry readers when a single entry can't be
+// converted, the import continues with the next entry
+type entryError struct {
+	err error
+}
+
+func (e entryError) Error() string {
+	return fmt.Sprintf("bad entry: %v", e.err)
+}
+
+func isEntryError(err error) bool {
+	var target entryError
+	return errors.As(err, &target)
+}
+
+type entryReader interface {
+	// Next returns the next request, io.EOF when there are no more entries
+	Next() (*model.Request, error)
+	// Offset returns the number of bytes consumed so far
+	Offset() int64
+}
+
+// newEntryReader creates a reader starting at offset, which is 0 or the
+// offset of a previous reader for the same file
+func newEntryReader(format ImportFormat, file io.ReadSeeker, offset int64) (entryReader, error) {
+	if format != ImportHar && format != ImportNdjson {
+		return nil, cerror.ErrUnknownImportFormat
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if format == ImportHar {
+		return newHarReader(file, offset)
+	}
+	return &ndjsonReader{r: bufio.NewReader(file), offset: offset}, nil
+}
+
+// ndjsonReader reads one line at a time, so a malformed line fails only its own entry
+type ndjsonReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+func (r *ndjsonReader) Next() (*model.Request, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		r.offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var rec dto.RequestExportDto
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, entryError{err}
+		}
+		request, err := rec.ToModel()
+		if err != nil {
+			return nil, entryError{err}
+		}
+		return request, nil
+	}
+}
+
+func (r *ndjsonReader) Offset() int64 {
+	return r.offset
+}
+
+// harReader walks the HAR document token by token and decodes one entry at a
+// time so big files are never loaded into memory
+type harReader struct {
+	dec     *json.Decoder
+	base    int64 // base is the file offset of the first byte the decoder reads
+	started bool
+	done    bool
+}
+
+// newHarReader creates a reader for r positioned at offset, a resumed reader
+// starts between two entries and reads the rest of them as a json array
+func newHarReader(r io.Reader, offset int64) (*harReader, error) {
+	if offset == 0 {
+		return &harReader{dec: json.NewDecoder(r)}, nil
+	}
+
+	buffered := bufio.NewReader(r)
+	skipped := int64(0)
+	for {
+		b, err := buffered.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			skipped++
+			continue
+		}
+		if b == ',' {
+			skipped++
+		} else if err := buffered.UnreadByte(); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	// the opening bracket is not part of the file
+	reader := &harReader{
+		dec:     json.NewDecoder(io.MultiReader(strings.NewReader("["), buffered)),
+		base:    offset + skipped - 1,
+		started: true,
+	}
+	if err := reader.expectDelim('['); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *harReader) Next() (*model.Request, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	if !r.started {
+		if err := r.seekEntries(); err != nil {
+			return nil, err
+		}
+		r.started = true
+	}
+	if !r.dec.More() {
+		r.done = true
+		return nil, io.EOF
+	}
+
+	var entry dto.HarEntry
+	if err := r.dec.Decode(&entry); err != nil {
+		return nil, err
+	}
+	request, err := entry.ToModel()
+	if err != nil {
+		return nil, entryError{err}
+	}
+	return request, nil
+}
+
+func (r *harReader) Offset() int64 {
+	return r.base + r.dec.InputOffset()
+}
+
+// seekEntries moves the decoder to the first element of log.entries
+func (r *harReader) seekEntries() error {
+	for _, key := range []string{"log", "entries"} {
+		if err := r.expectDelim('{'); err != nil {
+			return err
+		}
+		if err := r.seekKey(key); err != nil {
+			return err
+		}
+	}
+	return r.expectDelim('[')
+}
+
+func (r *harReader) seekKey(key string) error {
+	for r.dec.More() {
+		token, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		// skip the value of other keys
+		var skip json.RawMessage
+		if err := r.dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: missing %s", cerror.ErrBadHarFile, key)
+}
+
+func (r *harReader) expectDelim(delim json.Delim) error {
+	token, err := r.dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("%w: expected %v got %v", cerror.ErrBadHarFile, delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testHar = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "browser", "version": "1"},
+    "pages": [{"id": "page_1"}],
+    "entries": [
+      {
+        "startedDateTime": "2025-01-02T10:00:00Z",
+        "time": 120.5,
+        "request": {
+          "method": "POST",
+          "url": "https://api.example.com/v1/items?debug=true",
+          "headers": [{"name": ":authority", "value": "api.example.com"}, {"name": "content-type", "value": "application/json"}],
+          "postData": {"mimeType": "application/json", "text": "{\"name\":\"x\"}"}
+        },
+        "response": {
+          "status": 201,
+          "headers": [{"name": "content-type", "value": "application/json"}],
+          "content": {"size": 8, "mimeType": "application/json", "text": "eyJpZCI6MX0=", "encoding": "base64"}
+        }
+      },
+      {
+        "startedDateTime": "2025-01-02T10:00:01Z",
+        "time": 30,
+        "request": {"method": "GET", "url": "https://api.example.com/v1/items", "headers": []},
+        "response": {"status": 200, "headers": [], "content": {"size": 0, "mimeType": "application/json"}}
+      }
+    ]
+  }
+}`
+
+// --- ImportService Test Suite ---
+type ImportServiceTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	importSrv *service.ImportService
+	dir       string
+}
+
+func (suite *ImportServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:import_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.ImportJob{}))
+
+	suite.db = db
+	suite.importSrv = &service.ImportService{Db: db, Requests: service.NewSQLRequestStore(db), Logger: zap.NewNop().Sugar()}
+	suite.dir = suite.T().TempDir()
+}
+
+func (suite *ImportServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestImportServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ImportServiceTestSuite))
+}
+
+func (suite *ImportServiceTestSuite) writeFile(name, content string) string {
+	path := filepath.Join(suite.dir, name)
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// --- Test Cases ---
+
+func (suite *ImportServiceTestSuite) TestRun_Har() {
+	path := suite.writeFile("traffic.har", testHar)
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "browser", service.ImportHar, path)
+	suite.Require().NoError(err)
+
+	err = suite.importSrv.Run(context.Background(), job, nil)
+	suite.Require().NoError(err)
+
+	assert.Equal(suite.T(), model.ImportCompleted, job.Status)
+	assert.Equal(suite.T(), int64(2), job.Processed)
+	assert.Equal(suite.T(), int64(2), job.Imported)
+	assert.Positive(suite.T(), job.Offset)
+
+	var requests []model.Request
+	suite.Require().NoError(suite.db.Order("created_at asc").Find(&requests).Error)
+	suite.Require().Len(requests, 2)
+	assert.Equal(suite.T(), "browser", requests[0].Source)
+	assert.Equal(suite.T(), "POST", requests[0].Method)
+	assert.Equal(suite.T(), "/v1/items", requests[0].Path)
+	assert.Equal(suite.T(), "debug=true", requests[0].Query)
+	assert.Equal(suite.T(), 201, requests[0].Response)
+	assert.Equal(suite.T(), int64(120), requests[0].Latency.Milliseconds())
+	assert.Equal(suite.T(), `{"name":"x"}`, string(requests[0].RequestBody))
+	assert.Equal(suite.T(), `{"id":1}`, string(requests[0].ResponseBody))
+	assert.Equal(suite.T(), []string{"application/json"}, requests[0].RequestHeaders["Content-Type"])
+	assert.NotContains(suite.T(), requests[0].RequestHeaders, ":authority")
+	assert.NotNil(suite.T(), requests[0].Fingerprint)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_Ndjson_Deduplicates() {
+	line := `{"method":"GET","path":"/a","response":200,"createdAt":"2025-01-02T10:00:00Z","latency":5}`
+	other := `{"method":"GET","path":"/b","response":404,"createdAt":"2025-01-02T10:00:00Z","latency":5}`
+	path := suite.writeFile("traffic.ndjson", line+"\n"+other+"\n"+line+"\n")
+
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+
+	assert.Equal(suite.T(), int64(3), job.Processed)
+	assert.Equal(suite.T(), int64(2), job.Imported)
+	assert.Equal(suite.T(), int64(1), job.Skipped)
+
+	// importing the same file again only produces duplicates
+	job, err = suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+	assert.Equal(suite.T(), int64(0), job.Imported)
+	assert.Equal(suite.T(), int64(3), job.Skipped)
+
+	var count int64
+	suite.db.Model(&model.Request{}).Where("source = ?", "gateway").Count(&count)
+	assert.Equal(suite.T(), int64(2), count)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_ResumesInterruptedJob() {
+	var lines []string
+	for i := range 250 {
+		lines = append(lines, fmt.Sprintf(`{"method":"GET","path":"/items/%d","response":200,"createdAt":"2025-01-02T10:00:00Z"}`, i))
+	}
+	path := suite.writeFile("big.ndjson", strings.Join(lines, "\n"))
+
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+
+	// cancel after the first batch is stored
+	ctx, cancel := context.WithCancel(context.Background())
+	err = suite.importSrv.Run(ctx, job, func(job model.ImportJob) { cancel() })
+	assert.ErrorIs(suite.T(), err, context.Canceled)
+
+	stored, err := suite.importSrv.Get(model.DefaultProjectID, job.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.ImportPending, stored.Status)
+	assert.Equal(suite.T(), int64(100), stored.Processed)
+
+	// the cli resumes the unfinished job for the same file
+	resumed, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), job.ID, resumed.ID)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), resumed, nil))
+
+	assert.Equal(suite.T(), model.ImportCompleted, resumed.Status)
+	assert.Equal(suite.T(), int64(250), resumed.Processed)
+	assert.Equal(suite.T(), int64(250), resumed.Imported)
+	assert.Equal(suite.T(), int64(0), resumed.Skipped)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_ResumesHarAtOffset() {
+	var entries []string
+	for i := range 150 {
+		entries = append(entries, fmt.Sprintf(`{"startedDateTime": "2025-01-02T10:00:00Z", "time": 1,
+		"request": {"method": "GET", "url": "https://api.example.com/items/%d", "headers": []},
+		"response": {"status": 200, "headers": [], "content": {"size": 0}}}`, i))
+	}
+	path := suite.writeFile("big.har", `{"log": {"version": "1.2", "entries": [`+strings.Join(entries, ",\n")+`]}}`)
+
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "browser", service.ImportHar, path)
+	suite.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = suite.importSrv.Run(ctx, job, func(job model.ImportJob) { cancel() })
+	assert.ErrorIs(suite.T(), err, context.Canceled)
+
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+	assert.Equal(suite.T(), model.ImportCompleted, job.Status)
+	assert.Equal(suite.T(), int64(150), job.Processed)
+	assert.Equal(suite.T(), int64(150), job.Imported)
+	assert.Equal(suite.T(), int64(0), job.Failed)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_ScopedToProject() {
+	line := `{"method":"GET","path":"/a","response":200,"createdAt":"2025-01-02T10:00:00Z","latency":5}`
+	path := suite.writeFile("traffic.ndjson", line)
+
+	job, err := suite.importSrv.CreateFromPath(testActor, 7, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+	assert.Equal(suite.T(), int64(1), job.Imported)
+
+	var request model.Request
+	suite.Require().NoError(suite.db.First(&request).Error)
+	assert.Equal(suite.T(), uint(7), request.ProjectID)
+
+	// the job is only shown to its project
+	_, err = suite.importSrv.Get(model.DefaultProjectID, job.ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	jobs, err := suite.importSrv.List(model.DefaultProjectID)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), jobs)
+	jobs, err = suite.importSrv.List(7)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), jobs, 1)
+
+	// the same file imported into another project is not a duplicate
+	job, err = suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+	assert.Equal(suite.T(), int64(1), job.Imported)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_SkipsMalformedLines() {
+	line := `{"method":"GET","path":"/a","response":200,"createdAt":"2025-01-02T10:00:00Z"}`
+	other := `{"method":"GET","path":"/b","response":200,"createdAt":"2025-01-02T10:00:00Z"}`
+	path := suite.writeFile("broken.ndjson", line+"\n{\"method\": \"GET\",\n\n"+other)
+
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+
+	assert.Equal(suite.T(), model.ImportCompleted, job.Status)
+	assert.Equal(suite.T(), int64(3), job.Processed)
+	assert.Equal(suite.T(), int64(2), job.Imported)
+	assert.Equal(suite.T(), int64(1), job.Failed)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_JobClaimedElsewhere() {
+	path := suite.writeFile("traffic.ndjson", `{"method":"GET","path":"/a","response":200,"createdAt":"2025-01-02T10:00:00Z"}`)
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "gateway", service.ImportNdjson, path)
+	suite.Require().NoError(err)
+
+	// another process claimed the job in the meantime
+	suite.Require().NoError(suite.db.Model(&model.ImportJob{}).Where("id = ?", job.ID).Update("status", model.ImportRunning).Error)
+
+	err = suite.importSrv.Run(context.Background(), job, nil)
+	assert.ErrorIs(suite.T(), err, cerror.ErrImportJobClaimed)
+	var count int64
+	suite.db.Model(&model.Request{}).Count(&count)
+	assert.Zero(suite.T(), count)
+
+	// a job abandoned by a dead process can be claimed again
+	suite.Require().NoError(suite.db.Model(&model.ImportJob{}).Where("id = ?", job.ID).
+		UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	suite.Require().NoError(suite.importSrv.Run(context.Background(), job, nil))
+	assert.Equal(suite.T(), model.ImportCompleted, job.Status)
+	assert.Equal(suite.T(), int64(1), job.Imported)
+}
+
+func (suite *ImportServiceTestSuite) TestRun_BadFileFailsJob() {
+	path := suite.writeFile("bad.har", `{"log": {"version": "1.2"}}`)
+	job, err := suite.importSrv.CreateFromPath(testActor, model.DefaultProjectID, "browser", service.ImportHar, path)
+	suite.Require().NoError(err)
+
+	err = suite.importSrv.Run(context.Background(), job, nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), model.ImportFailed, job.Status)
+	assert.NotEmpty(suite.T(), job.Error)
+	assert.WithinDuration(suite.T(), time.Now(), job.UpdatedAt, time.Minute)
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// _MOCK_CANDIDATE_LIMIT is the max number of recorded requests compared to an incoming one
+	_MOCK_CANDIDATE_LIMIT = 200
+	// MockHeader tells the client how a mocked response was produced, one of hit, miss, synthetic
+	MockHeader = "X-Treblle-Mock"
+)
+
+type IMockService interface {
+	app.Mocker
+	// ListRoutes returns the mock routes of a project
+	ListRoutes(projectID uint) ([]model.MockRoute, error)
+	GetRoute(projectID, id uint) (*model.MockRoute, error)
+	CreateRoute(actor string, route *model.MockRoute) error
+	// UpdateRoute replaces a route of the project of route, routes of other projects are not found
+	UpdateRoute(actor string, route *model.MockRoute) error
+	DeleteRoute(actor string, projectID, id uint) error
+}
+
+// MockService answers proxied requests from recorded traffic when mock mode is enabled
+// globally or for the requested route. Routes and recorded traffic are those of the project of the request
+type MockService struct {
+	Db       *gorm.DB
+	Requests RequestStore // Requests holds the recorded traffic responses are mocked from
+	Logger   *zap.SugaredLogger
+	Enabled  bool               // Enabled is the mock mode of routes without a mock route
+	Strategy model.MockStrategy // Strategy is used by routes without their own strategy
+	Fallback model.MockFallback // Fallback is used by routes without their own fallback
+	Config   app.RuntimeConfig  // Config holds the body capture limit, body matching needs captured request bodies
+	AuditSrv IAuditService
+
+	mu     sync.RWMutex
+	loaded bool
+	routes []model.MockRoute
+}
+
+func NewMockService() IMockService {
+	var service *MockService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, logger *zap.SugaredLogger, config app.RuntimeConfig, auditSrv IAuditService) {
+		service = &MockService{
+			Db:       db,
+			Requests: requests,
+			Logger:   logger,
+			Enabled:  app.MockMode,
+			Strategy: model.MockMatchQuery,
+			Fallback: model.MockFallbackNotFound,
+			Config:   config,
+			AuditSrv: auditSrv,
+		}
+
+		if app.MockStrategy != "" {
+			service.Strategy = model.MockStrategy(app.MockStrategy)
+		}
+		if app.MockFallback != "" {
+			service.Fallback = model.MockFallback(app.MockFallback)
+		}
+		if !service.Strategy.IsValid() {
+			logger.Fatalf("%v, got %s", cerror.ErrUnknownMockStrategy, service.Strategy)
+		}
+		if !service.Fallback.IsValid() {
+			logger.Fatalf("%v, got %s", cerror.ErrUnknownMockFallback, service.Fallback)
+		}
+	})
+
+	return service
+}
+
+// NewMocker exposes the mock service to the proxy
+func NewMocker() app.Mocker {
+	var mocker app.Mocker
+	app.Invoke(func(service IMockService) {
+		mocker = service
+	})
+	return mocker
+}
+
+// Mock returns the recorded response matching req, the fallback response if nothing matches or can't be read,
+// or nil if the request should go to the upstream. The error is only set when the mock routes can't be read
+func (s *MockService) Mock(req *model.Request) (*http.Response, error) {
+	reqPath := normalizePath(req.Path)
+	route, err := s.route(req.ProjectID, req.Method, reqPath)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, strategy, fallback := s.Enabled, s.Strategy, s.Fallback
+	if route != nil {
+		enabled = route.Enabled
+		if route.Strategy != "" {
+			strategy = route.Strategy
+		}
+		if route.Fallback != "" {
+			fallback = route.Fallback
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if strategy == model.MockMatchBody && runtimeConfig(s.Config).CaptureBodyLimit <= 0 {
+		// without captured bodies every request would match on body
+		strategy = model.MockMatchQuery
+	}
+
+	// failing to read the recorded traffic is a miss, the fallback of the route decides what happens
+	hit, err := s.match(req, reqPath, strategy)
+	if err != nil {
+		s.Logger.Errorf("Failed to match recorded request, error = %v", err)
+	}
+
+	var resp *http.Response
+	switch {
+	case hit != nil:
+		resp = hit
+	case fallback == model.MockFallbackPassthrough:
+		return nil, nil
+	case fallback == model.MockFallbackSynthetic:
+		resp = syntheticResponse(route)
+	default:
+		header := http.Header{"Content-Type": {"application/json"}}
+		resp = mockResponse(http.StatusNotFound, header, []byte(`{"error":"no recorded response matches the request"}`), "miss")
+	}
+
+	// mocked responses are kept out of the recorded traffic used for matching,
+	// the source is stored with the response as well so a failing update is only logged
+	if err := s.Requests.SetSource(req.ID, model.SourceMock); err != nil {
+		s.Logger.Errorf("Failed to mark request as mocked, error = %v", err)
+	}
+	req.Source = model.SourceMock
+
+	return resp, nil
+}
+
+// localSources are the sources of requests answered by treblle instead of the upstream
+var localSources = []string{model.SourceMock, model.SourceRateLimit}
+
+// match returns the response of the newest recorded request matching req with strategy, nil if there is none
+func (s *MockService) match(req *model.Request, reqPath string, strategy model.MockStrategy) (*http.Response, error) {
+	filter := RequestFilter{
+		ProjectID:          &req.ProjectID,
+		Method:             &req.Method,
+		Paths:              []string{reqPath, reqPath + "/"},
+		Answered:           true,
+		ExcludeSources:     localSources,
+		ExcludeProxyErrors: true,
+	}
+	// one more candidate in case req itself is among them
+	var candidates []model.Request
+	err := s.Requests.Stream(filter, RequestPage{Limit: _MOCK_CANDIDATE_LIMIT + 1}, func(candidate *model.Request) error {
+		candidates = append(candidates, *candidate)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := loadPayloads(s.Requests, candidates); err != nil {
+		return nil, err
+	}
+
+	query := normalizeQuery(req.Query)
+	hash := bodyHash(req.RequestBody)
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.ID == req.ID {
+			continue
+		}
+		if strategy != model.MockMatchPath && normalizeQuery(candidate.Query) != query {
+			continue
+		}
+		// a cut body doesn't tell if the whole bodies are equal
+		if strategy == model.MockMatchBody && (req.RequestTruncated || candidate.RequestTruncated || bodyHash(candidate.RequestBody) != hash) {
+			continue
+		}
+		if resp, ok := recordedResponse(candidate); ok {
+			return resp, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordedResponse returns the recorded response of a request, false if its body can't be replayed because it
+// was cut at the capture limit or doesn't decode. Gzip and deflate bodies are sent decoded since the client may
+// not accept the recorded encoding, bodies of other encodings are sent as recorded along with their header
+func recordedResponse(recorded *model.Request) (*http.Response, bool) {
+	if recorded.ResponseTruncated {
+		return nil, false
+	}
+	header := replayHeaders(recorded.ResponseHeaders)
+	body := recorded.ResponseBody
+
+	var decoder io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		if len(body) > 0 {
+			decoder, err = gzip.NewReader(bytes.NewReader(body))
+		}
+	case "deflate":
+		if len(body) > 0 {
+			decoder, err = zlib.NewReader(bytes.NewReader(body))
+		}
+	case "", "identity":
+	default:
+		return mockResponse(recorded.Response, header, body, "hit"), true
+	}
+	if err != nil {
+		return nil, false
+	}
+	if decoder != nil {
+		defer decoder.Close()
+		if body, err = io.ReadAll(decoder); err != nil {
+			return nil, false
+		}
+	}
+	header.Del("Content-Encoding")
+	return mockResponse(recorded.Response, header, body, "hit"), true
+}
+
+// route returns the most specific mock route of the project covering the request, nil if there is none
+func (s *MockService) route(projectID uint, method, reqPath string) (*model.MockRoute, error) {
+	routes, err := s.cachedRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.MockRoute
+	for i := range routes {
+		route := &routes[i]
+		if route.ProjectID != projectID || !route.Covers(method, reqPath) {
+			continue
+		}
+		if best == nil || len(route.Path) > len(best.Path) ||
+			(len(route.Path) == len(best.Path) && best.Method == "" && route.Method != "") {
+			best = route
+		}
+	}
+	return best, nil
+}
+
+func (s *MockService) cachedRoutes() ([]model.MockRoute, error) {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		return s.routes, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		var routes []model.MockRoute
+		if err := s.Db.Find(&routes).Error; err != nil {
+			s.Logger.Errorf("Failed to load mock routes, error = %v", err)
+			return nil, err
+		}
+		s.routes = routes
+		s.loaded = true
+	}
+	return s.routes, nil
+}
+
+// invalidate drops the cached routes so they are reloaded on the next request
+func (s *MockService) invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.routes = nil
+	s.mu.Unlock()
+}
+
+func (s *MockService) ListRoutes(projectID uint) ([]model.MockRoute, error) {
+	var routes []model.MockRoute
+	if err := s.Db.Where("project_id = ?", projectID).Order("path asc").Order("method asc").Find(&routes).Error; err != nil {
+		s.Logger.Errorf("Failed to list mock routes, error = %v", err)
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (s *MockService) GetRoute(projectID, id uint) (*model.MockRoute, error) {
+	var route model.MockRoute
+	if err := s.Db.Where("project_id = ?", projectID).First(&route, id).Error; err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func (s *MockService) CreateRoute(actor string, route *model.MockRoute) error {
+	if err := prepareRoute(route); err != nil {
+		return err
+	}
+	route.ID = 0
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(route).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditMockRouteCreated, model.AuditTarget("mock_route", route.ID), nil, route)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create mock route, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *MockService) UpdateRoute(actor string, route *model.MockRoute) error {
+	if err := prepareRoute(route); err != nil {
+		return err
+	}
+
+	existing, err := s.GetRoute(route.ProjectID, route.ID)
+	if err != nil {
+		return err
+	}
+	route.CreatedAt = existing.CreatedAt
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(route).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditMockRouteUpdated, model.AuditTarget("mock_route", route.ID), existing, route)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to update mock route, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *MockService) DeleteRoute(actor string, projectID, id uint) error {
+	existing, err := s.GetRoute(projectID, id)
+	if err != nil {
+		return err
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.Delete(&model.MockRoute{}, id)
+		if rez.Error != nil {
+			s.Logger.Errorf("Failed to delete mock route, error = %v", rez.Error)
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditMockRouteDeleted, model.AuditTarget("mock_route", id), existing, nil)
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// prepareRoute validates the route and normalizes its method and path
+func prepareRoute(route *model.MockRoute) error {
+	if route.Strategy != "" && !route.Strategy.IsValid() {
+		return cerror.ErrUnknownMockStrategy
+	}
+	if route.Fallback != "" && !route.Fallback.IsValid() {
+		return cerror.ErrUnknownMockFallback
+	}
+	route.Method = strings.ToUpper(strings.TrimSpace(route.Method))
+	route.Path = normalizePath(route.Path)
+	return nil
+}
+
+// normalizePath cleans p so that /a//b/ and /a/b are the same path
+func normalizePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// normalizeQuery sorts the query parameters so their order does not matter
+func normalizeQuery(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	return values.Encode()
+}
+
+func syntheticResponse(route *model.MockRoute) *http.Response {
+	status := http.StatusOK
+	header := http.Header{}
+	var body []byte
+	if route != nil {
+		if route.SyntheticStatus != 0 {
+			status = route.SyntheticStatus
+		}
+		if route.SyntheticContentType != "" {
+			header.Set("Content-Type", route.SyntheticContentType)
+		}
+		body = []byte(route.SyntheticBody)
+	}
+	return mockResponse(status, header, body, "synthetic")
+}
+
+func mockResponse(status int, header http.Header, body []byte, kind string) *http.Response {
+	header.Set(MockHeader, kind)
+	return localResponse(status, header, body)
+}
+
+// localResponse builds a response answered by treblle instead of the upstream
+func localResponse(status int, header http.Header, body []byte) *http.Response {
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
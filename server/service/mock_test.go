@@ -0,0 +1,317 @@
+package service_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- MockService Test Suite ---
+type MockServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	mockSrv *service.MockService
+}
+
+func (suite *MockServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:mock_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.MockRoute{}))
+
+	suite.db = db
+	suite.mockSrv = &service.MockService{
+		Db:       db,
+		Requests: service.NewSQLRequestStore(db),
+		Logger:   zap.NewNop().Sugar(),
+		Enabled:  true,
+		Strategy: model.MockMatchQuery,
+		Fallback: model.MockFallbackNotFound,
+		Config:   model.RuntimeConfig{CaptureBodyLimit: 1024},
+	}
+
+	now := time.Now()
+	recorded := []model.Request{
+		{Source: model.SourceProxy, Method: "GET", Path: "/users/", Query: "page=1&size=10", Response: 200, CreatedAt: now.Add(-time.Minute),
+			ResponseHeaders: model.Headers{"Content-Type": {"application/json"}, "Set-Cookie": {model.RedactedValue}}, ResponseBody: []byte(`[{"id":1}]`)},
+		{Source: model.SourceProxy, Method: "GET", Path: "/users", Response: 200, CreatedAt: now.Add(-2 * time.Minute), ResponseBody: []byte(`[]`)},
+		{Source: model.SourceProxy, Method: "POST", Path: "/users", Response: 201, CreatedAt: now.Add(-time.Minute), RequestBody: []byte(`{"name":"a"}`), ResponseBody: []byte(`{"id":2}`)},
+		{Source: model.SourceProxy, Method: "POST", Path: "/users", Response: 409, CreatedAt: now.Add(-2 * time.Minute), RequestBody: []byte(`{"name":"b"}`), ResponseBody: []byte(`{"error":"exists"}`)},
+		// never finished, has no response to replay
+		{Source: model.SourceProxy, Method: "GET", Path: "/orders", CreatedAt: now},
+	}
+	suite.Require().NoError(db.Create(&recorded).Error)
+}
+
+func (suite *MockServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestMockServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(MockServiceTestSuite))
+}
+
+// incoming stores a request the way the proxy logs it before asking for a mock
+func (suite *MockServiceTestSuite) incoming(method, path, query, body string) *model.Request {
+	req := &model.Request{Source: model.SourceProxy, Method: method, Path: path, Query: query, CreatedAt: time.Now()}
+	if body != "" {
+		req.RequestBody = []byte(body)
+	}
+	suite.Require().NoError(suite.db.Create(req).Error)
+	return req
+}
+
+func (suite *MockServiceTestSuite) mock(req *model.Request) (*http.Response, string) {
+	resp, err := suite.mockSrv.Mock(req)
+	suite.Require().NoError(err)
+	if resp == nil {
+		return nil, ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	return resp, string(body)
+}
+
+// --- Test Cases ---
+
+func (suite *MockServiceTestSuite) TestMock_MatchesNormalizedPathAndQuery() {
+	req := suite.incoming("GET", "//users", "size=10&page=1", "")
+	resp, body := suite.mock(req)
+
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), `[{"id":1}]`, body)
+	assert.Equal(suite.T(), "hit", resp.Header.Get(service.MockHeader))
+	assert.Equal(suite.T(), "application/json", resp.Header.Get("Content-Type"))
+	assert.Empty(suite.T(), resp.Header.Get("Set-Cookie"))
+
+	// mocked requests are not used as recorded traffic
+	var stored model.Request
+	suite.Require().NoError(suite.db.First(&stored, req.ID).Error)
+	assert.Equal(suite.T(), model.SourceMock, stored.Source)
+}
+
+func (suite *MockServiceTestSuite) TestMock_PathStrategyIgnoresQuery() {
+	suite.mockSrv.Strategy = model.MockMatchPath
+
+	resp, body := suite.mock(suite.incoming("GET", "/users", "page=99", ""))
+	suite.Require().NotNil(resp)
+	// newest recorded request wins
+	assert.Equal(suite.T(), `[{"id":1}]`, body)
+}
+
+func (suite *MockServiceTestSuite) TestMock_BodyStrategy() {
+	suite.mockSrv.Strategy = model.MockMatchBody
+
+	resp, body := suite.mock(suite.incoming("POST", "/users", "", `{"name":"b"}`))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+	assert.Equal(suite.T(), `{"error":"exists"}`, body)
+
+	resp, _ = suite.mock(suite.incoming("POST", "/users", "", `{"name":"c"}`))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *MockServiceTestSuite) TestMock_BodyStrategyWithoutCapture() {
+	suite.mockSrv.Strategy = model.MockMatchBody
+	suite.mockSrv.Config = model.RuntimeConfig{}
+
+	// bodies aren't captured, the query strategy picks the newest request
+	resp, body := suite.mock(suite.incoming("POST", "/users", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+	assert.Equal(suite.T(), `{"id":2}`, body)
+}
+
+func (suite *MockServiceTestSuite) TestMock_BodyStrategySkipsTruncatedRequests() {
+	suite.mockSrv.Strategy = model.MockMatchBody
+	suite.Require().NoError(suite.db.Create(&model.Request{Source: model.SourceProxy, Method: "POST", Path: "/users", Response: 200,
+		CreatedAt: time.Now().Add(-time.Second), RequestBody: []byte(`{"name":"c"}`), RequestTruncated: true, ResponseBody: []byte(`{"id":3}`)}).Error)
+
+	// a cut recorded body doesn't match
+	resp, _ := suite.mock(suite.incoming("POST", "/users", "", `{"name":"c"}`))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+
+	// neither does a cut incoming body
+	req := suite.incoming("POST", "/users", "", `{"name":"b"}`)
+	req.RequestTruncated = true
+	resp, _ = suite.mock(req)
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *MockServiceTestSuite) TestMock_SkipsTruncatedBodies() {
+	suite.Require().NoError(suite.db.Create(&model.Request{Source: model.SourceProxy, Method: "GET", Path: "/items", Response: 200,
+		CreatedAt: time.Now().Add(-time.Second), ResponseBody: []byte(`[{"id":1},{"i`), ResponseTruncated: true}).Error)
+
+	resp, _ := suite.mock(suite.incoming("GET", "/items", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *MockServiceTestSuite) TestMock_SkipsProxyErrors() {
+	suite.Require().NoError(suite.db.Create(&model.Request{Source: model.SourceProxy, Method: "GET", Path: "/users", Response: 502,
+		ProxyError: string(model.ProxyErrorConnectionRefused), CreatedAt: time.Now().Add(-time.Second), ResponseBody: []byte(`{"error":"Bad Gateway"}`)}).Error)
+
+	// the newer synthetic 502 is no recorded answer, the older recorded response is served
+	resp, body := suite.mock(suite.incoming("GET", "/users", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), `[]`, body)
+}
+
+func (suite *MockServiceTestSuite) TestMock_DecodesRecordedEncoding() {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`[{"id":3}]`))
+	suite.Require().NoError(writer.Close())
+	suite.Require().NoError(suite.db.Create(&model.Request{Source: model.SourceProxy, Method: "GET", Path: "/items", Response: 200,
+		CreatedAt: time.Now().Add(-time.Second), ResponseHeaders: model.Headers{"Content-Encoding": {"gzip"}}, ResponseBody: compressed.Bytes()}).Error)
+
+	resp, body := suite.mock(suite.incoming("GET", "/items", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), `[{"id":3}]`, body)
+	assert.Empty(suite.T(), resp.Header.Get("Content-Encoding"))
+	assert.Equal(suite.T(), "10", resp.Header.Get("Content-Length"))
+}
+
+func (suite *MockServiceTestSuite) TestMock_Fallbacks() {
+	resp, _ := suite.mock(suite.incoming("GET", "/orders", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	assert.Equal(suite.T(), "miss", resp.Header.Get(service.MockHeader))
+
+	suite.mockSrv.Fallback = model.MockFallbackPassthrough
+	req := suite.incoming("GET", "/orders", "", "")
+	resp, _ = suite.mock(req)
+	assert.Nil(suite.T(), resp)
+	assert.Equal(suite.T(), model.SourceProxy, req.Source)
+
+	suite.Require().NoError(suite.mockSrv.CreateRoute(testActor, &model.MockRoute{
+		Path:                 "/orders",
+		Enabled:              true,
+		Fallback:             model.MockFallbackSynthetic,
+		SyntheticStatus:      http.StatusServiceUnavailable,
+		SyntheticContentType: "application/json",
+		SyntheticBody:        `{"status":"down"}`,
+	}))
+	resp, body := suite.mock(suite.incoming("GET", "/orders/7", "", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(suite.T(), `{"status":"down"}`, body)
+	assert.Equal(suite.T(), "synthetic", resp.Header.Get(service.MockHeader))
+}
+
+// brokenStore fails to read requests
+type brokenStore struct{ service.RequestStore }
+
+func (brokenStore) Stream(service.RequestFilter, service.RequestPage, func(*model.Request) error) error {
+	return errors.New("store is down")
+}
+
+func (suite *MockServiceTestSuite) TestMock_FallsBackWhenStoreFails() {
+	suite.mockSrv.Requests = brokenStore{suite.mockSrv.Requests}
+
+	// the request would be a hit, it's answered like a miss
+	req := suite.incoming("GET", "/users", "page=1&size=10", "")
+	resp, _ := suite.mock(req)
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	assert.Equal(suite.T(), "miss", resp.Header.Get(service.MockHeader))
+
+	suite.mockSrv.Fallback = model.MockFallbackPassthrough
+	resp, _ = suite.mock(suite.incoming("GET", "/users", "page=1&size=10", ""))
+	assert.Nil(suite.T(), resp)
+}
+
+func (suite *MockServiceTestSuite) TestMock_PerRouteToggle() {
+	suite.mockSrv.Enabled = false
+
+	resp, _ := suite.mock(suite.incoming("GET", "/users", "page=1&size=10", ""))
+	assert.Nil(suite.T(), resp)
+
+	route := &model.MockRoute{Path: "users/", Enabled: true}
+	suite.Require().NoError(suite.mockSrv.CreateRoute(testActor, route))
+	assert.Equal(suite.T(), "/users", route.Path)
+
+	resp, _ = suite.mock(suite.incoming("GET", "/users", "page=1&size=10", ""))
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	// a more specific route with a method turns mocking off again
+	suite.Require().NoError(suite.mockSrv.CreateRoute(testActor, &model.MockRoute{Method: "post", Path: "/users", Enabled: false}))
+	resp, _ = suite.mock(suite.incoming("POST", "/users", "", `{"name":"a"}`))
+	assert.Nil(suite.T(), resp)
+
+	// /users-archive is not under /users
+	resp, _ = suite.mock(suite.incoming("GET", "/users-archive", "", ""))
+	assert.Nil(suite.T(), resp)
+
+	route.Enabled = false
+	suite.Require().NoError(suite.mockSrv.UpdateRoute(testActor, route))
+	resp, _ = suite.mock(suite.incoming("GET", "/users", "page=1&size=10", ""))
+	assert.Nil(suite.T(), resp)
+}
+
+func (suite *MockServiceTestSuite) TestMock_ScopedToProject() {
+	const projectA, projectB = 1, 2
+	suite.Require().NoError(suite.db.Create(&model.Request{Source: model.SourceProxy, ProjectID: projectB, Method: "GET", Path: "/secrets", Response: 200,
+		CreatedAt: time.Now().Add(-time.Second), ResponseBody: []byte(`{"token":"of b"}`)}).Error)
+	suite.Require().NoError(suite.mockSrv.CreateRoute(testActor, &model.MockRoute{ProjectID: projectB, Path: "/secrets", Enabled: true, Fallback: model.MockFallbackPassthrough}))
+
+	// project b's recording and route are never used for project a
+	req := suite.incoming("GET", "/secrets", "", "")
+	req.ProjectID = projectA
+	suite.Require().NoError(suite.db.Save(req).Error)
+	resp, body := suite.mock(req)
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	assert.NotContains(suite.T(), body, "of b")
+
+	req = suite.incoming("GET", "/secrets", "", "")
+	req.ProjectID = projectB
+	suite.Require().NoError(suite.db.Save(req).Error)
+	resp, body = suite.mock(req)
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), `{"token":"of b"}`, body)
+
+	routes, err := suite.mockSrv.ListRoutes(projectA)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), routes)
+	routes, err = suite.mockSrv.ListRoutes(projectB)
+	suite.Require().NoError(err)
+	suite.Require().Len(routes, 1)
+	assert.ErrorIs(suite.T(), suite.mockSrv.DeleteRoute(testActor, projectA, routes[0].ID), gorm.ErrRecordNotFound)
+}
+
+func (suite *MockServiceTestSuite) TestCreateRoute_Validates() {
+	err := suite.mockSrv.CreateRoute(testActor, &model.MockRoute{Path: "/a", Strategy: "fuzzy"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownMockStrategy)
+
+	err = suite.mockSrv.CreateRoute(testActor, &model.MockRoute{Path: "/a", Fallback: "500"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownMockFallback)
+
+	err = suite.mockSrv.DeleteRoute(testActor, model.DefaultProjectID, 42)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
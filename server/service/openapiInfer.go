@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"treblle/app"
+	"treblle/model"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	_INFER_BATCH_SIZE  = 500
+	_INFER_POLL_PERIOD = time.Minute
+	// _INFER_SETTLE_DELAY is how long a request without a response is treated as in flight
+	_INFER_SETTLE_DELAY = time.Minute
+
+	// CallsExtension counts the requests merged into an inferred operation
+	CallsExtension = "x-treblle-calls"
+)
+
+// inferableMethods are the methods an OpenAPI path item can describe
+var inferableMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+type IOpenApiInferenceService interface {
+	// Inferred merges requests of the project recorded since the last update and returns its document
+	Inferred(projectID uint) (*openapi3.T, error)
+	// Update merges requests recorded since the last update into the document of every project and returns how many were merged
+	Update() (int, error)
+	Worker() app.Worker
+}
+
+// OpenApiInferenceService builds an OpenAPI 3 document per project from the request store,
+// new requests are merged into the stored document so history is only read once
+type OpenApiInferenceService struct {
+	Db        *gorm.DB
+	Requests  RequestStore // Requests is the request store the documents are inferred from
+	Logger    *zap.SugaredLogger
+	ServerUrl string // ServerUrl is the upstream url listed in the document servers
+
+	mu sync.Mutex
+}
+
+func NewOpenApiInferenceService() IOpenApiInferenceService {
+	var service *OpenApiInferenceService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, logger *zap.SugaredLogger) {
+		service = &OpenApiInferenceService{
+			Db:        db,
+			Requests:  requests,
+			Logger:    logger,
+			ServerUrl: app.ProxyUrl,
+		}
+	})
+
+	return service
+}
+
+// NewOpenApiInferenceWorker keeps the inferred document up to date in the background
+func NewOpenApiInferenceWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(service IOpenApiInferenceService) {
+		worker = service.Worker()
+	})
+	return worker
+}
+
+func (s *OpenApiInferenceService) Inferred(projectID uint) (*openapi3.T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spec, doc, _, err := s.update(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ServerUrl != "" {
+		doc.Servers = openapi3.Servers{{URL: s.ServerUrl}}
+	}
+	doc.Info.Description = "Inferred by treblle from " + strconv.FormatInt(spec.Observed, 10) + " recorded requests"
+	return doc, nil
+}
+
+func (s *OpenApiInferenceService) Update() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var projectIDs []uint
+	if err := s.Db.Model(&model.Project{}).Order("id asc").Pluck("id", &projectIDs).Error; err != nil {
+		s.Logger.Errorf("Failed to read projects, error = %v", err)
+		return 0, err
+	}
+
+	total := 0
+	for _, projectID := range append([]uint{model.DefaultProjectID}, projectIDs...) {
+		_, _, observed, err := s.update(projectID)
+		if err != nil {
+			return total, err
+		}
+		total += observed
+	}
+	return total, nil
+}
+
+func (s *OpenApiInferenceService) Worker() app.Worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(_INFER_POLL_PERIOD)
+		defer ticker.Stop()
+
+		for {
+			if n, err := s.Update(); err != nil {
+				s.Logger.Errorf("Failed to update inferred openapi document, error = %v", err)
+			} else if n > 0 {
+				s.Logger.Debugf("Merged %d requests into inferred openapi document", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				s.Logger.Infof("Stopped openapi inference worker")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// update merges new requests in batches, each batch is saved with the request id it ends on.
+// It stops at the first request that may still be waiting for its response
+func (s *OpenApiInferenceService) update(projectID uint) (*model.InferredSpec, *openapi3.T, int, error) {
+	spec, doc, err := s.load(projectID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	observed := 0
+	settled := time.Now().Add(-_INFER_SETTLE_DELAY)
+	for {
+		var requests []model.Request
+		filter := RequestFilter{ProjectID: &projectID, AfterID: spec.LastRequestID, ExcludeProxyErrors: true}
+		err := s.Requests.Stream(filter, RequestPage{Limit: _INFER_BATCH_SIZE, SortBy: "id", Order: "asc"}, func(request *model.Request) error {
+			requests = append(requests, *request)
+			return nil
+		})
+		if err != nil {
+			s.Logger.Errorf("Failed to read requests, error = %v", err)
+			return nil, nil, 0, err
+		}
+		if err := loadPayloads(s.Requests, requests); err != nil {
+			s.Logger.Errorf("Failed to read request payloads, error = %v", err)
+			return nil, nil, 0, err
+		}
+
+		merged := 0
+		inFlight := false
+		for i := range requests {
+			request := &requests[i]
+			if request.Response == 0 && request.CreatedAt.After(settled) {
+				inFlight = true
+				break
+			}
+			if request.Response != 0 && !slices.Contains(localSources, request.Source) {
+				observe(doc, request)
+				spec.Observed++
+				observed++
+			}
+			spec.LastRequestID = request.ID
+			merged++
+		}
+		if merged == 0 {
+			return spec, doc, observed, nil
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		spec.Document = string(data)
+		if err := s.Db.Save(spec).Error; err != nil {
+			s.Logger.Errorf("Failed to save inferred openapi document, error = %v", err)
+			return nil, nil, 0, err
+		}
+
+		if inFlight || len(requests) < _INFER_BATCH_SIZE {
+			return spec, doc, observed, nil
+		}
+	}
+}
+
+// load reads the stored document of the project or starts a new one
+func (s *OpenApiInferenceService) load(projectID uint) (*model.InferredSpec, *openapi3.T, error) {
+	var spec model.InferredSpec
+	err := s.Db.Where("project_id = ?", projectID).Order("id asc").First(&spec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.InferredSpec{ProjectID: projectID}, newInferredDocument(), nil
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read inferred openapi document, error = %v", err)
+		return nil, nil, err
+	}
+
+	var doc openapi3.T
+	if err := json.Unmarshal([]byte(spec.Document), &doc); err != nil {
+		s.Logger.Errorf("Failed to parse inferred openapi document, error = %v", err)
+		return nil, nil, err
+	}
+	if doc.Paths == nil {
+		doc.Paths = openapi3.NewPaths()
+	}
+	return &spec, &doc, nil
+}
+
+func newInferredDocument() *openapi3.T {
+	return &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:   "Inferred API",
+			Version: "1.0.0",
+		},
+		Paths: openapi3.NewPaths(),
+	}
+}
+
+// observe merges a recorded request into doc
+func observe(doc *openapi3.T, request *model.Request) {
+	if !slices.Contains(inferableMethods, request.Method) {
+		return
+	}
+
+	template, pathParams := templatePath(normalizePath(request.Path))
+	item := doc.Paths.Value(template)
+	if item == nil {
+		item = &openapi3.PathItem{}
+		doc.Paths.Set(template, item)
+	}
+
+	operation := item.GetOperation(request.Method)
+	first := operation == nil
+	if first {
+		operation = openapi3.NewOperation()
+		operation.Responses = openapi3.NewResponsesWithCapacity(0)
+		item.SetOperation(request.Method, operation)
+	}
+	if operation.Extensions == nil {
+		operation.Extensions = map[string]any{}
+	}
+	operation.Extensions[CallsExtension] = OperationCalls(operation) + 1
+
+	for _, p := range pathParams {
+		if param := operation.Parameters.GetByInAndName(openapi3.ParameterInPath, p.Name); param != nil {
+			param.Schema.Value = mergeSchema(param.Schema.Value, p.Schema)
+		} else {
+			operation.AddParameter(openapi3.NewPathParameter(p.Name).WithSchema(p.Schema))
+		}
+	}
+	observeQuery(operation, request.Query, first)
+
+	if len(request.RequestBody) > 0 {
+		if operation.RequestBody == nil {
+			operation.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(openapi3.Content{})}
+		}
+		contentType := request.RequestHeaders.Http().Get("Content-Type")
+		observeContent(operation.RequestBody.Value.Content, contentType, request.RequestBody)
+	}
+
+	status := strconv.Itoa(request.Response)
+	response := operation.Responses.Value(status)
+	if response == nil {
+		response = &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription(http.StatusText(request.Response))}
+		operation.Responses.Set(status, response)
+	}
+	if len(request.ResponseBody) > 0 {
+		if response.Value.Content == nil {
+			response.Value.Content = openapi3.Content{}
+		}
+		contentType := request.ResponseHeaders.Http().Get("Content-Type")
+		observeContent(response.Value.Content, contentType, request.ResponseBody)
+	}
+}
+
+// observeQuery merges query parameters, a parameter is required only if every request sent it
+func observeQuery(operation *openapi3.Operation, rawQuery string, first bool) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return
+	}
+
+	for _, ref := range operation.Parameters {
+		if ref.Value.In == openapi3.ParameterInQuery && !values.Has(ref.Value.Name) {
+			ref.Value.Required = false
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var schema *openapi3.Schema
+		for _, value := range values[name] {
+			schema = mergeSchema(schema, inferValueSchema(value))
+		}
+		if len(values[name]) > 1 {
+			schema = openapi3.NewArraySchema().WithItems(schema)
+		}
+
+		if param := operation.Parameters.GetByInAndName(openapi3.ParameterInQuery, name); param != nil {
+			param.Schema.Value = mergeSchema(param.Schema.Value, schema)
+		} else {
+			operation.AddParameter(openapi3.NewQueryParameter(name).WithSchema(schema).WithRequired(first))
+		}
+	}
+}
+
+// observeContent merges a body into the content entry of its media type, only json bodies get a schema
+func observeContent(content openapi3.Content, contentType string, body []byte) {
+	mt := mediaType(contentType, body)
+	if mt == "" {
+		return
+	}
+
+	media := content.Get(mt)
+	if media == nil {
+		media = openapi3.NewMediaType()
+		content[mt] = media
+	}
+	if !isJsonMediaType(mt) {
+		return
+	}
+
+	schema := inferBodySchema(body)
+	if schema == nil {
+		return
+	}
+	if media.Schema == nil {
+		media.Schema = openapi3.NewSchemaRef("", schema)
+	} else {
+		media.Schema.Value = mergeSchema(media.Schema.Value, schema)
+	}
+}
+
+// OperationCalls returns the number of requests merged into an inferred operation
+func OperationCalls(operation *openapi3.Operation) int64 {
+	switch calls := operation.Extensions[CallsExtension].(type) {
+	case int64:
+		return calls
+	case int:
+		return int64(calls)
+	case float64:
+		return int64(calls)
+	case json.Number:
+		n, _ := calls.Int64()
+		return n
+	}
+	return 0
+}
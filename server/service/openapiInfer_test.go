@@ -0,0 +1,227 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- OpenApiInferenceService Test Suite ---
+type OpenApiInferenceTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	inferSrv *service.OpenApiInferenceService
+}
+
+func (suite *OpenApiInferenceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:infer_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.Project{}, &model.InferredSpec{}))
+
+	suite.db = db
+	suite.inferSrv = &service.OpenApiInferenceService{
+		Db:        db,
+		Requests:  service.NewSQLRequestStore(db),
+		Logger:    zap.NewNop().Sugar(),
+		ServerUrl: "https://api.example.com",
+	}
+}
+
+func (suite *OpenApiInferenceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestOpenApiInferenceTestSuite(t *testing.T) {
+	suite.Run(t, new(OpenApiInferenceTestSuite))
+}
+
+var jsonHeaders = model.Headers{"Content-Type": {"application/json; charset=utf-8"}}
+
+func (suite *OpenApiInferenceTestSuite) record(requests ...model.Request) {
+	for i := range requests {
+		if requests[i].CreatedAt.IsZero() {
+			requests[i].CreatedAt = time.Now().Add(-time.Hour)
+		}
+		if requests[i].Source == "" {
+			requests[i].Source = model.SourceProxy
+		}
+	}
+	suite.Require().NoError(suite.db.Create(&requests).Error)
+}
+
+func (suite *OpenApiInferenceTestSuite) inferred() *openapi3.T {
+	doc, err := suite.inferSrv.Inferred(model.DefaultProjectID)
+	suite.Require().NoError(err)
+	suite.Require().NoError(doc.Validate(context.Background()))
+	return doc
+}
+
+// --- Test Cases ---
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_EndpointsParametersAndSchemas() {
+	suite.record(
+		model.Request{Method: "GET", Path: "/users/1", Query: "fields=name&verbose=true", Response: 200,
+			ResponseHeaders: jsonHeaders, ResponseBody: []byte(`{"id":1,"name":"ana","email":null,"tags":["a"]}`)},
+		model.Request{Method: "GET", Path: "/users/2", Query: "verbose=false", Response: 200,
+			ResponseHeaders: jsonHeaders, ResponseBody: []byte(`{"id":2,"name":"ben","email":"ben@example.com","tags":[],"score":1.5}`)},
+		model.Request{Method: "GET", Path: "/users/3", Response: 404,
+			ResponseHeaders: jsonHeaders, ResponseBody: []byte(`{"error":"not found"}`)},
+		model.Request{Method: "POST", Path: "/users", Response: 201, RequestHeaders: jsonHeaders, RequestBody: []byte(`{"name":"cid","age":3}`),
+			ResponseHeaders: model.Headers{"Content-Type": {"text/plain"}}, ResponseBody: []byte(`created`)},
+	)
+
+	doc := suite.inferred()
+	assert.Equal(suite.T(), "https://api.example.com", doc.Servers[0].URL)
+	assert.ElementsMatch(suite.T(), []string{"/users", "/users/{userId}"}, doc.Paths.InMatchingOrder())
+
+	get := doc.Paths.Value("/users/{userId}").Get
+	suite.Require().NotNil(get)
+	assert.Equal(suite.T(), int64(3), service.OperationCalls(get))
+
+	userId := get.Parameters.GetByInAndName(openapi3.ParameterInPath, "userId")
+	suite.Require().NotNil(userId)
+	assert.True(suite.T(), userId.Required)
+	assert.True(suite.T(), userId.Schema.Value.Type.Is(openapi3.TypeInteger))
+
+	// verbose was sent by the first two requests but not the third
+	verbose := get.Parameters.GetByInAndName(openapi3.ParameterInQuery, "verbose")
+	suite.Require().NotNil(verbose)
+	assert.False(suite.T(), verbose.Required)
+	assert.True(suite.T(), verbose.Schema.Value.Type.Is(openapi3.TypeBoolean))
+
+	suite.Require().NotNil(get.Responses.Value("200"))
+	suite.Require().NotNil(get.Responses.Value("404"))
+	user := get.Responses.Value("200").Value.Content.Get("application/json").Schema.Value
+	assert.True(suite.T(), user.Type.Is(openapi3.TypeObject))
+	assert.Equal(suite.T(), []string{"email", "id", "name", "tags"}, user.Required)
+	assert.True(suite.T(), user.Properties["score"].Value.Type.Is(openapi3.TypeNumber))
+	assert.True(suite.T(), user.Properties["email"].Value.Type.Is(openapi3.TypeString))
+	assert.True(suite.T(), user.Properties["email"].Value.Nullable)
+	assert.True(suite.T(), user.Properties["tags"].Value.Items.Value.Type.Is(openapi3.TypeString))
+
+	post := doc.Paths.Value("/users").Post
+	suite.Require().NotNil(post)
+	body := post.RequestBody.Value.Content.Get("application/json").Schema.Value
+	assert.True(suite.T(), body.Properties["age"].Value.Type.Is(openapi3.TypeInteger))
+	created := post.Responses.Value("201").Value.Content.Get("text/plain")
+	suite.Require().NotNil(created)
+	assert.Nil(suite.T(), created.Schema)
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_MergesIncrementally() {
+	suite.record(model.Request{Method: "GET", Path: "/items", Response: 200, ResponseBody: []byte(`[{"id":1,"price":2}]`)})
+	doc := suite.inferred()
+	items := doc.Paths.Value("/items").Get.Responses.Value("200").Value.Content.Get("application/json").Schema.Value.Items.Value
+	assert.True(suite.T(), items.Properties["price"].Value.Type.Is(openapi3.TypeInteger))
+
+	suite.record(model.Request{Method: "GET", Path: "/items", Response: 200, ResponseBody: []byte(`[{"id":"x1","price":2.5}]`)})
+	n, err := suite.inferSrv.Update()
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, n)
+
+	doc = suite.inferred()
+	operation := doc.Paths.Value("/items").Get
+	assert.Equal(suite.T(), int64(2), service.OperationCalls(operation))
+	items = operation.Responses.Value("200").Value.Content.Get("application/json").Schema.Value.Items.Value
+	assert.True(suite.T(), items.Properties["price"].Value.Type.Is(openapi3.TypeNumber))
+	assert.Len(suite.T(), items.Properties["id"].Value.AnyOf, 2)
+
+	var spec model.InferredSpec
+	suite.Require().NoError(suite.db.First(&spec).Error)
+	assert.Equal(suite.T(), int64(2), spec.Observed)
+	assert.Equal(suite.T(), uint(2), spec.LastRequestID)
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_PerProject() {
+	suite.Require().NoError(suite.db.Create(&model.Project{ID: 7, Name: "Shop", Slug: "shop", UpstreamUrl: "http://shop"}).Error)
+	suite.record(
+		model.Request{Method: "GET", Path: "/users", Response: 200},
+		model.Request{Method: "GET", Path: "/orders", Response: 200, ProjectID: 7},
+	)
+
+	n, err := suite.inferSrv.Update()
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 2, n)
+
+	doc := suite.inferred()
+	assert.Equal(suite.T(), []string{"/users"}, doc.Paths.InMatchingOrder())
+
+	doc, err = suite.inferSrv.Inferred(7)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []string{"/orders"}, doc.Paths.InMatchingOrder())
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_FromEmbeddedStore() {
+	store, err := service.NewEmbeddedRequestStore("")
+	suite.Require().NoError(err)
+	suite.inferSrv.Requests = store
+	for _, request := range []model.Request{
+		{Method: "GET", Path: "/users/1", Response: 200, Source: model.SourceProxy, CreatedAt: time.Now().Add(-time.Hour)},
+		{Method: "DELETE", Path: "/users/1", Response: 204, Source: model.SourceProxy, CreatedAt: time.Now().Add(-time.Hour)},
+	} {
+		suite.Require().NoError(store.Create(&request))
+	}
+
+	doc := suite.inferred()
+	item := doc.Paths.Value("/users/{userId}")
+	suite.Require().NotNil(item)
+	assert.NotNil(suite.T(), item.Get)
+	assert.NotNil(suite.T(), item.Delete)
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_WaitsForInFlightRequests() {
+	suite.record(
+		model.Request{Method: "GET", Path: "/a", Response: 200},
+		model.Request{Method: "GET", Path: "/b", CreatedAt: time.Now()},
+		model.Request{Method: "GET", Path: "/c", Response: 200},
+		model.Request{Method: "GET", Path: "/d", Response: 200, Source: model.SourceMock},
+	)
+
+	doc := suite.inferred()
+	assert.NotNil(suite.T(), doc.Paths.Value("/a"))
+	assert.Nil(suite.T(), doc.Paths.Value("/c"))
+
+	// the response of /b arrives, everything after it is merged
+	suite.Require().NoError(suite.db.Model(&model.Request{}).Where("path = ?", "/b").Update("response", 204).Error)
+	doc = suite.inferred()
+	assert.NotNil(suite.T(), doc.Paths.Value("/b"))
+	assert.NotNil(suite.T(), doc.Paths.Value("/c"))
+	assert.Nil(suite.T(), doc.Paths.Value("/d"))
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_SkipsProxyErrors() {
+	suite.record(
+		model.Request{Method: "GET", Path: "/users", Response: 200},
+		model.Request{Method: "GET", Path: "/users", Response: 504, ProxyError: string(model.ProxyErrorTimeout)},
+	)
+
+	doc := suite.inferred()
+	operation := doc.Paths.Value("/users").Get
+	assert.Equal(suite.T(), int64(1), service.OperationCalls(operation))
+	assert.Nil(suite.T(), operation.Responses.Value("504"))
+}
+
+func (suite *OpenApiInferenceTestSuite) TestInferred_TruncatedBodyKeepsMediaType() {
+	suite.record(model.Request{Method: "GET", Path: "/big", Response: 200, ResponseHeaders: jsonHeaders, ResponseBody: []byte(`{"items":[1,2`)})
+
+	doc := suite.inferred()
+	media := doc.Paths.Value("/big").Get.Responses.Value("200").Value.Content.Get("application/json")
+	suite.Require().NotNil(media)
+	assert.Nil(suite.T(), media.Schema)
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"treblle/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	_MONGO_TIMEOUT            = 10 * time.Second
+	_MONGO_DEFAULT_DATABASE   = "treblle"
+	_MONGO_PAYLOAD_COLLECTION = "request_payloads"
+)
+
+// PayloadStore stores the captured headers and bodies of requests apart from the requests
+type PayloadStore interface {
+	// Save creates or replaces the payload of a request
+	Save(payload *model.RequestPayload) error
+	// Find returns the stored payloads of the requests, requests without a payload are left out
+	Find(requestIDs []uint) ([]model.RequestPayload, error)
+	// Delete deletes the payloads of the requests
+	Delete(requestIDs []uint) error
+	// DeleteBefore deletes the payloads of requests created before before
+	DeleteBefore(before time.Time) error
+}
+
+// MongoPayloadStore stores payloads as documents of a mongo collection, with the request id as the document id
+type MongoPayloadStore struct {
+	Collection *mongo.Collection
+}
+
+// NewMongoPayloadStore connects to the database in conn, treblle if conn doesn't name one
+func NewMongoPayloadStore(conn string) (*MongoPayloadStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _MONGO_TIMEOUT)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(conn))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	database := _MONGO_DEFAULT_DATABASE
+	if parsed, err := url.Parse(conn); err == nil && strings.Trim(parsed.Path, "/") != "" {
+		database = strings.Trim(parsed.Path, "/")
+	}
+	store := &MongoPayloadStore{Collection: client.Database(database).Collection(_MONGO_PAYLOAD_COLLECTION)}
+
+	// the retention deletes by creation time
+	_, err = store.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: 1}}})
+	if err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *MongoPayloadStore) Save(payload *model.RequestPayload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), _MONGO_TIMEOUT)
+	defer cancel()
+
+	_, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": payload.RequestID}, payload, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoPayloadStore) Find(requestIDs []uint) ([]model.RequestPayload, error) {
+	if len(requestIDs) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), _MONGO_TIMEOUT)
+	defer cancel()
+
+	cursor, err := s.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": requestIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var payloads []model.RequestPayload
+	if err := cursor.All(ctx, &payloads); err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+func (s *MongoPayloadStore) Delete(requestIDs []uint) error {
+	if len(requestIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), _MONGO_TIMEOUT)
+	defer cancel()
+
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": requestIDs}})
+	return err
+}
+
+func (s *MongoPayloadStore) DeleteBefore(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), _MONGO_TIMEOUT)
+	defer cancel()
+
+	_, err := s.Collection.DeleteMany(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+	return err
+}
+
+// MemoryPayloadStore keeps payloads in memory, it stands in for mongo in tests
+type MemoryPayloadStore struct {
+	mu       sync.RWMutex
+	payloads map[uint]model.RequestPayload
+}
+
+func NewMemoryPayloadStore() *MemoryPayloadStore {
+	return &MemoryPayloadStore{payloads: make(map[uint]model.RequestPayload)}
+}
+
+func (s *MemoryPayloadStore) Save(payload *model.RequestPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads[payload.RequestID] = *payload
+	return nil
+}
+
+func (s *MemoryPayloadStore) Find(requestIDs []uint) ([]model.RequestPayload, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var payloads []model.RequestPayload
+	for _, id := range requestIDs {
+		if payload, ok := s.payloads[id]; ok {
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads, nil
+}
+
+func (s *MemoryPayloadStore) Delete(requestIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range requestIDs {
+		delete(s.payloads, id)
+	}
+	return nil
+}
+
+func (s *MemoryPayloadStore) DeleteBefore(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, payload := range s.payloads {
+		if payload.CreatedAt.Before(before) {
+			delete(s.payloads, id)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of stored payloads
+func (s *MemoryPayloadStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.payloads)
+}
+
+// PayloadRequestStore keeps the slim requests in a request store and their headers and bodies in a payload store.
+// Get returns the request with its payload, lists leave the payloads out until LoadPayloads is called
+type PayloadRequestStore struct {
+	RequestStore
+	Payloads PayloadStore
+}
+
+func NewPayloadRequestStore(requests RequestStore, payloads PayloadStore) *PayloadRequestStore {
+	return &PayloadRequestStore{RequestStore: requests, Payloads: payloads}
+}
+
+func (s *PayloadRequestStore) Create(request *model.Request) error {
+	slim := *request
+	payload := slim.TakePayload()
+	if err := s.RequestStore.Create(&slim); err != nil {
+		return err
+	}
+	request.ID = slim.ID
+	payload.RequestID = slim.ID
+	return s.Payloads.Save(&payload)
+}
+
+func (s *PayloadRequestStore) Save(request *model.Request) error {
+	slim := *request
+	payload := slim.TakePayload()
+	if err := s.RequestStore.Save(&slim); err != nil {
+		return err
+	}
+	return s.Payloads.Save(&payload)
+}
+
+func (s *PayloadRequestStore) Get(id uint) (*model.Request, error) {
+	request, err := s.RequestStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	requests := []model.Request{*request}
+	if err := s.LoadPayloads(requests); err != nil {
+		return nil, err
+	}
+	return &requests[0], nil
+}
+
+// List selects on the slim requests, searches don't look into the payloads
+func (s *PayloadRequestStore) List(filter RequestFilter, page RequestPage) ([]model.Request, int64, error) {
+	filter, err := filter.withoutPayloads()
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.RequestStore.List(filter, page)
+}
+
+func (s *PayloadRequestStore) Stream(filter RequestFilter, page RequestPage, fn func(*model.Request) error) error {
+	filter, err := filter.withoutPayloads()
+	if err != nil {
+		return err
+	}
+	return s.RequestStore.Stream(filter, page, fn)
+}
+
+// PathStatistics aggregates the slim requests, searches don't look into the payloads
+func (s *PayloadRequestStore) PathStatistics(filter RequestFilter) ([]model.PathStatistics, error) {
+	filter, err := filter.withoutPayloads()
+	if err != nil {
+		return nil, err
+	}
+	return s.RequestStore.PathStatistics(filter)
+}
+
+// LoadPayloads sets the headers and bodies of listed requests
+func (s *PayloadRequestStore) LoadPayloads(requests []model.Request) error {
+	ids := make([]uint, len(requests))
+	for i := range requests {
+		ids[i] = requests[i].ID
+	}
+	payloads, err := s.Payloads.Find(ids)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint]model.RequestPayload, len(payloads))
+	for _, payload := range payloads {
+		byID[payload.RequestID] = payload
+	}
+	for i := range requests {
+		if payload, ok := byID[requests[i].ID]; ok {
+			requests[i].SetPayload(payload)
+		}
+	}
+	return nil
+}
+
+// DeleteBefore deletes the payloads with their requests, payloads left behind by a failed delete
+// are deleted once no requests before before are left
+func (s *PayloadRequestStore) DeleteBefore(before time.Time, limit int) ([]uint, error) {
+	ids, err := s.RequestStore.DeleteBefore(before, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, s.Payloads.DeleteBefore(before)
+	}
+	if err := s.Payloads.Delete(ids); err != nil {
+		return ids, err
+	}
+	return ids, nil
+}
+
+// payloadLoader is implemented by request stores whose lists leave out the payloads
+type payloadLoader interface {
+	LoadPayloads(requests []model.Request) error
+}
+
+// loadPayloads sets the headers and bodies of requests listed from store, other stores list them with the requests
+func loadPayloads(store RequestStore, requests []model.Request) error {
+	if loader, ok := store.(payloadLoader); ok && len(requests) > 0 {
+		return loader.LoadPayloads(requests)
+	}
+	return nil
+}
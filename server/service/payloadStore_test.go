@@ -0,0 +1,249 @@
+package service_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- PayloadRequestStore Test Suite ---
+// Requests are kept in sqlite and their payloads in the in-memory stand-in for mongo
+type PayloadRequestStoreTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	payloads    *service.MemoryPayloadStore
+	store       *service.PayloadRequestStore
+	crudService service.IRequestCrudService
+	now         time.Time
+}
+
+func (suite *PayloadRequestStoreTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:payload_test_%s?mode=memory&cache=private", suite.T().Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}))
+	suite.db = db
+	suite.payloads = service.NewMemoryPayloadStore()
+	suite.store = service.NewPayloadRequestStore(service.NewSQLRequestStore(db), suite.payloads)
+	suite.now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.RequestStore { return suite.store })
+	suite.crudService = service.NewRequestCrudService()
+}
+
+func (suite *PayloadRequestStoreTestSuite) create(path string, createdAt time.Time) model.Request {
+	request := model.Request{
+		Method:          "POST",
+		Path:            path,
+		Source:          model.SourceProxy,
+		Response:        200,
+		CreatedAt:       createdAt,
+		RequestHeaders:  model.Headers{"Content-Type": {"application/json"}},
+		RequestBody:     []byte(`{"name":"` + path + `"}`),
+		ResponseHeaders: model.Headers{"Content-Type": {"text/plain"}},
+		ResponseBody:    []byte("ok"),
+	}
+	suite.Require().NoError(suite.store.Create(&request))
+	return request
+}
+
+func (suite *PayloadRequestStoreTestSuite) TestCreate_KeepsPayloadApart() {
+	request := suite.create("/users", suite.now)
+	suite.Require().NotZero(request.ID)
+	assert.Equal(suite.T(), []byte(`{"name":"/users"}`), request.RequestBody) // the caller keeps the payload
+
+	var row model.Request
+	suite.Require().NoError(suite.db.First(&row, request.ID).Error)
+	assert.Empty(suite.T(), row.RequestBody)
+	assert.Empty(suite.T(), row.RequestHeaders)
+	assert.Empty(suite.T(), row.ResponseBody)
+	assert.Equal(suite.T(), 1, suite.payloads.Len())
+
+	got, err := suite.store.Get(request.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), request.RequestBody, got.RequestBody)
+	assert.Equal(suite.T(), request.RequestHeaders, got.RequestHeaders)
+	assert.Equal(suite.T(), []byte("ok"), got.ResponseBody)
+}
+
+func (suite *PayloadRequestStoreTestSuite) TestLogResponse_KeepsRequestPayload() {
+	reqLogger := &service.ReqLogger{Requests: suite.store, Logger: zap.NewNop().Sugar(), Config: model.RuntimeConfig{SampleRate: 1, CaptureBodyLimit: 1024}}
+
+	req := httptest.NewRequest(http.MethodPost, "/proxy/users", strings.NewReader(`{"name":"ana"}`))
+	req.Header.Set("Content-Type", "application/json")
+	logged, err := reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+
+	resp := &http.Response{StatusCode: http.StatusCreated, Header: http.Header{"Location": {"/users/1"}}, Body: io.NopCloser(strings.NewReader(`{"id":1}`))}
+	_, err = reqLogger.LogResponse(logged, resp)
+	suite.Require().NoError(err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	suite.Require().NoError(err)
+	suite.Require().NoError(resp.Body.Close())
+
+	got, err := suite.store.Get(logged.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), http.StatusCreated, got.Response)
+	assert.Equal(suite.T(), []byte(`{"name":"ana"}`), got.RequestBody)
+	assert.Equal(suite.T(), "application/json", got.RequestHeaders.Http().Get("Content-Type"))
+	assert.Equal(suite.T(), []byte(`{"id":1}`), got.ResponseBody)
+	assert.Equal(suite.T(), "/users/1", got.ResponseHeaders.Http().Get("Location"))
+}
+
+func (suite *PayloadRequestStoreTestSuite) TestList_LoadsPayloadsLazily() {
+	first := suite.create("/users", suite.now)
+	suite.create("/orders", suite.now.Add(time.Minute))
+
+	requests, total, err := suite.crudService.List(service.ListRequestsParams{})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(2), total)
+	for _, request := range requests {
+		assert.Empty(suite.T(), request.RequestBody)
+	}
+
+	suite.Require().NoError(suite.crudService.LoadPayloads(requests))
+	assert.Equal(suite.T(), []byte(`{"name":"/orders"}`), requests[0].RequestBody)
+	assert.Equal(suite.T(), []byte(`{"name":"/users"}`), requests[1].RequestBody)
+
+	// the detail is read with its payload and only in its project
+	detail, err := suite.crudService.Get(model.DefaultProjectID, first.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), first.RequestBody, detail.RequestBody)
+	_, err = suite.crudService.Get(model.DefaultProjectID+1, first.ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	// exports stream the requests with their payloads
+	var streamed [][]byte
+	suite.Require().NoError(suite.crudService.Stream(service.ListRequestsParams{}, func(request *model.Request) error {
+		streamed = append(streamed, request.ResponseBody)
+		return nil
+	}))
+	assert.Equal(suite.T(), [][]byte{[]byte("ok"), []byte("ok")}, streamed)
+}
+
+func (suite *PayloadRequestStoreTestSuite) TestList_SearchSkipsPayloads() {
+	suite.create("/users", suite.now)
+
+	// searches only look into the slim requests
+	search := "users method:post"
+	_, total, err := suite.crudService.List(service.ListRequestsParams{Search: &search})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+
+	search = "body:name"
+	_, _, err = suite.crudService.List(service.ListRequestsParams{Search: &search})
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadSearch)
+	err = suite.crudService.Stream(service.ListRequestsParams{Search: &search}, func(*model.Request) error { return nil })
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadSearch)
+}
+
+func (suite *PayloadRequestStoreTestSuite) TestDeleteBefore_DeletesPayloads() {
+	old := suite.create("/old", suite.now.Add(-48*time.Hour))
+	kept := suite.create("/kept", suite.now)
+	// left behind by a failed delete
+	suite.Require().NoError(suite.payloads.Save(&model.RequestPayload{RequestID: 999, CreatedAt: suite.now.Add(-72 * time.Hour)}))
+
+	ids, err := suite.store.DeleteBefore(suite.now.Add(-time.Hour), 10)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []uint{old.ID}, ids)
+	assert.Equal(suite.T(), 2, suite.payloads.Len())
+
+	ids, err = suite.store.DeleteBefore(suite.now.Add(-time.Hour), 10)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), ids)
+	assert.Equal(suite.T(), 1, suite.payloads.Len())
+
+	payloads, err := suite.payloads.Find([]uint{old.ID, kept.ID, 999})
+	suite.Require().NoError(err)
+	suite.Require().Len(payloads, 1)
+	assert.Equal(suite.T(), kept.ID, payloads[0].RequestID)
+}
+
+func TestPayloadRequestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(PayloadRequestStoreTestSuite))
+}
+
+// TestMongoPayloadStore checks the commands sent to a mock mongo deployment
+func TestMongoPayloadStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("save upserts by request id", func(mt *mtest.T) {
+		store := &service.MongoPayloadStore{Collection: mt.Coll}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		err := store.Save(&model.RequestPayload{RequestID: 7, CreatedAt: createdAt, RequestBody: []byte("hello")})
+		assert.NoError(mt, err)
+
+		started := mt.GetStartedEvent()
+		assert.Equal(mt, "update", started.CommandName)
+		update := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("upsert").Boolean())
+		assert.Equal(mt, int64(7), update.Lookup("q", "_id").AsInt64())
+		_, body := update.Lookup("u", "request_body").Binary()
+		assert.Equal(mt, []byte("hello"), body)
+	})
+
+	mt.Run("find decodes payloads", func(mt *mtest.T) {
+		store := &service.MongoPayloadStore{Collection: mt.Coll}
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: int64(7)},
+			{Key: "created_at", Value: createdAt},
+			{Key: "request_headers", Value: bson.D{{Key: "Accept", Value: bson.A{"*/*"}}}},
+			{Key: "response_body", Value: []byte("ok")},
+		}))
+
+		payloads, err := store.Find([]uint{7, 8})
+		assert.NoError(mt, err)
+		if assert.Len(mt, payloads, 1) {
+			assert.Equal(mt, uint(7), payloads[0].RequestID)
+			assert.True(mt, createdAt.Equal(payloads[0].CreatedAt))
+			assert.Equal(mt, model.Headers{"Accept": {"*/*"}}, payloads[0].RequestHeaders)
+			assert.Equal(mt, []byte("ok"), payloads[0].ResponseBody)
+		}
+		assert.Equal(mt, "find", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("delete by ids and by creation time", func(mt *mtest.T) {
+		store := &service.MongoPayloadStore{Collection: mt.Coll}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		assert.NoError(mt, store.Delete([]uint{7, 8}))
+		started := mt.GetStartedEvent()
+		assert.Equal(mt, "delete", started.CommandName)
+		ids := started.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", "_id", "$in").Array()
+		values, err := ids.Values()
+		assert.NoError(mt, err)
+		assert.Len(mt, values, 2)
+
+		assert.NoError(mt, store.DeleteBefore(createdAt))
+		started = mt.GetStartedEvent()
+		before := started.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", "created_at", "$lt").Time()
+		assert.True(mt, createdAt.Equal(before))
+
+		assert.NoError(mt, store.Delete(nil)) // nothing is sent
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const _INGESTION_KEY_PREFIX = "trbp_"
+
+var projectSlugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+type IProjectService interface {
+	app.ProjectResolver
+	app.ProjectAuthorizer
+	// List returns the projects a user or api key can read, the default project first
+	List(user *model.User, apiKey *model.ApiKey) ([]model.Project, error)
+	Get(id uint) (*model.Project, error)
+	// Create stores a new project and returns its ingestion key, the key can't be read again afterwards
+	Create(actor string, project *model.Project) (string, error)
+	Update(actor string, project *model.Project) error
+	RotateIngestionKey(actor string, id uint) (string, error)
+	ListMembers(id uint) ([]model.User, error)
+	AddMember(actor string, id, userID uint) error
+	RemoveMember(actor string, id, userID uint) error
+}
+
+// ProjectService keeps the projects traffic is split into. Proxied requests are sent to a project by its
+// ingestion key or by its slug as the first path segment, everything else goes to the default project
+type ProjectService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Config   app.RuntimeConfig // Config holds the upstream of the default project
+	Requests RequestStore      // Requests holds the traffic of the default project new slugs would take over
+	AuditSrv IAuditService
+
+	mu       sync.RWMutex
+	loaded   bool
+	projects []model.Project
+}
+
+func NewProjectService() IProjectService {
+	var service *ProjectService
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, config app.RuntimeConfig, requests RequestStore, auditSrv IAuditService) {
+		service = &ProjectService{
+			Db:       db,
+			Logger:   logger,
+			Config:   config,
+			Requests: requests,
+			AuditSrv: auditSrv,
+		}
+	})
+
+	return service
+}
+
+// NewProjectResolver exposes the project service to the proxy
+func NewProjectResolver() app.ProjectResolver {
+	var resolver app.ProjectResolver
+	app.Invoke(func(service IProjectService) {
+		resolver = service
+	})
+	return resolver
+}
+
+// NewProjectAuthorizer exposes the project service to the http server
+func NewProjectAuthorizer() app.ProjectAuthorizer {
+	var authorizer app.ProjectAuthorizer
+	app.Invoke(func(service IProjectService) {
+		authorizer = service
+	})
+	return authorizer
+}
+
+func (s *ProjectService) defaultProject() model.Project {
+	return model.Project{ID: model.DefaultProjectID, Name: "Default", UpstreamUrl: runtimeConfig(s.Config).UpstreamUrl}
+}
+
+func (s *ProjectService) ResolveProject(req *http.Request) (*model.Project, string, error) {
+	projects, err := s.cachedProjects()
+	if err != nil {
+		return nil, "", err
+	}
+
+	reqPath := strings.TrimPrefix(req.URL.Path, "/proxy")
+	slug, rest, _ := strings.Cut(strings.TrimPrefix(reqPath, "/"), "/")
+	var byKey, bySlug *model.Project
+	key := req.Header.Get(model.ProjectKeyHeader)
+	keyHash := hashApiKey(key)
+	for i := range projects {
+		if key != "" && projects[i].IngestionKeyHash == keyHash {
+			byKey = &projects[i]
+		}
+		if projects[i].Slug == slug {
+			bySlug = &projects[i]
+		}
+	}
+
+	switch {
+	case key != "" && byKey == nil:
+		return nil, "", cerror.ErrInvalidIngestionKey
+	case byKey != nil && byKey != bySlug:
+		// the key selects the project, the whole path is sent to its upstream
+		return byKey, reqPath, nil
+	case bySlug != nil:
+		return bySlug, "/" + rest, nil
+	}
+	return nil, reqPath, nil
+}
+
+func (s *ProjectService) CanAccessProject(user *model.User, apiKey *model.ApiKey, projectID uint) (bool, error) {
+	if projectID != model.DefaultProjectID {
+		if _, err := s.Get(projectID); err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case apiKey != nil:
+		return apiKey.ProjectID == projectID, nil
+	case user == nil:
+		return false, nil
+	case user.Role == model.RoleAdmin, projectID == model.DefaultProjectID:
+		return true, nil
+	}
+
+	var count int64
+	err := s.Db.Model(&model.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, user.ID).Count(&count).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to read project members, error = %v", err)
+		return false, err
+	}
+	return count != 0, nil
+}
+
+func (s *ProjectService) List(user *model.User, apiKey *model.ApiKey) ([]model.Project, error) {
+	query := s.Db.Order("name asc").Order("id asc")
+	switch {
+	case apiKey != nil:
+		query = query.Where("id = ?", apiKey.ProjectID)
+	case user == nil:
+		return nil, nil
+	case user.Role != model.RoleAdmin:
+		query = query.Where("id IN (?)", s.Db.Model(&model.ProjectMember{}).Select("project_id").Where("user_id = ?", user.ID))
+	}
+
+	var projects []model.Project
+	if err := query.Find(&projects).Error; err != nil {
+		s.Logger.Errorf("Failed to list projects, error = %v", err)
+		return nil, err
+	}
+	if apiKey == nil || apiKey.ProjectID == model.DefaultProjectID {
+		projects = append([]model.Project{s.defaultProject()}, projects...)
+	}
+	return projects, nil
+}
+
+func (s *ProjectService) Get(id uint) (*model.Project, error) {
+	if id == model.DefaultProjectID {
+		project := s.defaultProject()
+		return &project, nil
+	}
+
+	var project model.Project
+	if err := s.Db.First(&project, id).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (s *ProjectService) Create(actor string, project *model.Project) (string, error) {
+	if err := s.prepareProject(project); err != nil {
+		return "", err
+	}
+	if err := s.checkSlugTraffic(project.Slug); err != nil {
+		return "", err
+	}
+
+	project.ID = 0
+	key, err := newIngestionKey(project)
+	if err != nil {
+		s.Logger.Errorf("Failed to generate ingestion key, error = %v", err)
+		return "", err
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(project).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditProjectCreated, model.AuditTarget("project", project.ID), nil, project)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create project, error = %v", err)
+		return "", err
+	}
+	s.invalidate()
+	return key, nil
+}
+
+func (s *ProjectService) Update(actor string, project *model.Project) error {
+	if project.ID == model.DefaultProjectID {
+		// the default project is configured by PROXY_URL
+		return gorm.ErrRecordNotFound
+	}
+	if err := s.prepareProject(project); err != nil {
+		return err
+	}
+
+	existing, err := s.Get(project.ID)
+	if err != nil {
+		return err
+	}
+	if project.Slug != existing.Slug {
+		if err := s.checkSlugTraffic(project.Slug); err != nil {
+			return err
+		}
+	}
+	project.IngestionKeyPrefix = existing.IngestionKeyPrefix
+	project.IngestionKeyHash = existing.IngestionKeyHash
+	project.CreatedAt = existing.CreatedAt
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(project).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditProjectUpdated, model.AuditTarget("project", project.ID), existing, project)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to update project, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *ProjectService) RotateIngestionKey(actor string, id uint) (string, error) {
+	if id == model.DefaultProjectID {
+		return "", gorm.ErrRecordNotFound
+	}
+	project, err := s.Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	before := *project
+	key, err := newIngestionKey(project)
+	if err != nil {
+		s.Logger.Errorf("Failed to generate ingestion key, error = %v", err)
+		return "", err
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(project).Updates(map[string]any{
+			"ingestion_key_prefix": project.IngestionKeyPrefix,
+			"ingestion_key_hash":   project.IngestionKeyHash,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditProjectKeyRotated, model.AuditTarget("project", project.ID), before, project)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to rotate ingestion key, error = %v", err)
+		return "", err
+	}
+	s.invalidate()
+	return key, nil
+}
+
+func (s *ProjectService) ListMembers(id uint) ([]model.User, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	var users []model.User
+	err := s.Db.Where("id IN (?)", s.Db.Model(&model.ProjectMember{}).Select("user_id").Where("project_id = ?", id)).
+		Order("email asc").Find(&users).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to list project members, error = %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *ProjectService) AddMember(actor string, id, userID uint) error {
+	if id == model.DefaultProjectID {
+		// every user is a member of the default project
+		return gorm.ErrRecordNotFound
+	}
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := s.Db.First(&model.User{}, userID).Error; err != nil {
+		return err
+	}
+
+	member := model.ProjectMember{ProjectID: id, UserID: userID}
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member)
+		if rez.Error != nil || rez.RowsAffected == 0 {
+			return rez.Error
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditProjectMemberAdded, model.AuditTarget("project", id), nil, member)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to add project member, error = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *ProjectService) RemoveMember(actor string, id, userID uint) error {
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.Where("project_id = ? AND user_id = ?", id, userID).Delete(&model.ProjectMember{})
+		if rez.Error != nil {
+			s.Logger.Errorf("Failed to remove project member, error = %v", rez.Error)
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		member := model.ProjectMember{ProjectID: id, UserID: userID}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditProjectMemberRemoved, model.AuditTarget("project", id), member, nil)
+	})
+}
+
+// prepareProject validates the project and checks its slug is free
+func (s *ProjectService) prepareProject(project *model.Project) error {
+	project.Name = strings.TrimSpace(project.Name)
+	project.Slug = strings.ToLower(strings.TrimSpace(project.Slug))
+	if !projectSlugRegex.MatchString(project.Slug) {
+		return cerror.ErrBadProjectSlug
+	}
+	upstream, err := url.Parse(project.UpstreamUrl)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return cerror.ErrBadTargetUrl
+	}
+
+	var count int64
+	err = s.Db.Model(&model.Project{}).Where("slug = ? AND id <> ?", project.Slug, project.ID).Count(&count).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to read projects, error = %v", err)
+		return err
+	}
+	if count != 0 {
+		return cerror.ErrProjectSlugTaken
+	}
+	return nil
+}
+
+// checkSlugTraffic rejects a slug that is the first path segment of requests to the default project,
+// the slug wins when resolving the project so those routes would be sent to the new project
+func (s *ProjectService) checkSlugTraffic(slug string) error {
+	defaultID := model.DefaultProjectID
+	for _, filter := range []RequestFilter{
+		{ProjectID: &defaultID, Paths: []string{"/" + slug}},
+		{ProjectID: &defaultID, PathPrefix: "/" + slug + "/"},
+	} {
+		_, total, err := s.Requests.List(filter, RequestPage{Limit: 1})
+		if err != nil {
+			s.Logger.Errorf("Failed to read requests of the default project, error = %v", err)
+			return err
+		}
+		if total > 0 {
+			return cerror.ErrProjectSlugRouted
+		}
+	}
+	return nil
+}
+
+func (s *ProjectService) cachedProjects() ([]model.Project, error) {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		return s.projects, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		var projects []model.Project
+		if err := s.Db.Find(&projects).Error; err != nil {
+			s.Logger.Errorf("Failed to load projects, error = %v", err)
+			return nil, err
+		}
+		s.projects = projects
+		s.loaded = true
+	}
+	return s.projects, nil
+}
+
+// invalidate drops the cached projects so they are reloaded on the next proxied request
+func (s *ProjectService) invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.projects = nil
+	s.mu.Unlock()
+}
+
+// newIngestionKey sets a new ingestion key on project and returns it
+func newIngestionKey(project *model.Project) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := _INGESTION_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(secret)
+
+	project.IngestionKeyPrefix = key[:len(_INGESTION_KEY_PREFIX)+8]
+	project.IngestionKeyHash = hashApiKey(key)
+	return key, nil
+}
@@ -0,0 +1,281 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+	"treblle/util/ws"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- Project Service Test Suite ---
+type ProjectServiceTestSuite struct {
+	suite.Suite
+	db             *gorm.DB
+	projectService service.IProjectService
+	crudService    service.IRequestCrudService
+	billing        model.Project
+	billingKey     string
+	shop           model.Project
+}
+
+func (suite *ProjectServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:project_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.Violation{}, &model.Project{}, &model.ProjectMember{}, &model.User{}))
+	suite.db = db
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	suite.projectService = &service.ProjectService{Db: db, Logger: zap.NewNop().Sugar(), Config: model.RuntimeConfig{UpstreamUrl: "http://default.local"},
+		Requests: service.NewSQLRequestStore(db)}
+	suite.crudService = service.NewRequestCrudService()
+
+	suite.billing = model.Project{Name: "Billing", Slug: "billing", UpstreamUrl: "http://billing.local"}
+	suite.billingKey, err = suite.projectService.Create(testActor, &suite.billing)
+	suite.Require().NoError(err)
+	suite.shop = model.Project{Name: "Shop", Slug: "shop", UpstreamUrl: "http://shop.local"}
+	_, err = suite.projectService.Create(testActor, &suite.shop)
+	suite.Require().NoError(err)
+}
+
+func (suite *ProjectServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestProjectServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ProjectServiceTestSuite))
+}
+
+// seedRequests stores the same traffic in the default, billing and shop projects
+func (suite *ProjectServiceTestSuite) seedRequests(createdAt time.Time) {
+	for _, project := range []model.Project{{ID: model.DefaultProjectID, Slug: "default"}, suite.billing, suite.shop} {
+		requests := []model.Request{
+			{ProjectID: project.ID, Method: "GET", Path: "/" + project.Slug, Consumer: "alice", Response: 200, CreatedAt: createdAt},
+			{ProjectID: project.ID, Method: "GET", Path: "/" + project.Slug, Consumer: "alice", Response: 500, CreatedAt: createdAt},
+		}
+		suite.Require().NoError(suite.db.Create(&requests).Error)
+		violation := model.Violation{RequestID: requests[1].ID, ProjectID: project.ID, Kind: model.ViolationBadParameter, Method: "GET", Endpoint: "/" + project.Slug}
+		suite.Require().NoError(suite.db.Create(&violation).Error)
+	}
+}
+
+// --- Test Cases ---
+
+func (suite *ProjectServiceTestSuite) TestCreate_Validates() {
+	_, err := suite.projectService.Create(testActor, &model.Project{Name: "Bad", Slug: "Not a slug", UpstreamUrl: "http://x.local"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadProjectSlug)
+
+	_, err = suite.projectService.Create(testActor, &model.Project{Name: "Bad", Slug: "bad", UpstreamUrl: "ftp://x.local"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadTargetUrl)
+
+	_, err = suite.projectService.Create(testActor, &model.Project{Name: "Billing again", Slug: "Billing", UpstreamUrl: "http://x.local"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrProjectSlugTaken)
+
+	assert.True(suite.T(), strings.HasPrefix(suite.billingKey, "trbp_"))
+	assert.Equal(suite.T(), suite.billingKey[:13], suite.billing.IngestionKeyPrefix)
+	assert.NotContains(suite.T(), suite.billing.IngestionKeyHash, suite.billingKey)
+}
+
+func (suite *ProjectServiceTestSuite) TestCreate_RejectsSlugOfDefaultTraffic() {
+	requests := []model.Request{
+		{ProjectID: model.DefaultProjectID, Method: "GET", Path: "/orders/7", CreatedAt: time.Now()},
+		{ProjectID: model.DefaultProjectID, Method: "GET", Path: "/health", CreatedAt: time.Now()},
+		{ProjectID: suite.shop.ID, Method: "GET", Path: "/users", CreatedAt: time.Now()},
+	}
+	suite.Require().NoError(suite.db.Create(&requests).Error)
+
+	// the slug would take over /proxy/orders/... and /proxy/health from the default project
+	for _, slug := range []string{"orders", "health"} {
+		_, err := suite.projectService.Create(testActor, &model.Project{Name: slug, Slug: slug, UpstreamUrl: "http://x.local"})
+		assert.ErrorIs(suite.T(), err, cerror.ErrProjectSlugRouted)
+	}
+	suite.billing.Slug = "orders"
+	assert.ErrorIs(suite.T(), suite.projectService.Update(testActor, &suite.billing), cerror.ErrProjectSlugRouted)
+
+	// paths that only start the same way and traffic of other projects don't clash
+	for _, slug := range []string{"order", "users"} {
+		_, err := suite.projectService.Create(testActor, &model.Project{Name: slug, Slug: slug, UpstreamUrl: "http://x.local"})
+		assert.NoError(suite.T(), err)
+	}
+}
+
+func (suite *ProjectServiceTestSuite) TestResolveProject() {
+	resolve := func(path, key string) (*model.Project, string, error) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set(model.ProjectKeyHeader, key)
+		}
+		return suite.projectService.ResolveProject(req)
+	}
+
+	project, path, err := resolve("/proxy/billing/invoices", "")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.billing.ID, project.ID)
+	assert.Equal(suite.T(), "/invoices", path)
+
+	project, path, err = resolve("/proxy/invoices", suite.billingKey)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.billing.ID, project.ID)
+	assert.Equal(suite.T(), "/invoices", path)
+
+	// the key wins over a slug of another project
+	project, path, err = resolve("/proxy/shop/invoices", suite.billingKey)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.billing.ID, project.ID)
+	assert.Equal(suite.T(), "/shop/invoices", path)
+
+	project, path, err = resolve("/proxy/users/1", "")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), project)
+	assert.Equal(suite.T(), "/users/1", path)
+
+	_, _, err = resolve("/proxy/billing/invoices", "trbp_wrong")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidIngestionKey)
+
+	// a rotated key stops working right away
+	newKey, err := suite.projectService.RotateIngestionKey(testActor, suite.billing.ID)
+	suite.Require().NoError(err)
+	_, _, err = resolve("/proxy/invoices", suite.billingKey)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidIngestionKey)
+	project, _, err = resolve("/proxy/invoices", newKey)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.billing.ID, project.ID)
+}
+
+func (suite *ProjectServiceTestSuite) TestCanAccessProject() {
+	admin := &model.User{ID: 1, Role: model.RoleAdmin}
+	member := &model.User{ID: 2, Role: model.RoleViewer}
+	outsider := &model.User{ID: 3, Role: model.RoleViewer}
+	suite.Require().NoError(suite.db.Create(&model.User{ID: member.ID, Email: "member@example.com", Role: member.Role}).Error)
+	suite.Require().NoError(suite.projectService.AddMember(testActor, suite.billing.ID, member.ID))
+
+	tests := []struct {
+		name      string
+		user      *model.User
+		apiKey    *model.ApiKey
+		projectID uint
+		allowed   bool
+	}{
+		{"admin", admin, nil, suite.shop.ID, true},
+		{"member", member, nil, suite.billing.ID, true},
+		{"not a member", member, nil, suite.shop.ID, false},
+		{"outsider", outsider, nil, suite.billing.ID, false},
+		{"default project", outsider, nil, model.DefaultProjectID, true},
+		{"api key of the project", nil, &model.ApiKey{ProjectID: suite.billing.ID}, suite.billing.ID, true},
+		{"api key of another project", nil, &model.ApiKey{ProjectID: suite.billing.ID}, suite.shop.ID, false},
+		{"default api key", nil, &model.ApiKey{}, suite.billing.ID, false},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			allowed, err := suite.projectService.CanAccessProject(tt.user, tt.apiKey, tt.projectID)
+			suite.Require().NoError(err)
+			assert.Equal(suite.T(), tt.allowed, allowed)
+		})
+	}
+
+	_, err := suite.projectService.CanAccessProject(admin, nil, 999)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	projects, err := suite.projectService.List(member, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(projects, 2)
+	assert.Equal(suite.T(), model.DefaultProjectID, projects[0].ID)
+	assert.Equal(suite.T(), suite.billing.ID, projects[1].ID)
+
+	suite.Require().NoError(suite.projectService.RemoveMember(testActor, suite.billing.ID, member.ID))
+	allowed, err := suite.projectService.CanAccessProject(member, nil, suite.billing.ID)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), allowed)
+}
+
+func (suite *ProjectServiceTestSuite) TestQueries_DontLeakAcrossProjects() {
+	suite.seedRequests(time.Now())
+
+	for _, project := range []model.Project{{ID: model.DefaultProjectID, Slug: "default"}, suite.billing, suite.shop} {
+		requests, total, err := suite.crudService.List(service.ListRequestsParams{ProjectID: &project.ID})
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), int64(2), total)
+		for _, request := range requests {
+			assert.Equal(suite.T(), project.ID, request.ProjectID)
+		}
+
+		stats, err := suite.crudService.GetStatistics(project.ID, nil, nil)
+		suite.Require().NoError(err)
+		suite.Require().Len(stats.StatsPerPath, 1)
+		assert.Equal(suite.T(), "/"+project.Slug, stats.StatsPerPath[0].Path)
+		suite.Require().Len(stats.ViolationsPerEndpoint, 1)
+		assert.Equal(suite.T(), "/"+project.Slug, stats.ViolationsPerEndpoint[0].Endpoint)
+
+		stats, err = suite.crudService.GetConsumerStatistics(project.ID, "alice", nil, nil)
+		suite.Require().NoError(err)
+		suite.Require().Len(stats.StatsPerPath, 1)
+		assert.Equal(suite.T(), int64(2), stats.StatsPerPath[0].RequestCount)
+		assert.Len(suite.T(), stats.ViolationsPerEndpoint, 1)
+
+		consumers, err := suite.crudService.TopConsumers(service.TopConsumersParams{ProjectID: project.ID})
+		suite.Require().NoError(err)
+		suite.Require().Len(consumers, 1)
+		assert.Equal(suite.T(), int64(2), consumers[0].RequestCount)
+	}
+
+	// internal callers can still read every project
+	_, total, err := suite.crudService.List(service.ListRequestsParams{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(6), total)
+}
+
+func (suite *ProjectServiceTestSuite) TestLobby_StreamsOnlyItsProject() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ws.NewClient(&service.NewLobby(suite.billing.ID, nil).Hub, conn)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var state dto.RequestStatistics
+	suite.Require().NoError(conn.ReadJSON(&state)) // initial empty state
+	suite.seedRequests(time.Now())
+
+	suite.Require().NoError(conn.WriteJSON(service.ChartMessage{Action: "refresh"}))
+	suite.Require().NoError(conn.ReadJSON(&state))
+	suite.Require().Len(state.RequestsPerPath, 1)
+	assert.Equal(suite.T(), "/billing", state.RequestsPerPath[0].Path)
+	assert.Equal(suite.T(), int64(2), state.RequestCount)
+}
+
+func TestProjectFromContext(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+	assert.Equal(t, model.DefaultProjectID, app.ProjectIDFrom(req.Context()))
+
+	ctx := app.WithProject(req.Context(), &model.Project{ID: 3})
+	assert.Equal(t, uint(3), app.ProjectIDFrom(ctx))
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// _DEFAULT_API_KEY_HEADER holds the client api key when no header is configured
+const _DEFAULT_API_KEY_HEADER = "X-Api-Key"
+
+type IRateLimitService interface {
+	app.RateLimiter
+	ListRules() ([]model.RateLimitRule, error)
+	GetRule(id uint) (*model.RateLimitRule, error)
+	CreateRule(actor string, rule *model.RateLimitRule) error
+	UpdateRule(actor string, rule *model.RateLimitRule) error
+	DeleteRule(actor string, id uint) error
+}
+
+// RateLimitService limits proxied requests with the most specific rule covering them,
+// routes without a rule use the default limit
+type RateLimitService struct {
+	Db        *gorm.DB
+	Requests  RequestStore // Requests holds the proxied requests, rejected ones are marked in it
+	Logger    *zap.SugaredLogger
+	Store     RateLimitStore
+	Default   model.RateLimitRule // Default applies to routes without a rule, a zero Limit disables it
+	KeyHeader string              // KeyHeader holds the client api key
+	Now       func() time.Time
+	AuditSrv  IAuditService
+
+	mu     sync.RWMutex
+	loaded bool
+	rules  []model.RateLimitRule
+}
+
+func NewRateLimitService() IRateLimitService {
+	var service *RateLimitService
+
+	app.Invoke(func(db *gorm.DB, requests RequestStore, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &RateLimitService{
+			Db:       db,
+			Requests: requests,
+			Logger:   logger,
+			Store:    NewMemoryRateLimitStore(),
+			Default: model.RateLimitRule{
+				Path:      "/",
+				Enabled:   app.RateLimit > 0,
+				Algorithm: model.RateLimitTokenBucket,
+				Key:       model.RateLimitByIP,
+				Limit:     app.RateLimit,
+				Window:    time.Duration(app.RateLimitWindow) * time.Second,
+			},
+			KeyHeader: app.RateLimitKeyHeader,
+			Now:       time.Now,
+			AuditSrv:  auditSrv,
+		}
+
+		if app.RateLimitAlgorithm != "" {
+			service.Default.Algorithm = model.RateLimitAlgorithm(app.RateLimitAlgorithm)
+		}
+		if app.RateLimitKey != "" {
+			service.Default.Key = model.RateLimitKey(app.RateLimitKey)
+		}
+		if service.KeyHeader == "" {
+			service.KeyHeader = _DEFAULT_API_KEY_HEADER
+		}
+		if service.Default.Enabled {
+			if err := prepareRule(&service.Default); err != nil {
+				logger.Fatalf("Bad default rate limit, error = %v", err)
+			}
+		}
+	})
+
+	return service
+}
+
+// NewRateLimiter exposes the rate limit service to the proxy
+func NewRateLimiter() app.RateLimiter {
+	var limiter app.RateLimiter
+	app.Invoke(func(service IRateLimitService) {
+		limiter = service
+	})
+	return limiter
+}
+
+// Limit counts the request against the quota of its client, requests over the quota get a 429 response
+func (s *RateLimitService) Limit(req *http.Request, logged *model.Request) (http.Header, *http.Response, error) {
+	rule, err := s.rule(logged.Method, normalizePath(logged.Path))
+	if err != nil {
+		return nil, nil, err
+	}
+	if rule == nil || !rule.Enabled {
+		return nil, nil, nil
+	}
+
+	key := s.key(rule, req, logged)
+	var rez RateLimitResult
+	switch rule.Algorithm {
+	case model.RateLimitSlidingWindow:
+		rez, err = s.Store.SlidingWindow(key, rule.Limit, rule.Window, s.Now())
+	default:
+		rez, err = s.Store.TokenBucket(key, rule.Limit, rule.Window, s.Now())
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to check rate limit of %s, error = %v", key, err)
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	header.Set("RateLimit-Limit", strconv.Itoa(rez.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(rez.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(rez.Reset)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, seconds(rule.Window)))
+	if rez.Allowed {
+		return header, nil, nil
+	}
+
+	// rejected requests are kept apart from requests the upstream answered
+	if err := s.Requests.SetSource(logged.ID, model.SourceRateLimit); err != nil {
+		s.Logger.Errorf("Failed to mark request as rate limited, error = %v", err)
+		return nil, nil, err
+	}
+	logged.Source = model.SourceRateLimit
+
+	retryAfter := strconv.Itoa(max(seconds(rez.RetryAfter), 1))
+	body, err := json.Marshal(map[string]string{"error": "rate limit exceeded, retry after " + retryAfter + "s"})
+	if err != nil {
+		return nil, nil, err
+	}
+	respHeader := header.Clone()
+	respHeader.Set("Retry-After", retryAfter)
+	respHeader.Set("Content-Type", "application/json")
+	return header, localResponse(http.StatusTooManyRequests, respHeader, body), nil
+}
+
+// key returns the store key of the quota the request counts against
+func (s *RateLimitService) key(rule *model.RateLimitRule, req *http.Request, logged *model.Request) string {
+	scope := "rule:" + strconv.FormatUint(uint64(rule.ID), 10)
+	if rule.ID == 0 {
+		scope = "default"
+	}
+	// every project has its own quotas, even for the same route or client
+	scope = "project:" + strconv.FormatUint(uint64(logged.ProjectID), 10) + ":" + scope
+
+	switch rule.Key {
+	case model.RateLimitByRoute:
+		if rule.ID == 0 {
+			// the default rule covers every route, each one gets its own quota
+			return scope + ":route:" + logged.Method + " " + normalizePath(logged.Path)
+		}
+		return scope + ":route"
+	case model.RateLimitByApiKey:
+		if apiKey := strings.TrimSpace(req.Header.Get(s.KeyHeader)); apiKey != "" {
+			return scope + ":key:" + apiKey
+		}
+	}
+	return scope + ":ip:" + clientIP(req)
+}
+
+// rule returns the most specific rule covering the request, the default rule if there is none
+func (s *RateLimitService) rule(method, reqPath string) (*model.RateLimitRule, error) {
+	rules, err := s.cachedRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.RateLimitRule
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Covers(method, reqPath) {
+			continue
+		}
+		if best == nil || len(rule.Path) > len(best.Path) ||
+			(len(rule.Path) == len(best.Path) && best.Method == "" && rule.Method != "") {
+			best = rule
+		}
+	}
+	if best == nil {
+		return &s.Default, nil
+	}
+	return best, nil
+}
+
+func (s *RateLimitService) cachedRules() ([]model.RateLimitRule, error) {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		return s.rules, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		var rules []model.RateLimitRule
+		if err := s.Db.Find(&rules).Error; err != nil {
+			s.Logger.Errorf("Failed to load rate limit rules, error = %v", err)
+			return nil, err
+		}
+		s.rules = rules
+		s.loaded = true
+	}
+	return s.rules, nil
+}
+
+// invalidate drops the cached rules so they are reloaded on the next request
+func (s *RateLimitService) invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.rules = nil
+	s.mu.Unlock()
+}
+
+func (s *RateLimitService) ListRules() ([]model.RateLimitRule, error) {
+	var rules []model.RateLimitRule
+	if err := s.Db.Order("path asc").Order("method asc").Find(&rules).Error; err != nil {
+		s.Logger.Errorf("Failed to list rate limit rules, error = %v", err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *RateLimitService) GetRule(id uint) (*model.RateLimitRule, error) {
+	var rule model.RateLimitRule
+	if err := s.Db.First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *RateLimitService) CreateRule(actor string, rule *model.RateLimitRule) error {
+	if err := prepareRule(rule); err != nil {
+		return err
+	}
+	rule.ID = 0
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditRateLimitCreated, model.AuditTarget("rate_limit", rule.ID), nil, rule)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create rate limit rule, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *RateLimitService) UpdateRule(actor string, rule *model.RateLimitRule) error {
+	if err := prepareRule(rule); err != nil {
+		return err
+	}
+
+	var existing model.RateLimitRule
+	if err := s.Db.First(&existing, rule.ID).Error; err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditRateLimitUpdated, model.AuditTarget("rate_limit", rule.ID), existing, rule)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to update rate limit rule, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *RateLimitService) DeleteRule(actor string, id uint) error {
+	var existing model.RateLimitRule
+	if err := s.Db.First(&existing, id).Error; err != nil {
+		return err
+	}
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.Delete(&model.RateLimitRule{}, id)
+		if rez.Error != nil {
+			s.Logger.Errorf("Failed to delete rate limit rule, error = %v", rez.Error)
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditRateLimitDeleted, model.AuditTarget("rate_limit", id), existing, nil)
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// prepareRule validates the rule and normalizes its method and path,
+// disabled rules only exempt their routes so they don't need a limit
+func prepareRule(rule *model.RateLimitRule) error {
+	rule.Method = strings.ToUpper(strings.TrimSpace(rule.Method))
+	rule.Path = normalizePath(rule.Path)
+	if !rule.Enabled {
+		return nil
+	}
+
+	if !rule.Algorithm.IsValid() {
+		return cerror.ErrUnknownRateLimitAlgorithm
+	}
+	if !rule.Key.IsValid() {
+		return cerror.ErrUnknownRateLimitKey
+	}
+	if rule.Limit <= 0 || rule.Window <= 0 {
+		return cerror.ErrBadRateLimitRule
+	}
+	return nil
+}
+
+// clientIP returns the ip of the connection the request came from
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// _RATE_LIMIT_SWEEP_PERIOD is how often the memory store drops idle keys
+const _RATE_LIMIT_SWEEP_PERIOD = time.Minute
+
+// RateLimitResult is the state of a quota after a request was counted against it
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // Remaining is the number of requests still allowed right now
+	Reset      time.Duration // Reset is the time until the whole quota is available again
+	RetryAfter time.Duration // RetryAfter is the time until the next request is allowed, 0 if allowed
+}
+
+// RateLimitStore keeps the limiter state. Each call checks and updates the state of key atomically,
+// so a shared store (e.g. redis with scripts) can enforce one quota for several proxy instances
+type RateLimitStore interface {
+	TokenBucket(key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error)
+	SlidingWindow(key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // full is when the bucket is refilled, the key is idle after it
+}
+
+type slidingWindow struct {
+	start    time.Time // start of the current window
+	current  int
+	previous int
+	window   time.Duration
+}
+
+// MemoryRateLimitStore keeps the limiter state of a single proxy instance in memory
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	windows   map[string]*slidingWindow
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: map[string]*tokenBucket{},
+		windows: map[string]*slidingWindow{},
+	}
+}
+
+func (s *MemoryRateLimitStore) TokenBucket(key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	// tokens refilled per nanosecond
+	rate := float64(limit) / float64(window)
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit), last: now}
+		s.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(float64(limit), bucket.tokens+float64(elapsed)*rate)
+		bucket.last = now
+	}
+
+	rez := RateLimitResult{Limit: limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		rez.Allowed = true
+	} else {
+		rez.RetryAfter = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+	rez.Remaining = int(bucket.tokens)
+	rez.Reset = time.Duration(math.Ceil((float64(limit) - bucket.tokens) / rate))
+	bucket.full = now.Add(rez.Reset)
+	return rez, nil
+}
+
+func (s *MemoryRateLimitStore) SlidingWindow(key string, limit int, window time.Duration, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	start := now.Truncate(window)
+	state, ok := s.windows[key]
+	switch {
+	case !ok:
+		state = &slidingWindow{start: start, window: window}
+		s.windows[key] = state
+	case state.start.Equal(start):
+	case state.start.Add(window).Equal(start):
+		state.start, state.previous, state.current = start, state.current, 0
+	default:
+		state.start, state.previous, state.current = start, 0, 0
+	}
+	state.window = window
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimated := float64(state.previous)*weight + float64(state.current)
+
+	rez := RateLimitResult{Limit: limit}
+	if estimated+1 <= float64(limit) {
+		state.current++
+		rez.Allowed = true
+		rez.Remaining = max(int(float64(limit)-estimated-1), 0)
+	}
+
+	// requests of the current window keep counting until the end of the next one
+	switch {
+	case state.current > 0:
+		rez.Reset = 2*window - elapsed
+	case state.previous > 0:
+		rez.Reset = window - elapsed
+	}
+	if rez.Allowed {
+		return rez, nil
+	}
+
+	if state.current+1 > limit {
+		// even without the previous window the current one is full
+		rez.RetryAfter = window - elapsed
+	} else {
+		// wait until the weight of the previous window makes room for one more request
+		free := (float64(limit-state.current-1) / float64(state.previous))
+		rez.RetryAfter = time.Duration(math.Ceil((1-free)*float64(window))) - elapsed
+	}
+	return rez, nil
+}
+
+// sweep drops keys whose quota is fully available again, so idle clients don't use memory
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < _RATE_LIMIT_SWEEP_PERIOD {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, state := range s.windows {
+		if !now.Before(state.start.Add(2 * state.window)) {
+			delete(s.windows, key)
+		}
+	}
+}
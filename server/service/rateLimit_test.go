@@ -0,0 +1,279 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMemoryRateLimitStore_TokenBucket(t *testing.T) {
+	store := service.NewMemoryRateLimitStore()
+	now := time.Unix(1700000000, 0)
+
+	// a burst of the whole limit is allowed
+	for i := range 3 {
+		rez, err := store.TokenBucket("a", 3, 3*time.Second, now)
+		assert.NoError(t, err)
+		assert.True(t, rez.Allowed)
+		assert.Equal(t, 2-i, rez.Remaining)
+	}
+
+	rez, err := store.TokenBucket("a", 3, 3*time.Second, now)
+	assert.NoError(t, err)
+	assert.False(t, rez.Allowed)
+	assert.Equal(t, time.Second, rez.RetryAfter)
+	assert.Equal(t, 3*time.Second, rez.Reset)
+
+	// other keys have their own bucket
+	rez, _ = store.TokenBucket("b", 3, 3*time.Second, now)
+	assert.True(t, rez.Allowed)
+
+	// one token is refilled per second
+	rez, _ = store.TokenBucket("a", 3, 3*time.Second, now.Add(time.Second))
+	assert.True(t, rez.Allowed)
+	assert.Equal(t, 0, rez.Remaining)
+	rez, _ = store.TokenBucket("a", 3, 3*time.Second, now.Add(time.Second))
+	assert.False(t, rez.Allowed)
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	store := service.NewMemoryRateLimitStore()
+	start := time.Unix(1700000040, 0).Truncate(time.Minute)
+
+	for range 4 {
+		rez, err := store.SlidingWindow("a", 4, time.Minute, start.Add(10*time.Second))
+		assert.NoError(t, err)
+		assert.True(t, rez.Allowed)
+	}
+	rez, _ := store.SlidingWindow("a", 4, time.Minute, start.Add(20*time.Second))
+	assert.False(t, rez.Allowed)
+	assert.Equal(t, 40*time.Second, rez.RetryAfter)
+
+	// a quarter into the next window the previous one still counts for 3 requests
+	next := start.Add(time.Minute + 15*time.Second)
+	rez, _ = store.SlidingWindow("a", 4, time.Minute, next)
+	assert.True(t, rez.Allowed)
+	assert.Equal(t, 0, rez.Remaining)
+	rez, _ = store.SlidingWindow("a", 4, time.Minute, next)
+	assert.False(t, rez.Allowed)
+	assert.Equal(t, 15*time.Second, rez.RetryAfter)
+
+	rez, _ = store.SlidingWindow("a", 4, time.Minute, next.Add(15*time.Second))
+	assert.True(t, rez.Allowed)
+
+	// after a whole idle window everything is available again
+	rez, _ = store.SlidingWindow("a", 4, time.Minute, start.Add(3*time.Minute))
+	assert.True(t, rez.Allowed)
+	assert.Equal(t, 3, rez.Remaining)
+}
+
+// --- RateLimitService Test Suite ---
+type RateLimitServiceTestSuite struct {
+	suite.Suite
+	db           *gorm.DB
+	rateLimitSrv *service.RateLimitService
+	now          time.Time
+}
+
+func (suite *RateLimitServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:rate_limit_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.RateLimitRule{}, &model.Violation{}))
+
+	suite.db = db
+	suite.now = time.Unix(1700000000, 0)
+	suite.rateLimitSrv = &service.RateLimitService{
+		Db:       db,
+		Requests: service.NewSQLRequestStore(db),
+		Logger:   zap.NewNop().Sugar(),
+		Store:    service.NewMemoryRateLimitStore(),
+		Default: model.RateLimitRule{
+			Path:      "/",
+			Enabled:   true,
+			Algorithm: model.RateLimitTokenBucket,
+			Key:       model.RateLimitByIP,
+			Limit:     2,
+			Window:    time.Minute,
+		},
+		KeyHeader: "X-Api-Key",
+		Now:       func() time.Time { return suite.now },
+	}
+}
+
+func (suite *RateLimitServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestRateLimitServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitServiceTestSuite))
+}
+
+// limit logs a proxied request from ip and runs it through the limiter
+func (suite *RateLimitServiceTestSuite) limit(method, path, ip, apiKey string) (*model.Request, http.Header, *http.Response) {
+	return suite.limitIn(model.DefaultProjectID, method, path, ip, apiKey)
+}
+
+// limitIn logs a request proxied to the project and runs it through the limiter
+func (suite *RateLimitServiceTestSuite) limitIn(projectID uint, method, path, ip, apiKey string) (*model.Request, http.Header, *http.Response) {
+	req := httptest.NewRequest(method, "/proxy"+path, nil)
+	req.RemoteAddr = ip + ":41234"
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+
+	logged := &model.Request{}
+	suite.Require().NoError(logged.FromRequest(req))
+	logged.ProjectID = projectID
+	suite.Require().NoError(suite.db.Create(logged).Error)
+
+	header, resp, err := suite.rateLimitSrv.Limit(req, logged)
+	suite.Require().NoError(err)
+	return logged, header, resp
+}
+
+func (suite *RateLimitServiceTestSuite) allowed(method, path, ip, apiKey string) bool {
+	_, _, resp := suite.limit(method, path, ip, apiKey)
+	return resp == nil
+}
+
+// --- Test Cases ---
+
+func (suite *RateLimitServiceTestSuite) TestLimit_RejectsWithHeaders() {
+	_, header, resp := suite.limit("GET", "/users", "10.0.0.1", "")
+	suite.Require().Nil(resp)
+	assert.Equal(suite.T(), "2", header.Get("RateLimit-Limit"))
+	assert.Equal(suite.T(), "1", header.Get("RateLimit-Remaining"))
+	assert.Equal(suite.T(), "30", header.Get("RateLimit-Reset"))
+	assert.Equal(suite.T(), "2;w=60", header.Get("RateLimit-Policy"))
+
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+	logged, _, resp := suite.limit("GET", "/orders", "10.0.0.1", "")
+	suite.Require().NotNil(resp)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(suite.T(), "30", resp.Header.Get("Retry-After"))
+	assert.Equal(suite.T(), "0", resp.Header.Get("RateLimit-Remaining"))
+
+	var stored model.Request
+	suite.Require().NoError(suite.db.First(&stored, logged.ID).Error)
+	assert.Equal(suite.T(), model.SourceRateLimit, stored.Source)
+
+	// other clients are not affected
+	suite.True(suite.allowed("GET", "/users", "10.0.0.2", ""))
+}
+
+func (suite *RateLimitServiceTestSuite) TestLimit_ByApiKey() {
+	suite.rateLimitSrv.Default.Key = model.RateLimitByApiKey
+
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", "key-a"))
+	suite.True(suite.allowed("GET", "/users", "10.0.0.2", "key-a"))
+	suite.False(suite.allowed("GET", "/users", "10.0.0.3", "key-a"))
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", "key-b"))
+
+	// requests without a key are limited by ip
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+	suite.False(suite.allowed("GET", "/users", "10.0.0.1", ""))
+}
+
+func (suite *RateLimitServiceTestSuite) TestLimit_RulesPerRoute() {
+	suite.Require().NoError(suite.rateLimitSrv.CreateRule(testActor, &model.RateLimitRule{
+		Path: "/search/", Enabled: true, Algorithm: model.RateLimitSlidingWindow, Key: model.RateLimitByRoute, Limit: 1, Window: time.Minute,
+	}))
+	suite.Require().NoError(suite.rateLimitSrv.CreateRule(testActor, &model.RateLimitRule{Path: "/health", Enabled: false}))
+
+	// the route quota is shared by every client
+	suite.True(suite.allowed("GET", "/search/users", "10.0.0.1", ""))
+	suite.False(suite.allowed("GET", "/search/orders", "10.0.0.2", ""))
+
+	// disabled rules exempt their paths from the default limit
+	for range 5 {
+		suite.True(suite.allowed("GET", "/health", "10.0.0.1", ""))
+	}
+
+	// the default limit is used outside the rules
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+	suite.False(suite.allowed("GET", "/users", "10.0.0.1", ""))
+
+	suite.now = suite.now.Add(time.Minute)
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", ""))
+}
+
+func (suite *RateLimitServiceTestSuite) TestLimit_QuotaPerProject() {
+	suite.rateLimitSrv.Default.Key = model.RateLimitByApiKey
+
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", "key-a"))
+	suite.True(suite.allowed("GET", "/users", "10.0.0.1", "key-a"))
+	suite.False(suite.allowed("GET", "/users", "10.0.0.1", "key-a"))
+
+	// the same client of another project has its own quota
+	_, _, resp := suite.limitIn(7, "GET", "/users", "10.0.0.1", "key-a")
+	suite.Nil(resp)
+}
+
+func (suite *RateLimitServiceTestSuite) TestLimit_DefaultDisabled() {
+	suite.rateLimitSrv.Default.Enabled = false
+	for range 5 {
+		_, header, resp := suite.limit("GET", "/users", "10.0.0.1", "")
+		suite.Nil(resp)
+		suite.Empty(header)
+	}
+}
+
+func (suite *RateLimitServiceTestSuite) TestRules_Validation() {
+	err := suite.rateLimitSrv.CreateRule(testActor, &model.RateLimitRule{Path: "/a", Enabled: true, Algorithm: "leaky", Key: model.RateLimitByIP, Limit: 1, Window: time.Second})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownRateLimitAlgorithm)
+	err = suite.rateLimitSrv.CreateRule(testActor, &model.RateLimitRule{Path: "/a", Enabled: true, Algorithm: model.RateLimitTokenBucket, Key: "user", Limit: 1, Window: time.Second})
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnknownRateLimitKey)
+	err = suite.rateLimitSrv.CreateRule(testActor, &model.RateLimitRule{Path: "/a", Enabled: true, Algorithm: model.RateLimitTokenBucket, Key: model.RateLimitByIP})
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadRateLimitRule)
+
+	rule := model.RateLimitRule{Method: " post", Path: "orders//", Enabled: true, Algorithm: model.RateLimitTokenBucket, Key: model.RateLimitByIP, Limit: 1, Window: time.Second}
+	suite.Require().NoError(suite.rateLimitSrv.CreateRule(testActor, &rule))
+	assert.Equal(suite.T(), "POST", rule.Method)
+	assert.Equal(suite.T(), "/orders", rule.Path)
+
+	assert.ErrorIs(suite.T(), suite.rateLimitSrv.DeleteRule(testActor, rule.ID+1), gorm.ErrRecordNotFound)
+	suite.Require().NoError(suite.rateLimitSrv.DeleteRule(testActor, rule.ID))
+}
+
+func (suite *RateLimitServiceTestSuite) TestStatistics_RateLimitedCount() {
+	for range 3 {
+		logged, _, resp := suite.limit("GET", "/users", "10.0.0.1", "")
+		status := http.StatusOK
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		suite.Require().NoError(suite.db.Model(logged).Update("response", status).Error)
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	stats, err := service.NewRequestCrudService().GetStatistics(model.DefaultProjectID, nil, nil)
+	suite.Require().NoError(err)
+
+	suite.Require().Len(stats.StatsPerPath, 1)
+	assert.Equal(suite.T(), int64(3), stats.StatsPerPath[0].RequestCount)
+	assert.Equal(suite.T(), int64(1), stats.StatsPerPath[0].ClientErrorCount)
+	assert.Equal(suite.T(), int64(1), stats.StatsPerPath[0].RateLimitedCount)
+}
@@ -0,0 +1,514 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	_REPLAY_BATCH_SIZE  = 100
+	_REPLAY_POLL_PERIOD = 30 * time.Second
+	_REPLAY_TIMEOUT     = 30 * time.Second
+	_REPLAY_STALE_AFTER = 5 * time.Minute // a running replay without progress for this long belongs to a dead process
+	_REPLAY_HEARTBEAT   = time.Minute     // a replay waiting for its next request is touched this often
+)
+
+// hopHeaders are connection specific and are not replayed
+var hopHeaders = []string{
+	"Host",
+	"Content-Length",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReplaySelection selects the recorded requests to replay, either by ids or by ListRequests filters
+type ReplaySelection struct {
+	ProjectID *uint   `json:"projectId,omitempty"` // ProjectID is the project of the replayed requests, nil is every project
+	IDs       []uint  `json:"ids,omitempty"`
+	Search    *string `json:"search,omitempty"`
+	Method    *string `json:"method,omitempty"`
+	Response  *int    `json:"response,omitempty"`
+	Source    *string `json:"source,omitempty"`
+	Limit     int     `json:"limit,omitempty"` // Limit is the max number of replayed requests, 0 is all
+}
+
+// params returns list parameters selecting the requests in the order they were recorded, by id so
+// the replay pages through them by the last replayed id. Requests the upstream never answered are
+// left out, there is no recorded response to compare to
+func (sel ReplaySelection) params() ListRequestsParams {
+	return ListRequestsParams{
+		ProjectID: sel.ProjectID,
+		IDs:       sel.IDs,
+		Search:    sel.Search,
+		Method:    sel.Method,
+		Response:  sel.Response,
+		Source:    sel.Source,
+		SortBy:    "id",
+		Order:     "asc",
+
+		ExcludeProxyErrors: true,
+	}
+}
+
+type IReplayService interface {
+	// Create creates a pending replay of requests of the project that the worker will pick up
+	Create(actor string, projectID uint, targetUrl string, selection ReplaySelection, preserveTiming bool, rateLimit float64) (*model.Replay, error)
+	// Get returns a replay of the project, replays of other projects are not found
+	Get(projectID, id uint) (*model.Replay, error)
+	List(projectID uint) ([]model.Replay, error)
+	// Results returns a page of the results of a replay of the project and the total count, onlyDiffs filters out matching results
+	Results(projectID uint, id uint, onlyDiffs bool, limit, offset int) ([]model.ReplayResult, int64, error)
+	// Run replays the requests until all are sent or ctx is done
+	Run(ctx context.Context, replay *model.Replay) error
+	// Worker processes unfinished replays in the background
+	Worker() app.Worker
+}
+
+type ReplayService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	CrudSrv  IRequestCrudService
+	Client   *http.Client
+	Config   app.RuntimeConfig // Config holds the capture limit, the number of compared body bytes
+	AuditSrv IAuditService
+	wake     chan struct{}
+}
+
+func NewReplayService() IReplayService {
+	var service *ReplayService
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, crudSrv IRequestCrudService, config app.RuntimeConfig, auditSrv IAuditService) {
+		service = &ReplayService{
+			Db:       db,
+			Logger:   logger,
+			CrudSrv:  crudSrv,
+			Client:   &http.Client{Timeout: _REPLAY_TIMEOUT},
+			Config:   config,
+			AuditSrv: auditSrv,
+			wake:     make(chan struct{}, 1),
+		}
+	})
+
+	return service
+}
+
+// NewReplayWorker creates the background worker running replays
+func NewReplayWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(service IReplayService) {
+		worker = service.Worker()
+	})
+	return worker
+}
+
+func (s *ReplayService) Create(actor string, projectID uint, targetUrl string, selection ReplaySelection, preserveTiming bool, rateLimit float64) (*model.Replay, error) {
+	target, err := url.Parse(targetUrl)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, cerror.ErrBadTargetUrl
+	}
+	if rateLimit < 0 {
+		return nil, cerror.ErrBadRateLimit
+	}
+
+	// only requests of the project of the replay are selected
+	selection.ProjectID = &projectID
+	params := selection.params()
+	params.Limit = 1
+	_, total, err := s.CrudSrv.List(params)
+	if err != nil {
+		return nil, err
+	}
+	if selection.Limit > 0 && int64(selection.Limit) < total {
+		total = int64(selection.Limit)
+	}
+
+	encoded, err := json.Marshal(selection)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := model.Replay{
+		ProjectID:      projectID,
+		TargetUrl:      strings.TrimSuffix(targetUrl, "/"),
+		Selection:      string(encoded),
+		PreserveTiming: preserveTiming,
+		RateLimit:      rateLimit,
+		Status:         model.ReplayPending,
+		Total:          total,
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&replay).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditReplayCreated, model.AuditTarget("replay", replay.ID), nil, replay)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create replay, error = %v", err)
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return &replay, nil
+}
+
+func (s *ReplayService) Get(projectID, id uint) (*model.Replay, error) {
+	var replay model.Replay
+	if err := s.Db.Where("project_id = ?", projectID).First(&replay, id).Error; err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func (s *ReplayService) List(projectID uint) ([]model.Replay, error) {
+	var replays []model.Replay
+	if err := s.Db.Where("project_id = ?", projectID).Order("id desc").Find(&replays).Error; err != nil {
+		s.Logger.Errorf("Failed to list replays, error = %v", err)
+		return nil, err
+	}
+	return replays, nil
+}
+
+func (s *ReplayService) Results(projectID uint, id uint, onlyDiffs bool, limit, offset int) ([]model.ReplayResult, int64, error) {
+	var results []model.ReplayResult
+	var total int64
+
+	// results belong to the project of their replay
+	if _, err := s.Get(projectID, id); err != nil {
+		return nil, 0, err
+	}
+	query := s.Db.Model(&model.ReplayResult{}).Where("replay_id = ?", id)
+	if onlyDiffs {
+		query = query.Where("status_match = ? OR (body_match = ? AND body_unknown = ?) OR error <> ''", false, false, false)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		s.Logger.Errorf("Failed to count replay results, error = %v", err)
+		return nil, 0, err
+	}
+
+	query = query.Order("id asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	if err := query.Find(&results).Error; err != nil {
+		s.Logger.Errorf("Failed to get replay results, error = %v", err)
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+func (s *ReplayService) Worker() app.Worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(_REPLAY_POLL_PERIOD)
+		defer ticker.Stop()
+
+		for {
+			s.runUnfinished(ctx)
+
+			select {
+			case <-ctx.Done():
+				s.Logger.Infof("Stopped replay worker")
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// runUnfinished runs all pending and interrupted replays in creation order
+func (s *ReplayService) runUnfinished(ctx context.Context) {
+	var replays []model.Replay
+	err := s.Db.
+		Where("status IN ?", []model.ReplayStatus{model.ReplayPending, model.ReplayRunning}).
+		Order("id asc").
+		Find(&replays).Error
+	if err != nil {
+		s.Logger.Errorf("Failed to read unfinished replays, error = %v", err)
+		return
+	}
+
+	for i := range replays {
+		if ctx.Err() != nil {
+			return
+		}
+		err := s.Run(ctx, &replays[i])
+		if errors.Is(err, cerror.ErrReplayClaimed) {
+			s.Logger.Debugf("Replay %d is running in another process", replays[i].ID)
+			continue
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.Logger.Errorf("Replay %d failed, error = %v", replays[i].ID, err)
+		}
+	}
+}
+
+func (s *ReplayService) Run(ctx context.Context, replay *model.Replay) error {
+	if replay.IsFinished() {
+		return nil
+	}
+
+	var selection ReplaySelection
+	if err := json.Unmarshal([]byte(replay.Selection), &selection); err != nil {
+		return s.fail(replay, err)
+	}
+
+	if err := s.claim(replay); err != nil {
+		return err
+	}
+	// results are saved in the order of the requests, a resumed replay continues after the last one
+	var lastID uint
+	err := s.Db.Model(&model.ReplayResult{}).Where("replay_id = ?", replay.ID).Select("coalesce(max(request_id), 0)").Scan(&lastID).Error
+	if err != nil {
+		return s.fail(replay, err)
+	}
+
+	var interval time.Duration
+	if replay.RateLimit > 0 {
+		interval = time.Duration(float64(time.Second) / replay.RateLimit)
+	}
+	start := time.Now()
+	var firstRecorded, lastSent time.Time
+
+	// requests are read in pages so no database cursor is held open while waiting on the target
+	params := selection.params()
+	for replay.Processed < replay.Total {
+		params.AfterID = lastID
+		params.Limit = int(min(_REPLAY_BATCH_SIZE, replay.Total-replay.Processed))
+		requests, _, err := s.CrudSrv.List(params)
+		if err != nil {
+			return s.fail(replay, err)
+		}
+		if len(requests) == 0 {
+			// requests were deleted since the replay was created
+			break
+		}
+		if err := s.CrudSrv.LoadPayloads(requests); err != nil {
+			return s.fail(replay, err)
+		}
+
+		for i := range requests {
+			request := &requests[i]
+
+			// wait until the request is due by the original timing and the rate limit
+			var wait time.Duration
+			if replay.PreserveTiming {
+				if firstRecorded.IsZero() {
+					firstRecorded = request.CreatedAt
+				}
+				wait = time.Until(start.Add(request.CreatedAt.Sub(firstRecorded)))
+			}
+			if interval > 0 && !lastSent.IsZero() {
+				wait = max(wait, time.Until(lastSent.Add(interval)))
+			}
+			if err := s.wait(ctx, replay, wait); err != nil {
+				// leave the replay running so it is resumed on next start
+				return err
+			}
+			lastSent = time.Now()
+
+			result := s.replayOne(ctx, replay, request)
+			if ctx.Err() != nil {
+				// the request was cut short by the shutdown, it is replayed again on next start
+				return ctx.Err()
+			}
+			if err := s.saveResult(replay, &result); err != nil {
+				return s.fail(replay, err)
+			}
+			lastID = request.ID
+		}
+	}
+
+	now := time.Now()
+	replay.Status = model.ReplayCompleted
+	replay.FinishedAt = &now
+	if err := s.Db.Save(replay).Error; err != nil {
+		return err
+	}
+	s.Logger.Infof("Finished replay %d, status diffs %d, body diffs %d, errors %d", replay.ID, replay.StatusDiffs, replay.BodyDiffs, replay.Errors)
+	return nil
+}
+
+// claim marks the replay running for this process and reloads its progress.
+// Only pending replays and running replays left by a dead process can be claimed,
+// so two servers never send the requests of the same replay at once.
+func (s *ReplayService) claim(replay *model.Replay) error {
+	now := time.Now()
+	rez := s.Db.Model(&model.Replay{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))",
+			replay.ID, model.ReplayPending, model.ReplayRunning, now.Add(-_REPLAY_STALE_AFTER)).
+		Updates(map[string]any{"status": model.ReplayRunning, "updated_at": now})
+	if rez.Error != nil {
+		s.Logger.Errorf("Failed to claim replay %d, error = %v", replay.ID, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return cerror.ErrReplayClaimed
+	}
+	return s.Db.First(replay, replay.ID).Error
+}
+
+// wait sleeps until the next request is due, a long wait touches the replay so it isn't taken for abandoned
+func (s *ReplayService) wait(ctx context.Context, replay *model.Replay, d time.Duration) error {
+	for d > _REPLAY_HEARTBEAT {
+		if err := sleep(ctx, _REPLAY_HEARTBEAT); err != nil {
+			return err
+		}
+		d -= _REPLAY_HEARTBEAT
+		if err := s.Db.Model(replay).Update("updated_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+	return sleep(ctx, d)
+}
+
+// replayOne sends a single recorded request to the target and compares the response
+func (s *ReplayService) replayOne(ctx context.Context, replay *model.Replay, request *model.Request) model.ReplayResult {
+	result := model.ReplayResult{
+		ReplayID:         replay.ID,
+		RequestID:        request.ID,
+		Method:           request.Method,
+		Path:             request.Path,
+		OriginalStatus:   request.Response,
+		OriginalLatency:  request.Latency,
+		OriginalBodyHash: bodyHash(request.ResponseBody),
+	}
+
+	targetUrl := replay.TargetUrl + request.Path
+	if request.Query != "" {
+		targetUrl += "?" + request.Query
+	}
+	req, err := http.NewRequestWithContext(ctx, request.Method, targetUrl, bytes.NewReader(request.RequestBody))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header = replayHeaders(request.RequestHeaders)
+
+	sent := time.Now()
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		result.ReplayLatency = time.Since(sent)
+		return result
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if limit := runtimeConfig(s.Config).CaptureBodyLimit; limit > 0 {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, int64(limit)))
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	result.ReplayLatency = time.Since(sent)
+	result.ReplayStatus = resp.StatusCode
+	result.ReplayBodyHash = bodyHash(body)
+	result.StatusMatch = result.OriginalStatus == result.ReplayStatus
+	// a missing or cut recording doesn't tell what the whole body was
+	if len(request.ResponseBody) == 0 || request.ResponseTruncated {
+		result.BodyUnknown = true
+	} else {
+		result.BodyMatch = result.OriginalBodyHash == result.ReplayBodyHash
+	}
+
+	return result
+}
+
+// saveResult stores the result and the replay progress in the same transaction
+func (s *ReplayService) saveResult(replay *model.Replay, result *model.ReplayResult) error {
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(result).Error; err != nil {
+			return err
+		}
+
+		replay.Processed++
+		switch {
+		case result.Error != "":
+			replay.Errors++
+		default:
+			if !result.StatusMatch {
+				replay.StatusDiffs++
+			}
+			if !result.BodyMatch && !result.BodyUnknown {
+				replay.BodyDiffs++
+			}
+		}
+		return tx.Save(replay).Error
+	})
+}
+
+func (s *ReplayService) fail(replay *model.Replay, cause error) error {
+	now := time.Now()
+	replay.Status = model.ReplayFailed
+	replay.Error = cause.Error()
+	replay.FinishedAt = &now
+	if err := s.Db.Save(replay).Error; err != nil {
+		s.Logger.Errorf("Failed to save replay %d, error = %v", replay.ID, err)
+	}
+	return cause
+}
+
+// replayHeaders returns the recorded headers without hop by hop and redacted headers
+func replayHeaders(headers model.Headers) http.Header {
+	rez := headers.Http()
+	for _, name := range hopHeaders {
+		rez.Del(name)
+	}
+	for name, values := range rez {
+		if len(values) == 1 && values[0] == model.RedactedValue {
+			rez.Del(name)
+		}
+	}
+	return rez
+}
+
+func bodyHash(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
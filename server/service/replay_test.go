@@ -0,0 +1,357 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- ReplayService Test Suite ---
+type ReplayServiceTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	replaySrv *service.ReplayService
+	upstream  *httptest.Server
+
+	mu       sync.Mutex
+	received []*http.Request
+	bodies   []string
+}
+
+func (suite *ReplayServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:replay_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.Replay{}, &model.ReplayResult{}))
+	suite.db = db
+
+	suite.received = nil
+	suite.bodies = nil
+	suite.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		suite.mu.Lock()
+		suite.received = append(suite.received, r)
+		suite.bodies = append(suite.bodies, string(body))
+		suite.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/users":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`[{"id":1}]`))
+		case "/orders":
+			// staging returns a different body
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`[]`))
+		case "/slow":
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	logger := zap.NewNop().Sugar()
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return logger })
+	app.Provide(service.NewRequestStore)
+
+	suite.replaySrv = &service.ReplayService{
+		Db:      db,
+		Logger:  logger,
+		CrudSrv: service.NewRequestCrudService(),
+		Client:  suite.upstream.Client(),
+		Config:  model.RuntimeConfig{CaptureBodyLimit: 1024},
+	}
+}
+
+func (suite *ReplayServiceTestSuite) TearDownTest() {
+	suite.upstream.Close()
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestReplayServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplayServiceTestSuite))
+}
+
+func (suite *ReplayServiceTestSuite) seed(requests ...model.Request) {
+	suite.Require().NoError(suite.db.Create(&requests).Error)
+}
+
+// --- Test Cases ---
+
+func (suite *ReplayServiceTestSuite) TestRun_DiffsAgainstOriginal() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Query: "page=1", Response: 200, CreatedAt: now.Add(-3 * time.Second), Latency: 10 * time.Millisecond,
+			RequestHeaders: model.Headers{"Authorization": {model.RedactedValue}, "X-Trace": {"abc"}}, ResponseBody: []byte(`[{"id":1}]`)},
+		model.Request{Method: "POST", Path: "/orders", Response: 201, CreatedAt: now.Add(-2 * time.Second), Latency: 10 * time.Millisecond,
+			RequestBody: []byte(`{"item":1}`), ResponseBody: []byte(`[{"id":7}]`)},
+		model.Request{Method: "GET", Path: "/broken", Response: 200, CreatedAt: now.Add(-1 * time.Second)},
+	)
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL+"/", service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(3), replay.Total)
+	assert.Equal(suite.T(), suite.upstream.URL, replay.TargetUrl)
+
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+
+	assert.Equal(suite.T(), model.ReplayCompleted, replay.Status)
+	assert.Equal(suite.T(), int64(3), replay.Processed)
+	assert.Equal(suite.T(), int64(2), replay.StatusDiffs) // 201 -> 200 and 200 -> 500
+	assert.Equal(suite.T(), int64(1), replay.BodyDiffs)   // only /orders has a different captured body
+	assert.NotNil(suite.T(), replay.FinishedAt)
+
+	// requests are replayed in recorded order with path, query, headers and body
+	suite.Require().Len(suite.received, 3)
+	assert.Equal(suite.T(), "/users", suite.received[0].URL.Path)
+	assert.Equal(suite.T(), "page=1", suite.received[0].URL.RawQuery)
+	assert.Equal(suite.T(), "abc", suite.received[0].Header.Get("X-Trace"))
+	assert.Empty(suite.T(), suite.received[0].Header.Get("Authorization"))
+	assert.Equal(suite.T(), http.MethodPost, suite.received[1].Method)
+	assert.Equal(suite.T(), `{"item":1}`, suite.bodies[1])
+
+	results, total, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, false, 10, 0)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(3), total)
+	assert.True(suite.T(), results[0].StatusMatch)
+	assert.True(suite.T(), results[0].BodyMatch)
+	assert.Equal(suite.T(), 201, results[1].OriginalStatus)
+	assert.Equal(suite.T(), 200, results[1].ReplayStatus)
+	assert.False(suite.T(), results[1].BodyMatch)
+	assert.NotEqual(suite.T(), results[1].OriginalBodyHash, results[1].ReplayBodyHash)
+
+	diffs, total, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, true, 10, 0)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+	assert.Len(suite.T(), diffs, 2)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_SkipsBodiesNotRecorded() {
+	now := time.Now()
+	suite.seed(
+		// the recording was cut, the replayed body starts the same but may differ after the cut
+		model.Request{Method: "GET", Path: "/orders", Response: 200, CreatedAt: now, ResponseBody: []byte(`[`), ResponseTruncated: true},
+		// nothing was captured
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now},
+	)
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+	assert.Zero(suite.T(), replay.BodyDiffs)
+
+	results, _, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, false, 10, 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 2)
+	for _, result := range results {
+		assert.True(suite.T(), result.BodyUnknown, result.Path)
+		assert.False(suite.T(), result.BodyMatch, result.Path)
+
+		var ret dto.ReplayResultDto
+		ret.FromModel(result)
+		assert.Nil(suite.T(), ret.BodyMatch)
+	}
+
+	diffs, _, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, true, 10, 0)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), diffs)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_SelectionByIds() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now},
+		model.Request{Method: "GET", Path: "/orders", Response: 200, CreatedAt: now},
+	)
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{IDs: []uint{2}}, false, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+
+	assert.Equal(suite.T(), int64(1), replay.Total)
+	suite.Require().Len(suite.received, 1)
+	assert.Equal(suite.T(), "/orders", suite.received[0].URL.Path)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_ScopedToProject() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now},
+		model.Request{Method: "GET", Path: "/orders", Response: 200, CreatedAt: now, ProjectID: 7},
+	)
+
+	projectID := uint(7)
+	replay, err := suite.replaySrv.Create(testActor, projectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+
+	assert.Equal(suite.T(), int64(1), replay.Total)
+	suite.Require().Len(suite.received, 1)
+	assert.Equal(suite.T(), "/orders", suite.received[0].URL.Path)
+
+	// the replay and its results are only shown to the project of the replayed requests
+	_, err = suite.replaySrv.Get(model.DefaultProjectID, replay.ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	_, _, err = suite.replaySrv.Results(model.DefaultProjectID, replay.ID, false, 10, 0)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	replays, err := suite.replaySrv.List(model.DefaultProjectID)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), replays)
+
+	replays, err = suite.replaySrv.List(projectID)
+	suite.Require().NoError(err)
+	suite.Require().Len(replays, 1)
+	assert.Equal(suite.T(), projectID, replays[0].ProjectID)
+	results, total, err := suite.replaySrv.Results(projectID, replay.ID, false, 10, 0)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+	assert.Equal(suite.T(), uint(2), results[0].RequestID)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_SkipsProxyErrors() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now},
+		model.Request{Method: "GET", Path: "/orders", Response: 502, ProxyError: string(model.ProxyErrorConnectionRefused), CreatedAt: now},
+	)
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+
+	assert.Equal(suite.T(), int64(1), replay.Total)
+	suite.Require().Len(suite.received, 1)
+	assert.Equal(suite.T(), "/users", suite.received[0].URL.Path)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_PreservesTiming() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now.Add(-time.Hour)},
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now.Add(-time.Hour).Add(300 * time.Millisecond)},
+	)
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, true, 0)
+	suite.Require().NoError(err)
+
+	start := time.Now()
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+	assert.GreaterOrEqual(suite.T(), time.Since(start), 300*time.Millisecond)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_RateLimit() {
+	now := time.Now()
+	for i := range 3 {
+		suite.seed(model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	// 10 per second, 3 requests need at least two intervals
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 10)
+	suite.Require().NoError(err)
+
+	start := time.Now()
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+	assert.GreaterOrEqual(suite.T(), time.Since(start), 200*time.Millisecond)
+	assert.Len(suite.T(), suite.received, 3)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_UnreachableTarget() {
+	suite.seed(model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: time.Now()})
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, "http://127.0.0.1:1", service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+
+	assert.Equal(suite.T(), int64(1), replay.Errors)
+	results, _, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, true, 10, 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	assert.NotEmpty(suite.T(), results[0].Error)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_CanceledRecordsNoResult() {
+	suite.seed(model.Request{Method: "GET", Path: "/slow", Response: 200, CreatedAt: time.Now()})
+
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = suite.replaySrv.Run(ctx, replay)
+	assert.ErrorIs(suite.T(), err, context.DeadlineExceeded)
+
+	assert.Equal(suite.T(), model.ReplayRunning, replay.Status)
+	assert.Equal(suite.T(), int64(0), replay.Processed)
+	assert.Equal(suite.T(), int64(0), replay.Errors)
+	_, total, err := suite.replaySrv.Results(model.DefaultProjectID, replay.ID, false, 10, 0)
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), total)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_ClaimsReplay() {
+	suite.seed(model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: time.Now()})
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+
+	// another process is running it
+	suite.Require().NoError(suite.db.Model(replay).Update("status", model.ReplayRunning).Error)
+	err = suite.replaySrv.Run(context.Background(), replay)
+	assert.ErrorIs(suite.T(), err, cerror.ErrReplayClaimed)
+	assert.Empty(suite.T(), suite.received)
+
+	// the process died, the replay is taken over
+	suite.Require().NoError(suite.db.Model(&model.Replay{}).Where("id = ?", replay.ID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+	assert.Equal(suite.T(), model.ReplayCompleted, replay.Status)
+	assert.Len(suite.T(), suite.received, 1)
+}
+
+func (suite *ReplayServiceTestSuite) TestRun_ResumesAfterLastReplayedRequest() {
+	now := time.Now()
+	suite.seed(
+		model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: now},
+		model.Request{Method: "GET", Path: "/orders", Response: 200, CreatedAt: now},
+		model.Request{Method: "GET", Path: "/broken", Response: 500, CreatedAt: now},
+	)
+	replay, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, suite.upstream.URL, service.ReplaySelection{}, false, 0)
+	suite.Require().NoError(err)
+
+	// the first request was replayed before a restart and deleted by the retention since
+	suite.Require().NoError(suite.db.Create(&model.ReplayResult{ReplayID: replay.ID, RequestID: 1, Method: "GET", Path: "/users"}).Error)
+	suite.Require().NoError(suite.db.Model(replay).Updates(map[string]any{"status": model.ReplayRunning, "processed": 1}).Error)
+	suite.Require().NoError(suite.db.Model(&model.Replay{}).Where("id = ?", replay.ID).UpdateColumn("updated_at", now.Add(-time.Hour)).Error)
+	suite.Require().NoError(suite.db.Delete(&model.Request{}, 1).Error)
+
+	suite.Require().NoError(suite.replaySrv.Run(context.Background(), replay))
+	assert.Equal(suite.T(), int64(3), replay.Processed)
+	suite.Require().Len(suite.received, 2)
+	assert.Equal(suite.T(), "/orders", suite.received[0].URL.Path)
+	assert.Equal(suite.T(), "/broken", suite.received[1].URL.Path)
+}
+
+func (suite *ReplayServiceTestSuite) TestCreate_BadTarget() {
+	_, err := suite.replaySrv.Create(testActor, model.DefaultProjectID, "ftp://staging", service.ReplaySelection{}, false, 0)
+	assert.Error(suite.T(), err)
+}
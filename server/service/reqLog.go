@@ -1,66 +1,270 @@
 package service
 
 import (
+	"bytes"
+	"io"
 	"net/http"
+	"sync"
 	"time"
 	"treblle/app"
 	"treblle/model"
 
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 type ReqLogger struct {
-	Db     *gorm.DB
-	Logger *zap.SugaredLogger
+	Requests  RequestStore
+	Logger    *zap.SugaredLogger
+	Config    app.RuntimeConfig   // Config holds the body capture limit and the sample rate
+	Consumers *ConsumerIdentifier // Consumers names the client of each request, nil disables identification
+	Sink      RequestSink         // Sink receives the completed requests, nil if no analytics store is configured
+	Sampling  ISamplingService    // Sampling holds the per route sampling rules, nil samples every route at the runtime sample rate
 }
 
 func NewRequestLoggerService() app.RequestLogger {
 	var service *ReqLogger
 
-	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+	app.Invoke(func(requests RequestStore, logger *zap.SugaredLogger, config app.RuntimeConfig, sink *AnalyticsSink, sampling ISamplingService) {
+		consumers, err := NewConsumerIdentifier()
+		if err != nil {
+			logger.Fatalf("Bad consumer identification config, error = %v", err)
+		}
+
 		service = &ReqLogger{
-			Db:     db,
-			Logger: logger,
+			Requests:  requests,
+			Logger:    logger,
+			Config:    config,
+			Consumers: consumers,
+			Sampling:  sampling,
+		}
+		if sink != nil {
+			service.Sink = sink
 		}
 	})
 
 	return service
 }
 
+// LogRequest stores the request if it's sampled. Requests left out by sampling are returned without an id and not stored,
+// tail sampled requests are returned with their decision and stored with their response
 func (r *ReqLogger) LogRequest(req *http.Request) (*model.Request, error) {
+	config := runtimeConfig(r.Config)
 	var request model.Request
 	if err := request.FromRequest(req); err != nil {
 		r.Logger.Errorf("Failed logging request, error = %v", err)
 		return nil, err
 	}
+	request.ProjectID = app.ProjectIDFrom(req.Context())
+	if r.Consumers != nil {
+		consumer, source := r.Consumers.Identify(req)
+		request.Consumer, request.ConsumerSource = consumer, string(source)
+	}
+
+	body, truncated, err := captureBody(&req.Body, config.CaptureBodyLimit)
+	if err != nil {
+		r.Logger.Errorf("Failed capturing request body, error = %v", err)
+		return nil, err
+	}
+	request.RequestBody, request.RequestTruncated = body, truncated
 
-	rez := r.Db.Create(&request)
-	if rez.Error != nil {
-		r.Logger.Errorf("Failed logging request, error = %v", rez.Error)
-		return nil, rez.Error
+	rule := r.samplingRule(&request, config.SampleRate)
+	keep := sampled(rule, req)
+	if rule.Mode == model.SamplingTail {
+		request.Sample = &model.SampleDecision{Rule: rule, Sampled: keep}
+		return &request, nil
+	}
+	if !keep {
+		return &request, nil
+	}
+	request.SampleWeight = 1 / rule.Rate
+	if err := r.Requests.Create(&request); err != nil {
+		r.Logger.Errorf("Failed logging request, error = %v", err)
+		return nil, err
 	}
 
 	return &request, nil
 }
 
-func (r *ReqLogger) LogResponse(id uint, resp *http.Response) (*model.Request, error) {
-	var request model.Request
+// LogResponse adds the response to a logged request. Stored requests are updated, tail sampled requests are stored
+// if their rule keeps them or the rate sampled them, nothing is stored for requests left out by sampling.
+// A captured response body is read as it streams to the client, the request is then stored once resp.Body is closed
+func (r *ReqLogger) LogResponse(logged *model.Request, resp *http.Response) (*model.Request, error) {
+	request, err := r.pending(logged)
+	if request == nil || err != nil {
+		return nil, err
+	}
+	if !complete(request, resp.StatusCode) {
+		return nil, nil
+	}
+	request.ResponseHeaders = model.HeadersFrom(resp.Header)
+	zap.S().Debugf("req latency is: %v ", request.Latency.Milliseconds())
 
-	if rez := r.Db.First(&request, id); rez.Error != nil {
-		r.Logger.Errorf("Failed reading request, error = %v", rez.Error)
-		return nil, rez.Error
+	limit := runtimeConfig(r.Config).CaptureBodyLimit
+	if limit <= 0 || resp.Body == nil || resp.Body == http.NoBody {
+		if err := r.store(request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+
+	resp.Body = &bodyCapture{ReadCloser: resp.Body, limit: limit, done: func(body []byte, truncated bool) {
+		request.ResponseBody, request.ResponseTruncated = body, truncated
+		// the client already got the response, failing to store it is only logged
+		r.store(request)
+	}}
+	return request, nil
+}
+
+// LogError completes a logged request the upstream never answered with the kind of proxyErr and its synthetic status,
+// it's sampled and stored like a response
+func (r *ReqLogger) LogError(logged *model.Request, proxyErr error) (*model.Request, error) {
+	request, err := r.pending(logged)
+	if request == nil || err != nil {
+		return nil, err
+	}
+	kind := model.ProxyErrorOf(proxyErr)
+	request.ProxyError = string(kind)
+	if !complete(request, kind.Status()) {
+		return nil, nil
+	}
+
+	if err := r.store(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// pending returns the request a response completes, the stored one for stored requests,
+// nil for requests left out by sampling
+func (r *ReqLogger) pending(logged *model.Request) (*model.Request, error) {
+	switch {
+	case logged.ID != 0:
+		stored, err := r.Requests.Get(logged.ID)
+		if err != nil {
+			r.Logger.Errorf("Failed reading request, error = %v", err)
+			return nil, err
+		}
+		return stored, nil
+	case logged.Sample == nil:
+		return nil, nil
 	}
+	return logged, nil
+}
 
+// complete sets the response status and timing of request and reports if it's stored,
+// tail sampled requests are only stored if their rule keeps them or the rate sampled them
+func complete(request *model.Request, status int) bool {
 	request.ResponseTime = time.Now()
-	request.Response = resp.StatusCode
+	request.Response = status
 	request.Latency = request.ResponseTime.Sub(request.CreatedAt)
-	zap.S().Debugf("req latency is: %v ", request.Latency.Milliseconds())
+	if request.ID != 0 {
+		return true
+	}
 
-	if rez := r.Db.Save(&request); rez.Error != nil {
-		r.Logger.Errorf("Failed logging request, error = %v", rez.Error)
-		return nil, rez.Error
+	// kept requests stand for themselves, the rest of the sampled ones for the requests the rate left out
+	switch decision := request.Sample; {
+	case decision.Rule.Keeps(request):
+		request.SampleWeight = 1
+	case decision.Sampled:
+		request.SampleWeight = 1 / decision.Rule.Rate
+	default:
+		return false
 	}
+	return true
+}
 
-	return &request, nil
+// store creates or updates the completed request and passes it to the sink
+func (r *ReqLogger) store(request *model.Request) error {
+	var err error
+	if request.ID == 0 {
+		err = r.Requests.Create(request)
+	} else {
+		err = r.Requests.Save(request)
+	}
+	if err != nil {
+		r.Logger.Errorf("Failed logging request, error = %v", err)
+		return err
+	}
+	if r.Sink != nil {
+		r.Sink.Record(request)
+	}
+	return nil
+}
+
+// samplingRule returns the rule request is sampled by, routes without a rule are head sampled at rate.
+// Rules that can't be loaded don't fail the request, the route falls back to rate
+func (r *ReqLogger) samplingRule(request *model.Request, rate float64) *model.SamplingRule {
+	if r.Sampling != nil {
+		rule, err := r.Sampling.Rule(request.ProjectID, request.Method, normalizePath(request.Path))
+		if err != nil {
+			r.Logger.Errorf("Failed to find sampling rule, error = %v", err)
+		}
+		if rule != nil {
+			return rule
+		}
+	}
+	return &model.SamplingRule{Path: "/", Rate: rate, Mode: model.SamplingHead}
+}
+
+// bodyCapture passes a body through while keeping its first limit bytes,
+// done is called with them once the body is closed
+type bodyCapture struct {
+	io.ReadCloser
+	limit     int
+	data      []byte
+	truncated bool // truncated is set once the body got past limit
+	once      sync.Once
+	done      func(data []byte, truncated bool)
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	room := b.limit - len(b.data)
+	if n > room {
+		b.truncated = true
+	}
+	if room > 0 && n > 0 {
+		b.data = append(b.data, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+func (b *bodyCapture) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if len(b.data) == 0 {
+			b.data = nil
+		}
+		b.done(b.data, b.truncated)
+	})
+	return err
+}
+
+// captureBody reads up to limit bytes from body and replaces it with a reader
+// that replays the read bytes followed by the rest of the original body,
+// truncated is set if the body is longer than limit
+func captureBody(body *io.ReadCloser, limit int) (data []byte, truncated bool, err error) {
+	if limit <= 0 || *body == nil || *body == http.NoBody {
+		return nil, false, nil
+	}
+
+	// one byte past the limit tells a cut body from one of exactly limit bytes
+	original := *body
+	read, err := io.ReadAll(io.LimitReader(original, int64(limit)+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	*body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(read), original), original}
+
+	if len(read) == 0 {
+		return nil, false, nil
+	}
+	if len(read) > limit {
+		return read[:limit:limit], true, nil
+	}
+	return read, false, nil
 }
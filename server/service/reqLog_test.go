@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 	"treblle/app"
@@ -59,8 +61,8 @@ func (suite *ReqLoggerTestSuite) SetupTest() {
 
 	// --- Service Initialization (Per Test) ---
 	suite.reqLogger = &service.ReqLogger{
-		Db:     db,
-		Logger: suite.logger,
+		Requests: service.NewSQLRequestStore(db),
+		Logger:   suite.logger,
 	}
 	suite.Require().NotNil(suite.reqLogger)
 }
@@ -125,7 +127,7 @@ func (suite *ReqLoggerTestSuite) TestLogResponse_Success() {
 	}
 
 	// Act
-	updatedReq, err := suite.reqLogger.LogResponse(initialID, mockResp)
+	updatedReq, err := suite.reqLogger.LogResponse(initialReq, mockResp)
 
 	// Assert
 	assert.NoError(suite.T(), err)
@@ -154,7 +156,7 @@ func (suite *ReqLoggerTestSuite) TestLogResponse_RequestNotFound() {
 	}
 
 	// Act
-	updatedReq, err := suite.reqLogger.LogResponse(nonExistentID, mockResp)
+	updatedReq, err := suite.reqLogger.LogResponse(&model.Request{ID: nonExistentID}, mockResp)
 
 	// Assert
 	assert.Error(suite.T(), err)
@@ -196,7 +198,7 @@ func (suite *ReqLoggerTestSuite) TestLogResponse_WithMockContext() {
 	}
 
 	// Act
-	updatedReq, err := suite.reqLogger.LogResponse(initialID, mockResp)
+	updatedReq, err := suite.reqLogger.LogResponse(initialReq, mockResp)
 
 	// Assert
 	assert.NoError(suite.T(), err)
@@ -210,3 +212,199 @@ func (suite *ReqLoggerTestSuite) TestLogResponse_WithMockContext() {
 	assert.NoError(suite.T(), result.Error)
 	assert.Equal(suite.T(), http.StatusOK, dbReq.Response)
 }
+
+func (suite *ReqLoggerTestSuite) TestLogRequestAndResponse_CapturesHeadersAndBodies() {
+	// Arrange
+	suite.reqLogger.(*service.ReqLogger).Config = model.RuntimeConfig{CaptureBodyLimit: 4, SampleRate: 1}
+	mockReq := httptest.NewRequest(http.MethodPost, "/proxy/api/items?page=1", strings.NewReader("abcdef"))
+	mockReq.Header.Set("Authorization", "Bearer secret")
+	mockReq.Header.Set("X-Trace", "1")
+
+	// Act
+	loggedReq, err := suite.reqLogger.LogRequest(mockReq)
+	suite.Require().NoError(err)
+
+	// The body must still be readable in full by the upstream
+	forwarded, err := io.ReadAll(mockReq.Body)
+	suite.Require().NoError(err)
+
+	mockResp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader("hello world")),
+		Request:    mockReq,
+	}
+	_, err = suite.reqLogger.LogResponse(loggedReq, mockResp)
+	suite.Require().NoError(err)
+	returned, err := io.ReadAll(mockResp.Body)
+	suite.Require().NoError(err)
+	suite.Require().NoError(mockResp.Body.Close())
+
+	// Assert
+	assert.Equal(suite.T(), "abcdef", string(forwarded))
+	assert.Equal(suite.T(), "hello world", string(returned))
+
+	var dbReq model.Request
+	suite.Require().NoError(suite.db.First(&dbReq, loggedReq.ID).Error)
+	assert.Equal(suite.T(), "/api/items", dbReq.Path)
+	assert.Equal(suite.T(), "page=1", dbReq.Query)
+	assert.Equal(suite.T(), "abcd", string(dbReq.RequestBody))
+	assert.True(suite.T(), dbReq.RequestTruncated)
+	assert.Equal(suite.T(), "hell", string(dbReq.ResponseBody))
+	assert.True(suite.T(), dbReq.ResponseTruncated)
+	assert.Equal(suite.T(), []string{"[REDACTED]"}, dbReq.RequestHeaders["Authorization"])
+	assert.Equal(suite.T(), []string{"1"}, dbReq.RequestHeaders["X-Trace"])
+	assert.Equal(suite.T(), []string{"text/plain"}, dbReq.ResponseHeaders["Content-Type"])
+}
+
+func (suite *ReqLoggerTestSuite) TestLogRequest_BodyAtLimitIsNotTruncated() {
+	suite.reqLogger.(*service.ReqLogger).Config = model.RuntimeConfig{CaptureBodyLimit: 4, SampleRate: 1}
+	req := httptest.NewRequest(http.MethodPost, "/proxy/items", strings.NewReader("abcd"))
+
+	logged, err := suite.reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+	forwarded, err := io.ReadAll(req.Body)
+	suite.Require().NoError(err)
+
+	assert.Equal(suite.T(), "abcd", string(forwarded))
+	assert.Equal(suite.T(), "abcd", string(logged.RequestBody))
+	assert.False(suite.T(), logged.RequestTruncated)
+}
+
+func (suite *ReqLoggerTestSuite) TestLogResponse_StreamsBody() {
+	suite.reqLogger.(*service.ReqLogger).Config = model.RuntimeConfig{CaptureBodyLimit: 1024, SampleRate: 1}
+	logged, err := suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/events", nil))
+	suite.Require().NoError(err)
+
+	// an event stream the upstream is still writing
+	reader, writer := io.Pipe()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/event-stream"}}, Body: reader}
+	_, err = suite.reqLogger.LogResponse(logged, resp)
+	suite.Require().NoError(err)
+
+	// every event reaches the client as soon as it's written
+	buf := make([]byte, 64)
+	for _, event := range []string{"data: 1\n\n", "data: 2\n\n"} {
+		go writer.Write([]byte(event))
+		n, err := resp.Body.Read(buf)
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), event, string(buf[:n]))
+	}
+	writer.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	suite.Require().NoError(err)
+	suite.Require().NoError(resp.Body.Close())
+
+	var stored model.Request
+	suite.Require().NoError(suite.db.First(&stored, logged.ID).Error)
+	assert.Equal(suite.T(), "data: 1\n\ndata: 2\n\n", string(stored.ResponseBody))
+	assert.False(suite.T(), stored.ResponseTruncated)
+}
+
+func (suite *ReqLoggerTestSuite) TestLogRequest_IdentifiesConsumer() {
+	suite.reqLogger = &service.ReqLogger{
+		Requests:  service.NewSQLRequestStore(suite.db),
+		Logger:    suite.logger,
+		Consumers: &service.ConsumerIdentifier{Sources: []model.ConsumerSource{model.ConsumerBasic, model.ConsumerIP}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+	req.SetBasicAuth("alice", "secret")
+	logged, err := suite.reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "alice", logged.Consumer)
+	assert.Equal(suite.T(), string(model.ConsumerBasic), logged.ConsumerSource)
+
+	logged, err = suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "192.0.2.1", logged.Consumer)
+	assert.Equal(suite.T(), string(model.ConsumerIP), logged.ConsumerSource)
+}
+
+func (suite *ReqLoggerTestSuite) TestLogRequest_SetsProject() {
+	req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+	req = req.WithContext(app.WithProject(req.Context(), &model.Project{ID: 7, Slug: "billing"}))
+	logged, err := suite.reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), uint(7), logged.ProjectID)
+
+	logged, err = suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.DefaultProjectID, logged.ProjectID)
+}
+
+func (suite *ReqLoggerTestSuite) TestLogRequest_Sampling() {
+	logger := suite.reqLogger.(*service.ReqLogger)
+	logger.Config = model.RuntimeConfig{SampleRate: 0}
+
+	logged, err := suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), logged.ID)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	updated, err := suite.reqLogger.LogResponse(logged, resp)
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), updated)
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&model.Request{}).Count(&count).Error)
+	assert.Zero(suite.T(), count)
+
+	logger.Config = model.RuntimeConfig{SampleRate: 1}
+	logged, err = suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	suite.Require().NoError(err)
+	assert.NotZero(suite.T(), logged.ID)
+}
+
+func (suite *ReqLoggerTestSuite) TestLogError_RecordsUpstreamFailures() {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	secure := httptest.NewTLSServer(http.NotFoundHandler())
+	defer secure.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		url        string
+		ctx        context.Context
+		wantKind   model.ProxyErrorKind
+		wantStatus int
+	}{
+		{"dns", "http://upstream.invalid/users", context.Background(), model.ProxyErrorDns, http.StatusBadGateway},
+		{"connection refused", closed.URL + "/users", context.Background(), model.ProxyErrorConnectionRefused, http.StatusBadGateway},
+		{"tls", secure.URL + "/users", context.Background(), model.ProxyErrorTls, http.StatusBadGateway},
+		{"timeout", slow.URL + "/users", context.Background(), model.ProxyErrorTimeout, http.StatusGatewayTimeout},
+		{"canceled", slow.URL + "/users", canceled, model.ProxyErrorCanceled, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			// the error the reverse proxy gets from its transport
+			transport := &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}
+			defer transport.CloseIdleConnections()
+			upstreamReq, err := http.NewRequestWithContext(tt.ctx, http.MethodGet, tt.url, nil)
+			suite.Require().NoError(err)
+			_, proxyErr := transport.RoundTrip(upstreamReq)
+			suite.Require().Error(proxyErr)
+
+			logged, err := suite.reqLogger.LogRequest(httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+			suite.Require().NoError(err)
+			failed, err := suite.reqLogger.LogError(logged, proxyErr)
+			suite.Require().NoError(err)
+			suite.Require().NotNil(failed)
+
+			var stored model.Request
+			suite.Require().NoError(suite.db.First(&stored, logged.ID).Error)
+			assert.Equal(suite.T(), string(tt.wantKind), stored.ProxyError, "error %v", proxyErr)
+			assert.Equal(suite.T(), tt.wantStatus, stored.Response)
+			assert.False(suite.T(), stored.ResponseTime.IsZero())
+			assert.Positive(suite.T(), stored.Latency)
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package service
 
 import (
-	"errors"
 	"sort"
 	"strings"
 	"time"
@@ -12,47 +11,87 @@ import (
 	"gorm.io/gorm"
 )
 
+// _STREAM_PAYLOAD_BATCH_SIZE is the number of streamed requests whose payloads are loaded at once
+const _STREAM_PAYLOAD_BATCH_SIZE = 100
+
 type ListRequestsParams struct {
-	Search   *string // Search term for 'path' field
-	Method   *string // Filter by method (e.g., "GET")
-	Response *int    // Filter by response code (e.g., 404)
+	ProjectID *uint   // Filter by project, nil is every project and only meant for internal use
+	IDs       []uint  // Filter by request ids
+	Search    *string // Search query, see ParseSearch
+	Method    *string // Filter by method (e.g., "GET")
+	Response  *int    // Filter by response code (e.g., 404)
+	Source    *string // Filter by source label (e.g., "proxy" or an import label)
+	Consumer  *string // Filter by consumer (e.g., an ip or a basic auth user)
+	StartTime *time.Time
+	EndTime   *time.Time
+	// ExcludeProxyErrors leaves out requests the upstream never answered, only meant for internal use
+	ExcludeProxyErrors bool
+	AfterID            uint // AfterID only selects requests with a bigger id, to page in id order
 
 	// Pagination
 	Limit  int
 	Offset int
 
 	// Sorting
-	SortBy string // "created_at" or "response_time" or "latency"
+	SortBy string // "created_at" or "response_time" or "latency" or "id"
 	Order  string // "asc" or "desc"
 }
 
-// Result struct specifically for the GORM Scan operation
-type pathStatsQueryResult struct {
-	Path             string
-	RequestCount     int64
-	AvgLatencyNanos  float64
-	ClientErrorCount int64
-	ServerErrorCount int64
+// TopConsumersParams selects the consumers returned by TopConsumers
+type TopConsumersParams struct {
+	ProjectID uint
+	StartTime *time.Time
+	EndTime   *time.Time
+	SortBy    string // "requests", "errors" or "latency"
+	Limit     int
+}
+
+type violationStatsQueryResult struct {
+	Method         string
+	Endpoint       string
+	Kind           model.ViolationKind
+	RequestCount   int64
+	ViolationCount int64
 }
 
 type RequestCrudService struct {
-	db     *gorm.DB
-	logger *zap.SugaredLogger
+	db       *gorm.DB
+	logger   *zap.SugaredLogger
+	requests RequestStore
+	// aggregates answers the statistics queries, the analytics store when it is configured for queries
+	aggregates RequestAggregator
 }
 
 type IRequestCrudService interface {
 	List(params ListRequestsParams) ([]model.Request, int64, error)
-	GetStatistics(startTime, endTime *time.Time) (*model.AllRequestStatistics, error)
+	Stream(params ListRequestsParams, fn func(*model.Request) error) error
+	// Get returns a request of a project with its captured headers and bodies
+	Get(projectID, id uint) (*model.Request, error)
+	// LoadPayloads sets the captured headers and bodies of listed requests, when they are stored apart
+	LoadPayloads(requests []model.Request) error
+	// GetStatistics returns the statistics of the requests of one project
+	GetStatistics(projectID uint, startTime, endTime *time.Time) (*model.AllRequestStatistics, error)
+	// GetConsumerStatistics returns the statistics of the requests of one consumer of a project
+	GetConsumerStatistics(projectID uint, consumer string, startTime, endTime *time.Time) (*model.AllRequestStatistics, error)
+	// GetFilteredStatistics returns the statistics of the requests matching params, sorting and pagination are ignored
+	GetFilteredStatistics(params ListRequestsParams) (*model.AllRequestStatistics, error)
+	// TopConsumers returns the consumers generating the most load, errors or latency
+	TopConsumers(params TopConsumersParams) ([]model.ConsumerStatistics, error)
 }
 
 // NewRequestCRUDService is your constructor from the snippet.
 func NewRequestCrudService() IRequestCrudService {
 	var service *RequestCrudService
 
-	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, requests RequestStore) {
 		service = &RequestCrudService{
-			db:     db,
-			logger: logger,
+			db:         db,
+			logger:     logger,
+			requests:   requests,
+			aggregates: requests,
+		}
+		if app.AnalyticsQueries {
+			service.aggregates = NewAnalyticsClient()
 		}
 	})
 
@@ -62,119 +101,139 @@ func NewRequestCrudService() IRequestCrudService {
 // List returns a paginated list of requests based on filter and search parameters.
 // It also returns the total count of records that match the query (before pagination).
 func (s *RequestCrudService) List(params ListRequestsParams) ([]model.Request, int64, error) {
-	var requests []model.Request
-	var total int64
-
-	query := s.db.Model(&model.Request{})
-
-	// --- Apply Search ---
-	if params.Search != nil && *params.Search != "" {
-		query = query.Where("path LIKE ?", "%"+*params.Search+"%")
-	}
-
-	if params.Method != nil && *params.Method != "" {
-		query = query.Where("method = ?", *params.Method)
+	filter, err := params.filter()
+	if err != nil {
+		return nil, 0, err
 	}
-	if params.Response != nil {
-		// Use a pointer to allow filtering for '0', though '0' is not a real HTTP status.
-		query = query.Where("response = ?", *params.Response)
+	requests, total, err := s.requests.List(filter, params.page())
+	if err != nil {
+		s.logger.Errorf("Failed to get requests: %v", err)
+		return nil, 0, err
 	}
+	return requests, total, nil
+}
 
-	// --- Get Total Count (before pagination) ---
-	// This is crucial for the UI to know how many pages there are.
-	err := query.Count(&total).Error
+// Stream calls fn for every request matching params in the same order as List, with the captured headers and bodies.
+// Rows are read one at a time so large result sets are never loaded into memory.
+func (s *RequestCrudService) Stream(params ListRequestsParams, fn func(*model.Request) error) error {
+	filter, err := params.filter()
 	if err != nil {
-		s.logger.Errorf("Failed to count requests: %v", err)
-		return nil, 0, err
+		return err
+	}
+	if _, ok := s.requests.(payloadLoader); !ok {
+		return s.requests.Stream(filter, params.page(), fn)
 	}
 
-	// --- Apply Sorting ---
-	if params.SortBy != "" {
-		order := "asc" // default order
-		if params.Order == "desc" {
-			order = "desc"
+	// payloads kept apart are loaded for a batch of requests at once
+	batch := make([]model.Request, 0, _STREAM_PAYLOAD_BATCH_SIZE)
+	flush := func() error {
+		if err := s.LoadPayloads(batch); err != nil {
+			return err
 		}
-
-		var column string
-		switch params.SortBy {
-		case "created_at":
-			column = "created_at"
-		case "response_time":
-			column = "response_time"
-		case "latency":
-			column = "latency"
-
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
 		}
-		query = query.Order(column + " " + order)
-	} else {
-		// Default sort if nothing is provided
-		query = query.Order("created_at desc")
+		batch = batch[:0]
+		return nil
 	}
-
-	// --- Apply Pagination ---
-	if params.Limit > 0 {
-		query = query.Limit(params.Limit)
-	}
-	if params.Offset > 0 {
-		query = query.Offset(params.Offset)
+	err = s.requests.Stream(filter, params.page(), func(request *model.Request) error {
+		batch = append(batch, *request)
+		if len(batch) < _STREAM_PAYLOAD_BATCH_SIZE {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
 	}
+	return flush()
+}
 
-	// --- Execute Query ---
-	err = query.Find(&requests).Error
+func (s *RequestCrudService) Get(projectID, id uint) (*model.Request, error) {
+	request, err := s.requests.Get(id)
 	if err != nil {
-		s.logger.Errorf("Failed to get requests from DB: %v", err)
-		return nil, 0, err
+		return nil, err
 	}
-
-	return requests, total, nil
+	if request.ProjectID != projectID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return request, nil
 }
-func (s *RequestCrudService) GetStatistics(startTime, endTime *time.Time) (*model.AllRequestStatistics, error) {
-	var results []pathStatsQueryResult // Use the intermediate struct for scanning
-	var allStats model.AllRequestStatistics
 
-	query := s.db.Model(&model.Request{})
+func (s *RequestCrudService) LoadPayloads(requests []model.Request) error {
+	return loadPayloads(s.requests, requests)
+}
 
-	// Apply time range filter if provided
-	if startTime != nil {
-		query = query.Where("created_at >= ?", *startTime)
+// filter returns the store filter of the filter and search parameters, an invalid search is reported with cerror.ErrBadSearch
+func (params ListRequestsParams) filter() (RequestFilter, error) {
+	filter := RequestFilter{
+		ProjectID: params.ProjectID,
+		IDs:       params.IDs,
+		Method:    params.Method,
+		Response:  params.Response,
+		Source:    params.Source,
+		StartTime: params.StartTime,
+		EndTime:   params.EndTime,
+
+		ExcludeProxyErrors: params.ExcludeProxyErrors,
+		AfterID:            params.AfterID,
 	}
-	if endTime != nil {
-		query = query.Where("created_at <= ?", *endTime)
+	if params.Consumer != nil && *params.Consumer != "" {
+		filter.Consumer = params.Consumer
 	}
+	if params.Search != nil {
+		query, err := ParseSearch(*params.Search)
+		if err != nil {
+			return filter, err
+		}
+		// a bare term is a path search, which the path index and the analytics store serve
+		if text, ok := query.pathSearch(); ok {
+			filter.Search = &text
+		} else if query != nil {
+			filter.Query = query
+		}
+	}
+	return filter, nil
+}
+
+// page returns the store page of the sorting and pagination parameters
+func (params ListRequestsParams) page() RequestPage {
+	return RequestPage{Limit: params.Limit, Offset: params.Offset, SortBy: params.SortBy, Order: params.Order}
+}
 
-	// Select path and aggregated statistics
-	// Using SUM with CASE WHEN (or equivalent) for conditional counting
-	query = query.Select(`
-		path,
-		count(*) as request_count,
-		avg(latency) as avg_latency_nanos,
-		sum(case when response >= 400 and response < 500 then 1 else 0 end) as client_error_count,
-		sum(case when response >= 500 then 1 else 0 end) as server_error_count
-	`).Group("path").Order("request_count desc") // Order by most frequent paths first
+func (s *RequestCrudService) GetStatistics(projectID uint, startTime, endTime *time.Time) (*model.AllRequestStatistics, error) {
+	return s.statistics(RequestFilter{ProjectID: &projectID, StartTime: startTime, EndTime: endTime})
+}
+
+func (s *RequestCrudService) GetConsumerStatistics(projectID uint, consumer string, startTime, endTime *time.Time) (*model.AllRequestStatistics, error) {
+	return s.statistics(RequestFilter{ProjectID: &projectID, Consumer: &consumer, StartTime: startTime, EndTime: endTime})
+}
 
-	err := query.Scan(&results).Error
+func (s *RequestCrudService) GetFilteredStatistics(params ListRequestsParams) (*model.AllRequestStatistics, error) {
+	filter, err := params.filter()
 	if err != nil {
-		// Handle potential "Scan error... converting NULL to float64" specifically if needed,
-		// though with counts, this is less likely than with just AVG.
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// No records found in the time range, return empty stats
-			return &allStats, nil // Return empty, not nil error
-		}
-		s.logger.Errorf("Failed to calculate statistics per path: %v", err)
 		return nil, err
 	}
+	return s.statistics(filter)
+}
 
-	// Convert intermediate results to the final structure
-	allStats.StatsPerPath = make([]model.PathStatistics, len(results))
-	for i, res := range results {
-		allStats.StatsPerPath[i] = model.PathStatistics{
-			Path:             res.Path,
-			RequestCount:     res.RequestCount,
-			AverageLatencyMs: res.AvgLatencyNanos / float64(time.Millisecond), // Convert ns to ms
-			ClientErrorCount: res.ClientErrorCount,
-			ServerErrorCount: res.ServerErrorCount,
-		}
+// statistics aggregates the requests matching filter
+func (s *RequestCrudService) statistics(filter RequestFilter) (*model.AllRequestStatistics, error) {
+	var allStats model.AllRequestStatistics
+
+	// the analytics store has no headers and bodies to search
+	aggregates := s.aggregates
+	if filter.Query != nil {
+		aggregates = s.requests
 	}
+	stats, err := aggregates.PathStatistics(filter)
+	if err != nil {
+		s.logger.Errorf("Failed to calculate statistics per path: %v", err)
+		return nil, err
+	}
+	allStats.StatsPerPath = stats
 
 	cleanedStatsMap := make(map[string]model.PathStatistics)
 	for _, pathStat := range allStats.StatsPerPath {
@@ -188,6 +247,8 @@ func (s *RequestCrudService) GetStatistics(startTime, endTime *time.Time) (*mode
 		existing.RequestCount += pathStat.RequestCount
 		existing.ClientErrorCount += pathStat.ClientErrorCount
 		existing.ServerErrorCount += pathStat.ServerErrorCount
+		existing.RateLimitedCount += pathStat.RateLimitedCount
+		existing.ProxyErrorCount += pathStat.ProxyErrorCount
 
 		// Calculate weighted average for latency
 		// Avoid division by zero if RequestCount is somehow 0
@@ -213,5 +274,109 @@ func (s *RequestCrudService) GetStatistics(startTime, endTime *time.Time) (*mode
 	})
 
 	allStats.StatsPerPath = cleanedSlice // Replace original slice with cleaned one
+
+	violations, err := s.violationStatistics(filter)
+	if err != nil {
+		return nil, err
+	}
+	allStats.ViolationsPerEndpoint = violations
 	return &allStats, nil
 }
+
+// violationStatistics aggregates api contract violations per spec endpoint of the requests matching filter,
+// the time range selects when the violations were found
+func (s *RequestCrudService) violationStatistics(filter RequestFilter) ([]model.EndpointViolations, error) {
+	violations := func(requests any) *gorm.DB {
+		query := s.db.Model(&model.Violation{})
+		if filter.ProjectID != nil {
+			query = query.Where("project_id = ?", *filter.ProjectID)
+		}
+		if requests != nil {
+			query = query.Where("request_id IN (?)", requests)
+		}
+		if filter.StartTime != nil {
+			query = query.Where("created_at >= ?", *filter.StartTime)
+		}
+		if filter.EndTime != nil {
+			query = query.Where("created_at <= ?", *filter.EndTime)
+		}
+		return query
+	}
+
+	var totals, kinds []violationStatsQueryResult
+	aggregate := func(requests any) error {
+		var batchTotals []violationStatsQueryResult
+		err := violations(requests).
+			Select("method, endpoint, count(distinct request_id) as request_count, count(*) as violation_count").
+			Group("method, endpoint").
+			Scan(&batchTotals).Error
+		if err != nil {
+			s.logger.Errorf("Failed to calculate violations per endpoint: %v", err)
+			return err
+		}
+
+		var batchKinds []violationStatsQueryResult
+		err = violations(requests).
+			Select("method, endpoint, kind, count(*) as violation_count").
+			Group("method, endpoint, kind").
+			Scan(&batchKinds).Error
+		if err != nil {
+			s.logger.Errorf("Failed to calculate violation kinds per endpoint: %v", err)
+			return err
+		}
+		totals = append(totals, batchTotals...)
+		kinds = append(kinds, batchKinds...)
+		return nil
+	}
+
+	// the violations carry the project, other criteria need the matching requests
+	requestFilter := filter
+	requestFilter.StartTime, requestFilter.EndTime = nil, nil
+	var err error
+	if requestFilter.selectsRequests() {
+		err = forRequestIDs(s.requests, requestFilter, aggregate)
+	} else {
+		err = aggregate(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// batches hold different requests, so their counts add up
+	stats := []model.EndpointViolations{}
+	index := make(map[[2]string]int, len(totals))
+	for _, total := range totals {
+		key := [2]string{total.Method, total.Endpoint}
+		i, ok := index[key]
+		if !ok {
+			i = len(stats)
+			index[key] = i
+			stats = append(stats, model.EndpointViolations{
+				Method:   total.Method,
+				Endpoint: total.Endpoint,
+				Kinds:    map[model.ViolationKind]int64{},
+			})
+		}
+		stats[i].RequestCount += total.RequestCount
+		stats[i].ViolationCount += total.ViolationCount
+	}
+	for _, kind := range kinds {
+		if i, ok := index[[2]string{kind.Method, kind.Endpoint}]; ok {
+			stats[i].Kinds[kind.Kind] += kind.ViolationCount
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].ViolationCount > stats[j].ViolationCount
+	})
+	return stats, nil
+}
+
+func (s *RequestCrudService) TopConsumers(params TopConsumersParams) ([]model.ConsumerStatistics, error) {
+	filter := RequestFilter{ProjectID: &params.ProjectID, WithConsumer: true, StartTime: params.StartTime, EndTime: params.EndTime}
+	stats, err := s.aggregates.ConsumerStatistics(filter, params.SortBy, params.Limit)
+	if err != nil {
+		s.logger.Errorf("Failed to calculate statistics per consumer: %v", err)
+		return nil, err
+	}
+	return stats, nil
+}
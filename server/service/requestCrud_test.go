@@ -44,7 +44,7 @@ func (suite *RequestCrudServiceTestSuite) SetupSuite() {
 
 	// --- Schema Migration ---
 	// Migrate only the necessary model for this service
-	err = suite.db.AutoMigrate(&model.Request{})
+	err = suite.db.AutoMigrate(&model.Request{}, &model.Violation{})
 	suite.Require().NoError(err, "Failed to migrate database schema for Request")
 
 	// --- Service Initialization ---
@@ -52,6 +52,7 @@ func (suite *RequestCrudServiceTestSuite) SetupSuite() {
 	app.Test() // Setup test DI container
 	app.Provide(func() *gorm.DB { return suite.db })
 	app.Provide(func() *zap.SugaredLogger { return suite.logger })
+	app.Provide(service.NewRequestStore)
 	suite.crudService = service.NewRequestCrudService() // This will now get the test DB and logger
 	suite.Require().NotNil(suite.crudService)
 
@@ -119,6 +120,24 @@ func (suite *RequestCrudServiceTestSuite) TestList_WithSearch() {
 	assert.Contains(suite.T(), requests[1].Path, "products")
 }
 
+func (suite *RequestCrudServiceTestSuite) TestList_SearchScansBodiesOnlyWhenAsked() {
+	request := model.Request{Method: "POST", Path: "/api/orders", Response: 201, ResponseBody: []byte(`{"sku":"products-9"}`), CreatedAt: time.Now()}
+	suite.Require().NoError(suite.db.Create(&request).Error)
+	defer suite.db.Delete(&request)
+
+	// a bare term is the path search
+	search := "products"
+	_, total, err := suite.crudService.List(service.ListRequestsParams{Search: &search})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+
+	search = "body:products"
+	requests, total, err := suite.crudService.List(service.ListRequestsParams{Search: &search})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+	assert.Equal(suite.T(), request.ID, requests[0].ID)
+}
+
 func (suite *RequestCrudServiceTestSuite) TestList_WithMethodFilter() {
 	method := "GET"
 	params := service.ListRequestsParams{Method: &method, Limit: 10, Offset: 0}
@@ -219,3 +238,21 @@ func (suite *RequestCrudServiceTestSuite) TestList_NoResults() {
 	assert.Len(suite.T(), requests, 0)
 }
 
+func (suite *RequestCrudServiceTestSuite) TestStream_MatchesList() {
+	method := "GET"
+	params := service.ListRequestsParams{Method: &method, SortBy: "latency", Order: "asc"}
+
+	var streamed []model.Request
+	err := suite.crudService.Stream(params, func(request *model.Request) error {
+		streamed = append(streamed, *request)
+		return nil
+	})
+	assert.NoError(suite.T(), err)
+
+	listed, _, err := suite.crudService.List(params)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), streamed, 3)
+	for i := range listed {
+		assert.Equal(suite.T(), listed[i].ID, streamed[i].ID)
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"treblle/app"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	_PARTITION_PERIOD = time.Hour
+	// _PARTITION_LOCK_KEY is the advisory lock serializing partition changes of all instances
+	_PARTITION_LOCK_KEY         = 7412653002
+	_REQUESTS_LEGACY_PARTITION  = "requests_legacy"
+	_REQUESTS_DEFAULT_PARTITION = "requests_default"
+)
+
+// PartitionInterval is the time range covered by one partition of the requests table
+type PartitionInterval string
+
+const (
+	PartitionDaily  PartitionInterval = app.PartitionsDaily
+	PartitionWeekly PartitionInterval = app.PartitionsWeekly
+)
+
+// Start returns the start of the partition holding t, partitions follow utc days and weeks starting on monday
+func (i PartitionInterval) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if i == PartitionWeekly {
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// Next returns the start of the partition after the one holding t
+func (i PartitionInterval) Next(t time.Time) time.Time {
+	if i == PartitionWeekly {
+		return i.Start(t).AddDate(0, 0, 7)
+	}
+	return i.Start(t).AddDate(0, 0, 1)
+}
+
+// RequestPartition is a partition of the requests table. From is nil for the legacy partition holding the requests
+// stored before the table was partitioned, the default partition holds requests no other partition covers
+type RequestPartition struct {
+	Name    string
+	From    *time.Time
+	To      *time.Time
+	Default bool
+}
+
+// RequestPartitions drops whole partitions of expired requests, which is cheaper than deleting their rows
+type RequestPartitions interface {
+	// DropBefore drops the partitions holding only requests created before before and returns how many requests were dropped
+	DropBefore(before time.Time) (int64, error)
+}
+
+// RequestPartitioner partitions the requests table by created_at on postgres and keeps partitions
+// created Ahead of time. Queries of the requests table don't change, postgres routes them to the partitions
+type RequestPartitioner struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	Interval PartitionInterval
+	Ahead    int // Ahead is the number of partitions created after the current one
+	Now      func() time.Time
+}
+
+// NewRequestPartitioner partitions the requests table if it isn't yet, returns nil if partitioning is off
+func NewRequestPartitioner() *RequestPartitioner {
+	if app.StoragePartitions == "" || app.StoragePartitions == app.PartitionsNone {
+		return nil
+	}
+
+	var partitioner *RequestPartitioner
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		partitioner = &RequestPartitioner{
+			Db:       db,
+			Logger:   logger,
+			Interval: PartitionInterval(app.StoragePartitions),
+			Ahead:    app.StoragePartitionsAhead,
+			Now:      time.Now,
+		}
+		if err := partitioner.Partition(); err != nil {
+			logger.Panicf("Can't partition the requests table err = %+v", err)
+		}
+		if _, err := partitioner.CreateAhead(); err != nil {
+			logger.Panicf("Can't create the requests partitions err = %+v", err)
+		}
+	})
+	return partitioner
+}
+
+// NewRequestPartitionWorker creates the background worker creating the partitions ahead of time
+func NewRequestPartitionWorker() app.Worker {
+	var worker app.Worker
+	app.Invoke(func(partitioner *RequestPartitioner) {
+		if partitioner == nil {
+			worker = func(ctx context.Context) {}
+			return
+		}
+		worker = partitioner.Worker()
+	})
+	return worker
+}
+
+// lock holds the partition lock until tx ends
+func (p *RequestPartitioner) lock(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", _PARTITION_LOCK_KEY).Error
+}
+
+// Partition converts the requests table to a table partitioned by created_at if it isn't yet. The existing table
+// is attached as the legacy partition, so no rows are copied, but its indexes are extended by created_at
+func (p *RequestPartitioner) Partition() error {
+	return p.Db.Transaction(func(tx *gorm.DB) error {
+		if err := p.lock(tx); err != nil {
+			return err
+		}
+		var partitioned bool
+		if err := tx.Raw("SELECT relkind = 'p' FROM pg_class WHERE oid = to_regclass('requests')").Scan(&partitioned).Error; err != nil {
+			return err
+		}
+		if partitioned {
+			return nil
+		}
+
+		var newest sql.NullTime
+		if err := tx.Raw("SELECT max(created_at) FROM requests").Scan(&newest).Error; err != nil {
+			return err
+		}
+		cutover := p.Now()
+		if newest.Valid && newest.Time.After(cutover) {
+			cutover = newest.Time
+		}
+		cutover = p.Interval.Next(cutover)
+
+		var sequence string
+		if err := tx.Raw("SELECT pg_get_serial_sequence('requests', 'id')").Scan(&sequence).Error; err != nil {
+			return err
+		}
+		var indexes []struct {
+			Name       string
+			Definition string
+			IsPrimary  bool
+			IsUnique   bool
+		}
+		if err := tx.Raw(`SELECT c.relname AS name, pg_get_indexdef(c.oid) AS definition, x.indisprimary AS is_primary, x.indisunique AS is_unique
+			FROM pg_index x JOIN pg_class c ON c.oid = x.indexrelid
+			WHERE x.indrelid = 'requests'::regclass`).Scan(&indexes).Error; err != nil {
+			return err
+		}
+
+		// the legacy table keeps its indexes under new names, the partitioned table gets the original ones
+		for _, index := range indexes {
+			if err := tx.Exec("ALTER INDEX ? RENAME TO ?", clause.Table{Name: index.Name}, clause.Table{Name: index.Name + "_legacy"}).Error; err != nil {
+				return err
+			}
+		}
+		statements := []string{
+			"ALTER TABLE requests RENAME TO " + _REQUESTS_LEGACY_PARTITION,
+			"CREATE TABLE requests (LIKE " + _REQUESTS_LEGACY_PARTITION + " INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (created_at)",
+			// the sequence would be dropped with the legacy partition otherwise
+			"ALTER SEQUENCE " + sequence + " OWNED BY requests.id",
+			// unique constraints of a partitioned table include the partition key
+			"ALTER TABLE requests ADD CONSTRAINT requests_pkey PRIMARY KEY (id, created_at)",
+		}
+		for _, index := range indexes {
+			switch {
+			case index.IsPrimary:
+			case index.IsUnique && strings.HasSuffix(index.Definition, ")"):
+				statements = append(statements, strings.TrimSuffix(index.Definition, ")")+", created_at)")
+			default:
+				statements = append(statements, index.Definition)
+			}
+		}
+		statements = append(statements,
+			fmt.Sprintf("ALTER TABLE requests ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO (%s)", _REQUESTS_LEGACY_PARTITION, boundLiteral(cutover)),
+			"CREATE TABLE "+_REQUESTS_DEFAULT_PARTITION+" PARTITION OF requests DEFAULT",
+		)
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		p.Logger.Infof("Partitioned the requests table %s, stored requests are kept in %s until %s", p.Interval, _REQUESTS_LEGACY_PARTITION, cutover.Format(time.DateOnly))
+		return nil
+	})
+}
+
+// Partitions returns the partitions of the requests table ordered by time, the default partition is last
+func (p *RequestPartitioner) Partitions() ([]RequestPartition, error) {
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	err := p.Db.Transaction(func(tx *gorm.DB) error {
+		// bounds are printed in the time zone of the session
+		if err := tx.Exec("SET LOCAL TIME ZONE 'UTC'").Error; err != nil {
+			return err
+		}
+		return tx.Raw(`SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+			FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = 'requests'::regclass`).Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]RequestPartition, 0, len(rows))
+	for _, row := range rows {
+		partition, err := parsePartitionBound(row.Name, row.Bound)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	slices.SortFunc(partitions, func(a, b RequestPartition) int {
+		switch {
+		case a.Default || b.Default:
+			return compareBool(a.Default, b.Default)
+		case a.From == nil || b.From == nil:
+			return compareBool(a.From != nil, b.From != nil)
+		default:
+			return a.From.Compare(*b.From)
+		}
+	})
+	return partitions, nil
+}
+
+// CreateAhead creates the partitions after the newest one up to Ahead partitions after the current one and returns their names
+func (p *RequestPartitioner) CreateAhead() ([]string, error) {
+	partitions, err := p.Partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.Now()
+	from := p.Interval.Start(now)
+	for _, partition := range partitions {
+		if partition.To != nil && partition.To.After(from) {
+			from = *partition.To
+		}
+	}
+	until := p.Interval.Start(now)
+	for range p.Ahead + 1 {
+		until = p.Interval.Next(until)
+	}
+
+	var created []string
+	for ; from.Before(until); from = p.Interval.Next(from) {
+		name := partitionName(from)
+		ok, err := p.createPartition(name, from, p.Interval.Next(from))
+		if err != nil {
+			return created, fmt.Errorf("create partition %s: %w", name, err)
+		}
+		if ok {
+			created = append(created, name)
+		}
+	}
+	if len(created) > 0 {
+		p.Logger.Infof("Created requests partitions %s", strings.Join(created, ", "))
+	}
+	return created, nil
+}
+
+// createPartition creates the partition of requests created from from until to, returns false if another instance created it.
+// Requests of the range stored before it existed are moved over from the default partition
+func (p *RequestPartitioner) createPartition(name string, from, to time.Time) (bool, error) {
+	created := false
+	err := p.Db.Transaction(func(tx *gorm.DB) error {
+		if err := p.lock(tx); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&exists).Error; err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		table := clause.Table{Name: name}
+		if err := tx.Exec("CREATE TABLE ? (LIKE requests INCLUDING DEFAULTS)", table).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("WITH moved AS (DELETE FROM ? WHERE created_at >= ? AND created_at < ? RETURNING *) INSERT INTO ? SELECT * FROM moved",
+			clause.Table{Name: _REQUESTS_DEFAULT_PARTITION}, from, to, table).Error; err != nil {
+			return err
+		}
+		bounds := fmt.Sprintf("FROM (%s) TO (%s)", boundLiteral(from), boundLiteral(to))
+		if err := tx.Exec("ALTER TABLE requests ATTACH PARTITION ? FOR VALUES "+bounds, table).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// DropBefore drops the partitions holding only requests created before before, with the violations of their requests.
+// The default partition is never dropped, the retention deletes its expired rows
+func (p *RequestPartitioner) DropBefore(before time.Time) (int64, error) {
+	partitions, err := p.Partitions()
+	if err != nil {
+		return 0, err
+	}
+
+	var dropped int64
+	for _, partition := range partitions {
+		if partition.Default || partition.To == nil || partition.To.After(before) {
+			continue
+		}
+		var count int64
+		err := p.Db.Transaction(func(tx *gorm.DB) error {
+			if err := p.lock(tx); err != nil {
+				return err
+			}
+			table := clause.Table{Name: partition.Name}
+			if err := tx.Raw("SELECT count(*) FROM ?", table).Scan(&count).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM violations WHERE request_id IN (SELECT id FROM ?)", table).Error; err != nil {
+				return err
+			}
+			return tx.Exec("DROP TABLE ?", table).Error
+		})
+		if err != nil {
+			return dropped, fmt.Errorf("drop partition %s: %w", partition.Name, err)
+		}
+		dropped += count
+		p.Logger.Infof("Dropped requests partition %s with %d requests", partition.Name, count)
+	}
+	return dropped, nil
+}
+
+func (p *RequestPartitioner) Worker() app.Worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(_PARTITION_PERIOD)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := p.CreateAhead(); err != nil {
+					p.Logger.Errorf("Failed to create requests partitions, error = %v", err)
+				}
+			}
+		}
+	}
+}
+
+var partitionBoundRegex = regexp.MustCompile(`^FOR VALUES FROM \((.+)\) TO \((.+)\)$`)
+
+// parsePartitionBound reads a bound printed by pg_get_expr in utc
+func parsePartitionBound(name, bound string) (RequestPartition, error) {
+	partition := RequestPartition{Name: name}
+	if bound == "DEFAULT" {
+		partition.Default = true
+		return partition, nil
+	}
+	match := partitionBoundRegex.FindStringSubmatch(bound)
+	if match == nil {
+		return partition, fmt.Errorf("unexpected bound of partition %s: %s", name, bound)
+	}
+	for i, value := range []**time.Time{&partition.From, &partition.To} {
+		if match[i+1] == "MINVALUE" || match[i+1] == "MAXVALUE" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02 15:04:05-07", strings.Trim(match[i+1], "'"))
+		if err != nil {
+			return partition, fmt.Errorf("unexpected bound of partition %s: %w", name, err)
+		}
+		t = t.UTC()
+		*value = &t
+	}
+	return partition, nil
+}
+
+// partitionName returns the name of the partition starting at start
+func partitionName(start time.Time) string {
+	return "requests_p" + start.UTC().Format("20060102")
+}
+
+// boundLiteral formats t for a partition bound, ddl statements don't take parameters
+func boundLiteral(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339) + "'"
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
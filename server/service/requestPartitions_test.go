@@ -0,0 +1,203 @@
+package service_test
+
+import (
+	"os"
+	"testing"
+	"time"
+	"treblle/migration"
+	"treblle/model"
+	"treblle/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const _PG_PARTITION_SCHEMA = "treblle_partition_test"
+
+func TestPartitionInterval(t *testing.T) {
+	sunday := time.Date(2024, 5, 5, 23, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	assert.Equal(t, day(5), service.PartitionDaily.Start(sunday))
+	assert.Equal(t, day(6), service.PartitionDaily.Next(sunday))
+	// weeks start on monday
+	assert.Equal(t, time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC), service.PartitionWeekly.Start(sunday))
+	assert.Equal(t, day(6), service.PartitionWeekly.Next(sunday))
+	assert.Equal(t, day(6), service.PartitionWeekly.Start(day(6)))
+	assert.Equal(t, day(13), service.PartitionWeekly.Next(day(6)))
+	// a partition left from daily partitions is followed by the next week
+	assert.Equal(t, day(13), service.PartitionWeekly.Next(day(8)))
+	// partitions follow utc days
+	local := time.Date(2024, 5, 6, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	assert.Equal(t, day(5), service.PartitionDaily.Start(local))
+}
+
+// RequestPartitionerTestSuite runs against the database in TEST_POSTGRES_DSN, in its own schema that is recreated for every test
+type RequestPartitionerTestSuite struct {
+	suite.Suite
+	dsn         string
+	db          *gorm.DB
+	now         time.Time
+	partitioner *service.RequestPartitioner
+}
+
+func (suite *RequestPartitionerTestSuite) SetupTest() {
+	suite.db = openPartitionTestDb(suite.T(), suite.dsn)
+	suite.now = time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	suite.partitioner = &service.RequestPartitioner{
+		Db:       suite.db,
+		Logger:   zap.NewNop().Sugar(),
+		Interval: service.PartitionDaily,
+		Ahead:    2,
+		Now:      func() time.Time { return suite.now },
+	}
+}
+
+// openPartitionTestDb recreates the test schema and applies the migrations
+func openPartitionTestDb(t *testing.T, dsn string) *gorm.DB {
+	db := openTestDb(t, postgres.Open(dsn))
+	if err := db.Exec("DROP SCHEMA IF EXISTS " + _PG_PARTITION_SCHEMA + " CASCADE").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE SCHEMA " + _PG_PARTITION_SCHEMA).Error; err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDb(t, postgres.Open(withSearchPath(dsn, _PG_PARTITION_SCHEMA)))
+	migrator := migration.New(db)
+	migrator.Logger = zap.NewNop().Sugar()
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRequestPartitioner_Postgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	suite.Run(t, &RequestPartitionerTestSuite{dsn: dsn})
+}
+
+// partitionNames returns the names of the partitions in order
+func (suite *RequestPartitionerTestSuite) partitionNames() []string {
+	partitions, err := suite.partitioner.Partitions()
+	suite.Require().NoError(err)
+	names := make([]string, len(partitions))
+	for i, partition := range partitions {
+		names[i] = partition.Name
+	}
+	return names
+}
+
+func (suite *RequestPartitionerTestSuite) TestPartition_KeepsStoredRequests() {
+	old := model.Request{Method: "GET", Path: "/users", CreatedAt: suite.now.AddDate(0, 0, -30)}
+	suite.Require().NoError(suite.db.Create(&old).Error)
+
+	suite.Require().NoError(suite.partitioner.Partition())
+	suite.Require().NoError(suite.partitioner.Partition()) // a partitioned table is left as it is
+	created, err := suite.partitioner.CreateAhead()
+	suite.Require().NoError(err)
+
+	// the legacy partition holds today, the partitions start tomorrow
+	assert.Equal(suite.T(), []string{"requests_p20240511", "requests_p20240512"}, created)
+	assert.Equal(suite.T(), []string{"requests_legacy", "requests_p20240511", "requests_p20240512", "requests_default"}, suite.partitionNames())
+
+	// ids continue and every query of the store works on the partitioned table
+	store := service.NewSQLRequestStore(suite.db)
+	request := &model.Request{Method: "POST", Path: "/orders", CreatedAt: suite.now.Add(24 * time.Hour)}
+	suite.Require().NoError(store.Create(request))
+	assert.Greater(suite.T(), request.ID, old.ID)
+	stored, err := store.Get(request.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "/orders", stored.Path)
+	requests, total, err := store.List(service.RequestFilter{}, service.RequestPage{Limit: 10})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+	assert.Len(suite.T(), requests, 2)
+
+	var partition string
+	suite.Require().NoError(suite.db.Raw("SELECT tableoid::regclass::text FROM requests WHERE id = ?", request.ID).Scan(&partition).Error)
+	assert.Equal(suite.T(), "requests_p20240511", partition)
+}
+
+func (suite *RequestPartitionerTestSuite) TestPartition_KeepsFingerprintDedupe() {
+	suite.Require().NoError(suite.partitioner.Partition())
+	fingerprint := "abc"
+	request := model.Request{Method: "GET", Path: "/users", CreatedAt: suite.now, Fingerprint: &fingerprint}
+	suite.Require().NoError(suite.db.Create(&request).Error)
+
+	duplicate := model.Request{Method: "GET", Path: "/users", CreatedAt: suite.now, Fingerprint: &fingerprint}
+	assert.Error(suite.T(), suite.db.Create(&duplicate).Error)
+}
+
+func (suite *RequestPartitionerTestSuite) TestCreateAhead_MovesRequestsOutOfDefault() {
+	suite.Require().NoError(suite.partitioner.Partition())
+	_, err := suite.partitioner.CreateAhead()
+	suite.Require().NoError(err)
+
+	// stored while no partition covered it
+	late := model.Request{Method: "GET", Path: "/users", CreatedAt: suite.now.AddDate(0, 0, 5)}
+	suite.Require().NoError(suite.db.Create(&late).Error)
+
+	suite.now = suite.now.AddDate(0, 0, 3) // the worker didn't run for a few days
+	created, err := suite.partitioner.CreateAhead()
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []string{"requests_p20240513", "requests_p20240514", "requests_p20240515"}, created)
+
+	var partition string
+	suite.Require().NoError(suite.db.Raw("SELECT tableoid::regclass::text FROM requests WHERE id = ?", late.ID).Scan(&partition).Error)
+	assert.Equal(suite.T(), "requests_p20240515", partition)
+}
+
+func (suite *RequestPartitionerTestSuite) TestDropBefore_DropsExpiredPartitions() {
+	legacy := model.Request{Method: "GET", Path: "/users", CreatedAt: suite.now.AddDate(0, 0, -30)}
+	suite.Require().NoError(suite.db.Create(&legacy).Error)
+	suite.Require().NoError(suite.partitioner.Partition())
+	_, err := suite.partitioner.CreateAhead()
+	suite.Require().NoError(err)
+	kept := model.Request{Method: "GET", Path: "/orders", CreatedAt: suite.now.AddDate(0, 0, 2)}
+	suite.Require().NoError(suite.db.Create(&kept).Error)
+	suite.Require().NoError(suite.db.Create(&model.Violation{RequestID: legacy.ID}).Error)
+	suite.Require().NoError(suite.db.Create(&model.Violation{RequestID: kept.ID}).Error)
+
+	// the partition of tomorrow and the legacy partition ended before
+	dropped, err := suite.partitioner.DropBefore(suite.now.AddDate(0, 0, 2))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), dropped)
+	assert.Equal(suite.T(), []string{"requests_p20240512", "requests_default"}, suite.partitionNames())
+
+	var requestIDs []uint
+	suite.Require().NoError(suite.db.Model(&model.Violation{}).Pluck("request_id", &requestIDs).Error)
+	assert.Equal(suite.T(), []uint{kept.ID}, requestIDs)
+	suite.Require().NoError(suite.db.Model(&model.Request{}).Pluck("id", &requestIDs).Error)
+	assert.Equal(suite.T(), []uint{kept.ID}, requestIDs)
+}
+
+// TestRequestStore_PostgresPartitioned runs the store checks on a partitioned requests table
+func TestRequestStore_PostgresPartitioned(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	suite.Run(t, &RequestStoreTestSuite{newStore: func(t *testing.T) service.RequestStore {
+		db := openPartitionTestDb(t, dsn)
+		partitioner := &service.RequestPartitioner{
+			Db:       db,
+			Logger:   zap.NewNop().Sugar(),
+			Interval: service.PartitionDaily,
+			Ahead:    1,
+			Now:      func() time.Time { return time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC) },
+		}
+		if err := partitioner.Partition(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := partitioner.CreateAhead(); err != nil {
+			t.Fatal(err)
+		}
+		return service.NewSQLRequestStore(db)
+	}})
+}
@@ -0,0 +1,647 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"treblle/model"
+	"treblle/util/cerror"
+)
+
+const (
+	_SEARCH_MAX_LENGTH = 1000
+	_SEARCH_MAX_TERMS  = 50
+)
+
+// searchField is the part of a request a search term matches, searchText is a bare term matching the path
+type searchField string
+
+const (
+	searchText     searchField = ""
+	searchPath     searchField = "path"
+	searchQuery    searchField = "query"
+	searchHeader   searchField = "header"
+	searchBody     searchField = "body"
+	searchMethod   searchField = "method"
+	searchStatus   searchField = "status"
+	searchLatency  searchField = "latency"
+	searchConsumer searchField = "consumer"
+	searchSource   searchField = "source"
+)
+
+var searchFields = []searchField{searchPath, searchQuery, searchHeader, searchBody, searchMethod, searchStatus, searchLatency, searchConsumer, searchSource}
+
+// SearchQuery is a parsed search over captured requests, see ParseSearch for the language.
+// It is compiled to sql with every value passed as a parameter, or matched against requests in memory
+type SearchQuery struct {
+	root searchNode
+}
+
+// searchNode is a term or an operator of a search query
+type searchNode interface {
+	sql(w *searchWriter)
+	matches(request *model.Request) bool
+	// withoutPayloads returns the node for requests stored without headers and bodies
+	withoutPayloads() (searchNode, error)
+	String() string
+}
+
+type searchAnd struct{ left, right searchNode }
+type searchOr struct{ left, right searchNode }
+type searchNot struct{ node searchNode }
+
+// searchTerm matches one field, text fields match a case insensitive substring, bodies and bare terms a case sensitive one
+type searchTerm struct {
+	field  searchField
+	value  string // value is the searched text, method, consumer or source
+	cmp    string // cmp compares status and latency, one of =, >, >=, <, <=
+	number int64  // number is the status or the latency in nanoseconds
+	class  bool   // class matches the 100 statuses starting at number, e.g. 5xx
+}
+
+// ParseSearch parses a search query, a blank query returns nil. The language is:
+//
+//	/users                       text in the path, matched like the path search so the path index serves it
+//	"/users/{id}"                quoted text, \" and \\ escape a quote and a backslash
+//	path:/users query:page=2     case insensitive text in one field
+//	header:json body:timeout     text in the headers or bodies of requests and responses, only scanned when asked for
+//	method:post consumer:alice   exact method, consumer or source
+//	status:404 status:5xx        exact status or status class, status:>=400 compares
+//	latency:>500ms latency:<=1s  latency comparison, a plain number is in milliseconds
+//	a b, a AND b, a OR b, NOT a  terms are and-ed by default, NOT binds tighter than AND, AND than OR
+//	(a OR b) c                   parentheses group
+func ParseSearch(query string) (*SearchQuery, error) {
+	if len(query) > _SEARCH_MAX_LENGTH {
+		return nil, fmt.Errorf("%w: longer than %d characters", cerror.ErrBadSearch, _SEARCH_MAX_LENGTH)
+	}
+	tokens, err := lexSearch(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	parser := searchParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token != nil {
+		return nil, fmt.Errorf("%w: unexpected %s at %d", cerror.ErrBadSearch, token, token.pos+1)
+	}
+	return &SearchQuery{root: root}, nil
+}
+
+// SQL returns the where condition of the query for the dialect of the gorm driver, postgres or sqlite
+func (q *SearchQuery) SQL(dialect string) (string, []any) {
+	w := searchWriter{postgres: dialect == "postgres"}
+	w.write("(")
+	q.root.sql(&w)
+	w.write(")")
+	return w.sql.String(), w.args
+}
+
+// Matches reports if the query selects request
+func (q *SearchQuery) Matches(request *model.Request) bool {
+	return q.root.matches(request)
+}
+
+// pathSearch returns the text of a query that is a single bare term, which the path search of RequestFilter serves
+func (q *SearchQuery) pathSearch() (string, bool) {
+	if q == nil {
+		return "", false
+	}
+	term, ok := q.root.(searchTerm)
+	if !ok || term.field != searchText {
+		return "", false
+	}
+	return term.value, true
+}
+
+// String returns the query with explicit operators and parentheses
+func (q *SearchQuery) String() string {
+	return q.root.String()
+}
+
+// withoutPayloads returns the query for requests stored without headers and bodies, header and body terms are rejected
+func (q *SearchQuery) withoutPayloads() (*SearchQuery, error) {
+	root, err := q.root.withoutPayloads()
+	if err != nil {
+		return nil, err
+	}
+	return &SearchQuery{root: root}, nil
+}
+
+// --- lexer ---
+
+type searchTokenKind int
+
+const (
+	searchWord searchTokenKind = iota
+	searchQuoted
+	searchLParen
+	searchRParen
+)
+
+type searchToken struct {
+	kind  searchTokenKind
+	text  string // text is the word or the unquoted text
+	field string // field is set for field:"quoted text"
+	pos   int
+}
+
+// keyword reports if the token is the operator keyword, operators are upper case so lower case and, or, not are searched
+func (t *searchToken) keyword(keyword string) bool {
+	return t.kind == searchWord && t.text == keyword
+}
+
+func (t *searchToken) String() string {
+	switch t.kind {
+	case searchLParen:
+		return "("
+	case searchRParen:
+		return ")"
+	case searchQuoted:
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+func lexSearch(query string) ([]searchToken, error) {
+	var tokens []searchToken
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, searchToken{kind: searchLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, searchToken{kind: searchRParen, pos: i})
+			i++
+		case c == '"':
+			text, next, err := lexQuoted(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, searchToken{kind: searchQuoted, text: text, pos: i})
+			i = next
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r()\"", rune(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			if i < len(query) && query[i] == '"' {
+				if !strings.HasSuffix(word, ":") {
+					return nil, fmt.Errorf("%w: unexpected quote at %d, quote the whole term", cerror.ErrBadSearch, i+1)
+				}
+				text, next, err := lexQuoted(query, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, searchToken{kind: searchQuoted, text: text, field: strings.TrimSuffix(word, ":"), pos: start})
+				i = next
+				continue
+			}
+			tokens = append(tokens, searchToken{kind: searchWord, text: word, pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+// lexQuoted reads the quoted text starting at start and returns it with the index after the closing quote
+func lexQuoted(query string, start int) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if i+1 < len(query) && (query[i+1] == '"' || query[i+1] == '\\') {
+				i++
+			}
+			text.WriteByte(query[i])
+		case '"':
+			return text.String(), i + 1, nil
+		default:
+			text.WriteByte(query[i])
+		}
+	}
+	return "", 0, fmt.Errorf("%w: unterminated quote at %d", cerror.ErrBadSearch, start+1)
+}
+
+// --- parser ---
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+	terms  int
+}
+
+func (p *searchParser) peek() *searchToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *searchParser) next() *searchToken {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *searchParser) parseOr() (searchNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for token := p.peek(); token != nil && token.keyword("OR"); token = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = searchOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *searchParser) parseAnd() (searchNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for token := p.peek(); token != nil && token.kind != searchRParen && !token.keyword("OR"); token = p.peek() {
+		if token.keyword("AND") {
+			p.next()
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = searchAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *searchParser) parseNot() (searchNode, error) {
+	if token := p.peek(); token != nil && token.keyword("NOT") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return searchNot{node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *searchParser) parsePrimary() (searchNode, error) {
+	token := p.next()
+	switch {
+	case token == nil:
+		return nil, fmt.Errorf("%w: expected a term at the end", cerror.ErrBadSearch)
+	case token.kind == searchLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing == nil || closing.kind != searchRParen {
+			return nil, fmt.Errorf("%w: missing ) for ( at %d", cerror.ErrBadSearch, token.pos+1)
+		}
+		return node, nil
+	case token.kind == searchRParen, token.keyword("AND"), token.keyword("OR"):
+		return nil, fmt.Errorf("%w: expected a term at %d, got %s", cerror.ErrBadSearch, token.pos+1, token)
+	}
+
+	p.terms++
+	if p.terms > _SEARCH_MAX_TERMS {
+		return nil, fmt.Errorf("%w: more than %d terms", cerror.ErrBadSearch, _SEARCH_MAX_TERMS)
+	}
+	field, value := token.field, token.text
+	if token.kind == searchWord {
+		if before, after, ok := strings.Cut(token.text, ":"); ok && before != "" {
+			field, value = before, after
+		}
+	}
+	term, err := parseSearchTerm(field, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w at %d", err, token.pos+1)
+	}
+	return term, nil
+}
+
+func parseSearchTerm(name, value string) (searchTerm, error) {
+	field := searchField(strings.ToLower(name))
+	if name != "" && !containsField(field) {
+		return searchTerm{}, fmt.Errorf("%w: unknown field %q, quote the term to search for it", cerror.ErrBadSearch, name)
+	}
+	if value == "" {
+		return searchTerm{}, fmt.Errorf("%w: missing value of %s", cerror.ErrBadSearch, name)
+	}
+
+	term := searchTerm{field: field, value: value}
+	switch field {
+	case searchMethod:
+		term.value = strings.ToUpper(value)
+	case searchStatus:
+		term.cmp, value = cutComparison(value)
+		if len(value) == 3 && value[0] >= '1' && value[0] <= '5' && strings.EqualFold(value[1:], "xx") {
+			if term.cmp != "" {
+				return term, fmt.Errorf("%w: a status class can't be compared, got %s", cerror.ErrBadSearch, term.cmp+value)
+			}
+			term.class = true
+			term.number = int64(value[0]-'0') * 100
+			break
+		}
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 0 || status > 999 {
+			return term, fmt.Errorf("%w: status should be a status code or class like 5xx, got %q", cerror.ErrBadSearch, value)
+		}
+		if term.cmp == "" {
+			term.cmp = "="
+		}
+		term.number = int64(status)
+	case searchLatency:
+		term.cmp, value = cutComparison(value)
+		if term.cmp == "" {
+			return term, fmt.Errorf("%w: latency needs a comparison like latency:>500ms", cerror.ErrBadSearch)
+		}
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "ms"
+		}
+		latency, err := time.ParseDuration(value)
+		if err != nil || latency < 0 {
+			return term, fmt.Errorf("%w: latency should be a duration like 500ms or 1.5s, got %q", cerror.ErrBadSearch, value)
+		}
+		term.number = int64(latency)
+	}
+	if field == searchStatus || field == searchLatency {
+		term.value = ""
+	}
+	return term, nil
+}
+
+func containsField(field searchField) bool {
+	for _, known := range searchFields {
+		if field == known {
+			return true
+		}
+	}
+	return false
+}
+
+// cutComparison splits the comparison operator from value, empty if there is none
+func cutComparison(value string) (string, string) {
+	for _, cmp := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(value, cmp); ok {
+			return cmp, rest
+		}
+	}
+	return "", value
+}
+
+// --- sql ---
+
+type searchWriter struct {
+	postgres bool
+	sql      strings.Builder
+	args     []any
+}
+
+func (w *searchWriter) write(sql string, args ...any) {
+	w.sql.WriteString(sql)
+	w.args = append(w.args, args...)
+}
+
+// like matches a case insensitive substring of a text column
+func (w *searchWriter) like(column, value string) {
+	op := "LIKE" // sqlite compares ascii letters case insensitive
+	if w.postgres {
+		op = "ILIKE"
+	}
+	w.write(column+" "+op+` ? ESCAPE '\'`, "%"+escapeLike(value)+"%")
+}
+
+// contains matches a case sensitive substring of a binary column
+func (w *searchWriter) contains(column, value string) {
+	if w.postgres {
+		w.write("COALESCE(position(? in "+column+"), 0) > 0", []byte(value))
+		return
+	}
+	w.write("COALESCE(instr("+column+", ?), 0) > 0", []byte(value))
+}
+
+func (n searchAnd) sql(w *searchWriter) {
+	w.write("(")
+	n.left.sql(w)
+	w.write(" AND ")
+	n.right.sql(w)
+	w.write(")")
+}
+
+func (n searchOr) sql(w *searchWriter) {
+	w.write("(")
+	n.left.sql(w)
+	w.write(" OR ")
+	n.right.sql(w)
+	w.write(")")
+}
+
+func (n searchNot) sql(w *searchWriter) {
+	w.write("NOT ")
+	n.node.sql(w)
+}
+
+func (t searchTerm) sql(w *searchWriter) {
+	// nullable columns are coalesced, so NOT selects the requests without them
+	switch t.field {
+	case searchText:
+		// the path search of RequestFilter, so a bare term selects the same requests in a query
+		w.write(`path LIKE ? ESCAPE '\'`, "%"+escapeLike(t.value)+"%")
+	case searchPath:
+		w.like("path", t.value)
+	case searchQuery:
+		w.like("COALESCE(query, '')", t.value)
+	case searchHeader:
+		w.write("(")
+		w.like("COALESCE(request_headers, '')", t.value)
+		w.write(" OR ")
+		w.like("COALESCE(response_headers, '')", t.value)
+		w.write(")")
+	case searchBody:
+		w.write("(")
+		w.contains("request_body", t.value)
+		w.write(" OR ")
+		w.contains("response_body", t.value)
+		w.write(")")
+	case searchMethod:
+		w.write("method = ?", t.value)
+	case searchConsumer:
+		w.write("consumer = ?", t.value)
+	case searchSource:
+		w.write("source = ?", t.value)
+	case searchStatus:
+		if t.class {
+			w.write("(COALESCE(response, 0) >= ? AND COALESCE(response, 0) < ?)", t.number, t.number+100)
+			return
+		}
+		w.write("COALESCE(response, 0) "+t.cmp+" ?", t.number)
+	case searchLatency:
+		w.write("COALESCE(latency, 0) "+t.cmp+" ?", t.number)
+	}
+}
+
+// --- matching ---
+
+func (n searchAnd) matches(request *model.Request) bool {
+	return n.left.matches(request) && n.right.matches(request)
+}
+
+func (n searchOr) matches(request *model.Request) bool {
+	return n.left.matches(request) || n.right.matches(request)
+}
+
+func (n searchNot) matches(request *model.Request) bool {
+	return !n.node.matches(request)
+}
+
+func (t searchTerm) matches(request *model.Request) bool {
+	switch t.field {
+	case searchText:
+		return strings.Contains(request.Path, t.value)
+	case searchPath:
+		return containsFold(request.Path, t.value)
+	case searchQuery:
+		return containsFold(request.Query, t.value)
+	case searchHeader:
+		// headers are matched as they are stored, in json
+		return containsFold(headersText(request.RequestHeaders), t.value) || containsFold(headersText(request.ResponseHeaders), t.value)
+	case searchBody:
+		return bytes.Contains(request.RequestBody, []byte(t.value)) || bytes.Contains(request.ResponseBody, []byte(t.value))
+	case searchMethod:
+		return request.Method == t.value
+	case searchConsumer:
+		return request.Consumer == t.value
+	case searchSource:
+		return request.Source == t.value
+	case searchStatus:
+		if t.class {
+			return int64(request.Response) >= t.number && int64(request.Response) < t.number+100
+		}
+		return compareSearch(int64(request.Response), t.cmp, t.number)
+	case searchLatency:
+		return compareSearch(int64(request.Latency), t.cmp, t.number)
+	}
+	return false
+}
+
+func compareSearch(value int64, cmp string, to int64) bool {
+	switch cmp {
+	case ">":
+		return value > to
+	case ">=":
+		return value >= to
+	case "<":
+		return value < to
+	case "<=":
+		return value <= to
+	}
+	return value == to
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func headersText(headers model.Headers) string {
+	value, err := headers.Value()
+	if text, ok := value.(string); ok && err == nil {
+		return text
+	}
+	return ""
+}
+
+// --- payloads stored apart ---
+
+func (n searchAnd) withoutPayloads() (searchNode, error) {
+	left, right, err := withoutPayloads(n.left, n.right)
+	return searchAnd{left, right}, err
+}
+
+func (n searchOr) withoutPayloads() (searchNode, error) {
+	left, right, err := withoutPayloads(n.left, n.right)
+	return searchOr{left, right}, err
+}
+
+func (n searchNot) withoutPayloads() (searchNode, error) {
+	node, err := n.node.withoutPayloads()
+	return searchNot{node}, err
+}
+
+func (t searchTerm) withoutPayloads() (searchNode, error) {
+	if t.field == searchHeader || t.field == searchBody {
+		return nil, fmt.Errorf("%w: %s search needs headers and bodies stored with the requests", cerror.ErrBadSearch, t.field)
+	}
+	return t, nil
+}
+
+// withoutPayloads returns the filter for requests stored without headers and bodies
+func (f RequestFilter) withoutPayloads() (RequestFilter, error) {
+	if f.Query == nil {
+		return f, nil
+	}
+	query, err := f.Query.withoutPayloads()
+	f.Query = query
+	return f, err
+}
+
+func withoutPayloads(left, right searchNode) (searchNode, searchNode, error) {
+	left, err := left.withoutPayloads()
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err = right.withoutPayloads()
+	return left, right, err
+}
+
+// --- formatting ---
+
+func (n searchAnd) String() string {
+	return "(" + n.left.String() + " AND " + n.right.String() + ")"
+}
+
+func (n searchOr) String() string {
+	return "(" + n.left.String() + " OR " + n.right.String() + ")"
+}
+
+func (n searchNot) String() string {
+	return "NOT " + n.node.String()
+}
+
+func (t searchTerm) String() string {
+	prefix := ""
+	if t.field != searchText {
+		prefix = string(t.field) + ":"
+	}
+	switch {
+	case t.field == searchStatus && t.class:
+		return prefix + strconv.FormatInt(t.number/100, 10) + "xx"
+	case t.field == searchStatus:
+		return prefix + strings.TrimPrefix(t.cmp, "=") + strconv.FormatInt(t.number, 10)
+	case t.field == searchLatency:
+		return prefix + t.cmp + time.Duration(t.number).String()
+	}
+	return prefix + quoteSearch(t.value)
+}
+
+// quoteSearch quotes value if it would not be read back as the same term
+func quoteSearch(value string) string {
+	if value == "AND" || value == "OR" || value == "NOT" || strings.ContainsAny(value, " \t\n\r()\":\\") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"timeout", "timeout"},
+		{`"connection reset"`, `"connection reset"`},
+		{`"say \"hi\" \\ bye"`, `"say \"hi\" \\ bye"`},
+		{"path:/users", "path:/users"},
+		{`body:"user id"`, `body:"user id"`},
+		{"PATH:/users", "path:/users"},
+		{"method:post", "method:POST"},
+		{"status:404", "status:404"},
+		{"status:5xx", "status:5xx"},
+		{"status:4XX", "status:4xx"},
+		{"status:>=400", "status:>=400"},
+		{"status:=200", "status:200"},
+		{"latency:>500ms", "latency:>500ms"},
+		{"latency:<=1.5s", "latency:<=1.5s"},
+		{"latency:>250", "latency:>250ms"},
+		{"query:page=2", "query:page=2"},
+		{":colon", `":colon"`},
+		{"a b", "(a AND b)"},
+		{"a AND b", "(a AND b)"},
+		{"a OR b", "(a OR b)"},
+		{"a OR b c", "(a OR (b AND c))"},
+		{"a b OR c", "((a AND b) OR c)"},
+		{"NOT a b", "(NOT a AND b)"},
+		{"NOT (a OR b)", "NOT (a OR b)"},
+		{"NOT NOT a", "NOT NOT a"},
+		{"(a OR b) c", "((a OR b) AND c)"},
+		{"((a))", "a"},
+		{"a and b", "((a AND and) AND b)"}, // operators are upper case
+		{`"AND"`, `"AND"`},
+		{"status:5xx latency:>500ms NOT path:/health", "((status:5xx AND latency:>500ms) AND NOT path:/health)"},
+		{"  \t ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := service.ParseSearch(tt.query)
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, query)
+				return
+			}
+			assert.Equal(t, tt.want, query.String())
+
+			// the formatted query is read back as the same query
+			again, err := service.ParseSearch(query.String())
+			require.NoError(t, err)
+			assert.Equal(t, query.String(), again.String())
+		})
+	}
+}
+
+func TestParseSearch_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"http://example.com", `unknown field "http"`},
+		{"status:", "missing value of status"},
+		{`path:""`, "missing value of path"},
+		{"status:teapot", "status should be a status code or class"},
+		{"status:1000", "status should be a status code or class"},
+		{"status:>5xx", "a status class can't be compared"},
+		{"latency:500ms", "latency needs a comparison"},
+		{"latency:>fast", "latency should be a duration"},
+		{"latency:>-1s", "latency should be a duration"},
+		{`"open`, "unterminated quote at 1"},
+		{`ab"cd"`, "unexpected quote at 3"},
+		{"(a OR b", "missing ) for ( at 1"},
+		{"a)", "unexpected ) at 2"},
+		{"()", "expected a term at 2, got )"},
+		{"a AND", "expected a term at the end"},
+		{"OR a", "expected a term at 1, got OR"},
+		{"a OR OR b", "expected a term at 6, got OR"},
+		{"NOT", "expected a term at the end"},
+		{strings.Repeat("a ", 51), "more than 50 terms"},
+		{strings.Repeat("a", 1001), "longer than 1000 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := service.ParseSearch(tt.query)
+			assert.ErrorIs(t, err, cerror.ErrBadSearch)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestSearchQuery_SQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		dialect  string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"path:/users", "sqlite", `(path LIKE ? ESCAPE '\')`, []any{"%/users%"}},
+		{"path:/users", "postgres", `(path ILIKE ? ESCAPE '\')`, []any{"%/users%"}},
+		{"path:100%_done", "sqlite", `(path LIKE ? ESCAPE '\')`, []any{`%100\%\_done%`}},
+		{"status:5xx OR status:>=400", "sqlite", "(((COALESCE(response, 0) >= ? AND COALESCE(response, 0) < ?) OR COALESCE(response, 0) >= ?))", []any{int64(500), int64(600), int64(400)}},
+		{"NOT method:get latency:>500ms", "sqlite", "((NOT method = ? AND COALESCE(latency, 0) > ?))", []any{"GET", int64(500 * time.Millisecond)}},
+		{"body:token", "sqlite", "((COALESCE(instr(request_body, ?), 0) > 0 OR COALESCE(instr(response_body, ?), 0) > 0))", []any{[]byte("token"), []byte("token")}},
+		{"body:token", "postgres", "((COALESCE(position(? in request_body), 0) > 0 OR COALESCE(position(? in response_body), 0) > 0))", []any{[]byte("token"), []byte("token")}},
+		{"consumer:alice source:proxy", "sqlite", "((consumer = ? AND source = ?))", []any{"alice", "proxy"}},
+		// bare terms are the path search, never a scan of the headers and bodies
+		{"timeout", "postgres", `(path LIKE ? ESCAPE '\')`, []any{"%timeout%"}},
+		{"timeout header:gzip", "sqlite", `((path LIKE ? ESCAPE '\' AND (COALESCE(request_headers, '') LIKE ? ESCAPE '\' OR COALESCE(response_headers, '') LIKE ? ESCAPE '\')))`, []any{"%timeout%", "%gzip%", "%gzip%"}},
+		// values never end up in the sql
+		{`path:"'; DROP TABLE requests; --"`, "postgres", `(path ILIKE ? ESCAPE '\')`, []any{"%'; DROP TABLE requests; --%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect+" "+tt.query, func(t *testing.T) {
+			query, err := service.ParseSearch(tt.query)
+			require.NoError(t, err)
+			sql, args := query.SQL(tt.dialect)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestSearchQuery_Matches(t *testing.T) {
+	request := &model.Request{
+		Method:          "POST",
+		Path:            "/api/Orders",
+		Query:           "page=2",
+		Response:        503,
+		Latency:         700 * time.Millisecond,
+		Consumer:        "alice",
+		Source:          model.SourceProxy,
+		RequestHeaders:  model.Headers{"X-Request-Id": {"abc-123"}},
+		ResponseBody:    []byte(`{"error":"Upstream Timeout"}`),
+		ResponseHeaders: model.Headers{"Retry-After": {"30"}},
+	}
+	tests := map[string]bool{
+		"Orders":                             true,
+		"orders":                             false, // bare terms match the path like the path search
+		"abc-123":                            false, // headers and bodies need a field
+		"page=2":                             false,
+		"path:orders":                        true, // fields are case insensitive
+		"header:ABC-123":                     true,
+		"body:timeout":                       false, // bodies are case sensitive
+		"header:retry-after":                 true,
+		"body:Upstream":                      true,
+		"body:page":                          false,
+		"query:page=2":                       true,
+		"method:post status:5xx":             true,
+		"status:503 latency:>500ms":          true,
+		"latency:>1s":                        false,
+		"status:<500 OR consumer:alice":      true,
+		"NOT consumer:alice":                 false,
+		"NOT (status:4xx OR latency:<100ms)": true,
+	}
+	for text, want := range tests {
+		t.Run(text, func(t *testing.T) {
+			query, err := service.ParseSearch(text)
+			require.NoError(t, err)
+			assert.Equal(t, want, query.Matches(request))
+		})
+	}
+}
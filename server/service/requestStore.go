@@ -0,0 +1,442 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RequestFilter selects stored requests, nil filters are not applied
+type RequestFilter struct {
+	ProjectID      *uint
+	IDs            []uint
+	AfterID        uint         // AfterID only selects requests with a bigger id, to page through requests in id order
+	Search         *string      // Search is a substring of the path
+	Query          *SearchQuery // Query is a search over the text, status and latency of the requests
+	Method         *string
+	Response       *int
+	Source         *string
+	Consumer       *string
+	Paths          []string // Paths are exact paths
+	PathPrefix     string   // PathPrefix only selects paths starting with it
+	ExcludeSources []string
+	Answered       bool // Answered only selects requests with a response
+	// ExcludeProxyErrors leaves out requests the upstream never answered, their responses are synthetic
+	ExcludeProxyErrors bool
+	WithConsumer       bool // WithConsumer only selects requests with a known consumer
+	StartTime          *time.Time
+	EndTime            *time.Time
+}
+
+// RequestPage sorts and paginates the selected requests
+type RequestPage struct {
+	Limit  int    // Limit is the max number of requests, 0 returns all
+	Offset int    // Offset is the number of skipped requests
+	SortBy string // SortBy is one of created_at, response_time, latency, id, created_at if empty
+	Order  string // Order is asc or desc, desc by created_at if SortBy is empty
+}
+
+// RequestAggregator computes the statistics of stored requests
+type RequestAggregator interface {
+	// PathStatistics aggregates the requests matching filter per path, most requested first
+	PathStatistics(filter RequestFilter) ([]model.PathStatistics, error)
+	// ConsumerStatistics aggregates the requests matching filter per consumer, sorted by requests, errors or latency
+	ConsumerStatistics(filter RequestFilter, sortBy string, limit int) ([]model.ConsumerStatistics, error)
+}
+
+// RequestStore stores the captured requests. Requests not found are reported with gorm.ErrRecordNotFound
+// for every backend, so callers don't depend on the backend
+type RequestStore interface {
+	// Create stores a new request and sets its id, a request with the fingerprint of a stored one
+	// isn't stored and cerror.ErrDuplicateRequest is returned
+	Create(request *model.Request) error
+	// Save replaces a stored request
+	Save(request *model.Request) error
+	Get(id uint) (*model.Request, error)
+	// SetSource changes the source of a stored request
+	SetSource(id uint, source string) error
+	// List returns a page of the requests matching filter and the total count before pagination
+	List(filter RequestFilter, page RequestPage) ([]model.Request, int64, error)
+	// Stream calls fn for every request matching filter in the same order as List, without loading them all
+	Stream(filter RequestFilter, page RequestPage, fn func(*model.Request) error) error
+	RequestAggregator
+	// DeleteBefore deletes up to limit of the oldest requests created before before and returns their ids,
+	// an error cleaning up after deleted requests is returned along with their ids
+	DeleteBefore(before time.Time, limit int) ([]uint, error)
+}
+
+// NewRequestStore creates the request store of the configured storage backend
+func NewRequestStore() RequestStore {
+	var store RequestStore
+
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		switch app.StorageBackend {
+		case app.StorageEmbedded:
+			embedded, err := NewEmbeddedRequestStore(app.StoragePath)
+			if err != nil {
+				logger.Fatalf("Failed to open the embedded request store, error = %v", err)
+			}
+			store = embedded
+		default:
+			store = NewSQLRequestStore(db)
+		}
+
+		if app.StoragePayloads == app.PayloadsMongo {
+			payloads, err := NewMongoPayloadStore(app.MongoConn)
+			if err != nil {
+				logger.Fatalf("Failed to connect to mongo, error = %v", err)
+			}
+			store = NewPayloadRequestStore(store, payloads)
+		}
+	})
+
+	return store
+}
+
+// _WEIGHTED_STATS_COLUMNS aggregates the statistics of a group of requests, sampled requests count as the requests they stand for.
+// The synthetic responses of proxy errors are counted apart from the server errors of the upstream
+const _WEIGHTED_STATS_COLUMNS = `
+		sum(sample_weight) as request_count,
+		sum(latency * sample_weight) / sum(case when latency is not null then sample_weight end) as avg_latency_nanos,
+		sum(case when response >= 400 and response < 500 then sample_weight else 0 end) as client_error_count,
+		sum(case when response >= 500 and coalesce(proxy_error, '') = '' then sample_weight else 0 end) as server_error_count,
+		sum(case when source = ? then sample_weight else 0 end) as rate_limited_count,
+		sum(case when coalesce(proxy_error, '') <> '' then sample_weight else 0 end) as proxy_error_count
+	`
+
+// Result struct specifically for the GORM Scan operation, counts are weighted so they are scanned as floats
+type pathStatsQueryResult struct {
+	Path             string
+	RequestCount     float64
+	AvgLatencyNanos  float64
+	ClientErrorCount float64
+	ServerErrorCount float64
+	RateLimitedCount float64
+	ProxyErrorCount  float64
+}
+
+type consumerStatsQueryResult struct {
+	Consumer         string
+	ConsumerSource   string
+	RequestCount     float64
+	AvgLatencyNanos  float64
+	ClientErrorCount float64
+	ServerErrorCount float64
+	RateLimitedCount float64
+	ProxyErrorCount  float64
+	LastSeen         string // LastSeen is scanned as text, sqlite returns max() of a time column as a string
+}
+
+// weightedCount rounds a sum of sample weights to the number of requests it stands for
+func weightedCount(weight float64) int64 {
+	return int64(math.Round(weight))
+}
+
+// SQLRequestStore stores requests in the requests table of a postgres or sqlite database
+type SQLRequestStore struct {
+	Db *gorm.DB
+}
+
+func NewSQLRequestStore(db *gorm.DB) *SQLRequestStore {
+	return &SQLRequestStore{Db: db}
+}
+
+func (s *SQLRequestStore) Create(request *model.Request) error {
+	if request.Fingerprint == nil {
+		return s.Db.Create(request).Error
+	}
+	// duplicates are detected by the unique fingerprint index
+	rez := s.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(request)
+	if rez.Error != nil {
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return cerror.ErrDuplicateRequest
+	}
+	return nil
+}
+
+func (s *SQLRequestStore) Save(request *model.Request) error {
+	return s.Db.Save(request).Error
+}
+
+func (s *SQLRequestStore) Get(id uint) (*model.Request, error) {
+	var request model.Request
+	if err := s.Db.First(&request, id).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (s *SQLRequestStore) SetSource(id uint, source string) error {
+	return s.Db.Model(&model.Request{}).Where("id = ?", id).Update("source", source).Error
+}
+
+func (s *SQLRequestStore) List(filter RequestFilter, page RequestPage) ([]model.Request, int64, error) {
+	var total int64
+	if err := s.filterQuery(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var requests []model.Request
+	if err := s.pageQuery(s.filterQuery(filter), page).Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
+
+func (s *SQLRequestStore) Stream(filter RequestFilter, page RequestPage, fn func(*model.Request) error) error {
+	rows, err := s.pageQuery(s.filterQuery(filter), page).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var request model.Request
+		if err := s.Db.ScanRows(rows, &request); err != nil {
+			return err
+		}
+		if err := fn(&request); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// filterQuery builds the query with all filter and search parameters applied
+func (s *SQLRequestStore) filterQuery(filter RequestFilter) *gorm.DB {
+	query := s.Db.Model(&model.Request{})
+
+	if filter.ProjectID != nil {
+		query = query.Where("project_id = ?", *filter.ProjectID)
+	}
+	if len(filter.IDs) > 0 {
+		query = query.Where("id IN ?", filter.IDs)
+	}
+	if filter.AfterID > 0 {
+		query = query.Where("id > ?", filter.AfterID)
+	}
+	if filter.Search != nil && *filter.Search != "" {
+		// a substring match, served by the trigram index on postgres
+		query = query.Where(`path LIKE ? ESCAPE '\'`, "%"+escapeLike(*filter.Search)+"%")
+	}
+	if filter.Query != nil {
+		sql, args := filter.Query.SQL(s.Db.Dialector.Name())
+		query = query.Where(sql, args...)
+	}
+	if filter.Method != nil && *filter.Method != "" {
+		query = query.Where("method = ?", *filter.Method)
+	}
+	if filter.Response != nil {
+		// Use a pointer to allow filtering for '0', though '0' is not a real HTTP status.
+		query = query.Where("response = ?", *filter.Response)
+	}
+	if filter.Source != nil && *filter.Source != "" {
+		query = query.Where("source = ?", *filter.Source)
+	}
+	if filter.Consumer != nil {
+		query = query.Where("consumer = ?", *filter.Consumer)
+	}
+	if len(filter.Paths) > 0 {
+		query = query.Where("path IN ?", filter.Paths)
+	}
+	if filter.PathPrefix != "" {
+		query = query.Where(`path LIKE ? ESCAPE '\'`, escapeLike(filter.PathPrefix)+"%")
+	}
+	if len(filter.ExcludeSources) > 0 {
+		query = query.Where("source NOT IN ?", filter.ExcludeSources)
+	}
+	if filter.Answered {
+		query = query.Where("response > 0")
+	}
+	if filter.ExcludeProxyErrors {
+		query = query.Where("coalesce(proxy_error, '') = ''")
+	}
+	if filter.WithConsumer {
+		query = query.Where("consumer <> ''")
+	}
+	if filter.StartTime != nil {
+		query = query.Where("created_at >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("created_at <= ?", *filter.EndTime)
+	}
+
+	return query
+}
+
+// pageQuery applies sorting and pagination parameters to the query
+func (s *SQLRequestStore) pageQuery(query *gorm.DB, page RequestPage) *gorm.DB {
+	if column := sortColumn(page.SortBy); column != "" {
+		order := "asc"
+		if page.Order == "desc" {
+			order = "desc"
+		}
+		query = query.Order(column + " " + order)
+		if column != "id" {
+			query = query.Order("id " + order)
+		}
+	} else {
+		// Default sort if nothing is provided, newest first
+		query = query.Order("created_at desc").Order("id desc")
+	}
+
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit)
+	}
+	if page.Offset > 0 {
+		query = query.Offset(page.Offset)
+	}
+	return query
+}
+
+// sortColumn returns the column requests can be sorted by, empty for unknown columns
+func sortColumn(sortBy string) string {
+	switch sortBy {
+	case "created_at", "response_time", "latency", "id":
+		return sortBy
+	}
+	return ""
+}
+
+func (s *SQLRequestStore) PathStatistics(filter RequestFilter) ([]model.PathStatistics, error) {
+	var results []pathStatsQueryResult
+	// Using SUM with CASE WHEN (or equivalent) for conditional counting, every request counts with its sample weight
+	err := s.filterQuery(filter).Select(`
+		path,
+		`+_WEIGHTED_STATS_COLUMNS, model.SourceRateLimit).Group("path").Order("request_count desc").Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]model.PathStatistics, len(results))
+	for i, res := range results {
+		stats[i] = model.PathStatistics{
+			Path:             res.Path,
+			RequestCount:     weightedCount(res.RequestCount),
+			AverageLatencyMs: res.AvgLatencyNanos / float64(time.Millisecond), // Convert ns to ms
+			ClientErrorCount: weightedCount(res.ClientErrorCount),
+			ServerErrorCount: weightedCount(res.ServerErrorCount),
+			RateLimitedCount: weightedCount(res.RateLimitedCount),
+			ProxyErrorCount:  weightedCount(res.ProxyErrorCount),
+		}
+	}
+	return stats, nil
+}
+
+func (s *SQLRequestStore) ConsumerStatistics(filter RequestFilter, sortBy string, limit int) ([]model.ConsumerStatistics, error) {
+	query := s.filterQuery(filter)
+
+	order := "request_count desc"
+	switch sortBy {
+	case "errors":
+		order = "sum(case when response >= 400 then sample_weight else 0 end) desc, request_count desc"
+	case "latency":
+		order = "avg_latency_nanos desc"
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var results []consumerStatsQueryResult
+	err := query.Select(`
+		consumer,
+		max(consumer_source) as consumer_source,
+		max(created_at) as last_seen,
+		`+_WEIGHTED_STATS_COLUMNS, model.SourceRateLimit).Group("consumer").Order(order).Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]model.ConsumerStatistics, len(results))
+	for i, res := range results {
+		stats[i] = model.ConsumerStatistics{
+			Consumer:         res.Consumer,
+			ConsumerSource:   res.ConsumerSource,
+			RequestCount:     weightedCount(res.RequestCount),
+			AverageLatencyMs: res.AvgLatencyNanos / float64(time.Millisecond),
+			ClientErrorCount: weightedCount(res.ClientErrorCount),
+			ServerErrorCount: weightedCount(res.ServerErrorCount),
+			RateLimitedCount: weightedCount(res.RateLimitedCount),
+			ProxyErrorCount:  weightedCount(res.ProxyErrorCount),
+			LastSeen:         parseDbTime(res.LastSeen),
+		}
+	}
+	return stats, nil
+}
+
+func (s *SQLRequestStore) DeleteBefore(before time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := s.Db.Model(&model.Request{}).Where("created_at < ?", before).Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := s.Db.Delete(&model.Request{}, ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// selectsRequests reports if filter selects requests by more than their project and time
+func (f RequestFilter) selectsRequests() bool {
+	return f.IDs != nil || f.AfterID > 0 || f.Search != nil || f.Query != nil || f.Method != nil || f.Response != nil || f.Source != nil ||
+		f.Consumer != nil || f.Paths != nil || f.PathPrefix != "" || f.ExcludeSources != nil || f.Answered || f.ExcludeProxyErrors || f.WithConsumer
+}
+
+const _REQUEST_ID_BATCH_SIZE = 1000
+
+// forRequestIDs calls fn with the ids of the requests matching filter so tables referencing requests can be filtered in sql.
+// It is called once with a subquery when the requests are in the same database, else with batches of at most
+// _REQUEST_ID_BATCH_SIZE ids to keep the IN lists bounded
+func forRequestIDs(store RequestStore, filter RequestFilter, fn func(ids any) error) error {
+	if payloadStore, ok := store.(*PayloadRequestStore); ok {
+		var err error
+		if filter, err = filter.withoutPayloads(); err != nil {
+			return err
+		}
+		store = payloadStore.RequestStore
+	}
+	if sqlStore, ok := store.(*SQLRequestStore); ok {
+		return fn(sqlStore.filterQuery(filter).Select("id"))
+	}
+
+	ids := make([]uint, 0, _REQUEST_ID_BATCH_SIZE)
+	err := store.Stream(filter, RequestPage{}, func(request *model.Request) error {
+		ids = append(ids, request.ID)
+		if len(ids) < _REQUEST_ID_BATCH_SIZE {
+			return nil
+		}
+		err := fn(ids)
+		ids = make([]uint, 0, _REQUEST_ID_BATCH_SIZE)
+		return err
+	})
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return fn(ids)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so they match themselves
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// parseDbTime parses a timestamp aggregated by the database, postgres and sqlite format them differently
+func parseDbTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,454 @@
+package service
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"gorm.io/gorm"
+)
+
+// embeddedRecord is a line of the embedded store file, a stored request or the ids of deleted requests
+type embeddedRecord struct {
+	Request *model.Request `json:"request,omitempty"`
+	Deleted []uint         `json:"deleted,omitempty"`
+}
+
+// EmbeddedRequestStore keeps requests in memory, for single binary deployments without a database server.
+// With a file every change is appended to it and the requests are read back on open, the file is
+// compacted on open so it only grows with the changes of one run
+type EmbeddedRequestStore struct {
+	mu           sync.RWMutex
+	requests     map[uint]*model.Request
+	fingerprints map[string]uint // fingerprints are the ids of imported requests by fingerprint
+	lastID       uint
+	file         *os.File // file is nil when requests are only kept in memory
+	encoder      *json.Encoder
+}
+
+// NewEmbeddedRequestStore opens the store kept in path, an empty path keeps requests in memory only
+func NewEmbeddedRequestStore(path string) (*EmbeddedRequestStore, error) {
+	store := &EmbeddedRequestStore{requests: map[uint]*model.Request{}, fingerprints: map[string]uint{}}
+	if path == "" {
+		return store, nil
+	}
+
+	if err := store.load(path); err != nil {
+		return nil, err
+	}
+	if err := store.compact(path); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load replays the records of the file in path
+func (s *EmbeddedRequestStore) load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var record embeddedRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// a record cut off by a crash is dropped
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.apply(record)
+	}
+}
+
+// compact rewrites the file with the current requests and keeps it open for appending
+func (s *EmbeddedRequestStore) compact(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, id := range s.sortedIDs() {
+		if err := encoder.Encode(embeddedRecord{Request: s.requests[id]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.encoder = json.NewEncoder(s.file)
+	return nil
+}
+
+// Close closes the file of the store
+func (s *EmbeddedRequestStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.encoder = nil, nil
+	return err
+}
+
+// apply changes the requests in memory
+func (s *EmbeddedRequestStore) apply(record embeddedRecord) {
+	if request := record.Request; request != nil {
+		s.forget(request.ID)
+		s.requests[request.ID] = request
+		if request.Fingerprint != nil {
+			s.fingerprints[*request.Fingerprint] = request.ID
+		}
+		s.lastID = max(s.lastID, request.ID)
+	}
+	for _, id := range record.Deleted {
+		s.forget(id)
+		delete(s.requests, id)
+	}
+}
+
+// forget drops the fingerprint of a request that is replaced or deleted
+func (s *EmbeddedRequestStore) forget(id uint) {
+	if request, ok := s.requests[id]; ok && request.Fingerprint != nil {
+		delete(s.fingerprints, *request.Fingerprint)
+	}
+}
+
+// commit writes record to the file and applies it, the caller holds the write lock
+func (s *EmbeddedRequestStore) commit(record embeddedRecord) error {
+	if s.encoder != nil {
+		if err := s.encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	s.apply(record)
+	return nil
+}
+
+func (s *EmbeddedRequestStore) sortedIDs() []uint {
+	ids := make([]uint, 0, len(s.requests))
+	for id := range s.requests {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (s *EmbeddedRequestStore) Create(request *model.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if request.Fingerprint != nil {
+		if _, ok := s.fingerprints[*request.Fingerprint]; ok {
+			return cerror.ErrDuplicateRequest
+		}
+	}
+	stored := *request
+	stored.ID = s.lastID + 1
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = time.Now()
+	}
+	if err := s.commit(embeddedRecord{Request: &stored}); err != nil {
+		return err
+	}
+	*request = stored
+	return nil
+}
+
+func (s *EmbeddedRequestStore) Save(request *model.Request) error {
+	if request.ID == 0 {
+		return s.Create(request)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *request
+	return s.commit(embeddedRecord{Request: &stored})
+}
+
+func (s *EmbeddedRequestStore) Get(id uint) (*model.Request, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.requests[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	request := *stored
+	return &request, nil
+}
+
+func (s *EmbeddedRequestStore) SetSource(id uint, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.requests[id]
+	if !ok {
+		return nil
+	}
+	request := *stored
+	request.Source = source
+	return s.commit(embeddedRecord{Request: &request})
+}
+
+// match returns copies of the requests matching filter sorted by page
+func (s *EmbeddedRequestStore) match(filter RequestFilter, page RequestPage) []model.Request {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []model.Request
+	for _, request := range s.requests {
+		if filter.matches(request) {
+			matched = append(matched, *request)
+		}
+	}
+
+	column := sortColumn(page.SortBy)
+	desc := page.Order == "desc" || column == ""
+	slices.SortStableFunc(matched, func(a, b model.Request) int {
+		var cmp int
+		switch column {
+		case "response_time":
+			cmp = a.ResponseTime.Compare(b.ResponseTime)
+		case "latency":
+			cmp = compareInt(int64(a.Latency), int64(b.Latency))
+		case "id":
+			// compared by id below
+		default:
+			cmp = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if cmp == 0 {
+			cmp = compareInt(int64(a.ID), int64(b.ID))
+		}
+		if desc {
+			return -cmp
+		}
+		return cmp
+	})
+	return matched
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matches reports if request is selected by f
+func (f RequestFilter) matches(request *model.Request) bool {
+	switch {
+	case f.ProjectID != nil && request.ProjectID != *f.ProjectID,
+		len(f.IDs) > 0 && !slices.Contains(f.IDs, request.ID),
+		request.ID <= f.AfterID,
+		f.Search != nil && !strings.Contains(request.Path, *f.Search),
+		f.Query != nil && !f.Query.Matches(request),
+		f.Method != nil && *f.Method != "" && request.Method != *f.Method,
+		f.Response != nil && request.Response != *f.Response,
+		f.Source != nil && *f.Source != "" && request.Source != *f.Source,
+		f.Consumer != nil && request.Consumer != *f.Consumer,
+		len(f.Paths) > 0 && !slices.Contains(f.Paths, request.Path),
+		!strings.HasPrefix(request.Path, f.PathPrefix),
+		slices.Contains(f.ExcludeSources, request.Source),
+		f.Answered && request.Response <= 0,
+		f.ExcludeProxyErrors && request.ProxyError != "",
+		f.WithConsumer && request.Consumer == "",
+		f.StartTime != nil && request.CreatedAt.Before(*f.StartTime),
+		f.EndTime != nil && request.CreatedAt.After(*f.EndTime):
+		return false
+	}
+	return true
+}
+
+// paginate returns the page of requests
+func paginate(requests []model.Request, page RequestPage) []model.Request {
+	if page.Offset > 0 {
+		requests = requests[min(page.Offset, len(requests)):]
+	}
+	if page.Limit > 0 {
+		requests = requests[:min(page.Limit, len(requests))]
+	}
+	return requests
+}
+
+func (s *EmbeddedRequestStore) List(filter RequestFilter, page RequestPage) ([]model.Request, int64, error) {
+	matched := s.match(filter, page)
+	return paginate(matched, page), int64(len(matched)), nil
+}
+
+func (s *EmbeddedRequestStore) Stream(filter RequestFilter, page RequestPage, fn func(*model.Request) error) error {
+	for _, request := range paginate(s.match(filter, page), page) {
+		if err := fn(&request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestAggregate sums up a group of requests
+// requestAggregate sums the sample weights of a group of requests, so sampled requests count as the requests they stand for
+type requestAggregate struct {
+	key            string
+	consumerSource string
+	count          float64
+	latency        float64 // latency is the weighted sum of the latencies in nanoseconds
+	clientErrors   float64
+	serverErrors   float64
+	rateLimited    float64
+	proxyErrors    float64
+	lastSeen       time.Time
+}
+
+func (a *requestAggregate) add(request *model.Request) {
+	weight := request.Weight()
+	a.count += weight
+	a.latency += float64(request.Latency) * weight
+	switch {
+	case request.ProxyError != "":
+		a.proxyErrors += weight
+	case request.Response >= 500:
+		a.serverErrors += weight
+	case request.Response >= 400:
+		a.clientErrors += weight
+	}
+	if request.Source == model.SourceRateLimit {
+		a.rateLimited += weight
+	}
+	a.consumerSource = max(a.consumerSource, request.ConsumerSource)
+	if request.CreatedAt.After(a.lastSeen) {
+		a.lastSeen = request.CreatedAt
+	}
+}
+
+func (a *requestAggregate) averageLatencyMs() float64 {
+	return a.latency / a.count / float64(time.Millisecond)
+}
+
+// aggregate groups the requests matching filter by key
+func (s *EmbeddedRequestStore) aggregate(filter RequestFilter, key func(*model.Request) string) []*requestAggregate {
+	groups := map[string]*requestAggregate{}
+	var aggregates []*requestAggregate
+	for _, request := range s.match(filter, RequestPage{}) {
+		name := key(&request)
+		group, ok := groups[name]
+		if !ok {
+			group = &requestAggregate{key: name}
+			groups[name] = group
+			aggregates = append(aggregates, group)
+		}
+		group.add(&request)
+	}
+	return aggregates
+}
+
+func (s *EmbeddedRequestStore) PathStatistics(filter RequestFilter) ([]model.PathStatistics, error) {
+	aggregates := s.aggregate(filter, func(request *model.Request) string { return request.Path })
+	slices.SortStableFunc(aggregates, func(a, b *requestAggregate) int {
+		return cmp.Compare(b.count, a.count)
+	})
+
+	stats := make([]model.PathStatistics, len(aggregates))
+	for i, aggregate := range aggregates {
+		stats[i] = model.PathStatistics{
+			Path:             aggregate.key,
+			RequestCount:     weightedCount(aggregate.count),
+			AverageLatencyMs: aggregate.averageLatencyMs(),
+			ClientErrorCount: weightedCount(aggregate.clientErrors),
+			ServerErrorCount: weightedCount(aggregate.serverErrors),
+			RateLimitedCount: weightedCount(aggregate.rateLimited),
+			ProxyErrorCount:  weightedCount(aggregate.proxyErrors),
+		}
+	}
+	return stats, nil
+}
+
+func (s *EmbeddedRequestStore) ConsumerStatistics(filter RequestFilter, sortBy string, limit int) ([]model.ConsumerStatistics, error) {
+	aggregates := s.aggregate(filter, func(request *model.Request) string { return request.Consumer })
+	slices.SortStableFunc(aggregates, func(a, b *requestAggregate) int {
+		switch sortBy {
+		case "errors":
+			if c := cmp.Compare(b.clientErrors+b.serverErrors+b.proxyErrors, a.clientErrors+a.serverErrors+a.proxyErrors); c != 0 {
+				return c
+			}
+		case "latency":
+			return cmp.Compare(b.latency/b.count, a.latency/a.count)
+		}
+		return cmp.Compare(b.count, a.count)
+	})
+	if limit > 0 {
+		aggregates = aggregates[:min(limit, len(aggregates))]
+	}
+
+	stats := make([]model.ConsumerStatistics, len(aggregates))
+	for i, aggregate := range aggregates {
+		stats[i] = model.ConsumerStatistics{
+			Consumer:         aggregate.key,
+			ConsumerSource:   aggregate.consumerSource,
+			RequestCount:     weightedCount(aggregate.count),
+			AverageLatencyMs: aggregate.averageLatencyMs(),
+			ClientErrorCount: weightedCount(aggregate.clientErrors),
+			ServerErrorCount: weightedCount(aggregate.serverErrors),
+			RateLimitedCount: weightedCount(aggregate.rateLimited),
+			ProxyErrorCount:  weightedCount(aggregate.proxyErrors),
+			LastSeen:         aggregate.lastSeen,
+		}
+	}
+	return stats, nil
+}
+
+func (s *EmbeddedRequestStore) DeleteBefore(before time.Time, limit int) ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uint
+	for _, id := range s.sortedIDs() {
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+		if s.requests[id].CreatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if err := s.commit(embeddedRecord{Deleted: ids}); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,236 @@
+package service_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"treblle/migration"
+	"treblle/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// capturedQuery is a select run by the store
+type capturedQuery struct {
+	sql  string
+	vars []any
+}
+
+// captureQueries records the selects run on db
+func captureQueries(t *testing.T, db *gorm.DB) func() []capturedQuery {
+	var mu sync.Mutex
+	var queries []capturedQuery
+	capture := func(tx *gorm.DB) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, capturedQuery{sql: tx.Statement.SQL.String(), vars: tx.Statement.Vars})
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture_query", capture))
+	require.NoError(t, db.Callback().Row().After("gorm:row").Register("test:capture_row", capture))
+	return func() []capturedQuery {
+		mu.Lock()
+		defer mu.Unlock()
+		captured := queries
+		queries = nil
+		return captured
+	}
+}
+
+// queryPlan returns the sqlite query plan of query
+func queryPlan(t *testing.T, db *gorm.DB, query capturedQuery) string {
+	var rows []struct {
+		Detail string
+	}
+	require.NoError(t, db.Raw("EXPLAIN QUERY PLAN "+query.sql, query.vars...).Scan(&rows).Error)
+	details := make([]string, len(rows))
+	for i, row := range rows {
+		details[i] = row.Detail
+	}
+	return strings.Join(details, "\n")
+}
+
+// TestRequestStore_QueryPlans checks the request log queries use the indexes of the migrations
+func TestRequestStore_QueryPlans(t *testing.T) {
+	db := openTestDb(t, sqlite.Open(filepath.Join(t.TempDir(), "plans.db")))
+	migrator := migration.New(db)
+	migrator.Logger = zap.NewNop().Sugar()
+	_, err := migrator.Up()
+	require.NoError(t, err)
+
+	store := service.NewSQLRequestStore(db)
+	captured := captureQueries(t, db)
+	projectID := uint(1)
+	method := "POST"
+	response := 500
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		run   func() error
+		index string
+	}{
+		{"list", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID}, service.RequestPage{Limit: 50})
+			return err
+		}, "idx_requests_project_created"},
+		{"list by method", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID, Method: &method}, service.RequestPage{Limit: 50})
+			return err
+		}, "idx_requests_project_method"},
+		{"list by response", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID, Response: &response}, service.RequestPage{Limit: 50})
+			return err
+		}, "idx_requests_project_response"},
+		{"path statistics", func() error {
+			_, err := store.PathStatistics(service.RequestFilter{ProjectID: &projectID, StartTime: &start})
+			return err
+		}, "idx_requests_project_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captured()
+			require.NoError(t, tt.run())
+			queries := captured()
+			require.NotEmpty(t, queries)
+			// the count may use any of the indexes, the rows are read with the index of the filter
+			for _, query := range queries {
+				plan := queryPlan(t, db, query)
+				assert.Contains(t, plan, "idx_requests_project_", query.sql)
+				assert.NotContains(t, strings.Split(plan, "\n"), "SCAN requests", query.sql)
+			}
+			assert.Contains(t, queryPlan(t, db, queries[len(queries)-1]), tt.index)
+		})
+	}
+}
+
+// BenchmarkRequestStore compares the request log queries on the schema before and after the index migration.
+// BENCH_REQUESTS sets the number of stored requests, with TEST_POSTGRES_DSN set postgres is measured as well:
+//
+//	go test ./service -run '^$' -bench RequestStore -benchtime 20x
+func BenchmarkRequestStore(b *testing.B) {
+	count := 1_000_000
+	if value := os.Getenv("BENCH_REQUESTS"); value != "" {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil {
+			b.Fatalf("BENCH_REQUESTS should be a number, err = %v", err)
+		}
+	}
+
+	type database struct {
+		name string
+		open func(b *testing.B, schema string) *gorm.DB
+	}
+	databases := []database{{"sqlite", func(b *testing.B, schema string) *gorm.DB {
+		return openTestDb(b, sqlite.Open(filepath.Join(b.TempDir(), schema+".db")))
+	}}}
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		databases = append(databases, database{"postgres", func(b *testing.B, schema string) *gorm.DB {
+			db := openTestDb(b, postgres.Open(dsn))
+			schema = "treblle_bench_" + schema
+			if err := db.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE").Error; err != nil {
+				b.Fatal(err)
+			}
+			if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+				b.Fatal(err)
+			}
+			return openTestDb(b, postgres.Open(withSearchPath(dsn, schema)))
+		}})
+	}
+
+	for _, database := range databases {
+		for _, schema := range []struct {
+			name    string
+			version int // version is the number of applied migrations
+		}{{"unindexed", 1}, {"indexed", len(migration.Migrations)}} {
+			db := database.open(b, schema.name)
+			migrator := migration.New(db)
+			migrator.Logger = zap.NewNop().Sugar()
+			migrator.Migrations = migration.Migrations[:schema.version]
+			if _, err := migrator.Up(); err != nil {
+				b.Fatal(err)
+			}
+			if err := seedRequests(db, count); err != nil {
+				b.Fatal(err)
+			}
+			benchmarkQueries(b, database.name+"/"+schema.name, service.NewSQLRequestStore(db))
+		}
+	}
+}
+
+func benchmarkQueries(b *testing.B, name string, store *service.SQLRequestStore) {
+	projectID := uint(3)
+	method := "DELETE"
+	response := 503
+	search := "orders/17"
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	dayEnd := day.Add(24 * time.Hour)
+
+	queries := []struct {
+		name string
+		run  func() error
+	}{
+		{"list", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID}, service.RequestPage{Limit: 50})
+			return err
+		}},
+		{"list_by_method_and_response", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID, Method: &method, Response: &response}, service.RequestPage{Limit: 50})
+			return err
+		}},
+		{"search_path", func() error {
+			_, _, err := store.List(service.RequestFilter{ProjectID: &projectID, Search: &search}, service.RequestPage{Limit: 50})
+			return err
+		}},
+		{"statistics_of_a_day", func() error {
+			_, err := store.PathStatistics(service.RequestFilter{ProjectID: &projectID, StartTime: &day, EndTime: &dayEnd})
+			return err
+		}},
+	}
+	for _, query := range queries {
+		b.Run(name+"/"+query.name, func(b *testing.B) {
+			for b.Loop() {
+				if err := query.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// seedRequests inserts count requests spread over 10 projects, 500 paths and a month
+func seedRequests(db *gorm.DB, count int) error {
+	createdAt := "datetime('2024-01-01', '+' || (n * 2) || ' seconds')"
+	if db.Dialector.Name() == "postgres" {
+		createdAt = "timestamp '2024-01-01' + n * interval '2 seconds'"
+	}
+	return db.Exec(fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < ?)
+		INSERT INTO requests (project_id, source, method, response, path, consumer, consumer_source, query, response_time, created_at, latency)
+		SELECT n %% 10, 'proxy',
+			CASE n %% 4 WHEN 0 THEN 'GET' WHEN 1 THEN 'POST' WHEN 2 THEN 'PUT' ELSE 'DELETE' END,
+			CASE WHEN n %% 50 = 0 THEN 503 WHEN n %% 7 = 0 THEN 404 ELSE 200 END,
+			'/api/' || CASE n %% 3 WHEN 0 THEN 'users' WHEN 1 THEN 'orders' ELSE 'products' END || '/' || (n %% 167),
+			'consumer-' || (n %% 100), 'api_key', '', %[1]s, %[1]s, (n %% 1000) * 1000000
+		FROM seq`, createdAt), count).Error
+}
+
+// withSearchPath sets the schema of a postgres connection string
+func withSearchPath(dsn, schema string) string {
+	switch {
+	case strings.Contains(dsn, "://") && strings.Contains(dsn, "?"):
+		return dsn + "&search_path=" + schema
+	case strings.Contains(dsn, "://"):
+		return dsn + "?search_path=" + schema
+	default:
+		return dsn + " search_path=" + schema
+	}
+}
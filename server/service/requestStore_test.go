@@ -0,0 +1,444 @@
+package service_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// RequestStoreTestSuite checks every backend behaves the same, newStore returns an empty store
+type RequestStoreTestSuite struct {
+	suite.Suite
+	newStore func(t *testing.T) service.RequestStore
+	store    service.RequestStore
+	now      time.Time
+}
+
+func (suite *RequestStoreTestSuite) SetupTest() {
+	suite.store = suite.newStore(suite.T())
+	suite.now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// seed stores requests created a minute apart, oldest first
+func (suite *RequestStoreTestSuite) seed() []model.Request {
+	requests := []model.Request{
+		{Method: "GET", Path: "/users", Response: 200, Source: model.SourceProxy, Consumer: "alice", ConsumerSource: "api_key", Latency: 10 * time.Millisecond},
+		{Method: "POST", Path: "/users", Response: 201, Source: model.SourceProxy, Consumer: "alice", ConsumerSource: "api_key", Latency: 30 * time.Millisecond},
+		{Method: "GET", Path: "/orders", Response: 404, Source: model.SourceProxy, Consumer: "bob", ConsumerSource: "ip", Latency: 50 * time.Millisecond},
+		{Method: "GET", Path: "/orders", Response: 500, Source: model.SourceMock, Consumer: "bob", ConsumerSource: "ip", Latency: 70 * time.Millisecond},
+		{Method: "GET", Path: "/health", Response: 0, Source: model.SourceProxy, ProjectID: 2, Latency: 5 * time.Millisecond},
+	}
+	for i := range requests {
+		requests[i].CreatedAt = suite.now.Add(time.Duration(i) * time.Minute)
+		requests[i].ResponseTime = requests[i].CreatedAt.Add(requests[i].Latency)
+		suite.Require().NoError(suite.store.Create(&requests[i]))
+		suite.Require().NotZero(requests[i].ID)
+	}
+	return requests
+}
+
+func ids(requests []model.Request) []uint {
+	ids := make([]uint, len(requests))
+	for i, request := range requests {
+		ids[i] = request.ID
+	}
+	return ids
+}
+
+func (suite *RequestStoreTestSuite) TestCreateGetSave() {
+	request := model.Request{Method: "GET", Path: "/users", Source: model.SourceProxy, CreatedAt: suite.now, RequestHeaders: model.Headers{"Accept": {"*/*"}}, RequestBody: []byte(`{"a":1}`)}
+	suite.Require().NoError(suite.store.Create(&request))
+
+	got, err := suite.store.Get(request.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "/users", got.Path)
+	assert.Equal(suite.T(), []byte(`{"a":1}`), got.RequestBody)
+	assert.Equal(suite.T(), model.Headers{"Accept": {"*/*"}}, got.RequestHeaders)
+	assert.True(suite.T(), suite.now.Equal(got.CreatedAt))
+
+	got.Response = 204
+	got.Latency = time.Second
+	suite.Require().NoError(suite.store.Save(got))
+	got, err = suite.store.Get(request.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 204, got.Response)
+	assert.Equal(suite.T(), time.Second, got.Latency)
+
+	suite.Require().NoError(suite.store.SetSource(request.ID, model.SourceRateLimit))
+	got, err = suite.store.Get(request.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.SourceRateLimit, got.Source)
+
+	_, err = suite.store.Get(request.ID + 100)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *RequestStoreTestSuite) TestList_ExcludesProxyErrors() {
+	requests := suite.seed()
+	failed := model.Request{Method: "GET", Path: "/orders", Response: 502, ProxyError: string(model.ProxyErrorConnectionRefused), Source: model.SourceProxy, CreatedAt: suite.now}
+	suite.Require().NoError(suite.store.Create(&failed))
+
+	filter := service.RequestFilter{Paths: []string{"/orders"}}
+	list, _, err := suite.store.List(filter, service.RequestPage{})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), list, 3)
+
+	filter.ExcludeProxyErrors = true
+	list, _, err = suite.store.List(filter, service.RequestPage{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []uint{requests[3].ID, requests[2].ID}, ids(list))
+}
+
+func (suite *RequestStoreTestSuite) TestList_FiltersSortsAndPaginates() {
+	requests := suite.seed()
+
+	list, total, err := suite.store.List(service.RequestFilter{}, service.RequestPage{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(5), total)
+	assert.Equal(suite.T(), []uint{requests[4].ID, requests[3].ID, requests[2].ID, requests[1].ID, requests[0].ID}, ids(list)) // newest first
+
+	method, consumer, response := "GET", "bob", 500
+	tests := []struct {
+		name   string
+		filter service.RequestFilter
+		want   []model.Request
+	}{
+		{"method", service.RequestFilter{Method: &method}, []model.Request{requests[4], requests[3], requests[2], requests[0]}},
+		{"consumer and response", service.RequestFilter{Consumer: &consumer, Response: &response}, []model.Request{requests[3]}},
+		{"paths", service.RequestFilter{Paths: []string{"/orders", "/health"}}, []model.Request{requests[4], requests[3], requests[2]}},
+		{"exclude sources", service.RequestFilter{ExcludeSources: []string{model.SourceMock}, Answered: true}, []model.Request{requests[2], requests[1], requests[0]}},
+		{"with consumer", service.RequestFilter{WithConsumer: true, IDs: []uint{requests[0].ID, requests[4].ID}}, []model.Request{requests[0]}},
+		{"time range", service.RequestFilter{StartTime: &requests[1].CreatedAt, EndTime: &requests[2].CreatedAt}, []model.Request{requests[2], requests[1]}},
+		{"after id", service.RequestFilter{AfterID: requests[2].ID}, []model.Request{requests[4], requests[3]}},
+		{"path prefix", service.RequestFilter{PathPrefix: "/use"}, []model.Request{requests[1], requests[0]}},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			list, total, err := suite.store.List(tt.filter, service.RequestPage{})
+			suite.Require().NoError(err)
+			assert.Equal(suite.T(), int64(len(tt.want)), total)
+			assert.Equal(suite.T(), ids(tt.want), ids(list))
+		})
+	}
+
+	search := "user"
+	projectID := uint(0)
+	list, total, err = suite.store.List(service.RequestFilter{Search: &search, ProjectID: &projectID}, service.RequestPage{SortBy: "latency", Order: "desc", Limit: 1, Offset: 1})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total) // total is before pagination
+	assert.Equal(suite.T(), []uint{requests[0].ID}, ids(list))
+
+	// keyset pages in id order
+	list, _, err = suite.store.List(service.RequestFilter{AfterID: requests[0].ID}, service.RequestPage{SortBy: "id", Order: "asc", Limit: 2})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []uint{requests[1].ID, requests[2].ID}, ids(list))
+
+	// wildcards in the search match themselves
+	for _, search := range []string{"_", "%", "/us_rs"} {
+		_, total, err = suite.store.List(service.RequestFilter{Search: &search}, service.RequestPage{})
+		suite.Require().NoError(err)
+		assert.Zero(suite.T(), total, search)
+	}
+
+	// Stream keeps the order of List
+	var streamed []uint
+	page := service.RequestPage{SortBy: "latency", Order: "asc", Limit: 3}
+	suite.Require().NoError(suite.store.Stream(service.RequestFilter{}, page, func(request *model.Request) error {
+		streamed = append(streamed, request.ID)
+		return nil
+	}))
+	list, _, err = suite.store.List(service.RequestFilter{}, page)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), ids(list), streamed)
+	assert.Equal(suite.T(), []uint{requests[4].ID, requests[0].ID, requests[1].ID}, streamed)
+}
+
+func (suite *RequestStoreTestSuite) TestList_SearchQuery() {
+	requests := suite.seed()
+	requests[2].Query = "page=2"
+	requests[2].RequestHeaders = model.Headers{"X-Request-Id": {"abc-123"}}
+	requests[3].ResponseBody = []byte(`{"error":"Upstream Timeout"}`)
+	suite.Require().NoError(suite.store.Save(&requests[2]))
+	suite.Require().NoError(suite.store.Save(&requests[3]))
+
+	tests := []struct {
+		search string
+		want   []model.Request
+	}{
+		{"orders", []model.Request{requests[3], requests[2]}},
+		{"abc-123 OR page=2 OR Timeout", nil},                      // bare terms only match the path
+		{"path:ORDERS", []model.Request{requests[3], requests[2]}}, // fields are case insensitive
+		{"query:page=2", []model.Request{requests[2]}},
+		{"header:abc-123", []model.Request{requests[2]}},
+		{"body:Timeout", []model.Request{requests[3]}},
+		{"body:timeout", nil}, // bodies are case sensitive
+		{"header:x-request-id", []model.Request{requests[2]}},
+		{"body:Upstream", []model.Request{requests[3]}},
+		{"status:5xx OR status:0", []model.Request{requests[4], requests[3]}},
+		{"status:>=400 latency:<60ms", []model.Request{requests[2]}},
+		{"method:post OR consumer:bob", []model.Request{requests[3], requests[2], requests[1]}},
+		{"path:/users NOT latency:>20ms", []model.Request{requests[0]}},
+		{"NOT body:Upstream NOT header:abc", []model.Request{requests[4], requests[1], requests[0]}}, // requests without bodies or headers
+		{"source:mock", []model.Request{requests[3]}},
+		{`"100%"`, nil},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.search, func() {
+			query, err := service.ParseSearch(tt.search)
+			suite.Require().NoError(err)
+			list, total, err := suite.store.List(service.RequestFilter{Query: query}, service.RequestPage{})
+			suite.Require().NoError(err)
+			assert.Equal(suite.T(), int64(len(tt.want)), total)
+			assert.Equal(suite.T(), ids(tt.want), ids(list))
+		})
+	}
+}
+
+func (suite *RequestStoreTestSuite) TestStatistics() {
+	suite.seed()
+	suite.Require().NoError(suite.store.Create(&model.Request{Method: "GET", Path: "/users", Response: 429, Source: model.SourceRateLimit, Consumer: "carol", CreatedAt: suite.now.Add(time.Hour)}))
+
+	paths, err := suite.store.PathStatistics(service.RequestFilter{Answered: true})
+	suite.Require().NoError(err)
+	suite.Require().Len(paths, 2)
+	assert.Equal(suite.T(), "/users", paths[0].Path)
+	assert.Equal(suite.T(), int64(3), paths[0].RequestCount)
+	assert.Equal(suite.T(), int64(1), paths[0].ClientErrorCount)
+	assert.Equal(suite.T(), int64(1), paths[0].RateLimitedCount)
+	assert.Equal(suite.T(), "/orders", paths[1].Path)
+	assert.InDelta(suite.T(), 60.0, paths[1].AverageLatencyMs, 0.001)
+	assert.Equal(suite.T(), int64(1), paths[1].ServerErrorCount)
+
+	consumers, err := suite.store.ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "", 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 3)
+	assert.Equal(suite.T(), int64(2), consumers[0].RequestCount)
+	assert.Equal(suite.T(), "carol", consumers[2].Consumer)
+
+	consumers, err = suite.store.ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "errors", 1)
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 1)
+	assert.Equal(suite.T(), "bob", consumers[0].Consumer)
+	assert.Equal(suite.T(), "ip", consumers[0].ConsumerSource)
+	assert.True(suite.T(), suite.now.Add(3*time.Minute).Equal(consumers[0].LastSeen), "last seen %v", consumers[0].LastSeen)
+
+	consumers, err = suite.store.ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "latency", 0)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "bob", consumers[0].Consumer)
+	assert.InDelta(suite.T(), 60.0, consumers[0].AverageLatencyMs, 0.001)
+}
+
+func (suite *RequestStoreTestSuite) TestStatistics_SampleWeights() {
+	// a request sampled at 1 in 4 stands for four, errors kept by tail sampling for themselves
+	requests := []model.Request{
+		{Method: "GET", Path: "/users", Response: 200, Consumer: "alice", Latency: 10 * time.Millisecond, SampleWeight: 4, CreatedAt: suite.now},
+		{Method: "GET", Path: "/users", Response: 503, Consumer: "alice", Latency: 60 * time.Millisecond, SampleWeight: 1, CreatedAt: suite.now},
+		{Method: "GET", Path: "/users", Response: 404, Consumer: "bob", Latency: 10 * time.Millisecond, SampleWeight: 2.5, CreatedAt: suite.now},
+	}
+	for i := range requests {
+		suite.Require().NoError(suite.store.Create(&requests[i]))
+	}
+
+	paths, err := suite.store.PathStatistics(service.RequestFilter{})
+	suite.Require().NoError(err)
+	suite.Require().Len(paths, 1)
+	assert.Equal(suite.T(), int64(8), paths[0].RequestCount) // 7.5 rounded
+	assert.Equal(suite.T(), int64(3), paths[0].ClientErrorCount)
+	assert.Equal(suite.T(), int64(1), paths[0].ServerErrorCount)
+	assert.InDelta(suite.T(), 125.0/7.5, paths[0].AverageLatencyMs, 0.001)
+
+	consumers, err := suite.store.ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "errors", 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 2)
+	assert.Equal(suite.T(), "bob", consumers[0].Consumer)
+	assert.Equal(suite.T(), int64(3), consumers[0].RequestCount)
+	assert.Equal(suite.T(), int64(5), consumers[1].RequestCount)
+	assert.InDelta(suite.T(), 20.0, consumers[1].AverageLatencyMs, 0.001)
+}
+
+func (suite *RequestStoreTestSuite) TestStatistics_ProxyErrors() {
+	// the synthetic 502 and 504 of proxy errors aren't server errors of the upstream
+	requests := []model.Request{
+		{Method: "GET", Path: "/users", Response: 503, Consumer: "alice", CreatedAt: suite.now},
+		{Method: "GET", Path: "/users", Response: 502, ProxyError: string(model.ProxyErrorConnectionRefused), Consumer: "alice", CreatedAt: suite.now},
+		{Method: "GET", Path: "/users", Response: 504, ProxyError: string(model.ProxyErrorTimeout), Consumer: "alice", SampleWeight: 2, CreatedAt: suite.now},
+		{Method: "GET", Path: "/users", Response: 200, Consumer: "alice", CreatedAt: suite.now},
+	}
+	for i := range requests {
+		suite.Require().NoError(suite.store.Create(&requests[i]))
+	}
+
+	paths, err := suite.store.PathStatistics(service.RequestFilter{})
+	suite.Require().NoError(err)
+	suite.Require().Len(paths, 1)
+	assert.Equal(suite.T(), int64(5), paths[0].RequestCount)
+	assert.Equal(suite.T(), int64(1), paths[0].ServerErrorCount)
+	assert.Equal(suite.T(), int64(3), paths[0].ProxyErrorCount)
+
+	consumers, err := suite.store.ConsumerStatistics(service.RequestFilter{WithConsumer: true}, "", 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 1)
+	assert.Equal(suite.T(), int64(1), consumers[0].ServerErrorCount)
+	assert.Equal(suite.T(), int64(3), consumers[0].ProxyErrorCount)
+}
+
+func (suite *RequestStoreTestSuite) TestDeleteBefore() {
+	requests := suite.seed()
+
+	deleted, err := suite.store.DeleteBefore(requests[3].CreatedAt, 2)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []uint{requests[0].ID, requests[1].ID}, deleted) // oldest first, up to the limit
+
+	deleted, err = suite.store.DeleteBefore(requests[3].CreatedAt, 2)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []uint{requests[2].ID}, deleted)
+
+	deleted, err = suite.store.DeleteBefore(requests[3].CreatedAt, 2)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), deleted)
+
+	_, err = suite.store.Get(requests[0].ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	_, total, err := suite.store.List(service.RequestFilter{}, service.RequestPage{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), total)
+}
+
+func (suite *RequestStoreTestSuite) TestCreate_SkipsDuplicateFingerprints() {
+	request := model.Request{Method: "GET", Path: "/users", Response: 200, CreatedAt: suite.now}
+	request.SetFingerprint()
+	first := request
+	suite.Require().NoError(suite.store.Create(&first))
+
+	again := request
+	assert.ErrorIs(suite.T(), suite.store.Create(&again), cerror.ErrDuplicateRequest)
+	_, total, err := suite.store.List(service.RequestFilter{}, service.RequestPage{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+
+	// the fingerprint of a deleted request can be stored again
+	_, err = suite.store.DeleteBefore(suite.now.Add(time.Minute), 10)
+	suite.Require().NoError(err)
+	again = request
+	assert.NoError(suite.T(), suite.store.Create(&again))
+}
+
+func openTestDb(t testing.TB, dialector gorm.Dialector) *gorm.DB {
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open the test database, err = %v", err)
+	}
+	return db
+}
+
+func TestRequestStore_Sqlite(t *testing.T) {
+	suite.Run(t, &RequestStoreTestSuite{newStore: func(t *testing.T) service.RequestStore {
+		db := openTestDb(t, sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())))
+		if err := db.Migrator().DropTable(&model.Request{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AutoMigrate(&model.Request{}); err != nil {
+			t.Fatal(err)
+		}
+		return service.NewSQLRequestStore(db)
+	}})
+}
+
+// TestRequestStore_Postgres runs against the database in TEST_POSTGRES_DSN, its requests table is recreated
+func TestRequestStore_Postgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	suite.Run(t, &RequestStoreTestSuite{newStore: func(t *testing.T) service.RequestStore {
+		db := openTestDb(t, postgres.Open(dsn))
+		if err := db.Migrator().DropTable(&model.Request{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AutoMigrate(&model.Request{}); err != nil {
+			t.Fatal(err)
+		}
+		return service.NewSQLRequestStore(db)
+	}})
+}
+
+func TestRequestStore_Embedded(t *testing.T) {
+	suite.Run(t, &RequestStoreTestSuite{newStore: func(t *testing.T) service.RequestStore {
+		store, err := service.NewEmbeddedRequestStore("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}})
+}
+
+func TestRequestStore_EmbeddedFile(t *testing.T) {
+	suite.Run(t, &RequestStoreTestSuite{newStore: func(t *testing.T) service.RequestStore {
+		store, err := service.NewEmbeddedRequestStore(filepath.Join(t.TempDir(), "requests.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}})
+}
+
+func TestEmbeddedRequestStore_ReopensChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := service.NewEmbeddedRequestStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := model.Request{Method: "GET", Path: "/old", CreatedAt: now.Add(-time.Hour)}
+	kept := model.Request{Method: "GET", Path: "/kept", CreatedAt: now, ResponseBody: []byte("ok")}
+	assert.NoError(t, store.Create(&old))
+	assert.NoError(t, store.Create(&kept))
+	kept.Response = 200
+	assert.NoError(t, store.Save(&kept))
+	assert.NoError(t, store.SetSource(kept.ID, model.SourceMock))
+	_, err = store.DeleteBefore(now, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	// an interrupted write leaves a partial last line
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"request":{"ID":`)
+	file.Close()
+
+	store, err = service.NewEmbeddedRequestStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	_, err = store.Get(old.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	got, err := store.Get(kept.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 200, got.Response)
+		assert.Equal(t, model.SourceMock, got.Source)
+		assert.Equal(t, []byte("ok"), got.ResponseBody)
+	}
+
+	// ids keep growing after a reopen
+	next := model.Request{Method: "GET", Path: "/next", CreatedAt: now}
+	assert.NoError(t, store.Create(&next))
+	assert.Greater(t, next.ID, kept.ID)
+}
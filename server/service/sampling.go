@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ISamplingService interface {
+	// Rule returns the most specific rule of the project covering a request with method and normalized path, nil if there is none
+	Rule(projectID uint, method, path string) (*model.SamplingRule, error)
+	// ListRules returns the sampling rules of a project
+	ListRules(projectID uint) ([]model.SamplingRule, error)
+	GetRule(projectID, id uint) (*model.SamplingRule, error)
+	CreateRule(actor string, rule *model.SamplingRule) error
+	// UpdateRule replaces a rule of the project of rule, rules of other projects are not found
+	UpdateRule(actor string, rule *model.SamplingRule) error
+	DeleteRule(actor string, projectID, id uint) error
+}
+
+// SamplingService keeps the per project and route sampling rules of the request logger,
+// routes without a rule are sampled at the runtime sample rate
+type SamplingService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	AuditSrv IAuditService
+
+	mu     sync.RWMutex
+	loaded bool
+	rules  []model.SamplingRule
+}
+
+func NewSamplingService() ISamplingService {
+	var service *SamplingService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &SamplingService{
+			Db:       db,
+			Logger:   logger,
+			AuditSrv: auditSrv,
+		}
+	})
+	return service
+}
+
+func (s *SamplingService) Rule(projectID uint, method, reqPath string) (*model.SamplingRule, error) {
+	rules, err := s.cachedRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.SamplingRule
+	for i := range rules {
+		rule := &rules[i]
+		if rule.ProjectID != projectID || !rule.Covers(method, reqPath) {
+			continue
+		}
+		if best == nil || len(rule.Path) > len(best.Path) ||
+			(len(rule.Path) == len(best.Path) && best.Method == "" && rule.Method != "") {
+			best = rule
+		}
+	}
+	return best, nil
+}
+
+func (s *SamplingService) cachedRules() ([]model.SamplingRule, error) {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		return s.rules, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		var rules []model.SamplingRule
+		if err := s.Db.Find(&rules).Error; err != nil {
+			s.Logger.Errorf("Failed to load sampling rules, error = %v", err)
+			return nil, err
+		}
+		s.rules = rules
+		s.loaded = true
+	}
+	return s.rules, nil
+}
+
+// invalidate drops the cached rules so they are reloaded on the next request
+func (s *SamplingService) invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.rules = nil
+	s.mu.Unlock()
+}
+
+func (s *SamplingService) ListRules(projectID uint) ([]model.SamplingRule, error) {
+	var rules []model.SamplingRule
+	if err := s.Db.Where("project_id = ?", projectID).Order("path asc").Order("method asc").Find(&rules).Error; err != nil {
+		s.Logger.Errorf("Failed to list sampling rules, error = %v", err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *SamplingService) GetRule(projectID, id uint) (*model.SamplingRule, error) {
+	var rule model.SamplingRule
+	if err := s.Db.Where("project_id = ?", projectID).First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *SamplingService) CreateRule(actor string, rule *model.SamplingRule) error {
+	if err := prepareSamplingRule(rule); err != nil {
+		return err
+	}
+	rule.ID = 0
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditSamplingRuleCreated, model.AuditTarget("sampling_rule", rule.ID), nil, rule)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create sampling rule, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *SamplingService) UpdateRule(actor string, rule *model.SamplingRule) error {
+	if err := prepareSamplingRule(rule); err != nil {
+		return err
+	}
+
+	existing, err := s.GetRule(rule.ProjectID, rule.ID)
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditSamplingRuleUpdated, model.AuditTarget("sampling_rule", rule.ID), existing, rule)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to update sampling rule, error = %v", err)
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *SamplingService) DeleteRule(actor string, projectID, id uint) error {
+	existing, err := s.GetRule(projectID, id)
+	if err != nil {
+		return err
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.Delete(&model.SamplingRule{}, id)
+		if rez.Error != nil {
+			s.Logger.Errorf("Failed to delete sampling rule, error = %v", rez.Error)
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditSamplingRuleDeleted, model.AuditTarget("sampling_rule", id), existing, nil)
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// prepareSamplingRule validates the rule and normalizes its method, path and key header
+func prepareSamplingRule(rule *model.SamplingRule) error {
+	rule.Method = strings.ToUpper(strings.TrimSpace(rule.Method))
+	rule.Path = normalizePath(rule.Path)
+	rule.KeyHeader = http.CanonicalHeaderKey(strings.TrimSpace(rule.KeyHeader))
+	if rule.Mode == "" {
+		rule.Mode = model.SamplingHead
+	}
+
+	if !rule.Mode.IsValid() {
+		return fmt.Errorf("%w: mode should be head or tail", cerror.ErrBadSamplingRule)
+	}
+	if rule.Rate < 0 || rule.Rate > 1 {
+		return fmt.Errorf("%w: rate should be between 0 and 1", cerror.ErrBadSamplingRule)
+	}
+	if rule.KeepStatus != 0 && (rule.KeepStatus < 100 || rule.KeepStatus > 599) {
+		return fmt.Errorf("%w: keepStatus should be a status code", cerror.ErrBadSamplingRule)
+	}
+	if rule.SlowThreshold < 0 {
+		return fmt.Errorf("%w: slowThresholdMs can't be negative", cerror.ErrBadSamplingRule)
+	}
+	if rule.Mode == model.SamplingHead && (rule.KeepStatus != 0 || rule.SlowThreshold != 0) {
+		return fmt.Errorf("%w: keeping errors and slow requests needs tail sampling", cerror.ErrBadSamplingRule)
+	}
+	return nil
+}
+
+// sampled reports if the rate of rule keeps the request. Requests with the key header are sampled by a hash of its value,
+// so every request with the same trace or request id gets the same decision
+func sampled(rule *model.SamplingRule, req *http.Request) bool {
+	if rule.Rate >= 1 {
+		return true
+	}
+	if rule.Rate <= 0 {
+		return false
+	}
+	if rule.KeyHeader != "" {
+		if key := model.SampleKey(rule.KeyHeader, req.Header.Get(rule.KeyHeader)); key != "" {
+			hash := sha256.Sum256([]byte(key))
+			return float64(binary.BigEndian.Uint64(hash[:8])>>11)/(1<<53) < rule.Rate
+		}
+	}
+	return rand.Float64() < rule.Rate
+}
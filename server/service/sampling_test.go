@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- Sampling Test Suite ---
+type SamplingTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	samplingSrv service.ISamplingService
+	reqLogger   *service.ReqLogger
+}
+
+func (suite *SamplingTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:sampling_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.SamplingRule{}))
+	suite.db = db
+
+	suite.samplingSrv = &service.SamplingService{Db: db, Logger: zap.NewNop().Sugar()}
+	suite.reqLogger = &service.ReqLogger{
+		Requests: service.NewSQLRequestStore(db),
+		Logger:   zap.NewNop().Sugar(),
+		Config:   model.RuntimeConfig{SampleRate: 1},
+		Sampling: suite.samplingSrv,
+	}
+}
+
+func (suite *SamplingTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestSamplingTestSuite(t *testing.T) {
+	suite.Run(t, new(SamplingTestSuite))
+}
+
+func (suite *SamplingTestSuite) createRule(rule model.SamplingRule) *model.SamplingRule {
+	suite.Require().NoError(suite.samplingSrv.CreateRule(testActor, &rule))
+	return &rule
+}
+
+// proxy logs a request to path with the headers and its response, returning the stored request or nil
+func (suite *SamplingTestSuite) proxy(path string, header http.Header, status int, latency time.Duration) *model.Request {
+	req := httptest.NewRequest(http.MethodGet, "/proxy"+path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	logged, err := suite.reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+	logged.CreatedAt = logged.CreatedAt.Add(-latency)
+
+	stored, err := suite.reqLogger.LogResponse(logged, &http.Response{StatusCode: status, Body: http.NoBody})
+	suite.Require().NoError(err)
+	return stored
+}
+
+func (suite *SamplingTestSuite) storedCount() int64 {
+	var count int64
+	suite.Require().NoError(suite.db.Model(&model.Request{}).Count(&count).Error)
+	return count
+}
+
+// --- Test Cases ---
+
+func (suite *SamplingTestSuite) TestRule_MostSpecific() {
+	rule, err := suite.samplingSrv.Rule(model.DefaultProjectID, "GET", "/users")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), rule)
+
+	all := suite.createRule(model.SamplingRule{Path: "/", Rate: 0.5})
+	orders := suite.createRule(model.SamplingRule{Path: "/orders/", Rate: 0.1})
+	getOrders := suite.createRule(model.SamplingRule{Method: "get", Path: "/orders", Rate: 0.2})
+
+	tests := []struct {
+		method, path string
+		want         *model.SamplingRule
+	}{
+		{"GET", "/users", all},
+		{"POST", "/orders/1", orders},
+		{"GET", "/orders/1", getOrders},
+		{"GET", "/ordersx", all},
+	}
+	for _, tt := range tests {
+		rule, err := suite.samplingSrv.Rule(model.DefaultProjectID, tt.method, tt.path)
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), tt.want.ID, rule.ID, "%s %s", tt.method, tt.path)
+	}
+	assert.Equal(suite.T(), model.SamplingHead, orders.Mode)
+
+	// changes apply to the next request
+	suite.Require().NoError(suite.samplingSrv.DeleteRule(testActor, model.DefaultProjectID, getOrders.ID))
+	rule, err = suite.samplingSrv.Rule(model.DefaultProjectID, "GET", "/orders/1")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), orders.ID, rule.ID)
+}
+
+func (suite *SamplingTestSuite) TestRule_ScopedToProject() {
+	other := suite.createRule(model.SamplingRule{ProjectID: 7, Path: "/", Rate: 0})
+
+	rule, err := suite.samplingSrv.Rule(7, "GET", "/users")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), other.ID, rule.ID)
+	rule, err = suite.samplingSrv.Rule(model.DefaultProjectID, "GET", "/users")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), rule)
+
+	// the rule of the other project doesn't sample the traffic of the default project
+	assert.NotNil(suite.T(), suite.proxy("/users", nil, http.StatusOK, 0))
+
+	rules, err := suite.samplingSrv.ListRules(model.DefaultProjectID)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), rules)
+	assert.ErrorIs(suite.T(), suite.samplingSrv.DeleteRule(testActor, model.DefaultProjectID, other.ID), gorm.ErrRecordNotFound)
+}
+
+func (suite *SamplingTestSuite) TestCreateRule_Validates() {
+	tests := []struct {
+		rule model.SamplingRule
+		want string
+	}{
+		{model.SamplingRule{Path: "/", Rate: 1.5}, "rate should be between 0 and 1"},
+		{model.SamplingRule{Path: "/", Rate: -0.1}, "rate should be between 0 and 1"},
+		{model.SamplingRule{Path: "/", Rate: 0.1, Mode: "random"}, "mode should be head or tail"},
+		{model.SamplingRule{Path: "/", Rate: 0.1, Mode: model.SamplingTail, KeepStatus: 1000}, "keepStatus should be a status code"},
+		{model.SamplingRule{Path: "/", Rate: 0.1, Mode: model.SamplingTail, SlowThreshold: -time.Second}, "slowThresholdMs can't be negative"},
+		{model.SamplingRule{Path: "/", Rate: 0.1, KeepStatus: 500}, "needs tail sampling"},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.want, func() {
+			err := suite.samplingSrv.CreateRule(testActor, &tt.rule)
+			assert.ErrorIs(suite.T(), err, cerror.ErrBadSamplingRule)
+			assert.ErrorContains(suite.T(), err, tt.want)
+		})
+	}
+}
+
+func (suite *SamplingTestSuite) TestHead_StoresSampledWithWeight() {
+	suite.createRule(model.SamplingRule{Path: "/users", Rate: 0.25, KeyHeader: "x-request-id"})
+
+	logRequest := func(requestID string) *model.Request {
+		req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+		req.Header.Set("X-Request-Id", requestID)
+		logged, err := suite.reqLogger.LogRequest(req)
+		suite.Require().NoError(err)
+		assert.Nil(suite.T(), logged.Sample)
+		return logged
+	}
+
+	stored := 0
+	for i := range 400 {
+		logged := logRequest(fmt.Sprintf("req-%d", i))
+		// head sampled requests are stored when they arrive
+		if logged.ID != 0 {
+			assert.Equal(suite.T(), 4.0, logged.SampleWeight)
+			stored++
+		}
+		// the same request id gets the same decision
+		again := logRequest(fmt.Sprintf("req-%d", i))
+		assert.Equal(suite.T(), logged.ID == 0, again.ID == 0)
+	}
+	assert.InDelta(suite.T(), 100, stored, 40)
+
+	// routes without a rule use the runtime sample rate
+	assert.NotNil(suite.T(), suite.proxy("/orders", nil, http.StatusOK, 0))
+}
+
+func (suite *SamplingTestSuite) TestHead_SameKeySameDecision() {
+	suite.createRule(model.SamplingRule{Path: "/", Rate: 0.5, KeyHeader: "traceparent"})
+
+	kept := 0
+	for i := range 50 {
+		traceID := fmt.Sprintf("%032x", i)
+		first := suite.proxy("/users", http.Header{"Traceparent": {"00-" + traceID + "-00f067aa0ba902b7-01"}}, http.StatusOK, 0)
+		// another span of the same trace
+		second := suite.proxy("/orders", http.Header{"Traceparent": {"00-" + traceID + "-53ce929d0e0e4736-01"}}, http.StatusOK, 0)
+		assert.Equal(suite.T(), first == nil, second == nil, "trace %s", traceID)
+		if first != nil {
+			kept++
+		}
+	}
+	assert.Greater(suite.T(), kept, 0)
+	assert.Less(suite.T(), kept, 50)
+}
+
+func (suite *SamplingTestSuite) TestTail_KeepsErrorsAndSlowRequests() {
+	suite.createRule(model.SamplingRule{Path: "/checkout", Rate: 0, Mode: model.SamplingTail, KeepStatus: 500, SlowThreshold: time.Second})
+
+	assert.Nil(suite.T(), suite.proxy("/checkout", nil, http.StatusOK, 0))
+	assert.Nil(suite.T(), suite.proxy("/checkout", nil, http.StatusNotFound, 0))
+	assert.Zero(suite.T(), suite.storedCount())
+
+	failed := suite.proxy("/checkout", nil, http.StatusBadGateway, 0)
+	suite.Require().NotNil(failed)
+	assert.NotZero(suite.T(), failed.ID)
+	assert.Equal(suite.T(), 1.0, failed.SampleWeight)
+	slow := suite.proxy("/checkout", nil, http.StatusOK, 2*time.Second)
+	suite.Require().NotNil(slow)
+	assert.GreaterOrEqual(suite.T(), slow.Latency, 2*time.Second)
+
+	var stored model.Request
+	suite.Require().NoError(suite.db.First(&stored, failed.ID).Error)
+	assert.Equal(suite.T(), http.StatusBadGateway, stored.Response)
+	assert.Equal(suite.T(), 1.0, stored.SampleWeight)
+	assert.Equal(suite.T(), int64(2), suite.storedCount())
+}
+
+func (suite *SamplingTestSuite) TestTail_WeightsSampledRequests() {
+	suite.createRule(model.SamplingRule{Path: "/", Rate: 0.5, Mode: model.SamplingTail, KeepStatus: 500, KeyHeader: "X-Request-Id"})
+
+	// tail sampled requests wait for their response
+	req := httptest.NewRequest(http.MethodGet, "/proxy/users", nil)
+	logged, err := suite.reqLogger.LogRequest(req)
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), logged.ID)
+	suite.Require().NotNil(logged.Sample)
+	assert.Zero(suite.T(), suite.storedCount())
+
+	// every error stands for itself, sampled successes for the ones left out
+	var successes, errors int
+	var weight float64
+	for i := range 200 {
+		header := http.Header{"X-Request-Id": {fmt.Sprintf("req-%d", i)}}
+		status := http.StatusOK
+		if i%10 == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		stored := suite.proxy("/users", header, status, 0)
+		if stored == nil {
+			continue
+		}
+		weight += stored.SampleWeight
+		if status == http.StatusOK {
+			successes++
+			assert.Equal(suite.T(), 2.0, stored.SampleWeight)
+		} else {
+			errors++
+			assert.Equal(suite.T(), 1.0, stored.SampleWeight)
+		}
+	}
+	assert.Equal(suite.T(), 20, errors)
+	assert.InDelta(suite.T(), 90, successes, 30)
+
+	stats, err := suite.reqLogger.Requests.PathStatistics(service.RequestFilter{})
+	suite.Require().NoError(err)
+	suite.Require().Len(stats, 1)
+	assert.Equal(suite.T(), int64(weight), stats[0].RequestCount)
+	assert.Equal(suite.T(), int64(20), stats[0].ServerErrorCount)
+}
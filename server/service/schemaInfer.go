@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexPattern  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// pathParam is a path segment that looks like an identifier
+type pathParam struct {
+	Name   string
+	Schema *openapi3.Schema
+}
+
+// templatePath replaces identifier like segments (numbers, uuids, long hex strings) with path parameters
+// named after the segment before them, /users/42 becomes /users/{userId}
+func templatePath(p string) (string, []pathParam) {
+	segments := strings.Split(p, "/")
+	var params []pathParam
+	for i, segment := range segments {
+		var schema *openapi3.Schema
+		switch {
+		case segment == "":
+			continue
+		case isInteger(segment):
+			schema = openapi3.NewIntegerSchema()
+		case uuidPattern.MatchString(segment):
+			schema = openapi3.NewUUIDSchema()
+		case hexPattern.MatchString(segment):
+			schema = openapi3.NewStringSchema()
+		default:
+			continue
+		}
+
+		name := "id"
+		if i > 0 && segments[i-1] != "" && !strings.HasPrefix(segments[i-1], "{") {
+			name = singular(segments[i-1]) + "Id"
+		}
+		for n := 2; slices.ContainsFunc(params, func(p pathParam) bool { return p.Name == name }); n++ {
+			name = strings.TrimRight(name, "0123456789") + strconv.Itoa(n)
+		}
+
+		params = append(params, pathParam{Name: name, Schema: schema})
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// singular turns a plural collection name into an identifier prefix, categories becomes category
+func singular(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' {
+			return -1
+		}
+		return r
+	}, s)
+	switch {
+	case strings.HasSuffix(s, "ies") && len(s) > 3:
+		return s[:len(s)-3] + "y"
+	case strings.HasSuffix(s, "ss"):
+		return s
+	case strings.HasSuffix(s, "s") && len(s) > 1:
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// mediaType returns the media type of a body, bodies without a content type are json if they parse as json
+func mediaType(contentType string, body []byte) string {
+	if contentType != "" {
+		if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+			return mt
+		}
+		return ""
+	}
+	if len(body) > 0 && json.Valid(body) {
+		return "application/json"
+	}
+	return ""
+}
+
+func isJsonMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// inferBodySchema returns the schema of a json body, nil if the body is not valid json (e.g. truncated on capture)
+func inferBodySchema(body []byte) *openapi3.Schema {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil
+	}
+	return inferSchema(value)
+}
+
+// inferSchema returns the schema of a decoded json value
+func inferSchema(value any) *openapi3.Schema {
+	switch v := value.(type) {
+	case nil:
+		return &openapi3.Schema{Nullable: true}
+	case bool:
+		return openapi3.NewBoolSchema()
+	case json.Number:
+		if isInteger(v.String()) {
+			return openapi3.NewIntegerSchema()
+		}
+		return openapi3.NewFloat64Schema()
+	case float64:
+		if v == float64(int64(v)) {
+			return openapi3.NewIntegerSchema()
+		}
+		return openapi3.NewFloat64Schema()
+	case string:
+		return inferStringSchema(v)
+	case []any:
+		var items *openapi3.Schema
+		for _, item := range v {
+			items = mergeSchema(items, inferSchema(item))
+		}
+		if items == nil {
+			items = &openapi3.Schema{}
+		}
+		return openapi3.NewArraySchema().WithItems(items)
+	case map[string]any:
+		schema := openapi3.NewObjectSchema()
+		required := make([]string, 0, len(v))
+		for key, property := range v {
+			schema.WithProperty(key, inferSchema(property))
+			required = append(required, key)
+		}
+		sort.Strings(required)
+		schema.Required = required
+		return schema
+	}
+	return &openapi3.Schema{}
+}
+
+func inferStringSchema(s string) *openapi3.Schema {
+	schema := openapi3.NewStringSchema()
+	if uuidPattern.MatchString(s) {
+		schema.Format = "uuid"
+	} else if _, err := time.Parse(time.RFC3339, s); err == nil {
+		schema.Format = "date-time"
+	}
+	return schema
+}
+
+// inferValueSchema returns the schema of a query or path parameter value
+func inferValueSchema(s string) *openapi3.Schema {
+	if isInteger(s) {
+		return openapi3.NewIntegerSchema()
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return openapi3.NewFloat64Schema()
+	}
+	if s == "true" || s == "false" {
+		return openapi3.NewBoolSchema()
+	}
+	return inferStringSchema(s)
+}
+
+// mergeSchema widens a so that it also describes b, a is modified in place.
+// Objects keep all properties and only require properties present in both,
+// integers widen to numbers and other type conflicts become anyOf
+func mergeSchema(a, b *openapi3.Schema) *openapi3.Schema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+
+	nullable := a.Nullable || b.Nullable
+	var rez *openapi3.Schema
+	switch {
+	case isUnknownSchema(a):
+		rez = b
+	case isUnknownSchema(b):
+		rez = a
+	case len(a.AnyOf) > 0 || len(b.AnyOf) > 0 || !compatibleTypes(a, b):
+		rez = mergeAnyOf(a, b)
+	default:
+		rez = mergeSameType(a, b)
+	}
+	rez.Nullable = nullable
+	return rez
+}
+
+// isUnknownSchema reports if nothing but null was observed for a schema
+func isUnknownSchema(s *openapi3.Schema) bool {
+	return s.Type == nil && len(s.AnyOf) == 0 && len(s.Properties) == 0
+}
+
+func schemaType(s *openapi3.Schema) string {
+	if s.Type == nil || len(*s.Type) == 0 {
+		return ""
+	}
+	return (*s.Type)[0]
+}
+
+func isNumeric(t string) bool {
+	return t == openapi3.TypeInteger || t == openapi3.TypeNumber
+}
+
+func compatibleTypes(a, b *openapi3.Schema) bool {
+	ta, tb := schemaType(a), schemaType(b)
+	return ta == tb || (isNumeric(ta) && isNumeric(tb))
+}
+
+func mergeSameType(a, b *openapi3.Schema) *openapi3.Schema {
+	switch schemaType(a) {
+	case openapi3.TypeInteger, openapi3.TypeNumber:
+		if schemaType(b) == openapi3.TypeNumber {
+			a.Type = b.Type
+			a.Format = b.Format
+		}
+	case openapi3.TypeString:
+		if a.Format != b.Format {
+			a.Format = ""
+		}
+	case openapi3.TypeArray:
+		var items, other *openapi3.Schema
+		if a.Items != nil {
+			items = a.Items.Value
+		}
+		if b.Items != nil {
+			other = b.Items.Value
+		}
+		if merged := mergeSchema(items, other); merged != nil {
+			a.Items = openapi3.NewSchemaRef("", merged)
+		}
+	case openapi3.TypeObject:
+		if a.Properties == nil {
+			a.Properties = openapi3.Schemas{}
+		}
+		for name, property := range b.Properties {
+			if existing, ok := a.Properties[name]; ok {
+				existing.Value = mergeSchema(existing.Value, property.Value)
+			} else {
+				a.Properties[name] = property
+			}
+		}
+		a.Required = slices.DeleteFunc(a.Required, func(name string) bool {
+			return !slices.Contains(b.Required, name)
+		})
+		if len(a.Required) == 0 {
+			a.Required = nil
+		}
+	}
+	return a
+}
+
+// mergeAnyOf merges every alternative of b into the alternative of a with a compatible type
+func mergeAnyOf(a, b *openapi3.Schema) *openapi3.Schema {
+	alternatives := schemaAlternatives(a)
+	for _, alternative := range schemaAlternatives(b) {
+		i := slices.IndexFunc(alternatives, func(s *openapi3.Schema) bool { return compatibleTypes(s, alternative) })
+		if i >= 0 {
+			alternatives[i] = mergeSameType(alternatives[i], alternative)
+		} else {
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+
+	rez := &openapi3.Schema{}
+	for _, alternative := range alternatives {
+		rez.AnyOf = append(rez.AnyOf, openapi3.NewSchemaRef("", alternative))
+	}
+	return rez
+}
+
+func schemaAlternatives(s *openapi3.Schema) []*openapi3.Schema {
+	if len(s.AnyOf) == 0 {
+		return []*openapi3.Schema{s}
+	}
+	rez := make([]*openapi3.Schema, 0, len(s.AnyOf))
+	for _, ref := range s.AnyOf {
+		rez = append(rez, ref.Value)
+	}
+	return rez
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"treblle/model"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"gorm.io/gorm"
+)
+
+const (
+	_REPORT_BATCH_SIZE = 500
+	// _REPORT_WINDOW is how far back traffic is checked when no start is given
+	_REPORT_WINDOW = 7 * 24 * time.Hour
+	// _SCHEMA_DIFF_DEPTH stops the schema diff on recursive schemas
+	_SCHEMA_DIFF_DEPTH = 32
+)
+
+// specDiff collects the breaking changes recorded requests run into
+type specDiff struct {
+	previous     *compiledSpec // previous is nil for the first spec version
+	next         *compiledSpec
+	upstreamPath string // upstreamPath is the path of the project's upstream
+
+	changes   map[string]*model.BreakingChange
+	responses map[string][]string // responses caches response diffs by operation and status
+}
+
+func (s *ContractService) Report(projectID uint, id uint, since time.Time) (*model.BreakingChangeReport, error) {
+	if since.IsZero() {
+		since = time.Now().Add(-_REPORT_WINDOW)
+	}
+
+	spec, err := s.Spec(projectID, id)
+	if err != nil {
+		return nil, err
+	}
+	upstreamPath, err := s.upstreamPath(projectID)
+	if err != nil {
+		return nil, err
+	}
+	diff := &specDiff{
+		changes:      map[string]*model.BreakingChange{},
+		responses:    map[string][]string{},
+		upstreamPath: upstreamPath,
+	}
+	if diff.next, err = s.compileStored(spec); err != nil {
+		return nil, err
+	}
+
+	report := &model.BreakingChangeReport{SpecID: spec.ID, Since: since}
+	var previous model.ApiSpec
+	err = s.Db.Where("project_id = ? AND id < ?", projectID, spec.ID).Order("id desc").First(&previous).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		s.Logger.Errorf("Failed to read previous api spec, error = %v", err)
+		return nil, err
+	default:
+		if diff.previous, err = s.compileStored(&previous); err != nil {
+			return nil, err
+		}
+		report.PreviousSpecID = &previous.ID
+	}
+
+	// payloads kept apart are loaded for a batch of requests at once
+	batch := make([]model.Request, 0, _REPORT_BATCH_SIZE)
+	flush := func() error {
+		if err := loadPayloads(s.Requests, batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			s.observeChanges(diff, &batch[i])
+			report.Observed++
+		}
+		batch = batch[:0]
+		return nil
+	}
+	filter := RequestFilter{
+		ProjectID:          &projectID,
+		StartTime:          &since,
+		Answered:           true,
+		ExcludeSources:     []string{model.SourceMock},
+		ExcludeProxyErrors: true,
+	}
+	err = s.Requests.Stream(filter, RequestPage{SortBy: "id", Order: "asc"}, func(request *model.Request) error {
+		batch = append(batch, *request)
+		if len(batch) < _REPORT_BATCH_SIZE {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		s.Logger.Errorf("Failed to read requests for breaking change report, error = %v", err)
+		return nil, err
+	}
+
+	report.Changes = make([]model.BreakingChange, 0, len(diff.changes))
+	for _, change := range diff.changes {
+		report.Changes = append(report.Changes, *change)
+	}
+	slices.SortFunc(report.Changes, func(a, b model.BreakingChange) int {
+		return cmp.Or(
+			cmp.Compare(b.Calls, a.Calls),
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.Endpoint, b.Endpoint),
+			cmp.Compare(a.Method, b.Method),
+			cmp.Compare(a.Parameter, b.Parameter),
+			cmp.Compare(a.Status, b.Status),
+		)
+	})
+	return report, nil
+}
+
+// observeChanges records the breaking changes a request would run into with the new spec version
+func (s *ContractService) observeChanges(diff *specDiff, request *model.Request) {
+	var old *routers.Route
+	if diff.previous != nil {
+		old = findRoute(diff.previous, diff.upstreamPath, request)
+	}
+	route := findRoute(diff.next, diff.upstreamPath, request)
+	if route == nil {
+		if old != nil {
+			diff.add(model.BreakingChange{Kind: model.BreakingRemovedEndpoint, Method: old.Method, Endpoint: old.Path})
+		}
+		return
+	}
+
+	req, err := routeRequest(diff.next, diff.upstreamPath, request)
+	if err != nil {
+		return
+	}
+	var oldRequired []*openapi3.Parameter
+	if old != nil {
+		oldRequired = requiredParameters(old)
+	}
+	for _, param := range requiredParameters(route) {
+		if slices.ContainsFunc(oldRequired, func(p *openapi3.Parameter) bool { return p.In == param.In && p.Name == param.Name }) {
+			continue
+		}
+		if parameterSent(req, param) {
+			continue
+		}
+		diff.add(model.BreakingChange{
+			Kind:      model.BreakingRequiredParameter,
+			Method:    route.Method,
+			Endpoint:  route.Path,
+			Parameter: param.In + "." + param.Name,
+		})
+	}
+
+	if old == nil {
+		return
+	}
+	if details := diff.responseChanges(old, route, request.Response); len(details) > 0 {
+		diff.add(model.BreakingChange{
+			Kind:     model.BreakingChangedResponse,
+			Method:   route.Method,
+			Endpoint: route.Path,
+			Status:   request.Response,
+			Details:  details,
+		})
+	}
+}
+
+// findRoute returns the operation of spec a logged request calls, nil if the spec doesn't describe it
+func findRoute(spec *compiledSpec, upstreamPath string, request *model.Request) *routers.Route {
+	req, err := routeRequest(spec, upstreamPath, request)
+	if err != nil {
+		return nil
+	}
+	route, _, err := spec.router.FindRoute(req)
+	if err != nil {
+		return nil
+	}
+	return route
+}
+
+// add counts a call that runs into change
+func (d *specDiff) add(change model.BreakingChange) {
+	key := strings.Join([]string{string(change.Kind), change.Method, change.Endpoint, change.Parameter, strconv.Itoa(change.Status)}, "|")
+	if existing, ok := d.changes[key]; ok {
+		existing.Calls++
+		return
+	}
+	change.Calls = 1
+	d.changes[key] = &change
+}
+
+// responseChanges returns how the documented response for status changed between two versions of an operation
+func (d *specDiff) responseChanges(old, route *routers.Route, status int) []string {
+	key := fmt.Sprintf("%s|%s|%s|%d", old.Method, old.Path, route.Path, status)
+	if details, ok := d.responses[key]; ok {
+		return details
+	}
+
+	var details []string
+	before := operationResponse(old.Operation, status)
+	after := operationResponse(route.Operation, status)
+	switch {
+	case before == nil:
+	case after == nil:
+		details = append(details, fmt.Sprintf("status %d is no longer documented", status))
+	default:
+		mediaTypes := make([]string, 0, len(before.Content))
+		for mt := range before.Content {
+			mediaTypes = append(mediaTypes, mt)
+		}
+		sort.Strings(mediaTypes)
+
+		for _, mt := range mediaTypes {
+			media := after.Content.Get(mt)
+			if media == nil {
+				details = append(details, fmt.Sprintf("media type %s was removed", mt))
+				continue
+			}
+			if before.Content[mt].Schema != nil && media.Schema != nil {
+				diffSchema(&details, "", before.Content[mt].Schema.Value, media.Schema.Value, 0)
+			}
+		}
+	}
+
+	d.responses[key] = details
+	return details
+}
+
+// operationResponse returns the response documented for status, falling back to the status range and default
+func operationResponse(operation *openapi3.Operation, status int) *openapi3.Response {
+	if operation == nil || operation.Responses == nil {
+		return nil
+	}
+	ref := operation.Responses.Status(status)
+	if ref == nil {
+		ref = operation.Responses.Default()
+	}
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+// requiredParameters returns the required non path parameters of an operation, including the ones of its path
+func requiredParameters(route *routers.Route) []*openapi3.Parameter {
+	var params openapi3.Parameters
+	if route.PathItem != nil {
+		params = append(params, route.PathItem.Parameters...)
+	}
+	if route.Operation != nil {
+		params = append(params, route.Operation.Parameters...)
+	}
+
+	var required []*openapi3.Parameter
+	for _, ref := range params {
+		if ref.Value != nil && ref.Value.Required && ref.Value.In != openapi3.ParameterInPath {
+			required = append(required, ref.Value)
+		}
+	}
+	return required
+}
+
+func parameterSent(req *http.Request, param *openapi3.Parameter) bool {
+	switch param.In {
+	case openapi3.ParameterInQuery:
+		return req.URL.Query().Has(param.Name)
+	case openapi3.ParameterInHeader:
+		return req.Header.Get(param.Name) != ""
+	case openapi3.ParameterInCookie:
+		_, err := req.Cookie(param.Name)
+		return err == nil
+	}
+	return true
+}
+
+// diffSchema appends the changes of a response schema that can break clients parsing it:
+// changed types, removed properties, properties that are no longer required and values that became nullable
+func diffSchema(details *[]string, pointer string, before, after *openapi3.Schema, depth int) {
+	if before == nil || after == nil || depth > _SCHEMA_DIFF_DEPTH {
+		return
+	}
+	location := pointer
+	if location == "" {
+		location = "/"
+	}
+
+	tb, ta := schemaType(before), schemaType(after)
+	if tb != "" && ta != "" && tb != ta {
+		*details = append(*details, fmt.Sprintf("%s: type changed from %s to %s", location, tb, ta))
+		return
+	}
+	if !before.Nullable && after.Nullable {
+		*details = append(*details, location+": became nullable")
+	}
+	if before.Format != "" && after.Format != before.Format {
+		*details = append(*details, fmt.Sprintf("%s: format changed from %s to %q", location, before.Format, after.Format))
+	}
+
+	names := make([]string, 0, len(before.Properties))
+	for name := range before.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property := pointer + "/" + name
+		next, ok := after.Properties[name]
+		if !ok {
+			*details = append(*details, property+": property was removed")
+			continue
+		}
+		if slices.Contains(before.Required, name) && !slices.Contains(after.Required, name) {
+			*details = append(*details, property+": is no longer required")
+		}
+		diffSchema(details, property, before.Properties[name].Value, next.Value, depth+1)
+	}
+
+	if before.Items != nil && after.Items != nil {
+		diffSchema(details, pointer+"/items", before.Items.Value, after.Items.Value, depth+1)
+	}
+}
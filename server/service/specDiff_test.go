@@ -0,0 +1,212 @@
+package service_test
+
+import (
+	"time"
+	"treblle/model"
+	"treblle/service"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const contractSpecV2 = `
+openapi: 3.0.3
+info:
+  title: Users
+  version: 2.0.0
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users/{id}:
+    parameters:
+      - name: X-Tenant
+        in: header
+        required: true
+        schema:
+          type: string
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+        - name: fields
+          in: query
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  id:
+                    type: string
+                  name:
+                    type: string
+  /orders:
+    get:
+      parameters:
+        - name: page
+          in: query
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: OK
+`
+
+// recorded stores finished requests for the breaking change report
+func (suite *ContractServiceTestSuite) recorded(requests ...model.Request) {
+	for i := range requests {
+		if requests[i].Source == "" {
+			requests[i].Source = model.SourceProxy
+		}
+		if requests[i].CreatedAt.IsZero() {
+			requests[i].CreatedAt = time.Now().Add(-time.Hour)
+		}
+	}
+	suite.Require().NoError(suite.db.Create(&requests).Error)
+}
+
+func (suite *ContractServiceTestSuite) change(report *model.BreakingChangeReport, kind model.BreakingChangeKind, endpoint, parameter string) *model.BreakingChange {
+	for i := range report.Changes {
+		change := &report.Changes[i]
+		if change.Kind == kind && change.Endpoint == endpoint && change.Parameter == parameter {
+			return change
+		}
+	}
+	return nil
+}
+
+// --- Test Cases ---
+
+func (suite *ContractServiceTestSuite) TestReport_AgainstPreviousVersionAndTraffic() {
+	suite.recorded(
+		model.Request{Method: "POST", Path: "/users", Response: 201},
+		model.Request{Method: "POST", Path: "/users", Response: 400},
+		model.Request{Method: "GET", Path: "/users/1", Query: "fields=name", Response: 200,
+			RequestHeaders: model.Headers{"X-Tenant": {"a"}}},
+		model.Request{Method: "GET", Path: "/users/2", Response: 200},
+		model.Request{Method: "GET", Path: "/users/3", Response: 200},
+		model.Request{Method: "GET", Path: "/orders", Response: 200},
+		// mocked, in flight and old requests are not checked
+		model.Request{Method: "POST", Path: "/users", Response: 201, Source: model.SourceMock},
+		model.Request{Method: "POST", Path: "/users"},
+		model.Request{Method: "POST", Path: "/users", Response: 201, CreatedAt: time.Now().AddDate(0, 0, -30)},
+	)
+	v2, err := suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(contractSpecV2))
+	suite.Require().NoError(err)
+
+	report, err := suite.contractSrv.Report(model.DefaultProjectID, v2.ID, time.Time{})
+	suite.Require().NoError(err)
+	suite.Require().NotNil(report.PreviousSpecID)
+	assert.Equal(suite.T(), int64(6), report.Observed)
+
+	removed := suite.change(report, model.BreakingRemovedEndpoint, "/users", "")
+	suite.Require().NotNil(removed)
+	assert.Equal(suite.T(), "POST", removed.Method)
+	assert.Equal(suite.T(), int64(2), removed.Calls)
+
+	fields := suite.change(report, model.BreakingRequiredParameter, "/users/{id}", "query.fields")
+	suite.Require().NotNil(fields)
+	assert.Equal(suite.T(), int64(2), fields.Calls)
+	tenant := suite.change(report, model.BreakingRequiredParameter, "/users/{id}", "header.X-Tenant")
+	suite.Require().NotNil(tenant)
+	assert.Equal(suite.T(), int64(2), tenant.Calls)
+
+	// the endpoint is new, callers already sending traffic to it don't send the parameter
+	page := suite.change(report, model.BreakingRequiredParameter, "/orders", "query.page")
+	suite.Require().NotNil(page)
+	assert.Equal(suite.T(), int64(1), page.Calls)
+
+	response := suite.change(report, model.BreakingChangedResponse, "/users/{id}", "")
+	suite.Require().NotNil(response)
+	assert.Equal(suite.T(), 200, response.Status)
+	assert.Equal(suite.T(), int64(3), response.Calls)
+	assert.Equal(suite.T(), []string{"/id: is no longer required", "/id: type changed from integer to string"}, response.Details)
+
+	assert.Len(suite.T(), report.Changes, 5)
+	assert.Equal(suite.T(), int64(3), report.Changes[0].Calls)
+}
+
+func (suite *ContractServiceTestSuite) TestReport_FirstVersionOnlyChecksTraffic() {
+	suite.recorded(
+		model.Request{Method: "GET", Path: "/users/1", Response: 200},
+		model.Request{Method: "DELETE", Path: "/users/1", Response: 204},
+	)
+	specs, err := suite.contractSrv.Specs(model.DefaultProjectID)
+	suite.Require().NoError(err)
+
+	report, err := suite.contractSrv.Report(model.DefaultProjectID, specs[0].ID, time.Time{})
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), report.PreviousSpecID)
+	assert.Equal(suite.T(), int64(2), report.Observed)
+	assert.Empty(suite.T(), report.Changes)
+
+	_, err = suite.contractSrv.Report(model.DefaultProjectID, specs[0].ID+10, time.Time{})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ContractServiceTestSuite) TestReport_ScopedToProject() {
+	project := suite.project("shop", "https://shop.example.com/v1", contractSpecV2)
+	suite.recorded(
+		model.Request{ProjectID: project.ID, Method: "GET", Path: "/orders", Response: 200},
+		model.Request{Method: "GET", Path: "/orders", Response: 200},
+	)
+	specs, err := suite.contractSrv.Specs(project.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(specs, 1)
+
+	// the older spec of the default project is not the previous version
+	report, err := suite.contractSrv.Report(project.ID, specs[0].ID, time.Time{})
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), report.PreviousSpecID)
+	assert.Equal(suite.T(), int64(1), report.Observed)
+	assert.NotNil(suite.T(), suite.change(report, model.BreakingRequiredParameter, "/orders", "query.page"))
+
+	_, err = suite.contractSrv.Report(model.DefaultProjectID, specs[0].ID, time.Time{})
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *ContractServiceTestSuite) TestReport_FromEmbeddedStore() {
+	store, err := service.NewEmbeddedRequestStore("")
+	suite.Require().NoError(err)
+	suite.contractSrv.Requests = store
+	for _, request := range []model.Request{
+		{Method: "POST", Path: "/users", Response: 201},
+		{Method: "GET", Path: "/users/1", Response: 200},
+	} {
+		request.Source = model.SourceProxy
+		request.CreatedAt = time.Now().Add(-time.Hour)
+		suite.Require().NoError(store.Create(&request))
+	}
+	v2, err := suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(contractSpecV2))
+	suite.Require().NoError(err)
+
+	report, err := suite.contractSrv.Report(model.DefaultProjectID, v2.ID, time.Time{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(2), report.Observed)
+	assert.NotNil(suite.T(), suite.change(report, model.BreakingRemovedEndpoint, "/users", ""))
+}
+
+func (suite *ContractServiceTestSuite) TestReport_SkipsProxyErrors() {
+	suite.recorded(
+		model.Request{Method: "POST", Path: "/users", Response: 201},
+		model.Request{Method: "POST", Path: "/users", Response: 502, ProxyError: string(model.ProxyErrorConnectionRefused)},
+	)
+	v2, err := suite.contractSrv.Upload(testActor, model.DefaultProjectID, []byte(contractSpecV2))
+	suite.Require().NoError(err)
+
+	report, err := suite.contractSrv.Report(model.DefaultProjectID, v2.ID, time.Time{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), report.Observed)
+	removed := suite.change(report, model.BreakingRemovedEndpoint, "/users", "")
+	suite.Require().NotNil(removed)
+	assert.Equal(suite.T(), int64(1), removed.Calls)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"treblle/app"
+	"treblle/model"
+	"treblle/util/cerror"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IViewService interface {
+	// List returns the views of a project user sees, the shared views and their own, user is nil for api keys
+	List(projectID uint, user *model.User) ([]model.View, error)
+	// Get returns a view of a project user sees
+	Get(projectID uint, user *model.User, id uint) (*model.View, error)
+	Create(actor string, user *model.User, view *model.View) error
+	Update(actor string, user *model.User, view *model.View) error
+	Delete(actor string, user *model.User, projectID, id uint) error
+}
+
+// ViewService keeps the saved views of the request log. Private views are only seen and changed by their owner,
+// shared views are seen by everyone with access to the project and changed by admins and api keys
+type ViewService struct {
+	Db       *gorm.DB
+	Logger   *zap.SugaredLogger
+	AuditSrv IAuditService
+}
+
+func NewViewService() IViewService {
+	var service *ViewService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, auditSrv IAuditService) {
+		service = &ViewService{
+			Db:       db,
+			Logger:   logger,
+			AuditSrv: auditSrv,
+		}
+	})
+	return service
+}
+
+func (s *ViewService) List(projectID uint, user *model.User) ([]model.View, error) {
+	var views []model.View
+	if err := s.visible(projectID, user).Order("name, id").Find(&views).Error; err != nil {
+		s.Logger.Errorf("Failed to list views, error = %v", err)
+		return nil, err
+	}
+	return views, nil
+}
+
+func (s *ViewService) Get(projectID uint, user *model.User, id uint) (*model.View, error) {
+	var view model.View
+	if err := s.visible(projectID, user).First(&view, id).Error; err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+func (s *ViewService) Create(actor string, user *model.User, view *model.View) error {
+	if err := prepareView(view); err != nil {
+		return err
+	}
+	if !canChangeView(user, view) {
+		return cerror.ErrViewAccess
+	}
+	view.ID = 0
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(view).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditViewCreated, model.AuditTarget("view", view.ID), nil, view)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to create view, error = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *ViewService) Update(actor string, user *model.User, view *model.View) error {
+	if err := prepareView(view); err != nil {
+		return err
+	}
+
+	existing, err := s.Get(view.ProjectID, user, view.ID)
+	if err != nil {
+		return err
+	}
+	if !canChangeView(user, existing) || !canChangeView(user, view) {
+		return cerror.ErrViewAccess
+	}
+	view.CreatedAt = existing.CreatedAt
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(view).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditViewUpdated, model.AuditTarget("view", view.ID), existing, view)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to update view, error = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *ViewService) Delete(actor string, user *model.User, projectID, id uint) error {
+	existing, err := s.Get(projectID, user, id)
+	if err != nil {
+		return err
+	}
+	if !canChangeView(user, existing) {
+		return cerror.ErrViewAccess
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.View{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, s.AuditSrv, actor, model.AuditViewDeleted, model.AuditTarget("view", id), existing, nil)
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to delete view, error = %v", err)
+		return err
+	}
+	return nil
+}
+
+// visible selects the views of a project user sees
+func (s *ViewService) visible(projectID uint, user *model.User) *gorm.DB {
+	query := s.Db.Where("project_id = ?", projectID)
+	if user == nil {
+		return query.Where("owner_id IS NULL")
+	}
+	return query.Where("(owner_id IS NULL OR owner_id = ?)", user.ID)
+}
+
+// canChangeView reports if user can save or delete view, api keys reaching a change already have ScopeManageConfig
+func canChangeView(user *model.User, view *model.View) bool {
+	if view.Shared() {
+		return user == nil || user.Role == model.RoleAdmin
+	}
+	return user != nil && *view.OwnerID == user.ID
+}
+
+// prepareView normalizes the filters of view and validates them
+func prepareView(view *model.View) error {
+	view.Name = strings.TrimSpace(view.Name)
+	view.Method = strings.ToUpper(view.Method)
+	if view.Name == "" || len(view.Name) > 100 {
+		return fmt.Errorf("%w: name should have 1 to 100 characters", cerror.ErrBadView)
+	}
+	if _, err := ParseSearch(view.Search); err != nil {
+		return fmt.Errorf("%w: %w", cerror.ErrBadView, err)
+	}
+	switch view.SortBy {
+	case "", "created_at", "response_time", "latency":
+	default:
+		return fmt.Errorf("%w: sort_by should be one of created_at, response_time, latency", cerror.ErrBadView)
+	}
+	switch view.Order {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("%w: order should be asc or desc", cerror.ErrBadView)
+	}
+	if view.Last < 0 {
+		return fmt.Errorf("%w: last can't be negative", cerror.ErrBadView)
+	}
+	if view.Last > 0 && (view.StartTime != nil || view.EndTime != nil) {
+		return fmt.Errorf("%w: a view has either a relative or an absolute time range", cerror.ErrBadView)
+	}
+	if view.StartTime != nil && view.EndTime != nil && view.StartTime.After(*view.EndTime) {
+		return fmt.Errorf("%w: start_time can't be after end_time", cerror.ErrBadView)
+	}
+	return nil
+}
+
+// ViewParams returns the list parameters of view applied at now, a relative time range ends at now
+func ViewParams(view *model.View, now time.Time) ListRequestsParams {
+	params := ListRequestsParams{
+		ProjectID: &view.ProjectID,
+		Response:  view.Response,
+		SortBy:    view.SortBy,
+		Order:     view.Order,
+	}
+	params.StartTime, params.EndTime = view.TimeRange(now)
+	if view.Search != "" {
+		params.Search = &view.Search
+	}
+	if view.Method != "" {
+		params.Method = &view.Method
+	}
+	if view.Source != "" {
+		params.Source = &view.Source
+	}
+	if view.Consumer != "" {
+		params.Consumer = &view.Consumer
+	}
+	return params
+}
@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"treblle/app"
+	"treblle/dto"
+	"treblle/model"
+	"treblle/service"
+	"treblle/util/cerror"
+	"treblle/util/ws"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// --- View Service Test Suite ---
+type ViewServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	viewSrv     service.IViewService
+	crudService service.IRequestCrudService
+	admin       *model.User
+	alice       *model.User
+	bob         *model.User
+}
+
+func (suite *ViewServiceTestSuite) SetupTest() {
+	dsn := fmt.Sprintf("file:view_test_%s?mode=memory&cache=private", strings.ReplaceAll(suite.T().Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Request{}, &model.Violation{}, &model.View{}))
+	suite.db = db
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewRequestStore)
+	suite.crudService = service.NewRequestCrudService()
+	suite.viewSrv = &service.ViewService{Db: db, Logger: zap.NewNop().Sugar()}
+
+	suite.admin = &model.User{ID: 1, Email: "admin@example.com", Role: model.RoleAdmin}
+	suite.alice = &model.User{ID: 2, Email: "alice@example.com", Role: model.RoleViewer}
+	suite.bob = &model.User{ID: 3, Email: "bob@example.com", Role: model.RoleViewer}
+}
+
+func (suite *ViewServiceTestSuite) TearDownTest() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestViewServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ViewServiceTestSuite))
+}
+
+// create saves a view of the default project, private to owner or shared if owner is nil
+func (suite *ViewServiceTestSuite) create(owner *model.User, view model.View) *model.View {
+	view.ProjectID = model.DefaultProjectID
+	user := owner
+	if owner != nil {
+		view.OwnerID = &owner.ID
+	} else {
+		user = suite.admin
+	}
+	suite.Require().NoError(suite.viewSrv.Create(testActor, user, &view))
+	return &view
+}
+
+// seedRequests stores checkout and users traffic at now and two hours before
+func (suite *ViewServiceTestSuite) seedRequests(now time.Time) {
+	var requests []model.Request
+	for _, createdAt := range []time.Time{now, now.Add(-2 * time.Hour)} {
+		requests = append(requests,
+			model.Request{Method: "POST", Path: "/checkout", Response: 502, Latency: time.Second, CreatedAt: createdAt},
+			model.Request{Method: "POST", Path: "/checkout", Response: 200, CreatedAt: createdAt},
+			model.Request{Method: "GET", Path: "/users", Response: 500, CreatedAt: createdAt},
+		)
+	}
+	suite.Require().NoError(suite.db.Create(&requests).Error)
+	violation := model.Violation{RequestID: requests[0].ID, Kind: model.ViolationBadParameter, Method: "POST", Endpoint: "/checkout", CreatedAt: now}
+	suite.Require().NoError(suite.db.Create(&violation).Error)
+}
+
+// --- Test Cases ---
+
+func (suite *ViewServiceTestSuite) TestList_SharedAndOwnViews() {
+	shared := suite.create(nil, model.View{Name: "5xx on checkout", Search: "status:5xx path:/checkout", Last: time.Hour})
+	private := suite.create(suite.alice, model.View{Name: "My posts", Method: "post"})
+	other := model.View{Name: "Other project", ProjectID: 7}
+	suite.Require().NoError(suite.viewSrv.Create(testActor, suite.admin, &other))
+
+	views, err := suite.viewSrv.List(model.DefaultProjectID, suite.alice)
+	suite.Require().NoError(err)
+	suite.Require().Len(views, 2)
+	assert.Equal(suite.T(), "5xx on checkout", views[0].Name)
+	assert.True(suite.T(), views[0].Shared())
+	assert.Equal(suite.T(), "POST", views[1].Method)
+
+	// bob and api keys only see the shared view
+	views, err = suite.viewSrv.List(model.DefaultProjectID, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(views, 1)
+	assert.Equal(suite.T(), shared.ID, views[0].ID)
+	views, err = suite.viewSrv.List(model.DefaultProjectID, nil)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), views, 1)
+
+	_, err = suite.viewSrv.Get(model.DefaultProjectID, suite.bob, private.ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	_, err = suite.viewSrv.Get(model.DefaultProjectID, suite.admin, other.ID)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *ViewServiceTestSuite) TestChanges_NeedOwnerOrAdmin() {
+	shared := suite.create(nil, model.View{Name: "Errors", Search: "status:>=400"})
+	private := suite.create(suite.alice, model.View{Name: "Mine"})
+
+	// viewers can't share views or change shared ones
+	err := suite.viewSrv.Create(testActor, suite.alice, &model.View{Name: "Shared"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrViewAccess)
+	shared.Name = "Renamed"
+	assert.ErrorIs(suite.T(), suite.viewSrv.Update(testActor, suite.alice, shared), cerror.ErrViewAccess)
+	assert.ErrorIs(suite.T(), suite.viewSrv.Delete(testActor, suite.alice, model.DefaultProjectID, shared.ID), cerror.ErrViewAccess)
+	// api keys change shared views
+	assert.NoError(suite.T(), suite.viewSrv.Update(testActor, nil, shared))
+
+	// private views are only found by their owner
+	private.Name = "Taken"
+	assert.ErrorIs(suite.T(), suite.viewSrv.Update(testActor, suite.bob, private), gorm.ErrRecordNotFound)
+	assert.ErrorIs(suite.T(), suite.viewSrv.Delete(testActor, suite.admin, model.DefaultProjectID, private.ID), gorm.ErrRecordNotFound)
+
+	// the owner shares it by taking the owner away, which only admins can do
+	private.OwnerID = nil
+	assert.ErrorIs(suite.T(), suite.viewSrv.Update(testActor, suite.alice, private), cerror.ErrViewAccess)
+
+	suite.Require().NoError(suite.viewSrv.Delete(testActor, suite.alice, model.DefaultProjectID, private.ID))
+	views, err := suite.viewSrv.List(model.DefaultProjectID, suite.alice)
+	suite.Require().NoError(err)
+	suite.Require().Len(views, 1)
+	assert.Equal(suite.T(), "Renamed", views[0].Name)
+}
+
+func (suite *ViewServiceTestSuite) TestCreate_Validates() {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(-time.Hour)
+	tests := []struct {
+		view model.View
+		want string
+	}{
+		{model.View{Name: "  "}, "name should have"},
+		{model.View{Name: "x", Search: "status:teapot"}, "status should be a status code or class"},
+		{model.View{Name: "x", SortBy: "path"}, "sort_by should be one of"},
+		{model.View{Name: "x", Order: "up"}, "order should be asc or desc"},
+		{model.View{Name: "x", Last: time.Hour, StartTime: &start}, "either a relative or an absolute time range"},
+		{model.View{Name: "x", StartTime: &start, EndTime: &end}, "start_time can't be after end_time"},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.want, func() {
+			err := suite.viewSrv.Create(testActor, suite.admin, &tt.view)
+			assert.ErrorIs(suite.T(), err, cerror.ErrBadView)
+			assert.ErrorContains(suite.T(), err, tt.want)
+		})
+	}
+}
+
+func (suite *ViewServiceTestSuite) TestViewParams() {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	response := 502
+	view := &model.View{ProjectID: 4, Search: "path:/checkout", Method: "POST", Response: &response, SortBy: "latency", Order: "desc", Last: time.Hour}
+
+	params := service.ViewParams(view, now)
+	assert.Equal(suite.T(), uint(4), *params.ProjectID)
+	assert.Equal(suite.T(), "path:/checkout", *params.Search)
+	assert.Equal(suite.T(), "POST", *params.Method)
+	assert.Equal(suite.T(), 502, *params.Response)
+	assert.Nil(suite.T(), params.Source)
+	assert.Nil(suite.T(), params.Consumer)
+	assert.Equal(suite.T(), "latency", params.SortBy)
+	assert.Equal(suite.T(), now.Add(-time.Hour), *params.StartTime)
+	assert.Equal(suite.T(), now, *params.EndTime)
+
+	// absolute ranges stay as they are
+	start := now.AddDate(0, 0, -1)
+	params = service.ViewParams(&model.View{StartTime: &start}, now)
+	assert.Equal(suite.T(), start, *params.StartTime)
+	assert.Nil(suite.T(), params.EndTime)
+}
+
+func (suite *ViewServiceTestSuite) TestViewRequestsAndStatistics() {
+	now := time.Now()
+	suite.seedRequests(now)
+	view := suite.create(nil, model.View{Name: "5xx on checkout", Search: "status:5xx path:/checkout", Last: time.Hour})
+
+	requests, total, err := suite.crudService.List(service.ViewParams(view, now.Add(time.Second)))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(1), total)
+	assert.Equal(suite.T(), 502, requests[0].Response)
+
+	stats, err := suite.crudService.GetFilteredStatistics(service.ViewParams(view, now.Add(time.Second)))
+	suite.Require().NoError(err)
+	suite.Require().Len(stats.StatsPerPath, 1)
+	assert.Equal(suite.T(), "/checkout", stats.StatsPerPath[0].Path)
+	assert.Equal(suite.T(), int64(1), stats.StatsPerPath[0].RequestCount)
+	assert.Equal(suite.T(), int64(1), stats.StatsPerPath[0].ServerErrorCount)
+	suite.Require().Len(stats.ViolationsPerEndpoint, 1)
+	assert.Equal(suite.T(), int64(1), stats.ViolationsPerEndpoint[0].ViolationCount)
+}
+
+func (suite *ViewServiceTestSuite) TestLobby_StreamsOnlyTheView() {
+	view := suite.create(nil, model.View{Name: "5xx on checkout", Search: "status:5xx path:/checkout", Last: time.Minute})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ws.NewClient(&service.NewLobby(model.DefaultProjectID, view).Hub, conn)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var state dto.RequestStatistics
+	suite.Require().NoError(conn.ReadJSON(&state)) // initial empty state
+	// the stream covers the time since the last update, not the range of the view
+	suite.seedRequests(time.Now())
+
+	suite.Require().NoError(conn.WriteJSON(service.ChartMessage{Action: "refresh"}))
+	suite.Require().NoError(conn.ReadJSON(&state))
+	suite.Require().Len(state.RequestsPerPath, 1)
+	assert.Equal(suite.T(), "/checkout", state.RequestsPerPath[0].Path)
+	assert.Equal(suite.T(), int64(1), state.RequestCount)
+}
@@ -7,13 +7,54 @@ import (
 )
 
 var (
-	ErrBadDateFormat      = fmt.Errorf("bad date format, should be %s", format.DateFormat)
-	ErrBadDateTimeFormat  = fmt.Errorf("bad date and time format, should be %s", format.DateTimeFormat)
-	ErrBadTimeFormat      = fmt.Errorf("bad time format, should be %s", format.TimeFormat)
-	ErrBadUuid            = errors.New("failed to parse uuid")
-	ErrUnknownRole        = errors.New("unknown role")
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrInvalidTokenFormat = errors.New("invalid token format")
-	ErrUserIsNil          = errors.New("user is nil")
-	ErrBadRole            = errors.New("role is not allowed")
+	ErrBadDateFormat       = fmt.Errorf("bad date format, should be %s", format.DateFormat)
+	ErrBadDateTimeFormat   = fmt.Errorf("bad date and time format, should be %s", format.DateTimeFormat)
+	ErrBadTimeFormat       = fmt.Errorf("bad time format, should be %s", format.TimeFormat)
+	ErrBadUuid             = errors.New("failed to parse uuid")
+	ErrUnknownRole         = errors.New("unknown role")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrTooManyLogins       = errors.New("too many failed logins, try again later")
+	ErrInvalidTokenFormat  = errors.New("invalid token format")
+	ErrUserIsNil           = errors.New("user is nil")
+	ErrBadRole             = errors.New("role is not allowed")
+	ErrUnknownExportFormat = errors.New("unknown export format, should be one of csv, ndjson, har")
+	ErrUnknownImportFormat = errors.New("unknown import format, should be one of ndjson, har")
+	ErrImportJobClaimed    = errors.New("import job is already running in another process")
+	ErrReplayClaimed       = errors.New("replay is already running in another process")
+	ErrDuplicateRequest    = errors.New("a request with this fingerprint is already stored")
+	ErrBadHarFile          = errors.New("bad har file")
+	ErrBadTargetUrl        = errors.New("target url should be an absolute http or https url")
+	ErrBadRateLimit        = errors.New("rate limit can't be negative")
+	ErrUnknownMockStrategy = errors.New("unknown mock strategy, should be one of path, query, body")
+	ErrUnknownMockFallback = errors.New("unknown mock fallback, should be one of 404, passthrough, synthetic")
+	ErrBadApiSpec          = errors.New("invalid openapi 3 spec")
+
+	ErrUnknownRateLimitAlgorithm = errors.New("unknown rate limit algorithm, should be one of token_bucket, sliding_window")
+	ErrUnknownRateLimitKey       = errors.New("unknown rate limit key, should be one of ip, api_key, route")
+	ErrBadRateLimitRule          = errors.New("rate limit needs a positive limit and window")
+	ErrUnknownConsumerSource     = errors.New("unknown consumer source, should be one of api_key, jwt, basic, ip")
+	ErrBadConsumerJwtKey         = errors.New("consumer jwt key should be a secret or a pem encoded rsa, ecdsa or ed25519 public key")
+	ErrWeakPassword              = errors.New("password should have 8 to 72 characters")
+	ErrBadEmail                  = errors.New("invalid email address")
+	ErrEmailTaken                = errors.New("a user with this email already exists")
+	ErrLastAdmin                 = errors.New("can't remove the last admin")
+	ErrInvalidApiKey             = errors.New("invalid, expired or revoked api key")
+	ErrMissingScope              = errors.New("api key is missing the scope of this route")
+	ErrUnknownApiKeyScope        = errors.New("unknown api key scope, should be one of read_requests, read_stats, manage_config")
+	ErrBadApiKeyExpiry           = errors.New("api key expiry should be in the future")
+	ErrBadProjectSlug            = errors.New("project slug should be 1 to 50 lowercase letters, digits or dashes")
+	ErrProjectSlugTaken          = errors.New("a project with this slug already exists")
+	ErrProjectSlugRouted         = errors.New("the default project has traffic under this slug, it would be sent to the project")
+	ErrInvalidIngestionKey       = errors.New("invalid project ingestion key")
+	ErrNoProjectAccess           = errors.New("no access to this project")
+	ErrAuditAppendOnly           = errors.New("audit entries can't be changed or deleted")
+	ErrBadConfig                 = errors.New("invalid config")
+	ErrAnalyticsStore            = errors.New("analytics store request failed")
+	ErrMigration                 = errors.New("schema migration failed")
+	ErrMigrationLocked           = errors.New("timed out waiting for another process to finish migrating")
+	ErrPendingMigrations         = errors.New("database schema has pending migrations, run treblle migrate")
+	ErrBadSearch                 = errors.New("invalid search query")
+	ErrBadView                   = errors.New("invalid view")
+	ErrViewAccess                = errors.New("only admins can change shared views")
+	ErrBadSamplingRule           = errors.New("invalid sampling rule")
 )
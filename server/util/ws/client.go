@@ -2,6 +2,8 @@ package ws
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -34,18 +36,39 @@ type Client struct {
 	unregFunc UnregisterFunc
 }
 
+// AllowedOrigins are the origins allowed to open a websocket besides the server itself, * allows every origin
+var AllowedOrigins []string
+
 var Upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// NOTE:
-		// Allow all connections for development purposes.
-		// In production, you should implement proper origin checking.
-		return true
-	},
+	CheckOrigin:     CheckOrigin,
 	// TODO: add error check func
 }
 
+// CheckOrigin allows requests without an origin, from the same host or from one of AllowedOrigins
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not sent by a browser
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	zap.S().Warnf("Rejected websocket from origin %s", origin)
+	return false
+}
+
 // NewClient Registers new client to hub
 func NewClient(hub *Hub, conn *websocket.Conn) error {
 	zap.S().Debugf("Registering new client to hub %s", hub.hubId)
@@ -66,7 +89,7 @@ func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
-		if c.hub.isEmpty() {
+		if c.hub.isEmpty() && c.unregFunc != nil {
 			c.unregFunc()
 		}
 	}()